@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+
+	"otel-demo/telemetry"
+)
+
+// The baggage values scenario.baggage draws from, tiers weighted towards
+// the free one as a real user base would be
+var (
+	baggageTenants = []string{"acme", "globex", "initech", "umbrella"}
+	baggageTiers   = []string{"free", "free", "free", "pro", "pro", "enterprise"}
+	baggageOrigins = []string{"web", "mobile", "partner-api"}
+)
+
+// baggageOptions installs the processors copying the baggage onto every
+// span and log record with scenario.baggage, so HyperDX can filter all of
+// a tenant's telemetry by the same key
+func baggageOptions(sc telemetry.ScenarioConfig) []telemetry.Option {
+	if !sc.Baggage {
+		return nil
+	}
+	return []telemetry.Option{
+		telemetry.WithSpanProcessor(telemetry.NewBaggageSpanProcessor()),
+		telemetry.WithLogProcessor(telemetry.NewBaggageLogProcessor()),
+	}
+}
+
+// withRequestBaggage gives a request a tenant, user tier and origin, which
+// travel with its calls to other services too
+func withRequestBaggage(ctx context.Context, rng *rand.Rand) context.Context {
+	ctx = telemetry.WithTenant(ctx, baggageTenants[rng.IntN(len(baggageTenants))])
+	ctx = telemetry.WithUserTier(ctx, baggageTiers[rng.IntN(len(baggageTiers))])
+	return telemetry.WithRequestOrigin(ctx, baggageOrigins[rng.IntN(len(baggageOrigins))])
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/trace"
+	"otel-demo/scenario"
+	"otel-demo/telemetry"
+)
+
+// batchJob collects the requests a batch job processes with
+// scenario.batch_size set, the way an export or billing job picks up the
+// orders of many requests at once
+type batchJob struct {
+	mu      sync.Mutex
+	pending []trace.SpanContext
+}
+
+// add queues a request's root span and returns the batch it completed, if
+// it did
+func (b *batchJob) add(sc trace.SpanContext, size int) []trace.SpanContext {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending = append(b.pending, sc)
+	if len(b.pending) < size {
+		return nil
+	}
+	batch := b.pending
+	b.pending = nil
+	return batch
+}
+
+// processBatch runs a batch job as a trace of its own, whose root span
+// links to the root span of every request in the batch, so each request
+// can be followed to the job and the job back to its requests
+func (w *workload) processBatch(ctx context.Context, sc telemetry.ScenarioConfig, rng *rand.Rand, batch []trace.SpanContext) {
+	links := make([]trace.Link, len(batch))
+	for i, request := range batch {
+		links[i] = trace.Link{SpanContext: request, Attributes: []attribute.KeyValue{
+			attribute.Int("batch.index", i),
+		}}
+	}
+	ctx, span := w.tracer.Start(ctx, "process-batch",
+		trace.WithNewRoot(),
+		trace.WithLinks(links...),
+		trace.WithAttributes(
+			attribute.String("job.name", "order-export"),
+			attribute.Int("batch.size", len(batch)),
+		),
+		trace.WithAttributes(scenarioAttributes(sc)...))
+	defer span.End()
+
+	env := &scenario.Env{
+		Tracer:     w.tracer,
+		Logger:     w.logger,
+		Metrics:    w.metrics,
+		Rand:       rng,
+		Attributes: scenarioAttributes(sc),
+		SpanEvents: sc.SpanEvents,
+	}
+	err := scenario.DBCall(scenario.DBCallConfig{
+		System:    "postgresql",
+		Name:      "exportdb",
+		Operation: "INSERT",
+		Statement: "INSERT INTO order_exports (order_id, exported_at) VALUES (?, ?)",
+		Latency:   sc.DBLatency,
+	})(ctx, env)
+	if err != nil {
+		telemetry.RecordError(span, err)
+		w.emit(ctx, sc, fmt.Sprintf("Batch job failed: %v", err), otellog.SeverityError,
+			otellog.String("component", "batch"))
+		return
+	}
+	w.emit(ctx, sc, fmt.Sprintf("Processed a batch of %d requests", len(batch)), otellog.SeverityInfo,
+		otellog.String("component", "batch"),
+		otellog.Int("batch.size", len(batch)))
+}
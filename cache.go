@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/extra/redisotel/v9"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/metric"
+	"otel-demo/scenario"
+	"otel-demo/telemetry"
+)
+
+// cacheKeys is how many distinct users the requests look up in the cache,
+// few enough that the hit ratio climbs as the run warms the cache up
+const cacheKeys = 20
+
+// cache is a Redis instance the simulated requests read users through with
+// scenario.redis set. The client is instrumented with redisotel, so every
+// command is a client span with db.system=redis and the command as its
+// db.statement, and the pool reports the db.client.connections.* metrics.
+type cache struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// openCache connects to the configured Redis, failing when it doesn't
+// answer a PING
+func openCache(ctx context.Context, cfg telemetry.RedisConfig) (*cache, error) {
+	client := redis.NewClient(&redis.Options{Addr: cfg.Addr, Password: cfg.Password, DB: cfg.DB})
+	// Before instrumenting, so the check isn't a stray root span
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to reach Redis at %s: %w", cfg.Addr, err)
+	}
+	if err := errors.Join(redisotel.InstrumentTracing(client), redisotel.InstrumentMetrics(client)); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to instrument the Redis client: %w", err)
+	}
+	return &cache{client: client, ttl: cfg.TTL}, nil
+}
+
+func (c *cache) close() error {
+	return c.client.Close()
+}
+
+// cached reads a random user from the cache and runs load only on a miss,
+// filling the cache afterwards. Hits and misses are logged, and GET and SET
+// record their durations under operations cache_get and cache_set. An
+// unavailable cache is logged as a warning and load runs anyway, as a
+// cache-aside service would carry on.
+func (c *cache) cached(load scenario.Step) scenario.Step {
+	return func(ctx context.Context, env *scenario.Env) error {
+		key := fmt.Sprintf("user:%d", 1+env.Rand.IntN(cacheKeys))
+		start := time.Now()
+		value, err := c.client.Get(ctx, key).Result()
+		switch {
+		case err == nil:
+			c.record(ctx, env, "cache_get", time.Since(start), "hit")
+			c.emit(ctx, env, "Cache hit", otellog.SeverityDebug, key, otellog.Int("value.size", len(value)))
+			return nil
+		case ctx.Err() != nil:
+			return fmt.Errorf("cache lookup interrupted: %w", err)
+		case errors.Is(err, redis.Nil):
+			c.record(ctx, env, "cache_get", time.Since(start), "miss")
+			c.emit(ctx, env, "Cache miss", otellog.SeverityInfo, key)
+		default:
+			c.emit(ctx, env, fmt.Sprintf("Cache unavailable, reading through: %v", err), otellog.SeverityWarn, key,
+				otellog.String("error", err.Error()))
+			return load(ctx, env)
+		}
+
+		if err := load(ctx, env); err != nil {
+			return err
+		}
+		start = time.Now()
+		if err := c.client.Set(ctx, key, fmt.Sprintf(`{"id":%q,"loaded_at":%q}`, key, start.Format(time.RFC3339)), c.ttl).Err(); err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("cache fill interrupted: %w", err)
+			}
+			c.emit(ctx, env, fmt.Sprintf("Cache fill failed: %v", err), otellog.SeverityWarn, key,
+				otellog.String("error", err.Error()))
+			return nil
+		}
+		c.record(ctx, env, "cache_set", time.Since(start), "ok")
+		return nil
+	}
+}
+
+func (c *cache) record(ctx context.Context, env *scenario.Env, operation string, d time.Duration, result string) {
+	if env.Metrics == nil {
+		return
+	}
+	env.Metrics.Duration.Record(ctx, d.Seconds(), metric.WithAttributes(env.Attributes...), metric.WithAttributes(
+		attribute.String("operation", operation),
+		attribute.String("db.system", "redis"),
+		attribute.String("cache.result", result),
+	))
+}
+
+func (c *cache) emit(ctx context.Context, env *scenario.Env, message string, severity otellog.Severity, key string, attrs ...otellog.KeyValue) {
+	attrs = append(attrs, otellog.String("component", "cache"), otellog.String("cache.key", key))
+	for _, kv := range env.Attributes {
+		attrs = append(attrs, otellog.KeyValueFromAttribute(kv))
+	}
+	logRecord(ctx, env.Logger, message, severity, attrs...)
+}
@@ -0,0 +1,730 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"otel-demo/telemetry"
+)
+
+// command is a clickstack-client subcommand
+type command struct {
+	name    string
+	summary string
+	flags   func(fs *flag.FlagSet, cfg *telemetry.Config)
+	run     func(ctx context.Context, cfg *telemetry.Config, reload func() (*telemetry.Config, error)) error
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		generateCommand("traces", "generate spans only", telemetry.Signals{Traces: true}),
+		generateCommand("logs", "generate log records only", telemetry.Signals{Logs: true}),
+		generateCommand("metrics", "generate metric data points only", telemetry.Signals{Metrics: true}),
+		generateCommand("all", "generate traces, logs and metrics (default)", telemetry.Signals{Traces: true, Logs: true, Metrics: true}),
+		validateCommand(),
+		replayCommand(),
+		compareCommand(),
+		statsdCommand(),
+		serveCommand(),
+		initCommand(),
+	}
+}
+
+// runCLI dispatches args to a subcommand. Without a subcommand name the
+// "all" command runs, so `clickstack-client -config x.yaml` still works.
+func runCLI(ctx context.Context, args []string) error {
+	name := "all"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		usage()
+		return nil
+	}
+
+	cmd := lookupCommand(name)
+	if cmd == nil {
+		usage()
+		return fmt.Errorf("unknown command %q", name)
+	}
+
+	load := func() (*telemetry.Config, error) { return parseCommandConfig(cmd, args) }
+	cfg, err := load()
+	if err != nil {
+		return err
+	}
+	return cmd.run(ctx, cfg, load)
+}
+
+func lookupCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: clickstack-client <command> [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'clickstack-client <command> -h' for the flags of a command.\n")
+}
+
+// parseCommandConfig builds the effective configuration for a command:
+// defaults, then the config file and the selected profile, then the
+// environment, then flags.
+//
+// The flags are parsed twice. The first pass only locates the config file
+// (everything else lands in a scratch config); the second pass binds the
+// same flags to the loaded config so that explicit flags win.
+func parseCommandConfig(cmd *command, args []string) (*telemetry.Config, error) {
+	var configPath, profile string
+	newFlagSet := func(cfg *telemetry.Config) *flag.FlagSet {
+		fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+		fs.Usage = func() {
+			fmt.Fprintf(fs.Output(), "Usage: clickstack-client %s [flags]\n\nFlags:\n", cmd.name)
+			fs.PrintDefaults()
+		}
+		fs.StringVar(&configPath, "config", configPath, "path to a YAML or TOML config file")
+		fs.StringVar(&profile, "profile", profile, "named profile from the config file's profiles section")
+		cmd.flags(fs, cfg)
+		return fs
+	}
+
+	if err := newFlagSet(telemetry.DefaultConfig()).Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg, err := telemetry.LoadConfig(configPath, profile)
+	if err != nil {
+		return nil, err
+	}
+	if err := telemetry.ApplyEnv(cfg); err != nil {
+		return nil, err
+	}
+
+	fs := newFlagSet(cfg)
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+// The bind*Flags functions register groups of flags shared between
+// commands. Each flag writes straight into cfg and uses its current value as
+// the default.
+
+func bindExporterFlags(fs *flag.FlagSet, cfg *telemetry.Config) {
+	fs.StringVar(&cfg.Exporter.Endpoint, "endpoint", cfg.Exporter.Endpoint, "OTLP collector endpoint (host[:port] or http(s):// URL)")
+	fs.StringVar(&cfg.Exporter.Type, "exporter", cfg.Exporter.Type, "exporter for every signal: otlp, clickhouse, kafka, stdout, file or sql; -trace-exporter also takes zipkin, -metric-exporter prometheus")
+	fs.Func("output-file", "append every exported batch to `path` as OTLP JSON lines instead of sending it; same as -exporter file", func(s string) error {
+		cfg.Exporter.Type = "file"
+		cfg.Exporter.Path = s
+		return nil
+	})
+	fs.Func("output-sql", "append every exported batch to `path` as ClickHouse INSERT statements for the ClickStack tables; same as -exporter sql", func(s string) error {
+		cfg.Exporter.Type = "sql"
+		cfg.Exporter.Path = s
+		return nil
+	})
+	fs.Func("syslog-endpoint", "send logs as RFC 5424 syslog to `udp|tcp|tls://host[:port]` instead of the log exporter", func(s string) error {
+		cfg.Exporter.Logs.Type = "syslog"
+		cfg.Exporter.Logs.Endpoint = s
+		return nil
+	})
+	fs.Func("loki-endpoint", "push logs to the Loki push API at `url` instead of the log exporter", func(s string) error {
+		cfg.Exporter.Logs.Type = "loki"
+		cfg.Exporter.Logs.Endpoint = s
+		return nil
+	})
+	fs.Func("fluent-endpoint", "forward logs to a fluent-bit or fluentd forward input at `[tcp|tls://]host[:port]` instead of the log exporter", func(s string) error {
+		cfg.Exporter.Logs.Type = "fluent"
+		cfg.Exporter.Logs.Endpoint = s
+		return nil
+	})
+	fs.StringVar(&cfg.Exporter.Traces.Type, "trace-exporter", cfg.Exporter.Traces.Type, "exporter for traces, overriding -exporter")
+	fs.StringVar(&cfg.Exporter.Logs.Type, "log-exporter", cfg.Exporter.Logs.Type, "exporter for logs, overriding -exporter")
+	fs.StringVar(&cfg.Exporter.Metrics.Type, "metric-exporter", cfg.Exporter.Metrics.Type, "exporter for metrics, overriding -exporter")
+	fs.StringVar(&cfg.Exporter.Traces.Topic, "traces-topic", cfg.Exporter.Traces.Topic, "Kafka topic for traces (default otlp_spans)")
+	fs.StringVar(&cfg.Exporter.Logs.Topic, "logs-topic", cfg.Exporter.Logs.Topic, "Kafka topic for logs (default otlp_logs), or the fluent tag (default the service name)")
+	fs.StringVar(&cfg.Exporter.Metrics.Topic, "metrics-topic", cfg.Exporter.Metrics.Topic, "Kafka topic for metrics (default otlp_metrics)")
+	fs.StringVar(&cfg.Exporter.Listen, "prometheus-listen", cfg.Exporter.Listen, "`host:port` serving /metrics when the metric exporter is prometheus")
+	fs.StringVar(&cfg.Exporter.Protocol, "protocol", cfg.Exporter.Protocol, "OTLP transport: grpc, http/protobuf or http/json")
+	fs.StringVar(&cfg.Exporter.Proxy, "proxy", cfg.Exporter.Proxy, "http(s):// forward proxy for all exporter connections; defaults to HTTPS_PROXY/HTTP_PROXY, honouring NO_PROXY")
+	fs.BoolFunc("insecure", "send plaintext instead of TLS, e.g. to a local collector", func(s string) error {
+		insecure, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		cfg.Exporter.Insecure = &insecure
+		return nil
+	})
+	fs.BoolFunc("tls", "use TLS even if the config or environment sets insecure", func(s string) error {
+		useTLS, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		insecure := !useTLS
+		cfg.Exporter.Insecure = &insecure
+		return nil
+	})
+	fs.StringVar(&cfg.Exporter.Certificate, "ca-cert", cfg.Exporter.Certificate, "PEM CA bundle to verify the collector with instead of the system roots")
+	fs.StringVar(&cfg.Exporter.ClientCertificate, "client-cert", cfg.Exporter.ClientCertificate, "PEM client certificate for mutual TLS; requires -client-key")
+	fs.StringVar(&cfg.Exporter.ClientKey, "client-key", cfg.Exporter.ClientKey, "PEM private key for -client-cert")
+	fs.DurationVar(&cfg.Exporter.GRPC.KeepaliveTime, "grpc-keepalive-time", cfg.Exporter.GRPC.KeepaliveTime, "ping gRPC collectors after this long without activity, keeping NAT mappings alive; 0 disables")
+	fs.DurationVar(&cfg.Exporter.GRPC.KeepaliveTimeout, "grpc-keepalive-timeout", cfg.Exporter.GRPC.KeepaliveTimeout, "drop the gRPC connection when a keepalive ping isn't answered within this long (default 20s)")
+	fs.IntVar(&cfg.Exporter.GRPC.MaxMessageSize, "grpc-max-message-size", cfg.Exporter.GRPC.MaxMessageSize, "largest gRPC export request or response in bytes; 0 keeps the gRPC default")
+	fs.DurationVar(&cfg.Exporter.GRPC.BackoffBaseDelay, "grpc-backoff-base-delay", cfg.Exporter.GRPC.BackoffBaseDelay, "first wait before the gRPC connection is re-established (default 1s)")
+	fs.DurationVar(&cfg.Exporter.GRPC.BackoffMaxDelay, "grpc-backoff-max-delay", cfg.Exporter.GRPC.BackoffMaxDelay, "longest wait between gRPC reconnection attempts (default 2m)")
+	fs.StringVar(&cfg.Exporter.Temporality, "temporality", cfg.Exporter.Temporality, "aggregation temporality of the exported metrics: cumulative, delta (counters and histograms) or lowmemory (synchronous ones only)")
+	fs.StringVar(&cfg.Exporter.Compression, "compression", cfg.Exporter.Compression, "compression for the OTLP exports: gzip or none")
+	fs.DurationVar(&cfg.Exporter.Timeout, "export-timeout", cfg.Exporter.Timeout, "connect and per-request export timeout for every signal")
+	fs.DurationVar(&cfg.Exporter.Traces.Timeout, "traces-export-timeout", cfg.Exporter.Traces.Timeout, "export timeout for traces, overriding -export-timeout")
+	fs.DurationVar(&cfg.Exporter.Logs.Timeout, "logs-export-timeout", cfg.Exporter.Logs.Timeout, "export timeout for logs, overriding -export-timeout")
+	fs.DurationVar(&cfg.Exporter.Metrics.Timeout, "metrics-export-timeout", cfg.Exporter.Metrics.Timeout, "export timeout for metrics, overriding -export-timeout")
+	fs.BoolFunc("retry", "retry failed exports with exponential backoff (default true; -retry=false fails fast)", func(s string) error {
+		retry, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		cfg.Exporter.Retry.Enabled = &retry
+		return nil
+	})
+	fs.DurationVar(&cfg.Exporter.Retry.InitialInterval, "retry-initial-interval", cfg.Exporter.Retry.InitialInterval, "wait before the first retry of a failed export")
+	fs.DurationVar(&cfg.Exporter.Retry.MaxInterval, "retry-max-interval", cfg.Exporter.Retry.MaxInterval, "longest wait between retries")
+	fs.DurationVar(&cfg.Exporter.Retry.MaxElapsedTime, "retry-max-elapsed", cfg.Exporter.Retry.MaxElapsedTime, "give up on an export after retrying for this long")
+	fs.Func("header", "`key=value` header (gRPC metadata) sent with every export, e.g. authorization=<api-key> (repeatable)", func(s string) error {
+		k, v, ok := strings.Cut(s, "=")
+		if !ok || k == "" {
+			return fmt.Errorf("want key=value, got %q", s)
+		}
+		if cfg.Exporter.Headers == nil {
+			cfg.Exporter.Headers = map[string]string{}
+		}
+		cfg.Exporter.Headers[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+		return nil
+	})
+	fs.Func("mirror", "also export everything to `name=endpoint` (repeatable)", func(s string) error {
+		name, endpoint, ok := strings.Cut(s, "=")
+		if !ok || name == "" || endpoint == "" {
+			return fmt.Errorf("want name=endpoint, got %q", s)
+		}
+		if cfg.Exporter.Mirrors == nil {
+			cfg.Exporter.Mirrors = map[string]telemetry.EndpointConfig{}
+		}
+		m := cfg.Exporter.Mirrors[name]
+		m.Endpoint = endpoint
+		cfg.Exporter.Mirrors[name] = m
+		return nil
+	})
+	fs.StringVar(&cfg.Exporter.Spool.Dir, "spool-dir", cfg.Exporter.Spool.Dir, "spool batches the collector doesn't accept to this `directory` and replay them once it's back")
+	fs.Int64Var(&cfg.Exporter.Spool.MaxSize, "spool-max-size", cfg.Exporter.Spool.MaxSize, "bytes the spool may use per signal before failed batches are dropped")
+	fs.DurationVar(&cfg.Exporter.Spool.ReplayInterval, "spool-replay-interval", cfg.Exporter.Spool.ReplayInterval, "how often spooled batches are sent again")
+	fs.StringVar(&cfg.Exporter.Record, "record", cfg.Exporter.Record, "also write every exported batch to this `directory`, to send the run again with replay -input")
+	fs.BoolVar(&cfg.Exporter.CircuitBreaker.Enabled, "circuit-breaker", cfg.Exporter.CircuitBreaker.Enabled, "stop exporting a signal after repeated failures and probe the collector until it recovers")
+	fs.IntVar(&cfg.Exporter.CircuitBreaker.FailureThreshold, "circuit-breaker-threshold", cfg.Exporter.CircuitBreaker.FailureThreshold, "consecutive failed exports that open the circuit")
+	fs.DurationVar(&cfg.Exporter.CircuitBreaker.ProbeInterval, "circuit-breaker-probe-interval", cfg.Exporter.CircuitBreaker.ProbeInterval, "how often an open circuit lets a batch through to probe the collector")
+	fs.StringVar(&cfg.Exporter.CircuitBreaker.Mode, "circuit-breaker-mode", cfg.Exporter.CircuitBreaker.Mode, "what an open circuit does with batches: drop, or buffer spans, logs and delta metrics for replay")
+	fs.IntVar(&cfg.Exporter.CircuitBreaker.BufferSize, "circuit-breaker-buffer", cfg.Exporter.CircuitBreaker.BufferSize, "batches per signal an open circuit holds in buffer mode before dropping the oldest")
+}
+
+func bindServiceFlags(fs *flag.FlagSet, cfg *telemetry.Config) {
+	fs.StringVar(&cfg.Service.Name, "service-name", cfg.Service.Name, "service.name resource attribute")
+	fs.StringVar(&cfg.Service.Version, "service-version", cfg.Service.Version, "service.version resource attribute")
+	fs.StringVar(&cfg.Service.InstanceID, "instance-id", cfg.Service.InstanceID, "service.instance.id resource attribute; empty generates a UUID per run")
+	fs.Func("resource-attr", "extra `key=value` resource attribute on all telemetry (repeatable)", func(s string) error {
+		k, v, ok := strings.Cut(s, "=")
+		if !ok || k == "" {
+			return fmt.Errorf("want key=value, got %q", s)
+		}
+		telemetry.ApplyResourceAttributes(&cfg.Service, map[string]string{k: v})
+		return nil
+	})
+	fs.Func("propagators", "comma-separated trace context formats sent to and accepted from other services: tracecontext, baggage, b3, b3multi, jaeger, xray, composite (all but xray) or none (default tracecontext,baggage)", func(s string) error {
+		cfg.Propagators = strings.Split(s, ",")
+		return nil
+	})
+}
+
+func bindGeneratorFlags(fs *flag.FlagSet, cfg *telemetry.Config) {
+	fs.BoolVar(&cfg.DryRun.Enabled, "dry-run", cfg.DryRun.Enabled, "print telemetry to stdout instead of exporting it")
+	fs.StringVar(&cfg.DryRun.Format, "dry-run-format", cfg.DryRun.Format, "dry-run output: text or json (OTLP JSON, one batch per line)")
+	fs.Func("sample-ratio", "keep this `fraction` of the traces, decided by trace ID (sampler.type parentbased_traceidratio), and report how many were kept", func(s string) error {
+		ratio, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		cfg.Sampler.Type, cfg.Sampler.Ratio = "parentbased_traceidratio", ratio
+		return nil
+	})
+	fs.BoolFunc("redact", "mask email addresses, card numbers and tokens in span attributes before export (a processors.spans redact entry)", func(s string) error {
+		redact, err := strconv.ParseBool(s)
+		if err != nil || !redact {
+			return err
+		}
+		cfg.Processors.Spans = append(cfg.Processors.Spans, telemetry.ProcessorConfig{Type: "redact"})
+		return nil
+	})
+	fs.BoolFunc("enrich", "add the deployment, cloud and Kubernetes attributes of a fake fleet to every span and log record as it's exported (a processors.spans and processors.logs enrich entry)", func(s string) error {
+		enrich, err := strconv.ParseBool(s)
+		if err != nil || !enrich {
+			return err
+		}
+		p := telemetry.ProcessorConfig{Type: "enrich", Generate: telemetry.EnrichKeys()}
+		cfg.Processors.Spans = append(cfg.Processors.Spans, p)
+		cfg.Processors.Logs = append(cfg.Processors.Logs, p)
+		return nil
+	})
+	fs.StringVar(&cfg.ExemplarFilter, "exemplar-filter", cfg.ExemplarFilter, "measurements kept as exemplars linking metrics to spans: trace_based (those in sampled spans), always_on or always_off")
+	fs.StringVar(&cfg.IDGenerator, "id-generator", cfg.IDGenerator, "trace and span ID generator: random, or xray for AWS X-Ray compatible trace IDs")
+	fs.Float64Var(&cfg.Scenario.Rate, "rate", cfg.Scenario.Rate, "simulated requests per second")
+	fs.DurationVar(&cfg.Scenario.Duration, "duration", cfg.Scenario.Duration, "how long to generate telemetry; 0 sends a single request")
+	fs.BoolVar(&cfg.Scenario.Forever, "forever", cfg.Scenario.Forever, "generate telemetry until interrupted, ignoring -duration")
+	fs.IntVar(&cfg.Batch.MaxQueueSize, "batch-max-queue-size", cfg.Batch.MaxQueueSize, "spans or log records buffered for export; more are dropped")
+	fs.IntVar(&cfg.Batch.MaxExportBatchSize, "batch-max-export-size", cfg.Batch.MaxExportBatchSize, "most spans or log records sent in one export")
+	fs.DurationVar(&cfg.Batch.BatchTimeout, "batch-timeout", cfg.Batch.BatchTimeout, "longest a span or log record waits in the queue before it's exported")
+	fs.DurationVar(&cfg.Batch.ExportTimeout, "batch-export-timeout", cfg.Batch.ExportTimeout, "give up on a batch export, retries included, after this long")
+	fs.DurationVar(&cfg.Batch.ShutdownTimeout, "shutdown-timeout", cfg.Batch.ShutdownTimeout, "longest the final flush may take at the end of a run or after an interrupt")
+	fs.IntVar(&cfg.Limits.AttributeCount, "span-attribute-limit", cfg.Limits.AttributeCount, "most attributes a span keeps; 0 keeps the SDK's 128, negative lifts the limit")
+	fs.IntVar(&cfg.Limits.EventCount, "span-event-limit", cfg.Limits.EventCount, "most events a span keeps; 0 keeps the SDK's 128, negative lifts the limit")
+	fs.IntVar(&cfg.Limits.LinkCount, "span-link-limit", cfg.Limits.LinkCount, "most links a span keeps; 0 keeps the SDK's 128, negative lifts the limit")
+	fs.IntVar(&cfg.Limits.AttributeValueLength, "attribute-length-limit", cfg.Limits.AttributeValueLength, "longest a span's string attribute values may be before they're cut; 0 keeps the SDK's, no limit")
+	fs.StringVar(&cfg.Scenario.RealHTTPTarget, "real-http-target", cfg.Scenario.RealHTTPTarget, "`URL` to send each request's API call to for real, instead of simulating it")
+	fs.Float64Var(&cfg.Scenario.ErrorRate, "error-rate", cfg.Scenario.ErrorRate, "fraction of simulated requests whose API call fails with a 5xx, failing the request")
+	fs.Func("http-statuses", "comma-separated `code=weight` list of the statuses answering the simulated API calls -error-rate doesn't fail, e.g. 200=90,404=5,429=2,503=3", func(s string) error {
+		statuses := map[string]float64{}
+		for _, kv := range strings.Split(s, ",") {
+			code, weight, ok := strings.Cut(kv, "=")
+			if !ok {
+				return fmt.Errorf("want code=weight, got %q", kv)
+			}
+			w, err := strconv.ParseFloat(weight, 64)
+			if err != nil {
+				return fmt.Errorf("bad weight %q for %s", weight, code)
+			}
+			statuses[code] = w
+		}
+		cfg.Scenario.HTTPStatuses = statuses
+		return nil
+	})
+	fs.Float64Var(&cfg.Scenario.Orphans.MissingRoot, "orphan-root-rate", cfg.Scenario.Orphans.MissingRoot, "fraction of requests whose root span is never exported, orphaning the rest of the trace")
+	fs.Float64Var(&cfg.Scenario.Orphans.DroppedParent, "orphan-parent-rate", cfg.Scenario.Orphans.DroppedParent, "fraction of requests where a span between the root and the work is never exported, orphaning the spans under it")
+	fs.IntVar(&cfg.Scenario.Hedge.Attempts, "hedge-attempts", cfg.Scenario.Hedge.Attempts, "make each request's API call a hedged request of up to this many racing copies (2-10), the losers cancelled; 0 makes one call")
+	fs.DurationVar(&cfg.Scenario.Hedge.Delay, "hedge-delay", cfg.Scenario.Hedge.Delay, "how long a hedged call waits on its copies before starting another")
+	fs.IntVar(&cfg.Scenario.ScatterGather.Width, "scatter-width", cfg.Scenario.ScatterGather.Width, "replace each request's API call with a scatter-gather across this many shards called at once (up to 1000); 0 makes the API call")
+	fs.Float64Var(&cfg.Scenario.ScatterGather.StragglerRate, "straggler-rate", cfg.Scenario.ScatterGather.StragglerRate, "fraction of the -scatter-width shard calls that straggle, taking scenario.scatter_gather.straggler_latency")
+	fs.IntVar(&cfg.Scenario.Transaction.Statements, "tx-statements", cfg.Scenario.Transaction.Statements, "have each request write its order in a simulated database transaction of this many statements (up to 100); 0 skips it")
+	fs.Float64Var(&cfg.Scenario.Transaction.DeadlockRate, "deadlock-rate", cfg.Scenario.Transaction.DeadlockRate, "fraction of the -tx-statements transactions rolled back on a deadlock, failing the request")
+	fs.BoolVar(&cfg.Scenario.SpanEvents, "span-events", cfg.Scenario.SpanEvents, "add cache lookup, lock wait, retry and GC pause events to the simulated spans")
+	fs.BoolVar(&cfg.Scenario.ExponentialHistograms, "exponential-histograms", cfg.Scenario.ExponentialHistograms, "record the simulated API's response body sizes, and the request durations once more, as base2 exponential histograms")
+	fs.BoolVar(&cfg.Scenario.ExceedLimits, "exceed-limits", cfg.Scenario.ExceedLimits, "start each request with a limits-probe span going past every span limit, and report what was dropped")
+	fs.BoolVar(&cfg.Scenario.PII, "pii", cfg.Scenario.PII, "put a fake email address, card number and bearer token on each request's root span")
+	fs.IntVar(&cfg.Scenario.BatchSize, "batch-size", cfg.Scenario.BatchSize, "run a batch job every `n` requests, its trace linked to theirs; 0 runs none")
+	fs.IntVar(&cfg.Scenario.Tree.Depth, "tree-depth", cfg.Scenario.Tree.Depth, "replace each request's work with a synthetic trace tree this many levels deep; 0 keeps the demo request")
+	fs.IntVar(&cfg.Scenario.Tree.FanOut, "tree-fan-out", cfg.Scenario.Tree.FanOut, "children of each span in the synthetic trace tree")
+	fs.StringVar(&cfg.Scenario.Tree.Distribution, "tree-distribution", cfg.Scenario.Tree.Distribution, "distribution of the tree spans' durations: uniform, exponential or lognormal")
+	fs.IntVar(&cfg.Scenario.Tree.Attributes, "tree-attributes", cfg.Scenario.Tree.Attributes, "attributes on each span of the synthetic trace tree")
+	fs.Func("stress-trace", "replace each request's work with a pathological trace: `depth=n,width=n` for a chain of n spans, each the parent of the next, with n children under the deepest", func(s string) error {
+		for _, kv := range strings.Split(s, ",") {
+			k, v, ok := strings.Cut(kv, "=")
+			n, err := strconv.Atoi(v)
+			switch {
+			case !ok || err != nil:
+				return fmt.Errorf("want depth=n or width=n, got %q", kv)
+			case k == "depth":
+				cfg.Scenario.StressTrace.Depth = n
+			case k == "width":
+				cfg.Scenario.StressTrace.Width = n
+			default:
+				return fmt.Errorf("unknown stress trace dimension %q, want depth or width", k)
+			}
+		}
+		return nil
+	})
+	fs.DurationVar(&cfg.Scenario.Backfill.Window, "backfill", cfg.Scenario.Backfill.Window, "date everything across this window of the past, ending when the run does, instead of now")
+	fs.DurationVar(&cfg.Scenario.Backfill.CompressTo, "compress-to", cfg.Scenario.Backfill.CompressTo, "run a -backfill for this long instead of the whole window, spreading it out to fill the window")
+	fs.DurationVar(&cfg.Scenario.LongRunning.Duration, "long-running", cfg.Scenario.LongRunning.Duration, "also run migration jobs this long each, their spans open the whole time; 0 runs none")
+	fs.DurationVar(&cfg.Scenario.LongRunning.Heartbeat, "heartbeat", cfg.Scenario.LongRunning.Heartbeat, "how often a -long-running job records its progress")
+	fs.DurationVar(&cfg.Scenario.GRPCStream.Duration, "grpc-stream", cfg.Scenario.GRPCStream.Duration, "also keep bidirectional gRPC streams to the inventory service open this long each, with message events both ways; 0 opens none")
+	fs.BoolVar(&cfg.Scenario.Queue.Enabled, "queue", cfg.Scenario.Queue.Enabled, "publish a message from every request to a simulated queue, processed later in a trace of its own linked to the request's")
+	fs.IntVar(&cfg.Scenario.LargeAttributes.Size, "large-attribute-size", cfg.Scenario.LargeAttributes.Size, "add a SQL statement and a base64 blob of about this many `bytes` each to every span")
+	fs.IntVar(&cfg.Scenario.LargeAttributes.Count, "large-attribute-count", cfg.Scenario.LargeAttributes.Count, "add this many more attributes to every span, raising the span attribute limit to fit")
+	fs.IntVar(&cfg.Scenario.Services, "services", cfg.Scenario.Services, "send each request through this many services of the demo topology (2-8), each with its own resource; 0 keeps a single service")
+	fs.Func("clock-skew", "`service=offset` moving the timestamps of the service, simulated or the generator's own, as if its clock were off, e.g. payment=-300ms (repeatable)", func(s string) error {
+		name, v, ok := strings.Cut(s, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("want service=offset, got %q", s)
+		}
+		skew, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		if cfg.Scenario.ClockSkew == nil {
+			cfg.Scenario.ClockSkew = map[string]time.Duration{}
+		}
+		cfg.Scenario.ClockSkew[name] = skew
+		return nil
+	})
+	fs.BoolVar(&cfg.Scenario.ServicesNetwork, "services-network", cfg.Scenario.ServicesNetwork, "run each of the -services as an HTTP server on a loopback port, calling one another over HTTP")
+	fs.BoolVar(&cfg.Scenario.GRPC, "grpc-demo", cfg.Scenario.GRPC, "also call an in-process gRPC inventory service from every request")
+	fs.BoolVar(&cfg.Scenario.Baggage, "baggage", cfg.Scenario.Baggage, "give every request a tenant, user tier and origin as baggage, copied onto its spans and log records")
+	fs.StringVar(&cfg.Scenario.Database.Driver, "db-driver", cfg.Scenario.Database.Driver, "run the database queries for real: sqlite (embedded) or postgres; empty simulates them")
+	fs.StringVar(&cfg.Scenario.Database.DSN, "db-dsn", cfg.Scenario.Database.DSN, "data source for -db-driver: a SQLite file or a postgres connection string")
+	fs.StringVar(&cfg.Scenario.Redis.Addr, "redis-addr", cfg.Scenario.Redis.Addr, "`host:port` of a Redis to cache the user lookups in; empty skips the cache")
+	fs.Func("kafka-brokers", "comma-separated `host:port` list of Kafka brokers to publish and consume order events through", func(s string) error {
+		cfg.Scenario.Kafka.Brokers = strings.Split(s, ",")
+		return nil
+	})
+	fs.Int64Var(&cfg.Scenario.Seed, "seed", cfg.Scenario.Seed, "seed for the simulated latencies, memory readings and attribute values; 0 picks one at random")
+	fs.Func("attr", "extra `key=value` attribute on the generated telemetry (repeatable)", func(s string) error {
+		k, v, ok := strings.Cut(s, "=")
+		if !ok || k == "" {
+			return fmt.Errorf("want key=value, got %q", s)
+		}
+		if cfg.Scenario.Attributes == nil {
+			cfg.Scenario.Attributes = map[string]string{}
+		}
+		cfg.Scenario.Attributes[k] = v
+		return nil
+	})
+}
+
+// generateCommand returns a command that runs the simulated workload with
+// only the given signals exported.
+func generateCommand(name, summary string, signals telemetry.Signals) *command {
+	var tui, loopback bool
+	return &command{
+		name:    name,
+		summary: summary,
+		flags: func(fs *flag.FlagSet, cfg *telemetry.Config) {
+			bindExporterFlags(fs, cfg)
+			bindServiceFlags(fs, cfg)
+			bindGeneratorFlags(fs, cfg)
+			fs.BoolVar(&tui, "tui", tui, "show a live dashboard with keyboard controls for the rates; runs until q without -duration")
+			fs.BoolVar(&loopback, "loopback", loopback, "export to a built-in OTLP receiver and check what it gets, instead of a collector")
+			fs.BoolVar(&cfg.Exporter.Preflight, "preflight", cfg.Exporter.Preflight, "check the collectors can be reached before generating anything")
+		},
+		run: func(ctx context.Context, cfg *telemetry.Config, reload func() (*telemetry.Config, error)) error {
+			// What a reload is checked against, before the run sets it up
+			parsed := cfg.Clone()
+			// A backfill lasts as long as it's compressed to
+			if b := cfg.Scenario.Backfill; b.Window > 0 {
+				cfg.Scenario.Duration = b.Over()
+			}
+			if tui {
+				if cfg.UsesStdout() {
+					return errors.New("-tui cannot be combined with -dry-run or the stdout exporter")
+				}
+				keepDashboardRunning(&cfg.Scenario)
+			}
+
+			var receiver *loopbackReceiver
+			if loopback {
+				if cfg.DryRun.Enabled {
+					return errors.New("-loopback cannot be combined with -dry-run")
+				}
+				var err error
+				if receiver, err = startLoopback(cfg); err != nil {
+					return err
+				}
+				defer receiver.stop()
+			}
+
+			// Keep stdout clean for the telemetry itself
+			status := os.Stdout
+			if cfg.UsesStdout() {
+				status = os.Stderr
+			}
+
+			client, shift, err := setupClient(ctx, cfg, signals, status)
+			if err != nil {
+				return err
+			}
+			w, err := setupWorkload(cfg, client)
+			if err != nil {
+				return errors.Join(err, client.Shutdown(ctx))
+			}
+			closeStores, err := setupStores(ctx, cfg.Scenario, w)
+			if err != nil {
+				return errors.Join(err, client.Shutdown(ctx))
+			}
+			defer closeStores()
+			inv, stopBackends, err := setupBackends(ctx, cfg, signals, shift, client, w)
+			if err != nil {
+				return errors.Join(err, client.Shutdown(ctx))
+			}
+
+			// Demonstrate tracing, logging, and metrics
+			fmt.Fprintln(status, "Starting OpenTelemetry demo...")
+			fmt.Fprintf(status, "Reporting as %s %s, instance %s\n", cfg.Service.Name, cfg.Service.Version, cfg.Service.InstanceID)
+			fmt.Fprintf(status, "Using seed %d (pass -seed %[1]d to reproduce this run)\n", cfg.Scenario.Seed)
+			if shift != nil {
+				fmt.Fprintf(status, "Backfilling the past %s in %s, %.6gx faster than real time\n", cfg.Scenario.Backfill.Window, cfg.Scenario.Duration, shift.Factor())
+			}
+			if cfg.Scenario.Continuous() {
+				stop := watchReload(cfg, parsed, tui, w, reload)
+				defer stop()
+			}
+			// An interrupt stops generating; what was generated is still flushed
+			runCtx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+			stopDashboard := func() {}
+			if tui {
+				if stopDashboard, err = runDashboard(cfg, w, client.Stats(), cancel); err != nil {
+					stopBackends()
+					return errors.Join(err, client.Shutdown(ctx))
+				}
+			}
+			stopJobs := startBackgroundJobs(runCtx, cfg.Scenario, w, inv)
+			start := time.Now()
+			issued := w.run(runCtx)
+			stopJobs()
+			stopDashboard()
+			interrupted := runCtx.Err() != nil && ctx.Err() == nil && !tui
+			// Restores the default handling, so a second interrupt quits at once
+			cancel()
+			fmt.Fprintf(status, "Issued %d simulated requests in %s\n", issued, time.Since(start).Round(time.Millisecond))
+			if interrupted {
+				fmt.Fprintf(status, "Interrupted, flushing for up to %s (interrupt again to quit now)\n", cfg.Batch.ShutdownTimeout)
+			}
+
+			// Before the shutdown, so the server and consumer spans are ended
+			// and flushed
+			stopBackends()
+			return finishRun(ctx, cfg, client, w, receiver, status)
+		},
+	}
+}
+
+// setupClient checks the collectors and starts the telemetry client of a
+// generator run, with the time shift of scenario.backfill, nil without one
+func setupClient(ctx context.Context, cfg *telemetry.Config, signals telemetry.Signals, status io.Writer) (*telemetry.Client, *telemetry.TimeShift, error) {
+	if err := preflight(ctx, cfg, signals, status); err != nil {
+		return nil, nil, err
+	}
+	cfg.Service.EnsureInstanceID()
+	if err := checkClockSkew(cfg.Scenario, cfg.Service.Name); err != nil {
+		return nil, nil, err
+	}
+	cfg.Views = exponentialHistogramViews(cfg)
+	var shift *telemetry.TimeShift
+	if b := cfg.Scenario.Backfill; b.Window > 0 {
+		shift = telemetry.NewTimeShift(b.Window, b.Over())
+	}
+	opts := append([]telemetry.Option{telemetry.WithConfig(cfg), telemetry.WithSignals(signals), telemetry.WithFailureHook(telemetry.LogExportFailure), telemetry.WithTimeShift(shift), telemetry.WithClockSkew(cfg.Scenario.ClockSkew[cfg.Service.Name])}, baggageOptions(cfg.Scenario)...)
+	opts = append(opts, largeAttributeOptions(cfg)...)
+	client, err := telemetry.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, shift, nil
+}
+
+// setupWorkload returns the workload of cfg's scenario, telemetry going to
+// client. It picks the seed when none is set.
+func setupWorkload(cfg *telemetry.Config, client *telemetry.Client) (*workload, error) {
+	// Pick a seed up front so every run can be reproduced
+	if cfg.Scenario.Seed == 0 {
+		cfg.Scenario.Seed = rand.Int64()
+	}
+	w, err := newWorkload(cfg.Scenario,
+		client.Tracer(cfg.Service.Name),
+		client.Logger(cfg.Service.Name),
+		client.Meter(cfg.Service.Name),
+	)
+	if err != nil {
+		return nil, err
+	}
+	w.baggage, w.client = cfg.Scenario.Baggage, client
+	w.limits = client.SpanLimits()
+	return w, nil
+}
+
+// setupStores connects w to the database of scenario.database and the
+// cache of scenario.redis, and returns what disconnects them, for once the
+// telemetry is flushed
+func setupStores(ctx context.Context, sc telemetry.ScenarioConfig, w *workload) (func(), error) {
+	var err error
+	if sc.Database.Driver != "" {
+		if w.db, err = openDatabase(ctx, sc.Database); err != nil {
+			return nil, err
+		}
+	}
+	if sc.Redis.Addr != "" {
+		if w.cache, err = openCache(ctx, sc.Redis); err != nil {
+			if w.db != nil {
+				w.db.Close()
+			}
+			return nil, err
+		}
+	}
+	return func() {
+		if w.cache != nil {
+			w.cache.close()
+		}
+		if w.db != nil {
+			w.db.Close()
+		}
+	}, nil
+}
+
+// setupBackends starts what the requests of w call besides the stores:
+// the Kafka messaging of scenario.kafka, the gRPC inventory, the queue and
+// the services of scenario.services. It returns the inventory, nil when
+// neither scenario.grpc nor scenario.grpc_stream needs one. stop stops all
+// but the services, which shut down with the telemetry in finishRun, and
+// goes before the telemetry's shutdown so their last spans are flushed.
+func setupBackends(ctx context.Context, cfg *telemetry.Config, signals telemetry.Signals, shift *telemetry.TimeShift, client *telemetry.Client, w *workload) (inv *inventory, stop func(), err error) {
+	stop = func() {
+		if inv != nil {
+			inv.stop()
+		}
+		if w.messaging != nil {
+			w.messaging.stop()
+		}
+		if w.queue != nil {
+			w.queue.stop()
+		}
+	}
+	fail := func(err error) (*inventory, func(), error) {
+		stop()
+		return nil, nil, err
+	}
+	if len(cfg.Scenario.Kafka.Brokers) > 0 {
+		if w.messaging, err = startMessaging(ctx, cfg.Scenario.Kafka, client, w.scenario.Load); err != nil {
+			return fail(err)
+		}
+	}
+	// Serving the streams of scenario.grpc_stream as well, without the
+	// requests checking stock unless scenario.grpc says so
+	if cfg.Scenario.GRPC || cfg.Scenario.GRPCStream.Duration > 0 {
+		if inv, err = startInventory(client, w.scenario.Load); err != nil {
+			return fail(err)
+		}
+		if cfg.Scenario.GRPC {
+			w.inventory = inv
+		}
+	}
+	if cfg.Scenario.Queue.Enabled {
+		if w.queue, err = newQueue(cfg.Scenario.Queue, client, w.scenario.Load); err != nil {
+			return fail(err)
+		}
+	}
+	if cfg.Scenario.Services > 0 {
+		if w.services, err = startServices(ctx, cfg, signals, shift, w.scenario.Load); err != nil {
+			return fail(err)
+		}
+	}
+	return inv, stop, nil
+}
+
+// startBackgroundJobs runs the jobs next to the requests until ctx is
+// done: the migrations of scenario.long_running and the streams of
+// scenario.grpc_stream, served by inv. stop waits for them to end.
+func startBackgroundJobs(ctx context.Context, sc telemetry.ScenarioConfig, w *workload, inv *inventory) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	if lr := sc.LongRunning; lr.Duration > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.runLongJobs(ctx, lr)
+		}()
+	}
+	if gs := sc.GRPCStream; gs.Duration > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			inv.runStreams(ctx, gs, w.seed)
+		}()
+	}
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// finishRun flushes and shuts down the telemetry of a generator run, its
+// services' included, reports what was exported and checks the loopback
+// receiver's count against it when there is one
+func finishRun(ctx context.Context, cfg *telemetry.Config, client *telemetry.Client, w *workload, receiver *loopbackReceiver, status io.Writer) error {
+	shutdownCtx, cancelShutdown := context.WithTimeout(ctx, cfg.Batch.ShutdownTimeout)
+	defer cancelShutdown()
+	shutdownErr := errors.Join(client.ForceFlush(shutdownCtx), client.Shutdown(shutdownCtx))
+	stats := client.Stats()
+	if w.services != nil {
+		// Reported as one with the workload's own, as the collector sees
+		// them
+		shutdownErr = errors.Join(shutdownErr, w.services.shutdown(shutdownCtx))
+		combined := w.services.stats()
+		combined.Add(stats)
+		stats = combined
+	}
+	// After the shutdown so the final flushes are counted too
+	if len(cfg.Exporter.Mirrors) > 0 && !cfg.DryRun.Enabled {
+		fmt.Fprintln(status, "\nMirror report:")
+		telemetry.WriteMirrorReport(status, stats)
+	}
+	if cfg.Sampler.Type != "always_on" {
+		telemetry.WriteSampling(status, stats)
+	}
+	telemetry.WriteLimits(status, stats)
+	telemetry.WriteRejections(status, stats)
+	failed := telemetry.WriteFailures(status, stats)
+	if shutdownErr != nil {
+		return fmt.Errorf("error shutting down providers: %w", shutdownErr)
+	}
+	if receiver != nil {
+		if err := receiver.report(status, stats); err != nil {
+			return err
+		}
+	}
+	if !failed {
+		fmt.Fprintln(status, "Demo completed. Check your OpenTelemetry collector for traces, logs, and metrics!")
+	} else if stats.Spans.Exported.Load()+stats.Logs.Exported.Load()+stats.Points.Exported.Load() == 0 {
+		return errors.New("nothing was exported: every export failed")
+	}
+	return nil
+}
+
+// preflight checks that the collectors of signals can be reached before
+// anything is generated, printing the report to status when one can't
+func preflight(ctx context.Context, cfg *telemetry.Config, signals telemetry.Signals, status io.Writer) error {
+	if !cfg.Exporter.Preflight {
+		return nil
+	}
+	report, err := telemetry.Preflight(ctx, telemetry.WithConfig(cfg), telemetry.WithSignals(signals))
+	if err != nil {
+		return err
+	}
+	if err := report.Err(); err != nil {
+		fmt.Fprintln(status, "Preflight check failed:")
+		report.Write(status)
+		return fmt.Errorf("collector check failed; is the collector running and the endpoint right? (-preflight=false starts anyway)\n%w", err)
+	}
+	return nil
+}
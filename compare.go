@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"otel-demo/telemetry"
+)
+
+// compareCommand diffs what two collectors accepted from the same run, for
+// example the current and the next collector version in front of
+// ClickStack. Both are sent identical telemetry with -mirror and write it
+// out with their file exporters (or are -record directories); compare then
+// matches the items up and reports the ones that went missing and the
+// attributes that were dropped, added or changed on the way.
+func compareCommand() *command {
+	var baseline, candidate string
+	limit := 20
+	return &command{
+		name:    "compare",
+		summary: "diff the telemetry two collectors accepted from the same run",
+		flags: func(fs *flag.FlagSet, cfg *telemetry.Config) {
+			fs.StringVar(&baseline, "baseline", baseline, "OTLP `file` or -record directory with what the reference collector accepted")
+			fs.StringVar(&candidate, "candidate", candidate, "OTLP `file` or -record directory with what the collector under test accepted")
+			fs.IntVar(&limit, "limit", limit, "differences to list individually; the rest are only counted")
+		},
+		run: func(ctx context.Context, cfg *telemetry.Config, _ func() (*telemetry.Config, error)) error {
+			if baseline == "" || candidate == "" {
+				return errors.New("nothing to compare: pass -baseline and -candidate")
+			}
+			a, err := loadSnapshot(baseline)
+			if err != nil {
+				return err
+			}
+			b, err := loadSnapshot(candidate)
+			if err != nil {
+				return err
+			}
+			if !compareSnapshots(os.Stdout, a, b, limit) {
+				return errors.New("the snapshots differ")
+			}
+			fmt.Println("Both collectors accepted identical telemetry")
+			return nil
+		},
+	}
+}
+
+// snapshotItem is one span, log record or data point, flattened to the
+// fields compare looks at: resource.<key>, scope.name, attributes.<key> and
+// the signal's own fields
+type snapshotItem struct {
+	label  string
+	fields map[string]string
+}
+
+// snapshot holds the items of each signal by the key that identifies them
+// on both sides: the span ID, the log record's timestamps and trace
+// context, the metric name, point attributes and timestamp
+type snapshot map[string]map[string]snapshotItem
+
+func (s snapshot) add(signal, key string, item snapshotItem) {
+	items := s[signal]
+	if items == nil {
+		items = map[string]snapshotItem{}
+		s[signal] = items
+	}
+	// Identical keys, such as repeated log lines, pair up in order
+	k := key
+	for n := 2; ; n++ {
+		if _, ok := items[k]; !ok {
+			break
+		}
+		k = key + "#" + strconv.Itoa(n)
+	}
+	items[k] = item
+}
+
+func loadSnapshot(path string) (snapshot, error) {
+	batches, err := readOTLPInput(path, "")
+	if err != nil {
+		return nil, err
+	}
+	s := snapshot{}
+	for _, b := range batches {
+		switch m := b.msg.(type) {
+		case *tracepb.TracesData:
+			for _, rs := range m.ResourceSpans {
+				for _, ss := range rs.ScopeSpans {
+					for _, span := range ss.Spans {
+						f := commonFields(rs.Resource, ss.Scope, span.Attributes)
+						f["name"] = span.Name
+						f["kind"] = span.Kind.String()
+						f["parent_span_id"] = hex.EncodeToString(span.ParentSpanId)
+						f["start_time"] = strconv.FormatUint(span.StartTimeUnixNano, 10)
+						f["end_time"] = strconv.FormatUint(span.EndTimeUnixNano, 10)
+						f["status.code"] = span.Status.GetCode().String()
+						f["status.message"] = span.Status.GetMessage()
+						f["events"] = strconv.Itoa(len(span.Events))
+						f["links"] = strconv.Itoa(len(span.Links))
+						s.add("traces", hex.EncodeToString(span.TraceId)+hex.EncodeToString(span.SpanId),
+							snapshotItem{fmt.Sprintf("span %q %x", span.Name, span.SpanId), f})
+					}
+				}
+			}
+		case *logspb.LogsData:
+			for _, rl := range m.ResourceLogs {
+				for _, sl := range rl.ScopeLogs {
+					for _, r := range sl.LogRecords {
+						f := commonFields(rl.Resource, sl.Scope, r.Attributes)
+						body := anyValueString(r.Body)
+						f["body"] = body
+						f["severity_number"] = strconv.Itoa(int(r.SeverityNumber))
+						f["severity_text"] = r.SeverityText
+						if len(body) > 40 {
+							body = body[:40] + "..."
+						}
+						s.add("logs", fmt.Sprintf("%d/%d/%x/%x", r.TimeUnixNano, r.ObservedTimeUnixNano, r.TraceId, r.SpanId),
+							snapshotItem{fmt.Sprintf("log record %q", body), f})
+					}
+				}
+			}
+		case *metricspb.MetricsData:
+			for _, rm := range m.ResourceMetrics {
+				for _, sm := range rm.ScopeMetrics {
+					for _, metric := range sm.Metrics {
+						for _, p := range snapshotPoints(metric) {
+							f := commonFields(rm.Resource, sm.Scope, nil)
+							maps.Copy(f, p.fields)
+							f["unit"] = metric.Unit
+							f["description"] = metric.Description
+							label := metric.Name + attributesString(p.attrs)
+							s.add("metrics", label+"@"+strconv.FormatUint(p.time, 10), snapshotItem{"metric " + label, f})
+						}
+					}
+				}
+			}
+		}
+	}
+	return s, nil
+}
+
+func commonFields(res *resourcepb.Resource, scope *commonpb.InstrumentationScope, attrs []*commonpb.KeyValue) map[string]string {
+	f := map[string]string{
+		"scope.name":    scope.GetName(),
+		"scope.version": scope.GetVersion(),
+	}
+	for _, kv := range res.GetAttributes() {
+		f["resource."+kv.Key] = anyValueString(kv.Value)
+	}
+	for _, kv := range attrs {
+		f["attributes."+kv.Key] = anyValueString(kv.Value)
+	}
+	return f
+}
+
+type snapshotPoint struct {
+	attrs  []*commonpb.KeyValue
+	time   uint64
+	fields map[string]string
+}
+
+// snapshotPoints flattens the data points of m. The point attributes are
+// part of the key, so a changed one shows up as a missing and an extra
+// point rather than as a change.
+func snapshotPoints(m *metricspb.Metric) []snapshotPoint {
+	var points []snapshotPoint
+	number := func(kind string, dps []*metricspb.NumberDataPoint, extra map[string]string) {
+		for _, dp := range dps {
+			f := map[string]string{"type": kind, "start_time": strconv.FormatUint(dp.StartTimeUnixNano, 10)}
+			switch v := dp.Value.(type) {
+			case *metricspb.NumberDataPoint_AsInt:
+				f["value"] = strconv.FormatInt(v.AsInt, 10)
+			case *metricspb.NumberDataPoint_AsDouble:
+				f["value"] = strconv.FormatFloat(v.AsDouble, 'g', -1, 64)
+			}
+			maps.Copy(f, extra)
+			points = append(points, snapshotPoint{dp.Attributes, dp.TimeUnixNano, f})
+		}
+	}
+	switch d := m.Data.(type) {
+	case *metricspb.Metric_Gauge:
+		number("gauge", d.Gauge.DataPoints, nil)
+	case *metricspb.Metric_Sum:
+		number("sum", d.Sum.DataPoints, map[string]string{
+			"temporality": d.Sum.AggregationTemporality.String(),
+			"monotonic":   strconv.FormatBool(d.Sum.IsMonotonic),
+		})
+	case *metricspb.Metric_Histogram:
+		for _, dp := range d.Histogram.DataPoints {
+			points = append(points, snapshotPoint{dp.Attributes, dp.TimeUnixNano, map[string]string{
+				"type":        "histogram",
+				"temporality": d.Histogram.AggregationTemporality.String(),
+				"start_time":  strconv.FormatUint(dp.StartTimeUnixNano, 10),
+				"count":       strconv.FormatUint(dp.Count, 10),
+				"sum":         strconv.FormatFloat(dp.GetSum(), 'g', -1, 64),
+				"bounds":      fmt.Sprint(dp.ExplicitBounds),
+				"buckets":     fmt.Sprint(dp.BucketCounts),
+			}})
+		}
+	case *metricspb.Metric_ExponentialHistogram:
+		for _, dp := range d.ExponentialHistogram.DataPoints {
+			points = append(points, snapshotPoint{dp.Attributes, dp.TimeUnixNano, map[string]string{
+				"type":        "exponential_histogram",
+				"temporality": d.ExponentialHistogram.AggregationTemporality.String(),
+				"start_time":  strconv.FormatUint(dp.StartTimeUnixNano, 10),
+				"count":       strconv.FormatUint(dp.Count, 10),
+				"sum":         strconv.FormatFloat(dp.GetSum(), 'g', -1, 64),
+				"scale":       strconv.Itoa(int(dp.Scale)),
+				"zero_count":  strconv.FormatUint(dp.ZeroCount, 10),
+			}})
+		}
+	case *metricspb.Metric_Summary:
+		for _, dp := range d.Summary.DataPoints {
+			points = append(points, snapshotPoint{dp.Attributes, dp.TimeUnixNano, map[string]string{
+				"type":       "summary",
+				"start_time": strconv.FormatUint(dp.StartTimeUnixNano, 10),
+				"count":      strconv.FormatUint(dp.Count, 10),
+				"sum":        strconv.FormatFloat(dp.Sum, 'g', -1, 64),
+			}})
+		}
+	}
+	return points
+}
+
+// attributesString renders attrs as {k=v,...} sorted by key, or nothing
+// when there are none
+func attributesString(attrs []*commonpb.KeyValue) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(attrs))
+	for _, kv := range attrs {
+		pairs = append(pairs, kv.Key+"="+anyValueString(kv.Value))
+	}
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// anyValueString renders v the way it would be shown in HyperDX: strings as
+// they are and everything else in a JSON-like form
+func anyValueString(v *commonpb.AnyValue) string {
+	switch v := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(v.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(v.IntValue, 10)
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(v.DoubleValue, 'g', -1, 64)
+	case *commonpb.AnyValue_BytesValue:
+		return hex.EncodeToString(v.BytesValue)
+	case *commonpb.AnyValue_ArrayValue:
+		values := make([]string, 0, len(v.ArrayValue.GetValues()))
+		for _, e := range v.ArrayValue.GetValues() {
+			values = append(values, strconv.Quote(anyValueString(e)))
+		}
+		return "[" + strings.Join(values, ",") + "]"
+	case *commonpb.AnyValue_KvlistValue:
+		pairs := make([]string, 0, len(v.KvlistValue.GetValues()))
+		for _, kv := range v.KvlistValue.GetValues() {
+			pairs = append(pairs, strconv.Quote(kv.Key)+":"+strconv.Quote(anyValueString(kv.Value)))
+		}
+		sort.Strings(pairs)
+		return "{" + strings.Join(pairs, ",") + "}"
+	default:
+		return ""
+	}
+}
+
+// fieldDiff counts how often a field was dropped, added or changed
+type fieldDiff struct {
+	signal, field           string
+	dropped, added, changed int
+}
+
+// compareSnapshots writes the differences between a and b to w, the counts
+// per signal and field first and then up to limit individual differences.
+// It reports whether the snapshots are identical.
+func compareSnapshots(w io.Writer, a, b snapshot, limit int) bool {
+	var examples []string
+	more := 0
+	example := func(format string, args ...any) {
+		if len(examples) < limit {
+			examples = append(examples, fmt.Sprintf(format, args...))
+		} else {
+			more++
+		}
+	}
+
+	identical := true
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "signal\tbaseline\tcandidate\tmissing\textra\tchanged")
+	diffs := map[string]*fieldDiff{}
+	for _, signal := range []string{"traces", "logs", "metrics"} {
+		var missing, extra, changed int
+		for _, key := range sortedKeys(a[signal]) {
+			ai := a[signal][key]
+			bi, ok := b[signal][key]
+			if !ok {
+				missing++
+				example("%s: %s is missing", signal, ai.label)
+				continue
+			}
+			differs := false
+			for _, field := range sortedKeys(unionFields(ai.fields, bi.fields)) {
+				av, inA := ai.fields[field]
+				bv, inB := bi.fields[field]
+				if inA && inB && av == bv {
+					continue
+				}
+				differs = true
+				d := diffs[signal+"\x00"+field]
+				if d == nil {
+					d = &fieldDiff{signal: signal, field: field}
+					diffs[signal+"\x00"+field] = d
+				}
+				switch {
+				case !inB:
+					d.dropped++
+					example("%s: %s lost %s=%q", signal, ai.label, field, av)
+				case !inA:
+					d.added++
+					example("%s: %s gained %s=%q", signal, ai.label, field, bv)
+				default:
+					d.changed++
+					example("%s: %s has %s=%q instead of %q", signal, ai.label, field, bv, av)
+				}
+			}
+			if differs {
+				changed++
+			}
+		}
+		for _, key := range sortedKeys(b[signal]) {
+			if _, ok := a[signal][key]; !ok {
+				extra++
+				example("%s: %s is extra", signal, b[signal][key].label)
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\n", signal, len(a[signal]), len(b[signal]), missing, extra, changed)
+		if missing+extra+changed > 0 {
+			identical = false
+		}
+	}
+	tw.Flush()
+	if identical {
+		return true
+	}
+
+	if len(diffs) > 0 {
+		fmt.Fprintln(w, "\nField differences:")
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "signal\tfield\tdropped\tadded\tchanged")
+		for _, key := range sortedKeys(diffs) {
+			d := diffs[key]
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\n", d.signal, d.field, d.dropped, d.added, d.changed)
+		}
+		tw.Flush()
+	}
+	fmt.Fprintln(w, "\nDifferences:")
+	for _, e := range examples {
+		fmt.Fprintf(w, "  %s\n", e)
+	}
+	if more > 0 {
+		fmt.Fprintf(w, "  ... and %d more\n", more)
+	}
+	return false
+}
+
+func unionFields(a, b map[string]string) map[string]string {
+	u := maps.Clone(a)
+	maps.Copy(u, b)
+	return u
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	return slices.Sorted(maps.Keys(m))
+}
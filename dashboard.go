@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"golang.org/x/term"
+	"otel-demo/telemetry"
+)
+
+// dashboard is the interactive terminal view of a running workload. It
+// redraws the generated and exported counts a few times a second and lets
+// the keyboard adjust the request and error rates on the fly.
+type dashboard struct {
+	cfg    *telemetry.Config
+	w      *workload
+	stats  *telemetry.ExportStats
+	cancel context.CancelFunc
+	start  time.Time
+
+	mu   sync.Mutex
+	note string // last log line or SDK error, shown under the table
+}
+
+// runDashboard takes over the terminal until the returned function is
+// called. Pressing q (or Ctrl-C) calls cancel, which ends the workload run.
+func runDashboard(cfg *telemetry.Config, w *workload, stats *telemetry.ExportStats, cancel context.CancelFunc) (stop func(), err error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return nil, errors.New("-tui needs an interactive terminal")
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to switch the terminal to raw mode: %w", err)
+	}
+
+	os.Stdout.WriteString("\x1b[2J")
+	d := &dashboard{cfg: cfg, w: w, stats: stats, cancel: cancel, start: time.Now()}
+
+	// Log output and SDK errors would scroll the screen; show the latest
+	// one inside the dashboard instead
+	log.SetOutput(d)
+	prevHandler := otel.GetErrorHandler()
+	// Without the errors the failure hook reports, which would each come
+	// again from the SDK
+	otel.SetErrorHandler(telemetry.SkipReportedErrors(otel.ErrorHandlerFunc(func(err error) { d.setNote("error: " + err.Error()) })))
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(250 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			d.draw()
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	// The read blocks until the next key press, so this goroutine can
+	// outlive stop; it only ever touches the workload and the cancel func
+	go d.readKeys()
+
+	return func() {
+		close(done)
+		wg.Wait()
+		d.draw()
+		term.Restore(fd, state)
+		fmt.Println()
+		log.SetOutput(os.Stderr)
+		otel.SetErrorHandler(prevHandler)
+	}, nil
+}
+
+func (d *dashboard) readKeys() {
+	buf := make([]byte, 16)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return
+		}
+		for _, key := range buf[:n] {
+			d.handleKey(key)
+		}
+	}
+}
+
+func (d *dashboard) handleKey(key byte) {
+	sc := *d.w.scenario.Load()
+	switch key {
+	case '+', '=':
+		sc.Rate *= 1.25
+	case '-', '_':
+		sc.Rate = max(sc.Rate/1.25, 0.1)
+	case '>', '.':
+		sc.ErrorRate = min(sc.ErrorRate+0.05, 1)
+	case '<', ',':
+		sc.ErrorRate = max(sc.ErrorRate-0.05, 0)
+	case 'q', 'Q', 3: // 3 is Ctrl-C, which raw mode delivers as a byte
+		d.setNote("stopping...")
+		d.cancel()
+		return
+	default:
+		return
+	}
+	d.w.setScenario(sc)
+}
+
+// Write implements io.Writer for log output
+func (d *dashboard) Write(p []byte) (int, error) {
+	d.setNote(string(bytes.TrimSpace(p)))
+	return len(p), nil
+}
+
+func (d *dashboard) setNote(s string) {
+	d.mu.Lock()
+	d.note = s
+	d.mu.Unlock()
+}
+
+func (d *dashboard) draw() {
+	sc := d.w.scenario.Load()
+	svc := d.cfg.Service
+
+	var b strings.Builder
+	// Raw mode turns off the \n to \r\n translation, so every line ends in
+	// an explicit \r\n
+	line := func(format string, args ...any) {
+		fmt.Fprintf(&b, format, args...)
+		b.WriteString("\x1b[K\r\n")
+	}
+
+	b.WriteString("\x1b[H")
+	line("clickstack-client   %s %s   instance %s", svc.Name, svc.Version, svc.InstanceID)
+	line("endpoint %s   seed %d   elapsed %s", d.cfg.Exporter.Endpoint, d.cfg.Scenario.Seed, time.Since(d.start).Round(time.Second))
+	line("")
+	line("%-9s %12s %12s %10s %10s %14s", "signal", "generated", "exported", "failed", "rejected", "last export")
+	for _, row := range []struct {
+		name  string
+		stats *telemetry.SignalStats
+	}{
+		{"spans", &d.stats.Spans},
+		{"logs", &d.stats.Logs},
+		{"metrics", &d.stats.Points},
+	} {
+		latency := "-"
+		if ns := row.stats.LastLatency.Load(); ns > 0 {
+			latency = time.Duration(ns).Round(100 * time.Microsecond).String()
+		}
+		line("%-9s %12d %12d %10d %10d %14s", row.name,
+			row.stats.Generated.Load(), row.stats.Exported.Load(), row.stats.Failed.Load(), row.stats.Rejected.Load(), latency)
+	}
+	line("")
+	line("rate %.2f/s   error rate %.2f", sc.Rate, sc.ErrorRate)
+	line("")
+	line("[+/-] rate   [</>] error rate   [q] quit")
+	d.mu.Lock()
+	line("%s", d.note)
+	d.mu.Unlock()
+	b.WriteString("\x1b[J")
+
+	os.Stdout.WriteString(b.String())
+}
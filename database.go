@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+
+	"github.com/XSAM/otelsql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	_ "modernc.org/sqlite"
+	"otel-demo/scenario"
+	"otel-demo/telemetry"
+)
+
+// demoUsers is how many users the demo schema is seeded with
+const demoUsers = 100
+
+// database is the real database behind the simulated requests' queries
+// with scenario.database set. It is opened through otelsql, so every query
+// gets client spans with the statement under the step's database-query
+// span, and the db.sql.* metrics report query latency and the state of the
+// connection pool.
+type database struct {
+	*sql.DB
+	system string // db.system, sqlite or postgresql
+}
+
+// openDatabase opens the configured database and creates and seeds the
+// users table the queries read, if it isn't there yet
+func openDatabase(ctx context.Context, cfg telemetry.DatabaseConfig) (*database, error) {
+	name, dsn, system := "sqlite", cfg.DSN, semconv.DBSystemSqlite
+	if cfg.Driver == "postgres" {
+		name, system = "pgx", semconv.DBSystemPostgreSQL
+	} else if dsn == "" {
+		// Shared, so every connection in the pool sees the same tables
+		dsn = "file:otel-demo?mode=memory&cache=shared"
+	}
+	opts := []otelsql.Option{
+		otelsql.WithAttributes(system),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			OmitConnResetSession: true,
+			OmitRows:             true,
+			// Only queries made for a request, not the setup below or the
+			// pool opening connections on its own
+			SpanFilter: func(ctx context.Context, _ otelsql.Method, _ string, _ []driver.NamedValue) bool {
+				return trace.SpanContextFromContext(ctx).IsValid()
+			},
+		}),
+	}
+	db, err := otelsql.Open(name, dsn, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the %s database: %w", cfg.Driver, err)
+	}
+	if err := otelsql.RegisterDBStatsMetrics(db, opts...); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to register the connection pool metrics: %w", err)
+	}
+
+	values := make([]string, demoUsers)
+	for i := range values {
+		values[i] = fmt.Sprintf("(%d, 'user-%[1]d', 'user-%[1]d@example.com')", i+1)
+	}
+	for _, stmt := range []string{
+		"CREATE TABLE IF NOT EXISTS users (id INTEGER PRIMARY KEY, name TEXT NOT NULL, email TEXT NOT NULL)",
+		"INSERT INTO users (id, name, email) VALUES " + strings.Join(values, ", ") + " ON CONFLICT (id) DO NOTHING",
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to set up the demo schema: %w", err)
+		}
+	}
+	return &database{DB: db, system: system.Value.AsString()}, nil
+}
+
+// userLookup is the workload's user query against the real database: the
+// user with a random id, so a few requests miss and read no rows
+func (db *database) userLookup() scenario.DBCallConfig {
+	return scenario.DBCallConfig{
+		System:    db.system,
+		Name:      "userdb",
+		Operation: "SELECT",
+		Statement: "SELECT id, name, email FROM users WHERE id = $1",
+		DB:        db.DB,
+		Args: func(rng *rand.Rand) []any {
+			return []any{1 + rng.IntN(demoUsers+demoUsers/10)}
+		},
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"path"
+	"slices"
+
+	"otel-demo/telemetry"
+)
+
+// exponentialHistogramViews returns the views of
+// scenario.exponential_histograms, appended to the configured ones: the
+// simulated API's http.client.response.body.size as a base2 exponential
+// histogram, and request_duration_seconds as one more, under
+// request_duration_exponential_seconds, next to its explicit buckets. A
+// configured view matching request_duration_seconds already keeps a
+// stream of it, so it isn't kept again.
+func exponentialHistogramViews(cfg *telemetry.Config) []telemetry.ViewConfig {
+	if !cfg.Scenario.ExponentialHistograms {
+		return cfg.Views
+	}
+	views := append(slices.Clone(cfg.Views),
+		telemetry.ViewConfig{Instrument: "http.client.response.body.size", Aggregation: "base2_exponential_histogram"},
+		telemetry.ViewConfig{Instrument: "request_duration_seconds", Name: "request_duration_exponential_seconds", Aggregation: "base2_exponential_histogram"},
+	)
+	for _, v := range cfg.Views {
+		if ok, _ := path.Match(v.Instrument, "request_duration_seconds"); ok {
+			return views
+		}
+	}
+	// Once a view matches an instrument, only views make its streams
+	return append(views, telemetry.ViewConfig{Instrument: "request_duration_seconds"})
+}
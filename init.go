@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"otel-demo/telemetry"
+)
+
+//go:embed config.example.yaml
+var configTemplate []byte
+
+// initCommand writes the commented sample config, which documents every key
+// with its default value.
+func initCommand() *command {
+	output := "clickstack.yaml"
+	force := false
+	return &command{
+		name:    "init",
+		summary: "write a commented sample config file",
+		flags: func(fs *flag.FlagSet, _ *telemetry.Config) {
+			fs.StringVar(&output, "o", output, "file to write; - prints the template to stdout")
+			fs.BoolVar(&force, "force", force, "overwrite the file if it already exists")
+		},
+		run: func(context.Context, *telemetry.Config, func() (*telemetry.Config, error)) error {
+			if output == "-" {
+				_, err := os.Stdout.Write(configTemplate)
+				return err
+			}
+
+			flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+			if force {
+				flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+			}
+			f, err := os.OpenFile(output, flags, 0o644)
+			if errors.Is(err, os.ErrExist) {
+				return fmt.Errorf("%s already exists; pass -force to overwrite it", output)
+			}
+			if err != nil {
+				return err
+			}
+			if _, err := f.Write(configTemplate); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+
+			fmt.Printf("Wrote %s. Edit it, then run: clickstack-client validate -config %[1]s\n", output)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strconv"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"otel-demo/scenario"
+	"otel-demo/telemetry"
+)
+
+// inventory is a gRPC stock service the simulated requests call over a
+// real connection when scenario.grpc is set. Client and server run in this
+// process on a loopback port, both instrumented with the otelgrpc stats
+// handlers, so the traces hold genuine rpc.* client and server spans and
+// the server continues the caller's trace from the request metadata.
+type inventory struct {
+	server *grpc.Server
+	conn   *grpc.ClientConn
+
+	// current returns the scenario settings, which reloads change
+	current func() *telemetry.ScenarioConfig
+	tracer  trace.Tracer
+	logger  otellog.Logger
+	metrics *scenario.Metrics
+}
+
+const checkStockMethod = "/clickstack.demo.Inventory/CheckStock"
+
+// inventoryServer is what inventoryServiceDesc dispatches to. The messages
+// are protobuf Structs, so the service needs no generated code.
+type inventoryServer interface {
+	checkStock(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error)
+	watchStock(stream grpc.ServerStream) error
+}
+
+var inventoryServiceDesc = grpc.ServiceDesc{
+	ServiceName: "clickstack.demo.Inventory",
+	HandlerType: (*inventoryServer)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "CheckStock",
+		Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			req := new(structpb.Struct)
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return srv.(inventoryServer).checkStock(ctx, req)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: checkStockMethod}
+			return interceptor(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+				return srv.(inventoryServer).checkStock(ctx, req.(*structpb.Struct))
+			})
+		},
+	}},
+	Streams: []grpc.StreamDesc{{
+		StreamName: "WatchStock",
+		Handler: func(srv any, stream grpc.ServerStream) error {
+			return srv.(inventoryServer).watchStock(stream)
+		},
+		ServerStreams: true,
+		ClientStreams: true,
+	}},
+}
+
+// startInventory serves the inventory service on a loopback port and dials
+// it. stop must be called before the providers shut down, so the last
+// spans are ended.
+func startInventory(client *telemetry.Client, current func() *telemetry.ScenarioConfig) (*inventory, error) {
+	inv := &inventory{
+		current: current,
+		tracer:  client.Tracer("otel-demo/inventory"),
+		logger:  client.Logger("otel-demo/inventory"),
+	}
+	var err error
+	if inv.metrics, err = scenario.NewMetrics(client.Meter("otel-demo/inventory")); err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for the inventory service: %w", err)
+	}
+	// Message events show the messages of a stream on its spans
+	events := otelgrpc.WithMessageEvents(otelgrpc.SentEvents, otelgrpc.ReceivedEvents)
+	inv.server = grpc.NewServer(grpc.StatsHandler(otelgrpc.NewServerHandler(events)))
+	inv.server.RegisterService(&inventoryServiceDesc, inv)
+	go inv.server.Serve(ln)
+
+	inv.conn, err = grpc.NewClient(ln.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler(events)))
+	if err != nil {
+		inv.server.Stop()
+		return nil, fmt.Errorf("failed to dial the inventory service: %w", err)
+	}
+	return inv, nil
+}
+
+func (inv *inventory) stop() {
+	inv.conn.Close()
+	inv.server.GracefulStop()
+}
+
+// checkStep returns the step calling CheckStock for a random SKU. The
+// request carries a seed for the server's draws, so seeded runs stay
+// reproducible on both sides of the call.
+func (inv *inventory) checkStep() scenario.Step {
+	return func(ctx context.Context, env *scenario.Env) error {
+		req, err := structpb.NewStruct(map[string]any{
+			"sku":  fmt.Sprintf("sku-%03d", env.Rand.IntN(1000)),
+			"seed": strconv.FormatUint(env.Rand.Uint64(), 10),
+		})
+		if err != nil {
+			return err
+		}
+		if err := inv.conn.Invoke(ctx, checkStockMethod, req, new(structpb.Struct)); err != nil {
+			return fmt.Errorf("inventory check failed: %w", err)
+		}
+		return nil
+	}
+}
+
+// checkStock looks the SKU up in the stock database under the server span
+// and reports it out of stock for the scenario's error rate
+func (inv *inventory) checkStock(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+	sc := inv.current()
+	sku := req.Fields["sku"].GetStringValue()
+	seed, _ := strconv.ParseUint(req.Fields["seed"].GetStringValue(), 10, 64)
+	rng := rand.New(rand.NewPCG(seed, 0))
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("inventory.sku", sku))
+
+	env := &scenario.Env{
+		Tracer:     inv.tracer,
+		Logger:     inv.logger,
+		Metrics:    inv.metrics,
+		Rand:       rng,
+		Attributes: scenarioAttributes(*sc),
+	}
+	err := scenario.DBCall(scenario.DBCallConfig{
+		System:    "postgresql",
+		Name:      "inventorydb",
+		Operation: "SELECT",
+		Statement: "SELECT quantity FROM stock WHERE sku = ?",
+		Latency:   sc.DBLatency,
+	})(ctx, env)
+	if err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+
+	if rng.Float64() < sc.ErrorRate {
+		logRecord(ctx, inv.logger, "SKU out of stock", otellog.SeverityWarn,
+			otellog.String("component", "inventory"),
+			otellog.String("sku", sku))
+		return nil, status.Errorf(codes.FailedPrecondition, "%s is out of stock", sku)
+	}
+	quantity := 1 + rng.IntN(500)
+	logRecord(ctx, inv.logger, "Stock checked", otellog.SeverityInfo,
+		otellog.String("component", "inventory"),
+		otellog.String("sku", sku),
+		otellog.Int("quantity", quantity))
+	return structpb.NewStruct(map[string]any{"sku": sku, "quantity": quantity})
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"otel-demo/scenario"
+)
+
+// maxProbeOverflow bounds a limit exceedLimits tries to go past; a higher
+// one, or none, is left alone rather than building spans that big
+const maxProbeOverflow = 10000
+
+// exceedLimits is the step of scenario.exceed_limits: a limits-probe span
+// that goes past every limit the spans are held to, so what the SDK cuts,
+// and how ClickStack shows it, can be seen. It records a value twice as
+// long as the length limit next to its real length, 8 attributes past the
+// count limit, then 4 events and 4 links past theirs, the last of each
+// with 4 attributes past the per-event and per-link limits. Every
+// attribute, event and link is numbered, so the gaps show what went; the
+// span's limits.* attributes say what was tried, and the run ends with a
+// tally of what was dropped.
+func exceedLimits(limits sdktrace.SpanLimits) scenario.Step {
+	probed := func(limit int) bool { return limit >= 0 && limit <= maxProbeOverflow }
+	return func(ctx context.Context, env *scenario.Env) error {
+		var links []trace.Link
+		if probed(limits.LinkCountLimit) {
+			for i := range limits.LinkCountLimit + 4 {
+				var attrs []attribute.KeyValue
+				if i == limits.LinkCountLimit+3 && probed(limits.AttributePerLinkCountLimit) {
+					attrs = numbered("limits.link_attr", limits.AttributePerLinkCountLimit+4)
+				}
+				links = append(links, trace.Link{
+					SpanContext: randomSpanContext(env),
+					Attributes:  append(attrs, attribute.Int("limits.link", i)),
+				})
+			}
+		}
+		// The probe's own attributes come first, so it's the numbered ones
+		// past the limit that are dropped
+		attrs := []attribute.KeyValue{
+			attribute.Int("limits.attribute_count_limit", limits.AttributeCountLimit),
+			attribute.Int("limits.attribute_value_length_limit", limits.AttributeValueLengthLimit),
+			attribute.Int("limits.event_count_limit", limits.EventCountLimit),
+			attribute.Int("limits.link_count_limit", limits.LinkCountLimit),
+		}
+		if probed(limits.AttributeValueLengthLimit) {
+			long := strings.Repeat("limits-probe-", 2*limits.AttributeValueLengthLimit/13+1)[:2*limits.AttributeValueLengthLimit]
+			attrs = append(attrs,
+				attribute.Int("limits.long_value.length", len(long)),
+				attribute.String("limits.long_value", long),
+			)
+		}
+		attrs = append(attrs, env.Attributes...)
+		if probed(limits.AttributeCountLimit) {
+			attrs = append(attrs, numbered("limits.attr", max(0, limits.AttributeCountLimit+8-len(attrs)))...)
+		}
+		ctx, span := env.Tracer.Start(ctx, "limits-probe",
+			trace.WithAttributes(attrs...),
+			trace.WithLinks(links...))
+		defer span.End()
+
+		if probed(limits.EventCountLimit) {
+			for i := range limits.EventCountLimit + 4 {
+				attrs := []attribute.KeyValue{attribute.Int("limits.event", i)}
+				if i == limits.EventCountLimit+3 && probed(limits.AttributePerEventCountLimit) {
+					attrs = append(attrs, numbered("limits.event_attr", limits.AttributePerEventCountLimit+4)...)
+				}
+				span.AddEvent("limits.event", trace.WithAttributes(attrs...))
+			}
+		}
+		logRecord(ctx, env.Logger, "Limits probe recorded past the span limits", otellog.SeverityInfo,
+			otellog.String("component", "limits"),
+			otellog.Int("attributes", len(attrs)),
+			otellog.Int("links", len(links)))
+		return nil
+	}
+}
+
+// numbered returns n attributes keyed prefix.000, prefix.001 and so on
+func numbered(prefix string, n int) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, n)
+	for i := range attrs {
+		attrs[i] = attribute.Int(fmt.Sprintf("%s.%03d", prefix, i), i)
+	}
+	return attrs
+}
+
+// randomSpanContext is a sampled span context of a trace that doesn't
+// exist, for the probe's links to point at
+func randomSpanContext(env *scenario.Env) trace.SpanContext {
+	var tid trace.TraceID
+	var sid trace.SpanID
+	for i := range tid {
+		tid[i] = byte(env.Rand.UintN(256))
+	}
+	for i := range sid {
+		sid[i] = byte(env.Rand.UintN(256))
+	}
+	return trace.NewSpanContext(trace.SpanContextConfig{TraceID: tid, SpanID: sid, TraceFlags: trace.FlagsSampled})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/trace"
+	"otel-demo/telemetry"
+)
+
+// runLongJobs runs the jobs of scenario.long_running one after another
+// until ctx is done, which interrupts the one in progress
+func (w *workload) runLongJobs(ctx context.Context, cfg telemetry.LongRunningConfig) {
+	// A source of its own, apart from the requests', keeps seeded runs
+	// reproducible
+	rng := rand.New(rand.NewPCG(w.seed, math.MaxUint64-1))
+	for n := 1; ctx.Err() == nil; n++ {
+		w.longJob(ctx, cfg, rng, n)
+	}
+}
+
+// longJob runs one migration under a root span that stays open for the
+// whole job. Every heartbeat a batch of rows is migrated under a child
+// span, exported while the job's span is still in flight, and the job's
+// span gets a progress event, with a log record of the progress.
+func (w *workload) longJob(ctx context.Context, cfg telemetry.LongRunningConfig, rng *rand.Rand, n int) {
+	sc := *w.scenario.Load()
+	batches := int(cfg.Duration / cfg.Heartbeat)
+	// Ended after ctx is done, so the span mustn't be tied to it
+	jobCtx, span := w.tracer.Start(context.WithoutCancel(ctx), "schema-migration",
+		trace.WithNewRoot(),
+		trace.WithAttributes(
+			attribute.String("job.name", "schema-migration"),
+			attribute.Int("job.run", n),
+			attribute.Int("job.batches", batches),
+			attribute.Float64("job.expected_duration_s", cfg.Duration.Seconds()),
+		),
+		trace.WithAttributes(scenarioAttributes(sc)...))
+	defer span.End()
+	w.emit(jobCtx, sc, fmt.Sprintf("Schema migration %d started, expected to take %s", n, cfg.Duration), otellog.SeverityInfo,
+		otellog.String("component", "migration"))
+
+	var rows int64
+	for i := 1; i <= batches; i++ {
+		_, batch := w.tracer.Start(jobCtx, "migrate-batch",
+			trace.WithAttributes(attribute.Int("job.batch", i)),
+			trace.WithAttributes(scenarioAttributes(sc)...))
+		select {
+		case <-ctx.Done():
+			batch.SetStatus(codes.Error, "interrupted")
+			batch.End()
+			percent := 100 * (i - 1) / batches
+			span.SetStatus(codes.Error, fmt.Sprintf("interrupted at %d%%", percent))
+			span.SetAttributes(attribute.Int64("job.rows_processed", rows))
+			w.emit(jobCtx, sc, fmt.Sprintf("Schema migration %d interrupted at %d%%", n, percent), otellog.SeverityWarn,
+				otellog.String("component", "migration"),
+				otellog.Int64("rows_processed", rows))
+			return
+		case <-time.After(cfg.Heartbeat):
+		}
+		migrated := 1000 + rng.Int64N(9000)
+		rows += migrated
+		batch.SetAttributes(attribute.Int64("job.rows_migrated", migrated))
+		batch.End()
+
+		percent := 100 * i / batches
+		span.AddEvent("progress", trace.WithAttributes(
+			attribute.Int("job.progress.percent", percent),
+			attribute.Int64("job.rows_processed", rows),
+		))
+		w.emit(jobCtx, sc, fmt.Sprintf("Schema migration %d at %d%%", n, percent), otellog.SeverityInfo,
+			otellog.String("component", "migration"),
+			otellog.Int("progress_percent", percent),
+			otellog.Int64("rows_processed", rows))
+	}
+	span.SetStatus(codes.Ok, "")
+	span.SetAttributes(attribute.Int64("job.rows_processed", rows))
+	w.emit(jobCtx, sc, fmt.Sprintf("Schema migration %d completed, %d rows migrated", n, rows), otellog.SeverityInfo,
+		otellog.String("component", "migration"),
+		otellog.Int64("rows_processed", rows))
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"otel-demo/telemetry"
+)
+
+// loopbackReceiver is an in-process OTLP receiver, over gRPC and HTTP, that
+// a run can export to instead of a collector. It counts what arrives and
+// checks it for mistakes a collector would choke on or ClickStack would
+// store wrongly, so CI can verify the generator without external services.
+type loopbackReceiver struct {
+	grpcLn, httpLn net.Listener
+	grpcServer     *grpc.Server
+	httpServer     *http.Server
+
+	mu       sync.Mutex
+	received map[string]int64
+	problems []string
+	dropped  int // problems beyond the ones kept for the report
+
+	// Span IDs seen and the parents referenced but not seen yet, per
+	// trace, to find spans whose parent never arrived. Only the first
+	// loopbackMaxSpans spans are tracked; untracked counts the others.
+	spanIDs   map[string]bool
+	parents   map[string]string // parent span ID -> the span referencing it
+	untracked int
+	// orphans is set when scenario.orphans leaves parents out on purpose,
+	// so the missing ones are counted rather than reported as problems
+	orphans bool
+	// exemplars are the spans the metric exemplars link to, by trace and
+	// span ID, with how many link to each, for up to loopbackMaxSpans
+	// spans; unlinked counts the exemplars linking to others
+	exemplars map[string]int
+	unlinked  int
+}
+
+const (
+	// loopbackMaxProblems bounds how many problems are kept for the report
+	loopbackMaxProblems = 20
+	// loopbackMaxSpans bounds how many spans, and spans exemplars link
+	// to, are kept to check the links against, so a long run doesn't
+	// grow the receiver without end
+	loopbackMaxSpans = 100000
+)
+
+// startLoopback starts the receiver on ephemeral localhost ports and points
+// every signal of cfg at it. Mirrors and the spool are turned off, since
+// the point is not to need anything outside the process.
+func startLoopback(cfg *telemetry.Config) (*loopbackReceiver, error) {
+	r := &loopbackReceiver{
+		received: map[string]int64{},
+		spanIDs:  map[string]bool{},
+		parents:  map[string]string{},
+
+		exemplars: map[string]int{},
+	}
+	if o := cfg.Scenario.Orphans; o.MissingRoot > 0 || o.DroppedParent > 0 {
+		r.orphans = true
+	}
+	var err error
+	if r.grpcLn, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		return nil, fmt.Errorf("failed to start loopback receiver: %w", err)
+	}
+	if r.httpLn, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		r.grpcLn.Close()
+		return nil, fmt.Errorf("failed to start loopback receiver: %w", err)
+	}
+
+	r.grpcServer = grpc.NewServer()
+	coltracepb.RegisterTraceServiceServer(r.grpcServer, loopbackTraceService{r: r})
+	collogspb.RegisterLogsServiceServer(r.grpcServer, loopbackLogsService{r: r})
+	colmetricpb.RegisterMetricsServiceServer(r.grpcServer, loopbackMetricsService{r: r})
+	go r.grpcServer.Serve(r.grpcLn)
+
+	mux := http.NewServeMux()
+	for _, signal := range []string{"traces", "logs", "metrics"} {
+		mux.HandleFunc("POST /v1/"+signal, func(w http.ResponseWriter, req *http.Request) {
+			r.serveHTTP(w, req, signal)
+		})
+	}
+	r.httpServer = &http.Server{Handler: mux}
+	go r.httpServer.Serve(r.httpLn)
+
+	insecure := true
+	cfg.Exporter.Insecure = &insecure
+	cfg.Exporter.Mirrors = nil
+	cfg.Exporter.Spool.Dir = ""
+	for _, ep := range []*telemetry.EndpointConfig{&cfg.Exporter.Traces, &cfg.Exporter.Logs, &cfg.Exporter.Metrics} {
+		ep.Type = "otlp"
+		ep.Insecure = nil
+		ep.Endpoint = "http://" + r.grpcLn.Addr().String()
+		if strings.HasPrefix(cfg.Exporter.Resolve(*ep).Protocol, "http/") {
+			// The path is left off so the usual /v1/<signal> is appended
+			ep.Endpoint = "http://" + r.httpLn.Addr().String()
+		}
+	}
+	return r, nil
+}
+
+func (r *loopbackReceiver) stop() {
+	r.grpcServer.Stop()
+	r.httpServer.Close()
+}
+
+func (r *loopbackReceiver) serveHTTP(w http.ResponseWriter, req *http.Request, signal string) {
+	var body io.Reader = req.Body
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = zr
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	msg := telemetry.NewExportRequest(signal)
+	jsonBody := strings.HasPrefix(req.Header.Get("Content-Type"), "application/json")
+	if jsonBody {
+		err = telemetry.UnmarshalOTLPJSON(b, msg)
+	} else {
+		err = proto.Unmarshal(b, msg)
+	}
+	if err != nil {
+		r.problem("%s: undecodable export request: %v", signal, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.check(msg)
+
+	resp := telemetry.NewExportResponse(signal)
+	if jsonBody {
+		b, err = telemetry.MarshalOTLPJSON(resp)
+	} else {
+		b, err = proto.Marshal(resp)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", req.Header.Get("Content-Type"))
+	w.Write(b)
+}
+
+type loopbackTraceService struct {
+	coltracepb.UnimplementedTraceServiceServer
+	r *loopbackReceiver
+}
+
+func (s loopbackTraceService) Export(_ context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	s.r.check(req)
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+type loopbackLogsService struct {
+	collogspb.UnimplementedLogsServiceServer
+	r *loopbackReceiver
+}
+
+func (s loopbackLogsService) Export(_ context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	s.r.check(req)
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+type loopbackMetricsService struct {
+	colmetricpb.UnimplementedMetricsServiceServer
+	r *loopbackReceiver
+}
+
+func (s loopbackMetricsService) Export(_ context.Context, req *colmetricpb.ExportMetricsServiceRequest) (*colmetricpb.ExportMetricsServiceResponse, error) {
+	s.r.check(req)
+	return &colmetricpb.ExportMetricsServiceResponse{}, nil
+}
+
+func (r *loopbackReceiver) problem(format string, args ...any) {
+	if len(r.problems) >= loopbackMaxProblems {
+		r.dropped++
+		return
+	}
+	r.problems = append(r.problems, fmt.Sprintf(format, args...))
+}
+
+// check counts the items in an export request and records what's wrong
+// with them
+func (r *loopbackReceiver) check(msg proto.Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch req := msg.(type) {
+	case *coltracepb.ExportTraceServiceRequest:
+		for _, rs := range req.ResourceSpans {
+			r.checkResource("traces", rs.Resource)
+			for _, ss := range rs.ScopeSpans {
+				for _, s := range ss.Spans {
+					r.received["traces"]++
+					r.checkSpan(s.Name, s.TraceId, s.SpanId, s.ParentSpanId, s.StartTimeUnixNano, s.EndTimeUnixNano)
+				}
+			}
+		}
+	case *collogspb.ExportLogsServiceRequest:
+		for _, rl := range req.ResourceLogs {
+			r.checkResource("logs", rl.Resource)
+			for _, sl := range rl.ScopeLogs {
+				for _, l := range sl.LogRecords {
+					r.received["logs"]++
+					if l.TimeUnixNano == 0 && l.ObservedTimeUnixNano == 0 {
+						r.problem("logs: record %q has no timestamp", l.Body.GetStringValue())
+					}
+					if l.SeverityNumber < 0 || l.SeverityNumber > 24 {
+						r.problem("logs: record %q has severity number %d", l.Body.GetStringValue(), l.SeverityNumber)
+					}
+					if len(l.TraceId) > 0 && (!validID(l.TraceId, 16) || !validID(l.SpanId, 8)) {
+						r.problem("logs: record %q has an invalid trace context", l.Body.GetStringValue())
+					}
+				}
+			}
+		}
+	case *colmetricpb.ExportMetricsServiceRequest:
+		for _, rm := range req.ResourceMetrics {
+			r.checkResource("metrics", rm.Resource)
+			for _, sm := range rm.ScopeMetrics {
+				for _, m := range sm.Metrics {
+					r.received["metrics"] += int64(metricDataPoints(m))
+					r.checkMetric(m)
+				}
+			}
+		}
+	}
+}
+
+func (r *loopbackReceiver) checkResource(signal string, res *resourcepb.Resource) {
+	for _, kv := range res.GetAttributes() {
+		if kv.Key == "service.name" && kv.Value.GetStringValue() != "" {
+			return
+		}
+	}
+	r.problem("%s: resource without service.name", signal)
+}
+
+func (r *loopbackReceiver) checkSpan(name string, traceID, spanID, parentID []byte, start, end uint64) {
+	switch {
+	case name == "":
+		r.problem("traces: span %x has no name", spanID)
+	case !validID(traceID, 16):
+		r.problem("traces: span %q has an invalid trace ID %x", name, traceID)
+	case !validID(spanID, 8):
+		r.problem("traces: span %q has an invalid span ID %x", name, spanID)
+	case len(parentID) > 0 && !validID(parentID, 8):
+		r.problem("traces: span %q has an invalid parent span ID %x", name, parentID)
+	case start == 0 || end < start:
+		r.problem("traces: span %q ends before it starts", name)
+	}
+	key := string(traceID) + string(spanID)
+	// A parent usually arrives after its children, which end first
+	delete(r.parents, key)
+	if len(r.spanIDs) >= loopbackMaxSpans {
+		// Its children aren't tracked either: their parent would look
+		// missing
+		r.untracked++
+		return
+	}
+	r.spanIDs[key] = true
+	if parent := string(traceID) + string(parentID); len(parentID) > 0 && !r.spanIDs[parent] {
+		r.parents[parent] = name
+	}
+}
+
+func (r *loopbackReceiver) checkMetric(m *metricspb.Metric) {
+	if m.Name == "" {
+		r.problem("metrics: metric without a name")
+		return
+	}
+	checkTime := func(t uint64) {
+		if t == 0 {
+			r.problem("metrics: %s has a data point without a timestamp", m.Name)
+		}
+	}
+	checkExemplars := func(exemplars []*metricspb.Exemplar) {
+		for _, e := range exemplars {
+			switch {
+			case len(e.TraceId) == 0 && len(e.SpanId) == 0:
+				// Recorded outside a span
+			case !validID(e.TraceId, 16) || !validID(e.SpanId, 8):
+				r.problem("metrics: %s has an exemplar with an invalid trace context", m.Name)
+			default:
+				key := string(e.TraceId) + string(e.SpanId)
+				if _, ok := r.exemplars[key]; !ok && len(r.exemplars) >= loopbackMaxSpans {
+					r.unlinked++
+					continue
+				}
+				r.exemplars[key]++
+			}
+		}
+	}
+	switch data := m.Data.(type) {
+	case *metricspb.Metric_Gauge:
+		for _, dp := range data.Gauge.DataPoints {
+			checkTime(dp.TimeUnixNano)
+			checkExemplars(dp.Exemplars)
+		}
+	case *metricspb.Metric_Sum:
+		for _, dp := range data.Sum.DataPoints {
+			checkTime(dp.TimeUnixNano)
+			checkExemplars(dp.Exemplars)
+		}
+	case *metricspb.Metric_ExponentialHistogram:
+		for _, dp := range data.ExponentialHistogram.DataPoints {
+			checkTime(dp.TimeUnixNano)
+			checkExemplars(dp.Exemplars)
+		}
+	case *metricspb.Metric_Histogram:
+		for _, dp := range data.Histogram.DataPoints {
+			checkTime(dp.TimeUnixNano)
+			checkExemplars(dp.Exemplars)
+			if len(dp.BucketCounts) != len(dp.ExplicitBounds)+1 {
+				r.problem("metrics: %s has %d buckets for %d bounds", m.Name, len(dp.BucketCounts), len(dp.ExplicitBounds))
+			}
+			var total uint64
+			for _, c := range dp.BucketCounts {
+				total += c
+			}
+			if total != dp.Count {
+				r.problem("metrics: %s buckets add up to %d, count is %d", m.Name, total, dp.Count)
+			}
+		}
+	}
+}
+
+// validID reports whether id is a non-zero ID of n bytes
+func validID(id []byte, n int) bool {
+	return len(id) == n && !bytes.Equal(id, make([]byte, n))
+}
+
+// report compares what the receiver got with what the exporters delivered
+// and prints the problems found. It returns an error if there were any, so
+// a loopback run can gate CI.
+func (r *loopbackReceiver) report(w io.Writer, stats *telemetry.ExportStats) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	missing := 0
+	for _, key := range slices.Sorted(maps.Keys(r.parents)) {
+		if r.orphans {
+			missing++
+			continue
+		}
+		r.problem("traces: the parent of span %q was never exported", r.parents[key])
+	}
+
+	fmt.Fprintln(w, "\nLoopback report:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "signal\texported\treceived")
+	mismatch := false
+	for _, s := range []struct {
+		signal string
+		stats  *telemetry.SignalStats
+	}{{"traces", &stats.Spans}, {"logs", &stats.Logs}, {"metrics", &stats.Points}} {
+		exported := s.stats.Exported.Load()
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", s.signal, exported, r.received[s.signal])
+		if exported != r.received[s.signal] {
+			mismatch = true
+		}
+	}
+	tw.Flush()
+	if missing > 0 {
+		fmt.Fprintf(w, "  %d parent spans were never exported, as scenario.orphans asks\n", missing)
+	}
+	if r.untracked > 0 {
+		fmt.Fprintf(w, "  %d spans past the first %d weren't checked for their parents\n", r.untracked, loopbackMaxSpans)
+	}
+	if len(r.exemplars) > 0 {
+		var exemplars, linked int
+		for key, n := range r.exemplars {
+			exemplars += n
+			if r.spanIDs[key] {
+				linked += n
+			}
+		}
+		// Spans still open when the run is cut short, or left out on
+		// purpose, never arrive, so the ones missing aren't a problem
+		fmt.Fprintf(w, "  %d of %d metric exemplars link to spans received\n", linked, exemplars)
+		if r.unlinked > 0 {
+			fmt.Fprintf(w, "  %d exemplars linking to spans past the first %d weren't checked\n", r.unlinked, loopbackMaxSpans)
+		}
+	}
+
+	for _, p := range r.problems {
+		fmt.Fprintf(w, "  %s\n", p)
+	}
+	if r.dropped > 0 {
+		fmt.Fprintf(w, "  ... and %d more\n", r.dropped)
+	}
+	switch {
+	case len(r.problems) > 0:
+		return fmt.Errorf("loopback: %d problems in the exported telemetry", len(r.problems)+r.dropped)
+	case mismatch:
+		return errors.New("loopback: the receiver didn't get what the exporters reported as exported")
+	}
+	fmt.Fprintln(w, "All exported telemetry was received and is well-formed")
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// testID returns an n-byte ID numbered i, valid for any i
+func testID(n int, i uint64) []byte {
+	id := make([]byte, n)
+	binary.BigEndian.PutUint64(id[n-8:], i+1)
+	return id
+}
+
+func TestLoopbackResolvesParents(t *testing.T) {
+	r := &loopbackReceiver{spanIDs: map[string]bool{}, parents: map[string]string{}}
+	trace := testID(16, 0)
+	// Children end, and arrive, before their parent
+	r.checkSpan("child", trace, testID(8, 2), testID(8, 1), 1, 2)
+	r.checkSpan("late child", trace, testID(8, 3), testID(8, 1), 1, 2)
+	if len(r.parents) != 1 {
+		t.Fatalf("%d parents pending, want 1", len(r.parents))
+	}
+	r.checkSpan("parent", trace, testID(8, 1), nil, 1, 3)
+	r.checkSpan("after its parent", trace, testID(8, 4), testID(8, 1), 1, 2)
+	if len(r.parents) != 0 || len(r.problems) != 0 {
+		t.Errorf("parents %v and problems %v pending, want none", r.parents, r.problems)
+	}
+}
+
+func TestLoopbackBoundsSpans(t *testing.T) {
+	r := &loopbackReceiver{spanIDs: map[string]bool{}, parents: map[string]string{}}
+	for i := range uint64(loopbackMaxSpans + 10) {
+		r.checkSpan("span", testID(16, i), testID(8, 0), testID(8, 1), 1, 2)
+	}
+	if len(r.spanIDs) != loopbackMaxSpans || len(r.parents) != loopbackMaxSpans || r.untracked != 10 {
+		t.Errorf("%d spans, %d parents and %d untracked, want %d, %[4]d and 10", len(r.spanIDs), len(r.parents), r.untracked, loopbackMaxSpans)
+	}
+}
+
+func TestLoopbackBoundsExemplars(t *testing.T) {
+	r := &loopbackReceiver{exemplars: map[string]int{}}
+	for i := range uint64(loopbackMaxSpans + 10) {
+		r.checkMetric(exemplarMetric(testID(16, i), testID(8, 0)))
+	}
+	// Spans already tracked are still counted
+	r.checkMetric(exemplarMetric(testID(16, 0), testID(8, 0)))
+	if len(r.exemplars) != loopbackMaxSpans || r.unlinked != 10 || r.exemplars[string(testID(16, 0))+string(testID(8, 0))] != 2 {
+		t.Errorf("%d exemplar spans and %d unlinked, want %d and 10", len(r.exemplars), r.unlinked, loopbackMaxSpans)
+	}
+}
+
+func exemplarMetric(traceID, spanID []byte) *metricspb.Metric {
+	return &metricspb.Metric{Name: "requests_total", Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+		DataPoints: []*metricspb.NumberDataPoint{{TimeUnixNano: 1, Exemplars: []*metricspb.Exemplar{{TraceId: traceID, SpanId: spanID}}}},
+	}}}
+}
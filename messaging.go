@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"otel-demo/scenario"
+	"otel-demo/telemetry"
+)
+
+// drainTimeout is how long stop waits for the consumer to process the
+// messages published so far
+const drainTimeout = 10 * time.Second
+
+// runHeader marks the messages of this run, so draining doesn't count
+// messages other runs left in the topic
+const runHeader = "otel-demo-run"
+
+// messaging publishes an order event to Kafka from every simulated request
+// with scenario.kafka set, and consumes the events in the same process the
+// way a downstream service would. The trace context travels in the message
+// headers: each publish is a producer span in the request's trace, and each
+// message is processed under a consumer span starting a trace of its own,
+// linked to the producer span, as asynchronous work is traced. The consumer
+// lag is reported per partition.
+type messaging struct {
+	cfg    telemetry.KafkaConfig
+	writer *kafka.Writer
+	reader *kafka.Reader
+
+	// current returns the scenario settings, which reloads change
+	current func() *telemetry.ScenarioConfig
+	tracer  trace.Tracer
+	logger  otellog.Logger
+	metrics *scenario.Metrics
+
+	run       string
+	published atomic.Int64
+	processed atomic.Int64 // of those published
+	lagMu     sync.Mutex
+	lag       map[int]int64 // by partition
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// startMessaging checks a broker answers, then starts the consumer. stop
+// must be called before the providers shut down.
+func startMessaging(ctx context.Context, cfg telemetry.KafkaConfig, client *telemetry.Client, current func() *telemetry.ScenarioConfig) (*messaging, error) {
+	dialCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	conn, err := kafka.DialContext(dialCtx, "tcp", cfg.Brokers[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach Kafka at %s: %w", cfg.Brokers[0], err)
+	}
+	conn.Close()
+
+	m := &messaging{
+		cfg:     cfg,
+		current: current,
+		tracer:  client.Tracer("otel-demo/messaging"),
+		logger:  client.Logger("otel-demo/messaging"),
+		run:     strconv.FormatUint(rand.Uint64(), 16),
+		lag:     map[int]int64{},
+		done:    make(chan struct{}),
+	}
+	meter := client.Meter("otel-demo/messaging")
+	if m.metrics, err = scenario.NewMetrics(meter); err != nil {
+		return nil, err
+	}
+	_, err = meter.Int64ObservableGauge(
+		"messaging.kafka.consumer.lag",
+		metric.WithDescription("Messages in the partition the consumer group has yet to process"),
+		metric.WithUnit("{message}"),
+		metric.WithInt64Callback(func(_ context.Context, observer metric.Int64Observer) error {
+			m.lagMu.Lock()
+			defer m.lagMu.Unlock()
+			for partition, lag := range m.lag {
+				observer.Observe(lag, metric.WithAttributes(
+					attribute.String("messaging.system", "kafka"),
+					attribute.String("messaging.destination.name", cfg.Topic),
+					attribute.String("messaging.kafka.consumer.group", cfg.Group),
+					attribute.String("messaging.destination.partition.id", strconv.Itoa(partition)),
+				))
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the consumer lag gauge: %w", err)
+	}
+
+	m.writer = &kafka.Writer{
+		Addr:                   kafka.TCP(cfg.Brokers...),
+		Topic:                  cfg.Topic,
+		Balancer:               &kafka.Hash{},
+		RequiredAcks:           kafka.RequireOne,
+		AllowAutoTopicCreation: true,
+		// Each request publishes one message and waits for it
+		BatchTimeout: 10 * time.Millisecond,
+	}
+	m.reader = kafka.NewReader(kafka.ReaderConfig{
+		Brokers: cfg.Brokers,
+		Topic:   cfg.Topic,
+		GroupID: cfg.Group,
+		MaxWait: 500 * time.Millisecond,
+	})
+	ctx, m.cancel = context.WithCancel(context.Background())
+	go m.consume(ctx)
+	return m, nil
+}
+
+// stop waits up to drainTimeout for the consumer to catch up with what
+// was published, then closes the producer and consumer
+func (m *messaging) stop() {
+	deadline := time.Now().Add(drainTimeout)
+	for m.processed.Load() < m.published.Load() && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	m.writer.Close()
+	m.cancel()
+	<-m.done
+	m.reader.Close()
+}
+
+// publishStep returns the step publishing the request's order event under
+// a producer span, whose context the message headers carry
+func (m *messaging) publishStep() scenario.Step {
+	return func(ctx context.Context, env *scenario.Env) error {
+		sc := m.current()
+		key := sc.UserID
+		value := fmt.Sprintf(`{"order_id":%d,"user_id":%q}`, env.Rand.Int64N(1_000_000), sc.UserID)
+		ctx, span := env.Tracer.Start(ctx, m.cfg.Topic+" publish",
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(
+				attribute.String("messaging.system", "kafka"),
+				attribute.String("messaging.destination.name", m.cfg.Topic),
+				attribute.String("messaging.operation", "publish"),
+				attribute.String("messaging.kafka.message.key", key),
+				attribute.Int("messaging.message.body.size", len(value)),
+			),
+			trace.WithAttributes(env.Attributes...))
+		defer span.End()
+
+		msg := kafka.Message{Key: []byte(key), Value: []byte(value), Headers: []kafka.Header{{Key: runHeader, Value: []byte(m.run)}}}
+		otel.GetTextMapPropagator().Inject(ctx, headerCarrier{&msg.Headers})
+		start := time.Now()
+		if err := m.writer.WriteMessages(ctx, msg); err != nil {
+			telemetry.RecordError(span, err)
+			if ctx.Err() != nil {
+				return fmt.Errorf("publish to %s interrupted: %w", m.cfg.Topic, err)
+			}
+			return fmt.Errorf("publish to %s failed: %w", m.cfg.Topic, err)
+		}
+		m.published.Add(1)
+		if env.Metrics != nil {
+			env.Metrics.Duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(env.Attributes...), metric.WithAttributes(
+				attribute.String("operation", "queue_publish"),
+				attribute.String("messaging.system", "kafka"),
+			))
+		}
+		logRecord(ctx, env.Logger, "Order event published", otellog.SeverityDebug,
+			otellog.String("component", "messaging"),
+			otellog.String("destination", m.cfg.Topic))
+		return nil
+	}
+}
+
+// consume processes messages until ctx is done, committing each one
+func (m *messaging) consume(ctx context.Context) {
+	defer close(m.done)
+	for {
+		msg, err := m.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				logRecord(ctx, m.logger, fmt.Sprintf("Failed to fetch from %s: %v", m.cfg.Topic, err), otellog.SeverityError,
+					otellog.String("component", "consumer"))
+				time.Sleep(time.Second)
+				continue
+			}
+			return
+		}
+		m.lagMu.Lock()
+		m.lag[msg.Partition] = max(msg.HighWaterMark-msg.Offset-1, 0)
+		m.lagMu.Unlock()
+
+		m.process(ctx, msg)
+		if err := m.reader.CommitMessages(ctx, msg); err != nil && ctx.Err() == nil {
+			logRecord(ctx, m.logger, fmt.Sprintf("Failed to commit the offset: %v", err), otellog.SeverityWarn,
+				otellog.String("component", "consumer"))
+		}
+		if (headerCarrier{&msg.Headers}).Get(runHeader) == m.run {
+			m.processed.Add(1)
+		}
+	}
+}
+
+// process handles one order event under a consumer span linked to the
+// span that published it
+func (m *messaging) process(ctx context.Context, msg kafka.Message) {
+	sc := m.current()
+	opts := []trace.SpanStartOption{
+		trace.WithNewRoot(),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "kafka"),
+			attribute.String("messaging.destination.name", msg.Topic),
+			attribute.String("messaging.operation", "process"),
+			attribute.String("messaging.kafka.consumer.group", m.cfg.Group),
+			attribute.String("messaging.destination.partition.id", strconv.Itoa(msg.Partition)),
+			attribute.Int64("messaging.kafka.message.offset", msg.Offset),
+			attribute.String("messaging.kafka.message.key", string(msg.Key)),
+			attribute.Int("messaging.message.body.size", len(msg.Value)),
+		),
+		trace.WithAttributes(scenarioAttributes(*sc)...),
+	}
+	producer := trace.SpanContextFromContext(otel.GetTextMapPropagator().Extract(ctx, headerCarrier{&msg.Headers}))
+	if producer.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: producer}))
+	}
+	ctx, span := m.tracer.Start(ctx, msg.Topic+" process", opts...)
+	defer span.End()
+
+	env := &scenario.Env{
+		Tracer:     m.tracer,
+		Logger:     m.logger,
+		Metrics:    m.metrics,
+		Rand:       rand.New(rand.NewPCG(uint64(msg.Partition), uint64(msg.Offset))),
+		Attributes: scenarioAttributes(*sc),
+	}
+	err := scenario.DBCall(scenario.DBCallConfig{
+		System:    "postgresql",
+		Name:      "orderdb",
+		Operation: "INSERT",
+		Statement: "INSERT INTO order_events (order_id, payload) VALUES (?, ?)",
+		Latency:   sc.DBLatency,
+	})(ctx, env)
+	if err != nil {
+		telemetry.RecordError(span, err)
+		if !errors.Is(err, context.Canceled) {
+			logRecord(ctx, m.logger, fmt.Sprintf("Failed to process the order event: %v", err), otellog.SeverityError,
+				otellog.String("component", "consumer"))
+		}
+		return
+	}
+	logRecord(ctx, m.logger, "Order event processed", otellog.SeverityInfo,
+		otellog.String("component", "consumer"),
+		otellog.Int64("offset", msg.Offset),
+		otellog.Int("partition", msg.Partition))
+}
+
+// headerCarrier carries the trace context in Kafka message headers
+type headerCarrier struct {
+	headers *[]kafka.Header
+}
+
+func (c headerCarrier) Get(key string) string {
+	for _, h := range *c.headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c headerCarrier) Set(key, value string) {
+	for i, h := range *c.headers {
+		if h.Key == key {
+			(*c.headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c.headers = append(*c.headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, len(*c.headers))
+	for i, h := range *c.headers {
+		keys[i] = h.Key
+	}
+	return keys
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"math/rand/v2"
+
+	"otel-demo/telemetry"
+)
+
+// orphan is how a request's trace is broken with scenario.orphans
+type orphan int
+
+const (
+	orphanNone orphan = iota
+	// orphanMissingRoot never ends the root span
+	orphanMissingRoot
+	// orphanDroppedParent never ends a span between the root and the work
+	orphanDroppedParent
+)
+
+// drawOrphan picks how the request's trace is broken, if at all. A span
+// that never ends is never exported, as when a process dies part way
+// through a request, so the spans referring to it are left without their
+// parent. Nothing is drawn without scenario.orphans, keeping seeded runs
+// as they were.
+func drawOrphan(sc telemetry.ScenarioConfig, rng *rand.Rand) orphan {
+	o := sc.Orphans
+	if o.MissingRoot == 0 && o.DroppedParent == 0 {
+		return orphanNone
+	}
+	switch r := rng.Float64(); {
+	case r < o.MissingRoot:
+		return orphanMissingRoot
+	case r < o.MissingRoot+o.DroppedParent:
+		return orphanDroppedParent
+	}
+	return orphanNone
+}
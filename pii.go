@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+
+	"go.opentelemetry.io/otel/attribute"
+	"otel-demo/telemetry"
+)
+
+// testCardNumbers are the card networks' published test numbers, written
+// the ways users type them
+var testCardNumbers = []string{
+	"4111 1111 1111 1111",
+	"5555-5555-5555-4444",
+	"378282246310005",
+	"6011111111111117",
+}
+
+// piiAttributes are the fake personal data of scenario.pii, the kind a
+// careless handler records and a redact processor should catch
+func piiAttributes(sc telemetry.ScenarioConfig, rng *rand.Rand) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("user.email", fmt.Sprintf("user%s.%d@example.com", sc.UserID, rng.IntN(1000))),
+		attribute.String("payment.card_number", testCardNumbers[rng.IntN(len(testCardNumbers))]),
+		attribute.String("http.request.header.authorization", fmt.Sprintf("Bearer %016x%016x", rng.Uint64(), rng.Uint64())),
+		attribute.String("request.note", fmt.Sprintf("refund to user%s@example.com, card ending %04d", sc.UserID, rng.IntN(10000))),
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"otel-demo/scenario"
+	"otel-demo/telemetry"
+)
+
+// queue simulates a message queue in process for scenario.queue: each
+// request publishes a fulfillment message under a producer span, and a
+// consumer processes it once its delay has passed, under a consumer span
+// starting a trace of its own and linked to the producer span, the way
+// queue-based systems appear in ClickStack. The trace context travels in
+// the message headers, as it would through a broker.
+type queue struct {
+	cfg telemetry.QueueConfig
+	// current returns the scenario settings, which reloads change
+	current func() *telemetry.ScenarioConfig
+	tracer  trace.Tracer
+	logger  otellog.Logger
+	metrics *scenario.Metrics
+
+	pending sync.WaitGroup
+}
+
+// queueMessage is a published message waiting for the consumer
+type queueMessage struct {
+	id        string
+	headers   propagation.MapCarrier
+	published time.Time
+	// seeds of the consumer's random source, drawn by the request
+	seed1, seed2 uint64
+}
+
+func newQueue(cfg telemetry.QueueConfig, client *telemetry.Client, current func() *telemetry.ScenarioConfig) (*queue, error) {
+	q := &queue{
+		cfg:     cfg,
+		current: current,
+		tracer:  client.Tracer("otel-demo/queue"),
+		logger:  client.Logger("otel-demo/queue"),
+	}
+	var err error
+	if q.metrics, err = scenario.NewMetrics(client.Meter("otel-demo/queue")); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// stop waits for the consumer to process every message published so far
+func (q *queue) stop() {
+	q.pending.Wait()
+}
+
+// publishStep returns the step publishing the request's fulfillment
+// message under a producer span, whose context the message headers carry
+func (q *queue) publishStep() scenario.Step {
+	return func(ctx context.Context, env *scenario.Env) error {
+		msg := &queueMessage{
+			id:      fmt.Sprintf("%016x", env.Rand.Uint64()),
+			headers: propagation.MapCarrier{},
+			seed1:   env.Rand.Uint64(),
+			seed2:   env.Rand.Uint64(),
+		}
+		ctx, span := env.Tracer.Start(ctx, q.cfg.Destination+" publish",
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(
+				attribute.String("messaging.system", "rabbitmq"),
+				attribute.String("messaging.destination.name", q.cfg.Destination),
+				attribute.String("messaging.operation", "publish"),
+				attribute.String("messaging.message.id", msg.id),
+			),
+			trace.WithAttributes(env.Attributes...))
+		defer span.End()
+
+		otel.GetTextMapPropagator().Inject(ctx, msg.headers)
+		msg.published = time.Now()
+		q.pending.Add(1)
+		time.AfterFunc(q.cfg.Delay.Sample(env.Rand), func() {
+			defer q.pending.Done()
+			q.process(msg)
+		})
+		logRecord(ctx, env.Logger, "Fulfillment message published", otellog.SeverityDebug,
+			otellog.String("component", "messaging"),
+			otellog.String("destination", q.cfg.Destination),
+			otellog.String("message_id", msg.id))
+		return nil
+	}
+}
+
+// process handles a message under a consumer span linked to the span that
+// published it, recording how long the message waited in the queue
+func (q *queue) process(msg *queueMessage) {
+	sc := q.current()
+	ctx := context.Background()
+	opts := []trace.SpanStartOption{
+		trace.WithNewRoot(),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "rabbitmq"),
+			attribute.String("messaging.destination.name", q.cfg.Destination),
+			attribute.String("messaging.operation", "process"),
+			attribute.String("messaging.message.id", msg.id),
+			attribute.Int64("messaging.message.queue_time_ms", time.Since(msg.published).Milliseconds()),
+		),
+		trace.WithAttributes(scenarioAttributes(*sc)...),
+	}
+	producer := trace.SpanContextFromContext(otel.GetTextMapPropagator().Extract(ctx, msg.headers))
+	if producer.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: producer}))
+	}
+	ctx, span := q.tracer.Start(ctx, q.cfg.Destination+" process", opts...)
+	defer span.End()
+
+	env := &scenario.Env{
+		Tracer:     q.tracer,
+		Logger:     q.logger,
+		Metrics:    q.metrics,
+		Rand:       rand.New(rand.NewPCG(msg.seed1, msg.seed2)),
+		Attributes: scenarioAttributes(*sc),
+		SpanEvents: sc.SpanEvents,
+	}
+	err := scenario.DBCall(scenario.DBCallConfig{
+		System:    "postgresql",
+		Name:      "fulfillmentdb",
+		Operation: "INSERT",
+		Statement: "INSERT INTO fulfillments (message_id, status) VALUES (?, 'pending')",
+		Latency:   sc.DBLatency,
+	})(ctx, env)
+	if err != nil {
+		telemetry.RecordError(span, err)
+		logRecord(ctx, q.logger, fmt.Sprintf("Failed to process the fulfillment message: %v", err), otellog.SeverityError,
+			otellog.String("component", "consumer"),
+			otellog.String("message_id", msg.id))
+		return
+	}
+	logRecord(ctx, q.logger, "Fulfillment message processed", otellog.SeverityInfo,
+		otellog.String("component", "consumer"),
+		otellog.String("message_id", msg.id))
+}
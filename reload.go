@@ -0,0 +1,80 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+
+	"otel-demo/telemetry"
+)
+
+// watchReload re-reads the configuration whenever the process receives
+// SIGHUP and hands the new scenario settings to the running workload. The
+// providers and their connections are left alone, so only the scenario
+// section can change at runtime; edits elsewhere, against the config as
+// parsed at startup, are reported and ignored until the next start. The
+// returned function stops watching.
+func watchReload(current, parsed *telemetry.Config, tui bool, w *workload, reload func() (*telemetry.Config, error)) (stop func()) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-sighup:
+			}
+
+			cfg, err := reload()
+			if err != nil {
+				log.Printf("Config reload failed, keeping the current settings: %v", err)
+				continue
+			}
+
+			sc, restart := reloadedScenario(current, parsed, tui, cfg)
+			w.setScenario(sc)
+			log.Printf("Config reloaded: rate=%g/s error_rate=%g duration=%s forever=%t attributes=%v",
+				sc.Rate, sc.ErrorRate, sc.Duration, sc.Forever, sc.Attributes)
+			if restart {
+				log.Printf("Config reload: only the scenario section is applied at runtime; restart to pick up the other changes")
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sighup)
+		close(done)
+	}
+}
+
+// reloadedScenario returns the scenario of the reloaded cfg as the run
+// goes on with it, keeping what was fixed at startup, and whether cfg
+// changes anything outside the scenario from parsed, the config the run
+// started from before it was set up
+func reloadedScenario(current, parsed *telemetry.Config, tui bool, cfg *telemetry.Config) (telemetry.ScenarioConfig, bool) {
+	next := *cfg
+	next.Scenario = parsed.Scenario
+	restart := !reflect.DeepEqual(&next, parsed)
+
+	sc := cfg.Scenario
+	if current.Scenario.Backfill.Window > 0 {
+		// The backfill's length was fixed at startup
+		sc.Backfill, sc.Duration, sc.Forever = current.Scenario.Backfill, current.Scenario.Duration, false
+	}
+	if tui {
+		keepDashboardRunning(&sc)
+	}
+	return sc, restart
+}
+
+// keepDashboardRunning makes a scenario of a single request run until the
+// dashboard is quit, since a dashboard over one request has nothing to show
+func keepDashboardRunning(sc *telemetry.ScenarioConfig) {
+	if !sc.Continuous() {
+		sc.Forever = true
+	}
+}
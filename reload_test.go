@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"otel-demo/telemetry"
+)
+
+func TestReloadedScenarioKeepsTheDashboardRunning(t *testing.T) {
+	parsed := telemetry.DefaultConfig()
+	current := parsed.Clone()
+	keepDashboardRunning(&current.Scenario)
+
+	reloaded := parsed.Clone()
+	reloaded.Scenario.Rate = 50
+	sc, restart := reloadedScenario(current, parsed, true, reloaded)
+	if !sc.Forever || sc.Rate != 50 {
+		t.Errorf("reloaded under -tui with forever %t and rate %g, want true and 50", sc.Forever, sc.Rate)
+	}
+	if restart {
+		t.Error("a scenario change asked for a restart")
+	}
+
+	// A duration set in the file is kept
+	reloaded.Scenario.Duration = time.Minute
+	if sc, _ := reloadedScenario(current, parsed, true, reloaded); sc.Forever || sc.Duration != time.Minute {
+		t.Errorf("reloaded with forever %t and duration %s, want false and 1m", sc.Forever, sc.Duration)
+	}
+	if sc, _ := reloadedScenario(current, parsed, false, parsed.Clone()); sc.Forever {
+		t.Error("reloaded without -tui runs forever")
+	}
+}
+
+func TestReloadedScenarioComparesWithTheParsedConfig(t *testing.T) {
+	parsed := telemetry.DefaultConfig()
+	// As the run sets itself up after parsing
+	current := parsed.Clone()
+	current.Views = exponentialHistogramViews(current)
+	current.Exporter.Endpoint = "127.0.0.1:43170"
+	current.Service.EnsureInstanceID()
+	current.Scenario.Seed = 22
+
+	if _, restart := reloadedScenario(current, parsed, false, parsed.Clone()); restart {
+		t.Error("reloading the unchanged file asked for a restart")
+	}
+	changed := parsed.Clone()
+	changed.Exporter.Endpoint = "collector:4317"
+	if _, restart := reloadedScenario(current, parsed, false, changed); !restart {
+		t.Error("a new endpoint didn't ask for a restart")
+	}
+}
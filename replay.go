@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+	"otel-demo/telemetry"
+)
+
+// replayCommand re-exports recorded OTLP data, such as the file exporter's
+// output, the collector's file exporter output or spooled batches, to the
+// configured OTLP endpoints.
+func replayCommand() *command {
+	var inputs []string
+	signal := ""
+	rewrite := false
+	return &command{
+		name:    "replay",
+		summary: "re-export OTLP JSON or protobuf files to the configured endpoint",
+		flags: func(fs *flag.FlagSet, cfg *telemetry.Config) {
+			// The flags are bound once per parsing pass
+			inputs = nil
+			bindExporterFlags(fs, cfg)
+			fs.Func("input", "OTLP `file` to replay (repeatable): JSON lines, protobuf with a .pb/.proto/.bin extension, or a -record directory", func(s string) error {
+				inputs = append(inputs, s)
+				return nil
+			})
+			fs.StringVar(&signal, "signal", signal, "signal in protobuf inputs: traces, logs or metrics; defaults to the name of the file's directory")
+			fs.BoolVar(&rewrite, "rewrite-timestamps", rewrite, "shift each file's timestamps so its latest one is now, keeping the spacing between them")
+		},
+		run: func(ctx context.Context, cfg *telemetry.Config, _ func() (*telemetry.Config, error)) error {
+			if len(inputs) == 0 {
+				return errors.New("nothing to replay: pass at least one -input file")
+			}
+			if signal != "" && signal != "traces" && signal != "logs" && signal != "metrics" {
+				return fmt.Errorf("-signal must be traces, logs or metrics, got %q", signal)
+			}
+
+			r := &replayer{cfg: cfg, senders: map[string]func(context.Context, []byte) error{}, items: map[string]int{}}
+			defer r.close()
+			for _, path := range inputs {
+				batches, err := readOTLPInput(path, signal)
+				if err != nil {
+					return err
+				}
+				if rewrite {
+					shiftTimestamps(batches, time.Now())
+				}
+				for i, b := range batches {
+					if err := r.send(ctx, b); err != nil {
+						return fmt.Errorf("%s: batch %d: %w", path, i+1, err)
+					}
+				}
+			}
+			fmt.Printf("Replayed %d batches: %d spans, %d log records and %d metric data points\n",
+				r.batches, r.items["traces"], r.items["logs"], r.items["metrics"])
+			return nil
+		},
+	}
+}
+
+// otlpBatch is one export request read back from a file
+type otlpBatch struct {
+	signal string
+	msg    proto.Message // *tracepb.TracesData, *logspb.LogsData or *metricspb.MetricsData
+}
+
+// replayer sends batches to each signal's resolved endpoint, connecting to
+// it on first use
+type replayer struct {
+	cfg      *telemetry.Config
+	senders  map[string]func(context.Context, []byte) error
+	releases []func() error
+	batches  int
+	items    map[string]int
+}
+
+func (r *replayer) send(ctx context.Context, b otlpBatch) error {
+	send, ok := r.senders[b.signal]
+	if !ok {
+		ep := r.cfg.Exporter.Resolve(map[string]telemetry.EndpointConfig{
+			"traces":  r.cfg.Exporter.Traces,
+			"logs":    r.cfg.Exporter.Logs,
+			"metrics": r.cfg.Exporter.Metrics,
+		}[b.signal])
+		if ep.Type != "otlp" {
+			return fmt.Errorf("%s exporter is %s, but replay only sends to OTLP endpoints", b.signal, ep.Type)
+		}
+		var release func() error
+		var err error
+		if send, release, err = telemetry.NewRequestSender(ctx, ep, b.signal); err != nil {
+			return err
+		}
+		r.senders[b.signal] = send
+		r.releases = append(r.releases, release)
+	}
+
+	// The *Data messages have the same wire format as the export requests
+	data, err := proto.Marshal(b.msg)
+	if err != nil {
+		return err
+	}
+	if err := send(ctx, data); err != nil {
+		return err
+	}
+	r.batches++
+	r.items[b.signal] += batchItems(b.msg)
+	return nil
+}
+
+func (r *replayer) close() {
+	for _, release := range r.releases {
+		release()
+	}
+}
+
+// readOTLPInput reads the batches in path, a file or a directory written
+// by -record or -spool-dir. A directory's .pb files are read from its
+// signal subdirectories and put back in the order they were written, which
+// their names record, so a run is replayed as it went out.
+func readOTLPInput(path, signal string) ([]otlpBatch, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return readOTLPFile(path, signal)
+	}
+	var files []string
+	for _, s := range []string{"traces", "logs", "metrics"} {
+		matches, err := filepath.Glob(filepath.Join(path, s, "*.pb"))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: no recorded batches in traces, logs or metrics", path)
+	}
+	sort.Slice(files, func(i, j int) bool { return filepath.Base(files[i]) < filepath.Base(files[j]) })
+	var batches []otlpBatch
+	for _, f := range files {
+		b, err := readOTLPFile(f, "")
+		if err != nil {
+			return nil, err
+		}
+		batches = append(batches, b...)
+	}
+	return batches, nil
+}
+
+// readOTLPFile reads the batches in path. JSON files hold one object per
+// line: a TracesData, LogsData or MetricsData as the collector writes them,
+// or a single ResourceSpans, ResourceLogs or ResourceMetrics as the file
+// exporter does. Protobuf files are either a stream of messages with a
+// 4-byte big-endian length prefix each, the collector's format, or a single
+// message like a spooled batch; their signal comes from signal or the
+// directory name.
+func readOTLPFile(path, signal string) ([]otlpBatch, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pb", ".proto", ".bin":
+		if signal == "" {
+			signal = filepath.Base(filepath.Dir(path))
+		}
+		if signal != "traces" && signal != "logs" && signal != "metrics" {
+			return nil, fmt.Errorf("%s: can't tell which signal the protobuf data is; pass -signal", path)
+		}
+		batches, err := readProtoMessages(data, signal)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return batches, nil
+	}
+
+	var batches []otlpBatch
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, len(data)+1)
+	for line := 1; sc.Scan(); line++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		b, err := parseJSONBatch(sc.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		batches = append(batches, b)
+	}
+	return batches, nil
+}
+
+// parseJSONBatch picks the message type from the line's top-level keys
+func parseJSONBatch(line []byte) (otlpBatch, error) {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(line, &keys); err != nil {
+		return otlpBatch{}, err
+	}
+	has := func(names ...string) bool {
+		for _, name := range names {
+			if _, ok := keys[name]; ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	var b otlpBatch
+	switch {
+	case has("resourceSpans", "resource_spans"):
+		b = otlpBatch{"traces", &tracepb.TracesData{}}
+	case has("resourceLogs", "resource_logs"):
+		b = otlpBatch{"logs", &logspb.LogsData{}}
+	case has("resourceMetrics", "resource_metrics"):
+		b = otlpBatch{"metrics", &metricspb.MetricsData{}}
+	case has("scopeSpans", "scope_spans"):
+		rs := &tracepb.ResourceSpans{}
+		if err := telemetry.UnmarshalOTLPJSON(line, rs); err != nil {
+			return otlpBatch{}, err
+		}
+		return otlpBatch{"traces", &tracepb.TracesData{ResourceSpans: []*tracepb.ResourceSpans{rs}}}, nil
+	case has("scopeLogs", "scope_logs"):
+		rl := &logspb.ResourceLogs{}
+		if err := telemetry.UnmarshalOTLPJSON(line, rl); err != nil {
+			return otlpBatch{}, err
+		}
+		return otlpBatch{"logs", &logspb.LogsData{ResourceLogs: []*logspb.ResourceLogs{rl}}}, nil
+	case has("scopeMetrics", "scope_metrics"):
+		rm := &metricspb.ResourceMetrics{}
+		if err := telemetry.UnmarshalOTLPJSON(line, rm); err != nil {
+			return otlpBatch{}, err
+		}
+		return otlpBatch{"metrics", &metricspb.MetricsData{ResourceMetrics: []*metricspb.ResourceMetrics{rm}}}, nil
+	default:
+		return otlpBatch{}, errors.New("not an OTLP traces, logs or metrics object")
+	}
+	if err := telemetry.UnmarshalOTLPJSON(line, b.msg); err != nil {
+		return otlpBatch{}, err
+	}
+	return b, nil
+}
+
+func readProtoMessages(data []byte, signal string) ([]otlpBatch, error) {
+	var batches []otlpBatch
+	add := func(b []byte) error {
+		msg := newDataMessage(signal)
+		if err := proto.Unmarshal(b, msg); err != nil {
+			return err
+		}
+		batches = append(batches, otlpBatch{signal, msg})
+		return nil
+	}
+
+	// A length-prefixed stream has to account for every byte; anything
+	// else is read as a single message
+	for rest := data; ; {
+		if len(rest) == 0 {
+			return batches, nil
+		}
+		if len(rest) < 4 || int(binary.BigEndian.Uint32(rest)) > len(rest)-4 {
+			break
+		}
+		n := int(binary.BigEndian.Uint32(rest))
+		if err := add(rest[4 : 4+n]); err != nil {
+			break
+		}
+		rest = rest[4+n:]
+	}
+	batches = nil
+	if err := add(data); err != nil {
+		return nil, err
+	}
+	return batches, nil
+}
+
+func newDataMessage(signal string) proto.Message {
+	switch signal {
+	case "traces":
+		return &tracepb.TracesData{}
+	case "logs":
+		return &logspb.LogsData{}
+	default:
+		return &metricspb.MetricsData{}
+	}
+}
+
+// shiftTimestamps moves every timestamp in batches by the same amount so
+// the latest lands on now. Unset (zero) timestamps stay unset.
+func shiftTimestamps(batches []otlpBatch, now time.Time) {
+	var latest uint64
+	for _, b := range batches {
+		visitTimestamps(b.msg, func(ts *uint64) { latest = max(latest, *ts) })
+	}
+	if latest == 0 {
+		return
+	}
+	delta := uint64(now.UnixNano()) - latest
+	for _, b := range batches {
+		visitTimestamps(b.msg, func(ts *uint64) {
+			if *ts != 0 {
+				*ts += delta
+			}
+		})
+	}
+}
+
+// visitTimestamps calls fn for every timestamp field in msg
+func visitTimestamps(msg proto.Message, fn func(*uint64)) {
+	switch m := msg.(type) {
+	case *tracepb.TracesData:
+		for _, rs := range m.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, s := range ss.Spans {
+					fn(&s.StartTimeUnixNano)
+					fn(&s.EndTimeUnixNano)
+					for _, e := range s.Events {
+						fn(&e.TimeUnixNano)
+					}
+				}
+			}
+		}
+	case *logspb.LogsData:
+		for _, rl := range m.ResourceLogs {
+			for _, sl := range rl.ScopeLogs {
+				for _, r := range sl.LogRecords {
+					fn(&r.TimeUnixNano)
+					fn(&r.ObservedTimeUnixNano)
+				}
+			}
+		}
+	case *metricspb.MetricsData:
+		for _, rm := range m.ResourceMetrics {
+			for _, sm := range rm.ScopeMetrics {
+				for _, metric := range sm.Metrics {
+					visitDataPointTimestamps(metric, fn)
+				}
+			}
+		}
+	}
+}
+
+func visitDataPointTimestamps(m *metricspb.Metric, fn func(*uint64)) {
+	exemplars := func(es []*metricspb.Exemplar) {
+		for _, e := range es {
+			fn(&e.TimeUnixNano)
+		}
+	}
+	switch d := m.Data.(type) {
+	case *metricspb.Metric_Gauge:
+		for _, dp := range d.Gauge.DataPoints {
+			fn(&dp.StartTimeUnixNano)
+			fn(&dp.TimeUnixNano)
+			exemplars(dp.Exemplars)
+		}
+	case *metricspb.Metric_Sum:
+		for _, dp := range d.Sum.DataPoints {
+			fn(&dp.StartTimeUnixNano)
+			fn(&dp.TimeUnixNano)
+			exemplars(dp.Exemplars)
+		}
+	case *metricspb.Metric_Histogram:
+		for _, dp := range d.Histogram.DataPoints {
+			fn(&dp.StartTimeUnixNano)
+			fn(&dp.TimeUnixNano)
+			exemplars(dp.Exemplars)
+		}
+	case *metricspb.Metric_ExponentialHistogram:
+		for _, dp := range d.ExponentialHistogram.DataPoints {
+			fn(&dp.StartTimeUnixNano)
+			fn(&dp.TimeUnixNano)
+			exemplars(dp.Exemplars)
+		}
+	case *metricspb.Metric_Summary:
+		for _, dp := range d.Summary.DataPoints {
+			fn(&dp.StartTimeUnixNano)
+			fn(&dp.TimeUnixNano)
+		}
+	}
+}
+
+// batchItems counts the spans, log records or data points in msg
+func batchItems(msg proto.Message) int {
+	n := 0
+	switch m := msg.(type) {
+	case *tracepb.TracesData:
+		for _, rs := range m.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				n += len(ss.Spans)
+			}
+		}
+	case *logspb.LogsData:
+		for _, rl := range m.ResourceLogs {
+			for _, sl := range rl.ScopeLogs {
+				n += len(sl.LogRecords)
+			}
+		}
+	case *metricspb.MetricsData:
+		for _, rm := range m.ResourceMetrics {
+			for _, sm := range rm.ScopeMetrics {
+				for _, metric := range sm.Metrics {
+					n += metricDataPoints(metric)
+				}
+			}
+		}
+	}
+	return n
+}
+
+func metricDataPoints(m *metricspb.Metric) int {
+	switch d := m.Data.(type) {
+	case *metricspb.Metric_Gauge:
+		return len(d.Gauge.DataPoints)
+	case *metricspb.Metric_Sum:
+		return len(d.Sum.DataPoints)
+	case *metricspb.Metric_Histogram:
+		return len(d.Histogram.DataPoints)
+	case *metricspb.Metric_ExponentialHistogram:
+		return len(d.ExponentialHistogram.DataPoints)
+	case *metricspb.Metric_Summary:
+		return len(d.Summary.DataPoints)
+	}
+	return 0
+}
@@ -0,0 +1,69 @@
+package scenario
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The chances of the occasional events of simulated work, with
+// Env.SpanEvents set
+const (
+	lockWaitChance = 0.25
+	retryChance    = 0.15
+	gcPauseChance  = 0.1
+)
+
+// at returns a point a fraction of the way through the d from start, drawn
+// between lo and hi, for events that happened part way through a step
+func at(rng *rand.Rand, start time.Time, d time.Duration, lo, hi float64) time.Time {
+	return start.Add(time.Duration((lo + (hi-lo)*rng.Float64()) * float64(d)))
+}
+
+// cacheLookup records a lookup of key in the named cache as the step
+// starts
+func cacheLookup(span trace.Span, start time.Time, name, key string, hit bool) {
+	span.AddEvent("cache.lookup", trace.WithTimestamp(start), trace.WithAttributes(
+		attribute.String("cache.name", name),
+		attribute.String("cache.key", key),
+		attribute.Bool("cache.hit", hit),
+	))
+}
+
+// lockWait sometimes records the query waiting for a lock of mode, the
+// event marking when it was granted
+func lockWait(span trace.Span, rng *rand.Rand, start time.Time, d time.Duration, mode string) {
+	if rng.Float64() >= lockWaitChance {
+		return
+	}
+	granted := at(rng, start, d, 0.1, 0.4)
+	span.AddEvent("lock.wait", trace.WithTimestamp(granted), trace.WithAttributes(
+		attribute.String("db.lock.mode", mode),
+		attribute.Int64("db.lock.wait_ms", granted.Sub(start).Milliseconds()),
+	))
+}
+
+// retry records attempt being retried after failing with reason, followed
+// by a backoff
+func retry(span trace.Span, ts time.Time, attempt int, reason string, backoff time.Duration) {
+	span.AddEvent("retry", trace.WithTimestamp(ts), trace.WithAttributes(
+		attribute.Int("retry.attempt", attempt),
+		attribute.String("retry.reason", reason),
+		attribute.Int64("retry.backoff_ms", backoff.Milliseconds()),
+	))
+}
+
+// gcPause sometimes records a garbage collection pausing the step
+func gcPause(span trace.Span, rng *rand.Rand, start time.Time, d time.Duration) {
+	if rng.Float64() >= gcPauseChance {
+		return
+	}
+	heap := int64(64+rng.IntN(192)) << 20
+	span.AddEvent("gc.pause", trace.WithTimestamp(at(rng, start, d, 0, 1)), trace.WithAttributes(
+		attribute.Float64("runtime.gc.pause_ms", 0.2+rng.Float64()*4.8),
+		attribute.Int64("runtime.gc.heap_before_bytes", heap),
+		attribute.Int64("runtime.gc.heap_after_bytes", heap*int64(40+rng.IntN(30))/100),
+	))
+}
@@ -0,0 +1,119 @@
+package scenario
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"otel-demo/telemetry"
+)
+
+// HedgeConfig describes hedged requests: up to Attempts copies of a step,
+// a new one started whenever Delay passes with no copy done, or as soon as
+// one fails.
+type HedgeConfig struct {
+	Attempts int
+	Delay    time.Duration
+}
+
+// Hedge runs step as a hedged request, as clients cutting their tail
+// latency do, under a hedged-request span. Each copy runs under a
+// hedge-attempt span of its own with hedge.attempt, side by side with the
+// others. The first copy to succeed wins and the ones still running are
+// cancelled: their hedge-attempt spans get a hedge.cancelled event naming
+// the winner, their status left unset as cancelling them was no failure,
+// and copies not yet started never are. The step's own spans under a
+// cancelled copy record the cancellation as they would any. When every
+// copy fails the request fails with the last one's error.
+func Hedge(cfg HedgeConfig, step Step) Step {
+	return func(ctx context.Context, env *Env) error {
+		ctx, span := env.Tracer.Start(ctx, "hedged-request",
+			trace.WithAttributes(
+				attribute.Int("hedge.max_attempts", cfg.Attempts),
+				attribute.Int64("hedge.delay_ms", cfg.Delay.Milliseconds()),
+			),
+			trace.WithAttributes(env.Attributes...))
+		defer span.End()
+
+		// Every copy draws from a generator of its own, made up front so
+		// that seeded runs draw the same whichever copies start
+		envs := make([]Env, cfg.Attempts)
+		for i := range envs {
+			envs[i] = *env
+			envs[i].Rand = rand.New(rand.NewPCG(env.Rand.Uint64(), env.Rand.Uint64()))
+		}
+
+		hedgeCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		type result struct {
+			attempt int
+			err     error
+		}
+		results := make(chan result, cfg.Attempts)
+		var attempts []trace.Span
+		var next <-chan time.Time
+		start := func() {
+			i := len(attempts)
+			attemptCtx, attempt := env.Tracer.Start(hedgeCtx, "hedge-attempt",
+				trace.WithAttributes(attribute.Int("hedge.attempt", i+1)),
+				trace.WithAttributes(env.Attributes...))
+			attempts = append(attempts, attempt)
+			go func() { results <- result{i, step(attemptCtx, &envs[i])} }()
+			next = nil
+			if len(attempts) < cfg.Attempts {
+				next = time.After(cfg.Delay)
+			}
+		}
+
+		start()
+		winner, running := -1, 1
+		var err error
+		for winner < 0 && running > 0 {
+			select {
+			case <-next:
+				start()
+				running++
+			case r := <-results:
+				running--
+				attempt := attempts[r.attempt]
+				if r.err == nil {
+					winner = r.attempt
+					attempt.SetAttributes(attribute.String("hedge.outcome", "won"))
+					attempt.End()
+					break
+				}
+				err = r.err
+				attempt.SetAttributes(attribute.String("hedge.outcome", "failed"))
+				attempt.SetStatus(codes.Error, r.err.Error())
+				attempt.End()
+				if len(attempts) < cfg.Attempts && ctx.Err() == nil {
+					start()
+					running++
+				}
+			}
+		}
+		span.SetAttributes(attribute.Int("hedge.attempts", len(attempts)))
+		if winner < 0 {
+			telemetry.RecordError(span, err)
+			return fmt.Errorf("hedged request failed after %d attempts: %w", len(attempts), err)
+		}
+
+		cancelled := time.Now()
+		cancel()
+		for ; running > 0; running-- {
+			r := <-results
+			attempt := attempts[r.attempt]
+			attempt.AddEvent("hedge.cancelled", trace.WithTimestamp(cancelled), trace.WithAttributes(
+				attribute.Int("hedge.winner", winner+1),
+			))
+			attempt.SetAttributes(attribute.String("hedge.outcome", "cancelled"))
+			attempt.End()
+		}
+		span.SetAttributes(attribute.Int("hedge.winner", winner+1))
+		return nil
+	}
+}
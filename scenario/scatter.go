@@ -0,0 +1,109 @@
+package scenario
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"otel-demo/telemetry"
+)
+
+// ScatterGatherConfig shapes a scatter-gather request: Width calls to the
+// shards of a downstream service at once, each taking Latency, or
+// StragglerLatency for the StragglerRate fraction of them that straggle.
+type ScatterGatherConfig struct {
+	Width            int
+	Latency          telemetry.LatencyRange
+	StragglerRate    float64
+	StragglerLatency telemetry.LatencyRange
+}
+
+// gatherPerResult is how long merging each shard's result takes
+const gatherPerResult = 50 * time.Microsecond
+
+// ScatterGather fans a request out to the shards and aggregates their
+// results, the wide and shallow trace of a search or a scatter-gather
+// service: a scatter-gather span with Width shard-call client spans side
+// by side under it, made concurrently, then a gather span once the last of
+// them, a straggler more often than not, has answered. Each shard-call
+// carries scatter.index and scatter.straggler, and records its duration
+// under operation shard_call.
+func ScatterGather(cfg ScatterGatherConfig) Step {
+	return func(ctx context.Context, env *Env) error {
+		ctx, span := env.Tracer.Start(ctx, "scatter-gather",
+			trace.WithAttributes(attribute.Int("scatter.width", cfg.Width)),
+			trace.WithAttributes(env.Attributes...))
+		defer span.End()
+
+		stragglers := make([]bool, cfg.Width)
+		calls := make([]Step, cfg.Width)
+		for i := range calls {
+			calls[i] = func(ctx context.Context, env *Env) error {
+				stragglers[i] = env.Rand.Float64() < cfg.StragglerRate
+				return cfg.shard(ctx, env, i, stragglers[i])
+			}
+		}
+		if err := Parallel(calls...)(ctx, env); err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return fmt.Errorf("scatter-gather interrupted: %w", err)
+		}
+
+		var n int
+		for _, s := range stragglers {
+			if s {
+				n++
+			}
+		}
+		gatherCtx, gather := env.Tracer.Start(ctx, "gather",
+			trace.WithAttributes(
+				attribute.Int("gather.results", cfg.Width),
+				attribute.Int("gather.stragglers", n),
+			),
+			trace.WithAttributes(env.Attributes...))
+		// Merging takes longer the more results there are
+		err := wait(gatherCtx, time.Duration(cfg.Width)*gatherPerResult)
+		if err != nil {
+			telemetry.RecordError(gather, err)
+		}
+		gather.End()
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return fmt.Errorf("scatter-gather interrupted: %w", err)
+		}
+		span.SetAttributes(attribute.Int("scatter.stragglers", n))
+		return nil
+	}
+}
+
+// shard is the call to the shard at index
+func (cfg ScatterGatherConfig) shard(ctx context.Context, env *Env, index int, straggler bool) error {
+	shard := fmt.Sprintf("shard-%02d", index)
+	ctx, span := env.Tracer.Start(ctx, "shard-call",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.Int("scatter.index", index),
+			attribute.Bool("scatter.straggler", straggler),
+			attribute.String("server.address", shard),
+			attribute.String("peer.service", "search-"+shard),
+		),
+		trace.WithAttributes(env.Attributes...))
+	defer span.End()
+
+	latency := cfg.Latency
+	if straggler {
+		latency = cfg.StragglerLatency
+	}
+	start := time.Now()
+	if err := wait(ctx, latency.Sample(env.Rand)); err != nil {
+		telemetry.RecordError(span, err)
+		return err
+	}
+	env.recordDuration(ctx, time.Since(start),
+		attribute.String("operation", "shard_call"),
+		attribute.Bool("scatter.straggler", straggler),
+	)
+	return nil
+}
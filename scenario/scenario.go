@@ -0,0 +1,191 @@
+// Package scenario scripts simulated workloads out of small building
+// blocks, so teams can reproduce the shape of their own services' traffic
+// against ClickStack. A Step is one piece of work such as a database query
+// or an outgoing HTTP call, reported as a span with its logs and metrics;
+// Sequence and Parallel combine steps into a request:
+//
+//	checkout := scenario.Sequence(
+//		scenario.DBCall(scenario.DBCallConfig{System: "postgresql", Name: "orders", Operation: "SELECT", Latency: dbLatency}),
+//		scenario.Parallel(
+//			scenario.HTTPCall(scenario.HTTPCallConfig{Method: "POST", URL: "https://payments.internal/charge", Latency: apiLatency}),
+//			scenario.QueuePublish(scenario.QueuePublishConfig{System: "kafka", Destination: "order-events", Latency: queueLatency}),
+//		),
+//	)
+//	err := checkout(ctx, env)
+//
+// Every wait ends early when ctx is done, with the step's span ended and
+// its status set to the context's error.
+package scenario
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"otel-demo/telemetry"
+)
+
+// Step is one piece of simulated work. It reports through env, under the
+// span in ctx, and returns an error when the simulated work failed or ctx
+// was done before it finished.
+type Step func(ctx context.Context, env *Env) error
+
+// Env is what steps report through. Rand drives every random draw, so a
+// seeded source makes the run reproducible; it isn't safe for concurrent
+// use, which Parallel takes care of.
+type Env struct {
+	Tracer  trace.Tracer
+	Logger  otellog.Logger
+	Metrics *Metrics // nil records no metrics
+	Rand    *rand.Rand
+
+	// Attributes go on every span, log record and measurement
+	Attributes []attribute.KeyValue
+	// SpanEvents adds the events of the simulated work to the steps'
+	// spans: cache lookups, lock waits, retries and garbage collection
+	// pauses, timestamped at points during the work
+	SpanEvents bool
+}
+
+// Metrics are the instruments steps record to
+type Metrics struct {
+	// Duration is request_duration_seconds, by operation
+	Duration metric.Float64Histogram
+	// Connections is active_connections, by connection_type
+	Connections metric.Int64UpDownCounter
+	// ResponseSize is http.client.response.body.size, the bytes of the
+	// simulated API answers that record it
+	ResponseSize metric.Int64Histogram
+}
+
+// NewMetrics creates the instruments steps record to from meter
+func NewMetrics(meter metric.Meter) (*Metrics, error) {
+	m := &Metrics{}
+	var err error
+	m.Duration, err = meter.Float64Histogram(
+		"request_duration_seconds",
+		metric.WithDescription("Duration of requests"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create histogram: %w", err)
+	}
+
+	m.Connections, err = meter.Int64UpDownCounter(
+		"active_connections",
+		metric.WithDescription("Number of active connections"),
+		metric.WithUnit("1"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create up-down counter: %w", err)
+	}
+
+	m.ResponseSize, err = meter.Int64Histogram(
+		"http.client.response.body.size",
+		metric.WithDescription("Size of HTTP client response bodies"),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create histogram: %w", err)
+	}
+	return m, nil
+}
+
+// Sequence runs steps one after the other, stopping at the first that
+// fails
+func Sequence(steps ...Step) Step {
+	return func(ctx context.Context, env *Env) error {
+		for _, step := range steps {
+			if err := step(ctx, env); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Parallel runs steps concurrently and waits for all of them, returning
+// their errors joined. Each step gets its own random source, split from
+// env's before any of them starts, so seeded runs stay reproducible.
+func Parallel(steps ...Step) Step {
+	return func(ctx context.Context, env *Env) error {
+		errs := make([]error, len(steps))
+		envs := make([]Env, len(steps))
+		for i := range steps {
+			envs[i] = *env
+			envs[i].Rand = rand.New(rand.NewPCG(env.Rand.Uint64(), env.Rand.Uint64()))
+		}
+		var wg sync.WaitGroup
+		for i, step := range steps {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = step(ctx, &envs[i])
+			}()
+		}
+		wg.Wait()
+		return errors.Join(errs...)
+	}
+}
+
+// Sleep waits for a latency drawn from latency without reporting anything,
+// standing in for work the service does between calls
+func Sleep(latency telemetry.LatencyRange) Step {
+	return func(ctx context.Context, env *Env) error {
+		return wait(ctx, latency.Sample(env.Rand))
+	}
+}
+
+// wait waits for d, returning early with ctx's error if ctx is done first
+func wait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// emit logs message through env's logger, appending env's attributes
+func (env *Env) emit(ctx context.Context, message string, severity otellog.Severity, attrs ...otellog.KeyValue) {
+	for _, kv := range env.Attributes {
+		attrs = append(attrs, otellog.KeyValueFromAttribute(kv))
+	}
+	var record otellog.Record
+	record.SetTimestamp(time.Now())
+	record.SetBody(otellog.StringValue(message))
+	record.SetSeverity(severity)
+	record.AddAttributes(attrs...)
+	env.Logger.Emit(ctx, record)
+}
+
+// recordDuration records d in the duration histogram
+func (env *Env) recordDuration(ctx context.Context, d time.Duration, attrs ...attribute.KeyValue) {
+	if env.Metrics == nil {
+		return
+	}
+	env.Metrics.Duration.Record(ctx, d.Seconds(), metric.WithAttributes(env.Attributes...), metric.WithAttributes(attrs...))
+}
+
+// connect counts an open connection of connectionType until the returned
+// func is called
+func (env *Env) connect(ctx context.Context, connectionType string) func() {
+	if env.Metrics == nil {
+		return func() {}
+	}
+	opts := []metric.AddOption{
+		metric.WithAttributes(env.Attributes...),
+		metric.WithAttributes(attribute.String("connection_type", connectionType)),
+	}
+	env.Metrics.Connections.Add(ctx, 1, opts...)
+	return func() { env.Metrics.Connections.Add(ctx, -1, opts...) }
+}
@@ -0,0 +1,453 @@
+package scenario
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"otel-demo/telemetry"
+)
+
+// DBCallConfig describes a database query. Without DB the query is
+// simulated by waiting for Latency; with it Statement really runs, with the
+// arguments Args draws, and takes as long as it takes.
+type DBCallConfig struct {
+	System    string // db.system, e.g. postgresql
+	Name      string // db.name
+	Operation string // db.operation, e.g. SELECT
+	Statement string // logged as the query
+	Latency   telemetry.LatencyRange
+
+	DB   *sql.DB
+	Args func(*rand.Rand) []any
+}
+
+// DBCall runs a database query as a database-query span, a debug log of
+// the statement and its duration under operation database_query. A real
+// query also sets db.statement and the rows the query returned or changed
+// as db.rows_affected; an instrumented DB adds its own spans under this one.
+func DBCall(cfg DBCallConfig) Step {
+	return func(ctx context.Context, env *Env) error {
+		defer env.connect(ctx, "database")()
+
+		ctx, span := env.Tracer.Start(ctx, "database-query",
+			trace.WithAttributes(
+				attribute.String("db.system", cfg.System),
+				attribute.String("db.name", cfg.Name),
+				attribute.String("db.operation", cfg.Operation),
+			),
+			trace.WithAttributes(env.Attributes...))
+		defer span.End()
+
+		env.emit(ctx, "Executing database query", otellog.SeverityDebug,
+			otellog.String("component", "database"),
+			otellog.String("query", cfg.Statement))
+
+		var (
+			d    time.Duration
+			rows int64 = 1
+			err  error
+		)
+		if cfg.DB != nil {
+			span.SetAttributes(attribute.String("db.statement", cfg.Statement))
+			start := time.Now()
+			rows, err = cfg.query(ctx, env.Rand)
+			d = time.Since(start)
+		} else {
+			start := time.Now()
+			d = cfg.Latency.Sample(env.Rand)
+			err = wait(ctx, d)
+			if env.SpanEvents {
+				cacheLookup(span, start, "query_cache", cfg.Name+":"+cfg.Statement, false)
+				mode := "row exclusive"
+				if cfg.Operation == "SELECT" {
+					mode = "access share"
+				}
+				lockWait(span, env.Rand, start, d, mode)
+				gcPause(span, env.Rand, start, d)
+			}
+		}
+		if err != nil {
+			telemetry.RecordError(span, err)
+			if ctx.Err() != nil {
+				return fmt.Errorf("database query interrupted: %w", err)
+			}
+			return fmt.Errorf("database query failed: %w", err)
+		}
+
+		env.recordDuration(ctx, d,
+			attribute.String("operation", "database_query"),
+			attribute.String("db.system", cfg.System),
+		)
+		span.SetAttributes(
+			attribute.Int64("db.rows_affected", rows),
+			attribute.String("db.query_time", fmt.Sprintf("%.0fms", d.Seconds()*1000)),
+		)
+		return nil
+	}
+}
+
+// query runs the statement on the DB, reading every row a SELECT returns,
+// and returns the number of rows read or changed
+func (cfg DBCallConfig) query(ctx context.Context, rng *rand.Rand) (int64, error) {
+	var args []any
+	if cfg.Args != nil {
+		args = cfg.Args(rng)
+	}
+	if cfg.Operation != "SELECT" {
+		res, err := cfg.DB.ExecContext(ctx, cfg.Statement, args...)
+		if err != nil {
+			return 0, err
+		}
+		return res.RowsAffected()
+	}
+	rows, err := cfg.DB.QueryContext(ctx, cfg.Statement, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	var n int64
+	for rows.Next() {
+		n++
+	}
+	return n, rows.Err()
+}
+
+// HTTPCallConfig describes an outgoing HTTP request. Without Client it is
+// simulated: it takes Latency and ErrorRate is the fraction of calls
+// answered 503 Service Unavailable, each with a reason. The others are
+// answered 200, or with a status drawn from Statuses when it weighs
+// any. ResponseSizes gives the simulated answers a body size, from a few
+// hundred bytes to megabytes. With Client the request is really sent to
+// URL, and transport errors and 5xx answers are retried up to Retries
+// times.
+type HTTPCallConfig struct {
+	Method        string
+	URL           string
+	Latency       telemetry.LatencyRange
+	ErrorRate     float64
+	Statuses      []WeightedStatus
+	ResponseSizes bool
+
+	Client  *http.Client
+	Retries int
+}
+
+// HTTPCall makes an outgoing HTTP request as an external-api-call span,
+// logs of the request and response and its duration under operation
+// api_call. A simulated answer with a body size records it as
+// http.response.body.size and in http.client.response.body.size, whose
+// values span too many orders of magnitude for fixed buckets. A failed
+// call sets the span's status and returns an error. An
+// instrumented Client, as telemetry.NewHTTPClient returns, adds a client
+// span per attempt under this one.
+func HTTPCall(cfg HTTPCallConfig) Step {
+	return func(ctx context.Context, env *Env) error {
+		defer env.connect(ctx, "http_client")()
+
+		// A simulated call is the client span itself; a real one's client
+		// spans are the instrumented Client's
+		kind := trace.SpanKindInternal
+		if cfg.Client == nil {
+			kind = trace.SpanKindClient
+		}
+		ctx, span := env.Tracer.Start(ctx, "external-api-call",
+			trace.WithSpanKind(kind),
+			trace.WithAttributes(
+				attribute.String("http.method", cfg.Method),
+				attribute.String("http.url", cfg.URL),
+				attribute.String("http.request.method", cfg.Method),
+				attribute.String("url.full", cfg.URL),
+			),
+			trace.WithAttributes(env.Attributes...))
+		defer span.End()
+
+		env.emit(ctx, "Making external API call", otellog.SeverityInfo,
+			otellog.String("component", "api-client"),
+			otellog.String("url", cfg.URL),
+			otellog.String("method", cfg.Method))
+
+		var (
+			d          time.Duration
+			statusCode = 200
+			reason     string
+			err        error
+		)
+		if cfg.Client != nil {
+			start := time.Now()
+			statusCode, err = cfg.send(ctx, env, span)
+			d = time.Since(start)
+		} else {
+			start := time.Now()
+			d = cfg.Latency.Sample(env.Rand)
+			err = wait(ctx, d)
+			if env.Rand.Float64() < cfg.ErrorRate {
+				statusCode = http.StatusServiceUnavailable
+				reason = simulatedReason(statusCode, env.Rand)
+			} else if len(cfg.Statuses) > 0 {
+				statusCode = drawStatus(cfg.Statuses, env.Rand)
+				reason = simulatedReason(statusCode, env.Rand)
+			}
+			if env.SpanEvents {
+				cfg.simulatedEvents(span, env.Rand, start, d)
+			}
+		}
+		if err != nil {
+			telemetry.RecordError(span, err)
+			if ctx.Err() != nil {
+				return fmt.Errorf("external API call interrupted: %w", err)
+			}
+			return fmt.Errorf("external API call failed: %w", err)
+		}
+
+		env.recordDuration(ctx, d,
+			attribute.String("operation", "api_call"),
+			attribute.String("http.method", cfg.Method),
+			attribute.Int("http.status_code", statusCode),
+		)
+		if cfg.ResponseSizes && cfg.Client == nil {
+			size := responseSize(env.Rand)
+			span.SetAttributes(attribute.Int64("http.response.body.size", size))
+			if env.Metrics != nil {
+				env.Metrics.ResponseSize.Record(ctx, size, metric.WithAttributes(env.Attributes...), metric.WithAttributes(
+					attribute.String("http.request.method", cfg.Method),
+					attribute.Int("http.response.status_code", statusCode),
+				))
+			}
+		}
+
+		if statusCode >= 400 {
+			// An error status fails the call from the client's side, 4xx
+			// included; only the server's side leaves 4xx unset
+			se := &StatusError{StatusCode: statusCode, Reason: reason}
+			err := fmt.Errorf("external API call failed: %w", se)
+			span.SetAttributes(
+				attribute.Int("http.status_code", statusCode),
+				attribute.Int("http.response.status_code", statusCode),
+				attribute.String("error.type", strconv.Itoa(statusCode)),
+			)
+			telemetry.RecordError(span, err)
+			severity := otellog.SeverityError
+			if statusCode < 500 {
+				severity = otellog.SeverityWarn
+			}
+			env.emit(ctx, fmt.Sprintf("External API call failed: %v", se), severity,
+				otellog.String("component", "api-client"),
+				otellog.String("url", cfg.URL),
+				otellog.Int("status_code", statusCode))
+			return err
+		}
+
+		responseTime := fmt.Sprintf("%.0fms", d.Seconds()*1000)
+		span.SetAttributes(
+			attribute.Int("http.status_code", statusCode),
+			attribute.Int("http.response.status_code", statusCode),
+			attribute.String("http.response_time", responseTime),
+		)
+		env.emit(ctx, "API call completed successfully", otellog.SeverityInfo,
+			otellog.String("component", "api-client"),
+			otellog.Int("status_code", statusCode),
+			otellog.String("response_time", responseTime))
+		return nil
+	}
+}
+
+// responseSize draws a response body size in bytes, log-normal around
+// 4KiB with now and then an answer of megabytes, at most 64MiB
+func responseSize(rng *rand.Rand) int64 {
+	return min(int64(4096*math.Exp(2*rng.NormFloat64())), 64<<20) + 1
+}
+
+// StatusError is an API call answered with an error status, with the
+// reason the simulated API gave, if any
+type StatusError struct {
+	StatusCode int
+	Reason     string
+}
+
+func (e *StatusError) Error() string {
+	msg := fmt.Sprintf("external API returned %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+// simulatedFailures are the 5xx answers of a failing simulated API, with
+// their reasons. ErrorRate fails calls with the 503s, as a real overloaded
+// upstream would; the others come from Statuses.
+var simulatedFailures = []struct {
+	statusCode int
+	reason     string
+}{
+	{http.StatusServiceUnavailable, "upstream connection pool exhausted"},
+	{http.StatusServiceUnavailable, "service is shedding load, retry later"},
+	{http.StatusBadGateway, "upstream closed the connection without a response"},
+	{http.StatusGatewayTimeout, "upstream did not respond within 5s"},
+	{http.StatusInternalServerError, "unexpected nil pointer in the order handler"},
+}
+
+// WeightedStatus is a status code a simulated API answers with, Weight
+// times as often as a status of weight 1
+type WeightedStatus struct {
+	Code   int
+	Weight float64
+}
+
+// drawStatus picks a status code from statuses in proportion to their
+// weights
+func drawStatus(statuses []WeightedStatus, rng *rand.Rand) int {
+	var total float64
+	for _, s := range statuses {
+		total += s.Weight
+	}
+	r := rng.Float64() * total
+	for _, s := range statuses {
+		if r < s.Weight {
+			return s.Code
+		}
+		r -= s.Weight
+	}
+	return statuses[len(statuses)-1].Code
+}
+
+// simulatedRejections are the reasons a simulated API gives for the 4xx
+// statuses it answers with
+var simulatedRejections = map[int]string{
+	http.StatusBadRequest:          "missing required field user_id",
+	http.StatusUnauthorized:        "bearer token expired",
+	http.StatusForbidden:           "API key lacks the orders:write scope",
+	http.StatusNotFound:            "no user with that id",
+	http.StatusConflict:            "order already submitted",
+	http.StatusUnprocessableEntity: "quantity must be positive",
+	http.StatusTooManyRequests:     "rate limit of 100 requests per minute exceeded",
+}
+
+// simulatedReason returns the reason a simulated API gives for answering
+// with the status code, if any
+func simulatedReason(statusCode int, rng *rand.Rand) string {
+	if statusCode < 500 {
+		return simulatedRejections[statusCode]
+	}
+	var reasons []string
+	for _, f := range simulatedFailures {
+		if f.statusCode == statusCode {
+			reasons = append(reasons, f.reason)
+		}
+	}
+	if len(reasons) == 0 {
+		return ""
+	}
+	return reasons[rng.IntN(len(reasons))]
+}
+
+// send makes the request, retrying with a backoff doubling from 100ms, and
+// returns the status code of the last attempt
+func (cfg HTTPCallConfig) send(ctx context.Context, env *Env, span trace.Span) (int, error) {
+	backoff := 100 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		statusCode, err := cfg.attempt(ctx)
+		if (err == nil && statusCode < 500) || attempt == cfg.Retries || ctx.Err() != nil {
+			if attempt > 0 {
+				span.SetAttributes(attribute.Int("http.resend_count", attempt))
+			}
+			return statusCode, err
+		}
+		reason := http.StatusText(statusCode)
+		if err != nil {
+			reason = err.Error()
+		}
+		env.emit(ctx, fmt.Sprintf("Retrying external API call: %s", reason), otellog.SeverityWarn,
+			otellog.String("component", "api-client"),
+			otellog.String("url", cfg.URL),
+			otellog.Int("attempt", attempt+1))
+		retry(span, time.Now(), attempt+1, reason, backoff)
+		if err := wait(ctx, backoff); err != nil {
+			return 0, err
+		}
+		backoff *= 2
+	}
+}
+
+// simulatedEvents adds the events of a simulated call: a miss in the
+// response cache and, now and then, a first attempt reset part way
+// through and retried
+func (cfg HTTPCallConfig) simulatedEvents(span trace.Span, rng *rand.Rand, start time.Time, d time.Duration) {
+	cacheLookup(span, start, "http_response_cache", cfg.Method+" "+cfg.URL, false)
+	if rng.Float64() < retryChance {
+		retry(span, at(rng, start, d, 0.2, 0.5), 1, "connection reset by peer", 100*time.Millisecond)
+		span.SetAttributes(attribute.Int("http.resend_count", 1))
+	}
+	gcPause(span, rng, start, d)
+}
+
+func (cfg HTTPCallConfig) attempt(ctx context.Context) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, cfg.Method, cfg.URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := cfg.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Read the body so the connection is reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	return resp.StatusCode, nil
+}
+
+// QueuePublishConfig describes a simulated message publish
+type QueuePublishConfig struct {
+	System      string // messaging.system, e.g. kafka
+	Destination string // messaging.destination.name, the topic or queue
+	Latency     telemetry.LatencyRange
+}
+
+// QueuePublish simulates publishing a message as a producer span named
+// after the destination, a debug log and its duration under operation
+// queue_publish
+func QueuePublish(cfg QueuePublishConfig) Step {
+	return func(ctx context.Context, env *Env) error {
+		defer env.connect(ctx, "messaging")()
+
+		ctx, span := env.Tracer.Start(ctx, cfg.Destination+" publish",
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(
+				attribute.String("messaging.system", cfg.System),
+				attribute.String("messaging.destination.name", cfg.Destination),
+				attribute.String("messaging.operation", "publish"),
+			),
+			trace.WithAttributes(env.Attributes...))
+		defer span.End()
+
+		env.emit(ctx, "Publishing message", otellog.SeverityDebug,
+			otellog.String("component", "messaging"),
+			otellog.String("destination", cfg.Destination))
+
+		start := time.Now()
+		d := cfg.Latency.Sample(env.Rand)
+		if err := wait(ctx, d); err != nil {
+			telemetry.RecordError(span, err)
+			return fmt.Errorf("publish to %s interrupted: %w", cfg.Destination, err)
+		}
+		if env.SpanEvents {
+			gcPause(span, env.Rand, start, d)
+		}
+
+		env.recordDuration(ctx, d,
+			attribute.String("operation", "queue_publish"),
+			attribute.String("messaging.system", cfg.System),
+		)
+		return nil
+	}
+}
@@ -0,0 +1,71 @@
+package scenario
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"otel-demo/telemetry"
+)
+
+// StressTraceConfig shapes a pathological trace: a chain of Depth spans
+// under the span in ctx, each the parent of the next, and Width children
+// side by side under the deepest of them, or under the span in ctx without
+// a chain.
+type StressTraceConfig struct {
+	Depth int
+	Width int
+}
+
+// StressTrace builds the trace cfg describes, for measuring how trace
+// views and queries cope with traces far deeper or wider than any request
+// makes. The chain's spans are named recurse and carry stress.depth, the
+// children fan-out with stress.index. The spans do no work of their own,
+// so a trace of thousands of spans takes milliseconds to make; each chain
+// span ends after everything under it.
+func StressTrace(cfg StressTraceConfig) Step {
+	return func(ctx context.Context, env *Env) error {
+		// Iterative rather than recursive, however deep the chain
+		chain := make([]trace.Span, 0, cfg.Depth)
+		defer func() {
+			for i := len(chain) - 1; i >= 0; i-- {
+				chain[i].End()
+			}
+		}()
+		for depth := 1; depth <= cfg.Depth; depth++ {
+			if err := ctx.Err(); err != nil {
+				return stressInterrupted(chain, err)
+			}
+			var span trace.Span
+			ctx, span = env.Tracer.Start(ctx, "recurse",
+				trace.WithAttributes(attribute.Int("stress.depth", depth)),
+				trace.WithAttributes(env.Attributes...))
+			chain = append(chain, span)
+		}
+		for i := range cfg.Width {
+			if err := ctx.Err(); err != nil {
+				return stressInterrupted(chain, err)
+			}
+			_, span := env.Tracer.Start(ctx, "fan-out",
+				trace.WithAttributes(attribute.Int("stress.index", i)),
+				trace.WithAttributes(env.Attributes...))
+			span.End()
+		}
+		return nil
+	}
+}
+
+// stressInterrupted records err on the deepest span of the chain, the one
+// cut short, and fails the ones above it
+func stressInterrupted(chain []trace.Span, err error) error {
+	if len(chain) == 0 {
+		return fmt.Errorf("stress trace interrupted: %w", err)
+	}
+	telemetry.RecordError(chain[len(chain)-1], err)
+	for _, span := range chain[:len(chain)-1] {
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return fmt.Errorf("stress trace interrupted: %w", err)
+}
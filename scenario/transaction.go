@@ -0,0 +1,169 @@
+package scenario
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/trace"
+	"otel-demo/telemetry"
+)
+
+// TransactionConfig describes a simulated multi-statement transaction:
+// Statements statements between BEGIN and COMMIT, each taking Latency,
+// with DeadlockRate the fraction of transactions one of whose statements
+// is picked as a deadlock victim, rolling it back.
+type TransactionConfig struct {
+	System       string // db.system, e.g. postgresql
+	Name         string // db.name
+	Statements   int
+	Latency      telemetry.LatencyRange
+	DeadlockRate float64
+}
+
+// ErrDeadlock is the error of a statement picked as a deadlock victim
+var ErrDeadlock = errors.New("deadlock detected (SQLSTATE 40P01)")
+
+// deadlockState is the SQLSTATE of a deadlock, in db.response.status_code
+// and error.type
+const deadlockState = "40P01"
+
+// transactionStatements are the statements of a transaction writing an
+// order, taken in turn
+var transactionStatements = []struct{ operation, table, statement string }{
+	{"INSERT", "orders", "INSERT INTO orders (user_id, total) VALUES (?, ?) RETURNING id"},
+	{"INSERT", "order_items", "INSERT INTO order_items (order_id, sku, quantity) VALUES (?, ?, ?)"},
+	{"UPDATE", "stock", "UPDATE stock SET quantity = quantity - ? WHERE sku = ?"},
+	{"SELECT", "stock", "SELECT quantity FROM stock WHERE sku = ? FOR UPDATE"},
+	{"UPDATE", "users", "UPDATE users SET last_order_at = now() WHERE id = ?"},
+}
+
+// The latencies of a transaction's BEGIN and COMMIT, the last waiting for
+// the write-ahead log to be flushed, and of a ROLLBACK
+var (
+	beginLatency    = telemetry.LatencyRange{Min: 500 * time.Microsecond, Max: 2 * time.Millisecond}
+	commitLatency   = telemetry.LatencyRange{Min: 2 * time.Millisecond, Max: 8 * time.Millisecond}
+	rollbackLatency = telemetry.LatencyRange{Min: 1 * time.Millisecond, Max: 3 * time.Millisecond}
+)
+
+// Transaction runs the transaction as a transaction span over client spans
+// for BEGIN, each statement, named after its operation and table, and
+// COMMIT, with the database semantic convention attributes. A deadlock
+// victim's span fails with ErrDeadlock and a db.response.status_code of
+// 40P01 after waiting on the lock, then a ROLLBACK span ends the
+// transaction, the transaction span fails and so does the step. The
+// transaction span carries db.transaction.outcome, commit or rollback, and
+// its duration is recorded under operation db_transaction.
+func Transaction(cfg TransactionConfig) Step {
+	return func(ctx context.Context, env *Env) error {
+		defer env.connect(ctx, "database")()
+
+		ctx, span := env.Tracer.Start(ctx, "transaction",
+			trace.WithAttributes(
+				attribute.String("db.system", cfg.System),
+				attribute.String("db.name", cfg.Name),
+				attribute.Int("db.transaction.statements", cfg.Statements),
+			),
+			trace.WithAttributes(env.Attributes...))
+		defer span.End()
+		start := time.Now()
+
+		victim := -1
+		if env.Rand.Float64() < cfg.DeadlockRate {
+			victim = env.Rand.IntN(cfg.Statements)
+		}
+		if err := cfg.statement(ctx, env, "BEGIN", "", "BEGIN", beginLatency, false); err != nil {
+			return cfg.interrupted(span, err)
+		}
+		for i := range cfg.Statements {
+			s := transactionStatements[i%len(transactionStatements)]
+			err := cfg.statement(ctx, env, s.operation, s.table, s.statement, cfg.Latency, i == victim)
+			if errors.Is(err, ErrDeadlock) {
+				return cfg.rollback(ctx, env, span, start, err)
+			}
+			if err != nil {
+				return cfg.interrupted(span, err)
+			}
+		}
+		if err := cfg.statement(ctx, env, "COMMIT", "", "COMMIT", commitLatency, false); err != nil {
+			return cfg.interrupted(span, err)
+		}
+		span.SetAttributes(attribute.String("db.transaction.outcome", "commit"))
+		env.recordDuration(ctx, time.Since(start),
+			attribute.String("operation", "db_transaction"),
+			attribute.String("db.system", cfg.System),
+			attribute.String("db.transaction.outcome", "commit"),
+		)
+		return nil
+	}
+}
+
+// statement runs one statement of the transaction under a client span, a
+// deadlock victim waiting twice as long before failing
+func (cfg TransactionConfig) statement(ctx context.Context, env *Env, operation, table, statement string, latency telemetry.LatencyRange, deadlock bool) error {
+	name, attrs := operation, []attribute.KeyValue{
+		attribute.String("db.system", cfg.System),
+		attribute.String("db.name", cfg.Name),
+		attribute.String("db.operation", operation),
+		attribute.String("db.statement", statement),
+	}
+	if table != "" {
+		name = operation + " " + cfg.Name + "." + table
+		attrs = append(attrs, attribute.String("db.sql.table", table))
+	}
+	ctx, span := env.Tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+		trace.WithAttributes(env.Attributes...))
+	defer span.End()
+
+	d := latency.Sample(env.Rand)
+	if deadlock {
+		d *= 2
+	}
+	if err := wait(ctx, d); err != nil {
+		telemetry.RecordError(span, err)
+		return err
+	}
+	if deadlock {
+		span.SetAttributes(
+			attribute.String("db.response.status_code", deadlockState),
+			attribute.String("error.type", deadlockState),
+		)
+		telemetry.RecordError(span, ErrDeadlock)
+		env.emit(ctx, fmt.Sprintf("%s failed: %v", name, ErrDeadlock), otellog.SeverityWarn,
+			otellog.String("component", "database"),
+			otellog.String("query", statement))
+		return ErrDeadlock
+	}
+	return nil
+}
+
+// rollback rolls the transaction back after the statement failing with
+// err, and fails it
+func (cfg TransactionConfig) rollback(ctx context.Context, env *Env, span trace.Span, start time.Time, err error) error {
+	if rerr := cfg.statement(ctx, env, "ROLLBACK", "", "ROLLBACK", rollbackLatency, false); rerr != nil {
+		return cfg.interrupted(span, rerr)
+	}
+	span.SetAttributes(attribute.String("db.transaction.outcome", "rollback"))
+	span.SetStatus(codes.Error, err.Error())
+	env.recordDuration(ctx, time.Since(start),
+		attribute.String("operation", "db_transaction"),
+		attribute.String("db.system", cfg.System),
+		attribute.String("db.transaction.outcome", "rollback"),
+	)
+	env.emit(ctx, fmt.Sprintf("Transaction rolled back: %v", err), otellog.SeverityError,
+		otellog.String("component", "database"),
+		otellog.String("db.name", cfg.Name))
+	return fmt.Errorf("transaction rolled back: %w", err)
+}
+
+// interrupted fails the transaction span for a statement cut short
+func (cfg TransactionConfig) interrupted(span trace.Span, err error) error {
+	span.SetStatus(codes.Error, err.Error())
+	return fmt.Errorf("transaction interrupted: %w", err)
+}
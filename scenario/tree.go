@@ -0,0 +1,88 @@
+package scenario
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"otel-demo/telemetry"
+)
+
+// TreeConfig shapes a synthetic trace tree: Depth levels of spans under
+// the span in ctx, FanOut children under each span but the last level's,
+// and Attributes attributes on each. Every span does some work of its own
+// before its children, which run concurrently, for a time drawn from
+// Latency as Distribution says: uniform within it, exponential from Min
+// with the midpoint as the mean, or lognormal with the midpoint as the
+// median and Max about the 95th percentile. The last two have long tails
+// beyond Max.
+type TreeConfig struct {
+	Depth        int
+	FanOut       int
+	Distribution string
+	Latency      telemetry.LatencyRange
+	Attributes   int
+}
+
+// Tree builds the trace tree cfg describes, for testing queries against
+// traces of a known shape; the spans are named level-1 to level-Depth
+func Tree(cfg TreeConfig) Step {
+	return func(ctx context.Context, env *Env) error {
+		return cfg.node(ctx, env, 1, 0)
+	}
+}
+
+func (cfg TreeConfig) node(ctx context.Context, env *Env, level, index int) error {
+	attrs := make([]attribute.KeyValue, 0, cfg.Attributes+2)
+	attrs = append(attrs, attribute.Int("tree.level", level), attribute.Int("tree.index", index))
+	for i := range cfg.Attributes {
+		// A hundred values per key keeps the cardinality realistic
+		attrs = append(attrs, attribute.String(fmt.Sprintf("tree.attr.%02d", i), fmt.Sprintf("value-%02d", env.Rand.IntN(100))))
+	}
+	ctx, span := env.Tracer.Start(ctx, fmt.Sprintf("level-%d", level),
+		trace.WithAttributes(attrs...),
+		trace.WithAttributes(env.Attributes...))
+	defer span.End()
+
+	if err := wait(ctx, cfg.sample(env.Rand)); err != nil {
+		telemetry.RecordError(span, err)
+		return fmt.Errorf("tree span interrupted: %w", err)
+	}
+	if level == cfg.Depth {
+		return nil
+	}
+	children := make([]Step, cfg.FanOut)
+	for i := range children {
+		children[i] = func(ctx context.Context, env *Env) error {
+			return cfg.node(ctx, env, level+1, i)
+		}
+	}
+	if err := Parallel(children...)(ctx, env); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	return nil
+}
+
+// sample draws a span's own duration from the distribution
+func (cfg TreeConfig) sample(rng *rand.Rand) time.Duration {
+	r := cfg.Latency
+	mid := float64(r.Min+r.Max) / 2
+	switch cfg.Distribution {
+	case "exponential":
+		return r.Min + time.Duration(rng.ExpFloat64()*(mid-float64(r.Min)))
+	case "lognormal":
+		if mid <= 0 || r.Max <= r.Min {
+			return r.Min
+		}
+		// Max at the 95th percentile
+		sigma := math.Log(float64(r.Max)/mid) / 1.645
+		return max(r.Min, time.Duration(mid*math.Exp(sigma*rng.NormFloat64())))
+	}
+	return r.Sample(rng)
+}
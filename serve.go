@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/trace"
+	"otel-demo/scenario"
+	"otel-demo/telemetry"
+)
+
+// serveCommand runs a real HTTP server instrumented with otelhttp, so every
+// request it's sent produces a genuine server span with the http.*
+// attributes and the HTTP server metrics, continuing the caller's trace
+// when the request carries its context in a format -propagators accepts,
+// a traceparent header by default.
+func serveCommand() *command {
+	listen := "localhost:8080"
+	var duration time.Duration
+	return &command{
+		name:    "serve",
+		summary: "serve a demo HTTP API whose requests are traced, logged and measured",
+		flags: func(fs *flag.FlagSet, cfg *telemetry.Config) {
+			bindExporterFlags(fs, cfg)
+			bindServiceFlags(fs, cfg)
+			fs.BoolVar(&cfg.DryRun.Enabled, "dry-run", cfg.DryRun.Enabled, "print telemetry to stdout instead of exporting it")
+			fs.StringVar(&cfg.DryRun.Format, "dry-run-format", cfg.DryRun.Format, "dry-run output: text or json (OTLP JSON, one batch per line)")
+			fs.StringVar(&listen, "listen", listen, "`host:port` to serve the demo API on")
+			fs.DurationVar(&duration, "duration", duration, "stop after this long; 0 runs until interrupted")
+			fs.BoolVar(&cfg.Scenario.Baggage, "baggage", cfg.Scenario.Baggage, "copy the baggage requests carry onto their spans and log records")
+			fs.BoolVar(&cfg.Exporter.Preflight, "preflight", cfg.Exporter.Preflight, "check the collectors can be reached before serving")
+		},
+		run: func(ctx context.Context, cfg *telemetry.Config, _ func() (*telemetry.Config, error)) error {
+			ln, err := net.Listen("tcp", listen)
+			if err != nil {
+				return fmt.Errorf("failed to listen: %w", err)
+			}
+			defer ln.Close()
+
+			status := os.Stdout
+			if cfg.UsesStdout() {
+				status = os.Stderr
+			}
+			signals := telemetry.Signals{Traces: true, Logs: true, Metrics: true}
+			if err := preflight(ctx, cfg, signals, status); err != nil {
+				return err
+			}
+			cfg.Service.EnsureInstanceID()
+			cfg.Views = exponentialHistogramViews(cfg)
+			opts := append([]telemetry.Option{telemetry.WithConfig(cfg), telemetry.WithSignals(signals), telemetry.WithFailureHook(telemetry.LogExportFailure)}, baggageOptions(cfg.Scenario)...)
+			client, err := telemetry.NewClient(ctx, opts...)
+			if err != nil {
+				return err
+			}
+			api, err := newDemoAPI(cfg.Scenario, client)
+			if err != nil {
+				return errors.Join(err, client.Shutdown(ctx))
+			}
+
+			server := &http.Server{
+				Handler:           otelhttp.NewHandler(client.RecoverHandler(api.routes()), "serve", otelhttp.WithSpanNameFormatter(patternSpanName)),
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			served := make(chan error, 1)
+			go func() { served <- server.Serve(ln) }()
+			fmt.Fprintf(status, "Serving the demo API on http://%s (GET /api/users, GET /api/users/{id}, GET and POST /api/orders, GET /healthz)\n", ln.Addr())
+
+			ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			if duration > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, duration)
+				defer cancel()
+			}
+			var serveErr error
+			select {
+			case <-ctx.Done():
+			case serveErr = <-served:
+			}
+			stop()
+
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Batch.ShutdownTimeout)
+			defer cancel()
+			// Let the requests in flight finish so their spans are exported
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				log.Printf("Failed to stop the server cleanly: %v", err)
+			}
+			fmt.Fprintf(status, "Served %d requests\n", api.served.Load())
+			shutdownErr := client.Shutdown(shutdownCtx)
+			telemetry.WriteRejections(status, client.Stats())
+			telemetry.WriteFailures(status, client.Stats())
+			if serveErr != nil && !errors.Is(serveErr, http.ErrServerClosed) {
+				return errors.Join(fmt.Errorf("server failed: %w", serveErr), shutdownErr)
+			}
+			if shutdownErr != nil {
+				return fmt.Errorf("error shutting down providers: %w", shutdownErr)
+			}
+			return nil
+		},
+	}
+}
+
+// demoAPI serves a small user and order API. The handlers run scenario
+// steps for the database and downstream work behind each request, so the
+// server spans have realistic children, and fail with the scenario's
+// error rate.
+type demoAPI struct {
+	sc      telemetry.ScenarioConfig
+	tracer  trace.Tracer
+	logger  otellog.Logger
+	metrics *scenario.Metrics
+
+	served  atomic.Int64
+	orderID atomic.Int64
+}
+
+func newDemoAPI(sc telemetry.ScenarioConfig, client *telemetry.Client) (*demoAPI, error) {
+	api := &demoAPI{
+		sc:     sc,
+		tracer: client.Tracer("otel-demo/serve"),
+		logger: client.Logger("otel-demo/serve"),
+	}
+	var err error
+	if api.metrics, err = scenario.NewMetrics(client.Meter("otel-demo/serve")); err != nil {
+		return nil, err
+	}
+	return api, nil
+}
+
+func (api *demoAPI) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/users", api.listUsers)
+	mux.HandleFunc("GET /api/users/{id}", api.getUser)
+	mux.HandleFunc("GET /api/orders", api.listOrders)
+	mux.HandleFunc("POST /api/orders", api.createOrder)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api.served.Add(1)
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (api *demoAPI) listUsers(w http.ResponseWriter, r *http.Request) {
+	err := api.run(r, scenario.DBCall(scenario.DBCallConfig{
+		System:    "postgresql",
+		Name:      "userdb",
+		Operation: "SELECT",
+		Statement: "SELECT id, name FROM users LIMIT 20",
+		Latency:   api.sc.DBLatency,
+	}))
+	if err != nil {
+		api.fail(w, r, err)
+		return
+	}
+	api.reply(w, r, http.StatusOK, []map[string]any{{"id": 1, "name": "Ada"}, {"id": 2, "name": "Grace"}})
+}
+
+func (api *demoAPI) getUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		api.log(r.Context(), "Invalid user id", otellog.SeverityWarn, otellog.String("id", r.PathValue("id")))
+		api.reply(w, r, http.StatusBadRequest, map[string]string{"error": "user id must be a positive integer"})
+		return
+	}
+	trace.SpanFromContext(r.Context()).SetAttributes(attribute.Int("user.id", id))
+	err = api.run(r, scenario.DBCall(scenario.DBCallConfig{
+		System:    "postgresql",
+		Name:      "userdb",
+		Operation: "SELECT",
+		Statement: "SELECT * FROM users WHERE id = ?",
+		Latency:   api.sc.DBLatency,
+	}))
+	if err != nil {
+		api.fail(w, r, err)
+		return
+	}
+	api.reply(w, r, http.StatusOK, map[string]any{"id": id, "name": "user-" + strconv.Itoa(id)})
+}
+
+func (api *demoAPI) listOrders(w http.ResponseWriter, r *http.Request) {
+	err := api.run(r, scenario.DBCall(scenario.DBCallConfig{
+		System:    "postgresql",
+		Name:      "orderdb",
+		Operation: "SELECT",
+		Statement: "SELECT * FROM orders ORDER BY created_at DESC LIMIT 20",
+		Latency:   api.sc.DBLatency,
+	}))
+	if err != nil {
+		api.fail(w, r, err)
+		return
+	}
+	api.reply(w, r, http.StatusOK, []map[string]any{})
+}
+
+// createOrder charges through the scenario's API, then stores the order
+// and announces it at the same time
+func (api *demoAPI) createOrder(w http.ResponseWriter, r *http.Request) {
+	err := api.run(r, scenario.Sequence(
+		scenario.HTTPCall(scenario.HTTPCallConfig{
+			Method:        "POST",
+			URL:           api.sc.APIURL,
+			Latency:       api.sc.APILatency,
+			ErrorRate:     api.sc.ErrorRate,
+			Statuses:      httpStatuses(api.sc),
+			ResponseSizes: api.sc.ExponentialHistograms,
+		}),
+		scenario.Parallel(
+			scenario.DBCall(scenario.DBCallConfig{
+				System:    "postgresql",
+				Name:      "orderdb",
+				Operation: "INSERT",
+				Statement: "INSERT INTO orders (user_id, total) VALUES (?, ?)",
+				Latency:   api.sc.DBLatency,
+			}),
+			scenario.QueuePublish(scenario.QueuePublishConfig{
+				System:      "kafka",
+				Destination: "order-events",
+				Latency:     api.sc.DBLatency,
+			}),
+		),
+	))
+	if err != nil {
+		api.fail(w, r, err)
+		return
+	}
+	id := api.orderID.Add(1)
+	trace.SpanFromContext(r.Context()).SetAttributes(attribute.Int64("order.id", id))
+	api.log(r.Context(), "Order created", otellog.SeverityInfo, otellog.Int64("order.id", id))
+	api.reply(w, r, http.StatusCreated, map[string]any{"id": id})
+}
+
+// run runs step under the request's server span
+func (api *demoAPI) run(r *http.Request, step scenario.Step) error {
+	env := &scenario.Env{
+		Tracer:     api.tracer,
+		Logger:     api.logger,
+		Metrics:    api.metrics,
+		Rand:       rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())),
+		Attributes: scenarioAttributes(api.sc),
+		SpanEvents: api.sc.SpanEvents,
+	}
+	return step(r.Context(), env)
+}
+
+// patternSpanName names a server span after the mux pattern of the request,
+// such as GET /api/users/{id}, once it's routed
+func patternSpanName(_ string, r *http.Request) string {
+	if r.Pattern != "" {
+		return r.Pattern
+	}
+	return r.Method
+}
+
+// fail answers a failed request, with the error in a log record: 503 with
+// the error on the server span, or the API's 4xx as it is when the client
+// was at fault, leaving the span's status unset
+func (api *demoAPI) fail(w http.ResponseWriter, r *http.Request, err error) {
+	var se *scenario.StatusError
+	if errors.As(err, &se) && se.StatusCode < 500 {
+		api.log(r.Context(), fmt.Sprintf("Request rejected: %v", err), otellog.SeverityWarn, otellog.String("error", err.Error()))
+		api.reply(w, r, se.StatusCode, map[string]string{"error": err.Error()})
+		return
+	}
+	span := trace.SpanFromContext(r.Context())
+	telemetry.RecordError(span, err)
+	api.log(r.Context(), fmt.Sprintf("Request failed: %v", err), otellog.SeverityError, otellog.String("error", err.Error()))
+	api.reply(w, r, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+}
+
+func (api *demoAPI) reply(w http.ResponseWriter, r *http.Request, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		api.log(r.Context(), fmt.Sprintf("Failed to write the response: %v", err), otellog.SeverityWarn)
+	}
+}
+
+// log emits a record correlated with the request's server span
+func (api *demoAPI) log(ctx context.Context, message string, severity otellog.Severity, attrs ...otellog.KeyValue) {
+	attrs = append(attrs, otellog.String("component", "server"))
+	for _, k := range slices.Sorted(maps.Keys(api.sc.Attributes)) {
+		attrs = append(attrs, otellog.String(k, api.sc.Attributes[k]))
+	}
+	logRecord(ctx, api.logger, message, severity, attrs...)
+}
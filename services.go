@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"otel-demo/scenario"
+	"otel-demo/telemetry"
+)
+
+// topologyService is one service of the demo topology: the route its
+// callers reach it on, the work it does itself and the services it calls
+// in turn
+type topologyService struct {
+	name   string
+	method string
+	route  string
+	work   func(sc telemetry.ScenarioConfig) scenario.Step
+	calls  []string
+}
+
+// topology is the shop scenario.services simulates the first services of,
+// frontend first. A call to a service that isn't simulated is left out.
+var topology = []topologyService{
+	{name: "frontend", method: "POST", route: "/api/checkout",
+		calls: []string{"recommendation", "cart", "checkout"}},
+	{name: "cart", method: "GET", route: "/cart/{user_id}",
+		work: func(sc telemetry.ScenarioConfig) scenario.Step {
+			return scenario.DBCall(scenario.DBCallConfig{
+				System:    "redis",
+				Name:      "cart",
+				Operation: "HGETALL",
+				Statement: "HGETALL cart:?",
+				Latency:   telemetry.LatencyRange{Min: sc.DBLatency.Min / 10, Max: sc.DBLatency.Max / 10},
+			})
+		}},
+	{name: "checkout", method: "POST", route: "/checkout",
+		calls: []string{"cart", "inventory", "payment", "shipping", "email"}},
+	{name: "payment", method: "POST", route: "/charge",
+		work: func(sc telemetry.ScenarioConfig) scenario.Step {
+			return scenario.HTTPCall(scenario.HTTPCallConfig{
+				Method:        "POST",
+				URL:           "https://payments.example.com/v1/charges",
+				Latency:       sc.APILatency,
+				ErrorRate:     sc.ErrorRate,
+				Statuses:      httpStatuses(sc),
+				ResponseSizes: sc.ExponentialHistograms,
+			})
+		}},
+	{name: "inventory", method: "GET", route: "/stock/{sku}",
+		work: func(sc telemetry.ScenarioConfig) scenario.Step {
+			return scenario.DBCall(scenario.DBCallConfig{
+				System:    "postgresql",
+				Name:      "inventorydb",
+				Operation: "SELECT",
+				Statement: "SELECT quantity FROM stock WHERE sku = ?",
+				Latency:   sc.DBLatency,
+			})
+		}},
+	{name: "shipping", method: "POST", route: "/quote",
+		work: func(sc telemetry.ScenarioConfig) scenario.Step {
+			return scenario.HTTPCall(scenario.HTTPCallConfig{
+				Method:        "GET",
+				URL:           "https://carrier.example.com/v2/rates",
+				Latency:       sc.APILatency,
+				ResponseSizes: sc.ExponentialHistograms,
+			})
+		}},
+	{name: "email", method: "POST", route: "/send",
+		work: func(sc telemetry.ScenarioConfig) scenario.Step {
+			return scenario.QueuePublish(scenario.QueuePublishConfig{
+				System:      "rabbitmq",
+				Destination: "order-confirmations",
+				Latency:     telemetry.LatencyRange{Min: sc.DBLatency.Min / 4, Max: sc.DBLatency.Max / 4},
+			})
+		}},
+	{name: "recommendation", method: "GET", route: "/recommendations",
+		calls: []string{"inventory"}},
+}
+
+// services runs the simulated services of scenario.services, each with a
+// telemetry client of its own, so each reports under its own service.name
+// and instance and a request's trace crosses from one to the next. With
+// scenario.services_network each service is an HTTP server on a loopback
+// port, and the calls between them real requests carrying the trace
+// context in their headers.
+type services struct {
+	byName map[string]*simulatedService
+	// current returns the scenario settings for the requests the services
+	// serve over the network, which reloads change
+	current func() *telemetry.ScenarioConfig
+	network bool
+	// httpClient makes the generator's calls over the network
+	httpClient *http.Client
+}
+
+type simulatedService struct {
+	topologyService
+	client  *telemetry.Client
+	tracer  trace.Tracer
+	logger  otellog.Logger
+	metrics *scenario.Metrics
+
+	// With scenario.services_network, where the service listens and the
+	// client for its calls, traced through its own providers
+	addr       string
+	server     *http.Server
+	httpClient *http.Client
+}
+
+// randHeader carries the seeds of the random source a service serving a
+// call over the network draws from, so seeded runs stay reproducible
+const randHeader = "X-Otel-Demo-Rand"
+
+// startServices creates the clients of the first scenario.services
+// services of the topology, exporting the signals as cfg describes under
+// the services' names, and starts their servers with
+// scenario.services_network. They leave the global providers to the
+// workload's own client. shift, if not nil, is the workload's, dating their
+// telemetry alike.
+func startServices(ctx context.Context, cfg *telemetry.Config, signals telemetry.Signals, shift *telemetry.TimeShift, current func() *telemetry.ScenarioConfig) (*services, error) {
+	s := &services{
+		byName:     map[string]*simulatedService{},
+		current:    current,
+		network:    cfg.Scenario.ServicesNetwork,
+		httpClient: newServiceHTTPClient(otel.GetTracerProvider(), otel.GetMeterProvider()),
+	}
+	for _, t := range topology[:cfg.Scenario.Services] {
+		c := *cfg
+		c.Service.Name, c.Service.InstanceID = t.name, ""
+		opts := append([]telemetry.Option{telemetry.WithConfig(&c), telemetry.WithSignals(signals), telemetry.WithFailureHook(telemetry.LogExportFailure), telemetry.WithoutGlobal(), telemetry.WithTimeShift(shift), telemetry.WithClockSkew(cfg.Scenario.ClockSkew[t.name])}, baggageOptions(cfg.Scenario)...)
+		opts = append(opts, largeAttributeOptions(&c)...)
+		client, err := telemetry.NewClient(ctx, opts...)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("service %s: %w", t.name, err), s.shutdown(ctx))
+		}
+		svc := &simulatedService{
+			topologyService: t,
+			client:          client,
+			tracer:          client.Tracer("otel-demo/" + t.name),
+			logger:          client.Logger("otel-demo/" + t.name),
+		}
+		s.byName[t.name] = svc
+		if svc.metrics, err = scenario.NewMetrics(client.Meter("otel-demo/" + t.name)); err != nil {
+			return nil, errors.Join(err, s.shutdown(ctx))
+		}
+		if s.network {
+			if err := s.listen(svc); err != nil {
+				return nil, errors.Join(fmt.Errorf("service %s: %w", t.name, err), s.shutdown(ctx))
+			}
+		}
+	}
+	return s, nil
+}
+
+// checkClockSkew rejects scenario.clock_skew entries for services that
+// don't run: the generator's own, named self, and the first
+// scenario.services of the topology
+func checkClockSkew(sc telemetry.ScenarioConfig, self string) error {
+	running := []string{self}
+	for _, t := range topology[:sc.Services] {
+		running = append(running, t.name)
+	}
+	for _, name := range slices.Sorted(maps.Keys(sc.ClockSkew)) {
+		if !slices.Contains(running, name) {
+			return fmt.Errorf("scenario.clock_skew: no service %q runs, want one of %s", name, strings.Join(running, ", "))
+		}
+	}
+	return nil
+}
+
+// listen starts the service's server on a loopback port, behind the
+// otelhttp middleware reporting through the service's providers
+func (s *services) listen(svc *simulatedService) error {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(svc.method+" "+svc.route, func(w http.ResponseWriter, r *http.Request) {
+		sc := *s.current()
+		var seed1, seed2 uint64
+		if _, err := fmt.Sscanf(r.Header.Get(randHeader), "%x-%x", &seed1, &seed2); err != nil {
+			seed1, seed2 = rand.Uint64(), rand.Uint64()
+		}
+		env := &scenario.Env{
+			Rand:       rand.New(rand.NewPCG(seed1, seed2)),
+			Attributes: scenarioAttributes(sc),
+			SpanEvents: sc.SpanEvents,
+		}
+		if status, err := s.serve(r.Context(), sc, svc, env); err != nil {
+			http.Error(w, err.Error(), status)
+		}
+	})
+	svc.addr = ln.Addr().String()
+	svc.server = &http.Server{
+		Handler: otelhttp.NewHandler(svc.client.RecoverHandler(mux), svc.name,
+			otelhttp.WithTracerProvider(svc.client.TracerProvider()),
+			otelhttp.WithMeterProvider(svc.client.MeterProvider()),
+			otelhttp.WithSpanNameFormatter(patternSpanName)),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go svc.server.Serve(ln)
+	svc.httpClient = newServiceHTTPClient(svc.client.TracerProvider(), svc.client.MeterProvider())
+	return nil
+}
+
+// routeKey holds the route of a call in its request's context, to name the
+// client span after
+type routeKey struct{}
+
+// newServiceHTTPClient returns a client tracing the calls between services
+// through the providers given, its spans named after the route called
+func newServiceHTTPClient(tp trace.TracerProvider, mp metric.MeterProvider) *http.Client {
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: otelhttp.NewTransport(http.DefaultTransport.(*http.Transport).Clone(),
+			otelhttp.WithTracerProvider(tp),
+			otelhttp.WithMeterProvider(mp),
+			otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+				route, _ := r.Context().Value(routeKey{}).(string)
+				return r.Method + " " + route
+			})),
+	}
+}
+
+// shutdown stops the services' servers, letting the calls in flight
+// finish, then flushes and stops every service's client
+func (s *services) shutdown(ctx context.Context) error {
+	var errs []error
+	for _, svc := range s.byName {
+		if svc.server != nil {
+			errs = append(errs, svc.server.Shutdown(ctx))
+		}
+	}
+	for _, svc := range s.byName {
+		errs = append(errs, svc.client.ForceFlush(ctx), svc.client.Shutdown(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// stats returns the export counts of all the services together
+func (s *services) stats() *telemetry.ExportStats {
+	var stats telemetry.ExportStats
+	for _, svc := range s.byName {
+		stats.Add(svc.client.Stats())
+	}
+	return &stats
+}
+
+// serviceError is a call another service answered with an error status
+type serviceError struct {
+	service    string
+	statusCode int
+	message    string
+}
+
+func (e *serviceError) Error() string {
+	return fmt.Sprintf("%s answered %d: %s", e.service, e.statusCode, e.message)
+}
+
+// call returns the step calling the named service from another one, or
+// from the generator when from is nil. In process it's a client span in
+// the caller, under which the service handles the request in a server span
+// of its own; over the network the otelhttp client and server make those
+// spans. Either way the service then does its work and calls the services
+// it depends on.
+func (s *services) call(from *simulatedService, sc telemetry.ScenarioConfig, name string) scenario.Step {
+	svc := s.byName[name]
+	if s.network {
+		return s.callHTTP(from, sc, svc)
+	}
+	return func(ctx context.Context, env *scenario.Env) error {
+		ctx, span := env.Tracer.Start(ctx, svc.method+" "+svc.route,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("http.request.method", svc.method),
+				attribute.String("url.full", "http://"+svc.name+svc.route),
+				attribute.String("server.address", svc.name),
+				attribute.String("peer.service", svc.name),
+			),
+			trace.WithAttributes(env.Attributes...))
+		defer span.End()
+
+		ctx, server := svc.tracer.Start(ctx, svc.method+" "+svc.route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", svc.method),
+				attribute.String("http.route", svc.route),
+			),
+			trace.WithAttributes(env.Attributes...))
+		status, err := s.serve(ctx, sc, svc, &scenario.Env{Rand: env.Rand, Attributes: env.Attributes, SpanEvents: env.SpanEvents})
+		server.SetAttributes(attribute.Int("http.response.status_code", status))
+		server.End()
+
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if err != nil {
+			telemetry.RecordError(span, err)
+			return fmt.Errorf("%s: %w", svc.name, err)
+		}
+		return nil
+	}
+}
+
+// callHTTP is call over the network, svc's answer to a failed call read
+// back as a serviceError
+func (s *services) callHTTP(from *simulatedService, sc telemetry.ScenarioConfig, svc *simulatedService) scenario.Step {
+	client := s.httpClient
+	if from != nil {
+		client = from.httpClient
+	}
+	return func(ctx context.Context, env *scenario.Env) error {
+		path := strings.NewReplacer("{user_id}", sc.UserID, "{sku}", fmt.Sprintf("sku-%04d", env.Rand.IntN(10000))).Replace(svc.route)
+		req, err := http.NewRequestWithContext(context.WithValue(ctx, routeKey{}, svc.route), svc.method, "http://"+svc.addr+path, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set(randHeader, fmt.Sprintf("%x-%x", env.Rand.Uint64(), env.Rand.Uint64()))
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("%s: %w", svc.name, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+			return &serviceError{service: svc.name, statusCode: resp.StatusCode, message: strings.TrimSpace(string(body))}
+		}
+		return nil
+	}
+}
+
+// serve is the service's side of a call, in the server span in ctx: its
+// work and calls, reported through its own providers, and the log of the
+// outcome. It returns the status the call is answered with.
+func (s *services) serve(ctx context.Context, sc telemetry.ScenarioConfig, svc *simulatedService, env *scenario.Env) (int, error) {
+	env.Tracer, env.Logger, env.Metrics = svc.tracer, svc.logger, svc.metrics
+	var steps []scenario.Step
+	if svc.work != nil {
+		steps = append(steps, svc.work(sc))
+	}
+	for _, name := range svc.calls {
+		if _, ok := s.byName[name]; ok {
+			steps = append(steps, s.call(svc, sc, name))
+		}
+	}
+	err := scenario.Sequence(steps...)(ctx, env)
+	if err != nil {
+		// A client error is the caller's, leaving the server span unset
+		status, severity := responseStatus(err), otellog.SeverityWarn
+		if status >= 500 {
+			telemetry.RecordError(trace.SpanFromContext(ctx), err)
+			severity = otellog.SeverityError
+		}
+		logRecord(ctx, svc.logger, fmt.Sprintf("%s %s failed: %v", svc.method, svc.route, err), severity,
+			otellog.String("component", svc.name),
+			otellog.Int("status_code", status))
+		return status, err
+	}
+	logRecord(ctx, svc.logger, fmt.Sprintf("%s %s handled", svc.method, svc.route), otellog.SeverityInfo,
+		otellog.String("component", svc.name),
+		otellog.Int("status_code", http.StatusOK))
+	return http.StatusOK, nil
+}
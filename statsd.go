@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"otel-demo/telemetry"
+)
+
+// statsdCommand listens for StatsD metrics over UDP and records them with
+// OTel instruments, so applications that only speak StatsD reach ClickStack
+// through the normal metric pipeline: exporters, mirrors, batching and all.
+func statsdCommand() *command {
+	listen := "localhost:8125"
+	var duration time.Duration
+	return &command{
+		name:    "statsd",
+		summary: "forward StatsD metrics received over UDP as OTel metrics",
+		flags: func(fs *flag.FlagSet, cfg *telemetry.Config) {
+			bindExporterFlags(fs, cfg)
+			bindServiceFlags(fs, cfg)
+			fs.StringVar(&listen, "listen", listen, "UDP `host:port` to receive StatsD metrics on")
+			fs.DurationVar(&duration, "duration", duration, "stop after this long; 0 runs until interrupted")
+			fs.BoolVar(&cfg.Exporter.Preflight, "preflight", cfg.Exporter.Preflight, "check the collector can be reached before listening")
+		},
+		run: func(ctx context.Context, cfg *telemetry.Config, _ func() (*telemetry.Config, error)) error {
+			conn, err := net.ListenPacket("udp", listen)
+			if err != nil {
+				return fmt.Errorf("failed to listen for StatsD: %w", err)
+			}
+
+			status := os.Stdout
+			if cfg.UsesStdout() {
+				status = os.Stderr
+			}
+			signals := telemetry.Signals{Metrics: true}
+			if err := preflight(ctx, cfg, signals, status); err != nil {
+				conn.Close()
+				return err
+			}
+			cfg.Service.EnsureInstanceID()
+			client, err := telemetry.NewClient(ctx, telemetry.WithConfig(cfg), telemetry.WithSignals(signals), telemetry.WithFailureHook(telemetry.LogExportFailure))
+			if err != nil {
+				conn.Close()
+				return err
+			}
+
+			ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			if duration > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, duration)
+				defer cancel()
+			}
+			go func() {
+				<-ctx.Done()
+				conn.Close()
+			}()
+
+			b := newStatsdBridge(client.Meter("otel-demo/statsd"))
+			log.Printf("Listening for StatsD metrics on udp://%s", conn.LocalAddr())
+			buf := make([]byte, 65535)
+			for {
+				n, _, err := conn.ReadFrom(buf)
+				if err != nil {
+					if ctx.Err() != nil {
+						break
+					}
+					return errors.Join(err, client.Shutdown(context.Background()))
+				}
+				b.handlePacket(context.Background(), buf[:n])
+			}
+
+			log.Printf("Received %d StatsD metrics, %d malformed or unsupported", b.received, b.rejected)
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Batch.ShutdownTimeout)
+			defer cancel()
+			shutdownErr := client.Shutdown(shutdownCtx)
+			telemetry.WriteRejections(status, client.Stats())
+			telemetry.WriteFailures(status, client.Stats())
+			if shutdownErr != nil {
+				return fmt.Errorf("error shutting down providers: %w", shutdownErr)
+			}
+			return nil
+		},
+	}
+}
+
+// statsdBridge turns StatsD lines into measurements:
+//
+//	name:value|c[|@rate]  counter, scaled up by the sample rate
+//	name:value|g          gauge; a leading + or - adjusts the last value
+//	name:value|ms         timer, recorded in a histogram with unit ms
+//	name:value|h or |d    histogram or distribution
+//
+// DogStatsD tags (|#key:value,key2:value2) become attributes. Sets aren't
+// supported. Instruments are created on first use, one per name and type.
+type statsdBridge struct {
+	meter metric.Meter
+
+	mu          sync.Mutex
+	counters    map[string]metric.Float64Counter
+	gauges      map[string]metric.Float64Gauge
+	histograms  map[string]metric.Float64Histogram
+	gaugeValues map[string]float64 // last value per gauge and attributes, for +/- updates
+	warned      map[string]bool
+
+	received, rejected int
+}
+
+func newStatsdBridge(meter metric.Meter) *statsdBridge {
+	return &statsdBridge{
+		meter:       meter,
+		counters:    map[string]metric.Float64Counter{},
+		gauges:      map[string]metric.Float64Gauge{},
+		histograms:  map[string]metric.Float64Histogram{},
+		gaugeValues: map[string]float64{},
+		warned:      map[string]bool{},
+	}
+}
+
+// handlePacket records every line of packet, which may hold several
+// newline-separated metrics
+func (b *statsdBridge) handlePacket(ctx context.Context, packet []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, line := range strings.Split(string(packet), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		b.received++
+		if err := b.handleLine(ctx, line); err != nil {
+			b.rejected++
+			// Once per kind of problem, a misbehaving client sends thousands
+			if kind, _, _ := strings.Cut(err.Error(), ":"); !b.warned[kind] {
+				b.warned[kind] = true
+				log.Printf("StatsD: %v (further %q errors are not logged)", err, kind)
+			}
+		}
+	}
+}
+
+// statsdMetric is one parsed StatsD line
+type statsdMetric struct {
+	name  string
+	value string
+	kind  string
+	rate  float64
+	attrs []attribute.KeyValue
+}
+
+func parseStatsdLine(line string) (statsdMetric, error) {
+	m := statsdMetric{rate: 1}
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return m, fmt.Errorf("malformed line: %q", line)
+	}
+	m.name = statsdInstrumentName(name)
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return m, fmt.Errorf("malformed line: %q", line)
+	}
+	m.value, m.kind = parts[0], parts[1]
+	for _, p := range parts[2:] {
+		switch {
+		case strings.HasPrefix(p, "@"):
+			rate, err := strconv.ParseFloat(p[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return m, fmt.Errorf("invalid sample rate: %q", line)
+			}
+			m.rate = rate
+		case strings.HasPrefix(p, "#"):
+			for _, tag := range strings.Split(p[1:], ",") {
+				if tag == "" {
+					continue
+				}
+				k, v, _ := strings.Cut(tag, ":")
+				m.attrs = append(m.attrs, attribute.String(k, v))
+			}
+		}
+	}
+	return m, nil
+}
+
+func (b *statsdBridge) handleLine(ctx context.Context, line string) error {
+	m, err := parseStatsdLine(line)
+	if err != nil {
+		return err
+	}
+	delta := m.kind == "g" && (strings.HasPrefix(m.value, "+") || strings.HasPrefix(m.value, "-"))
+	value, err := strconv.ParseFloat(m.value, 64)
+	if err != nil {
+		return fmt.Errorf("invalid value: %q", line)
+	}
+	attrs := attribute.NewSet(m.attrs...)
+	opt := metric.WithAttributeSet(attrs)
+
+	switch m.kind {
+	case "c":
+		if value < 0 {
+			return fmt.Errorf("negative counter: %q", line)
+		}
+		c, err := statsdInstrument(b.counters, m.name, func() (metric.Float64Counter, error) {
+			return b.meter.Float64Counter(m.name)
+		})
+		if err != nil {
+			return err
+		}
+		c.Add(ctx, value/m.rate, opt)
+	case "g":
+		key := m.name + "\x00" + attrs.Encoded(attribute.DefaultEncoder())
+		if delta {
+			value += b.gaugeValues[key]
+		}
+		b.gaugeValues[key] = value
+		g, err := statsdInstrument(b.gauges, m.name, func() (metric.Float64Gauge, error) {
+			return b.meter.Float64Gauge(m.name)
+		})
+		if err != nil {
+			return err
+		}
+		g.Record(ctx, value, opt)
+	case "ms", "h", "d":
+		var unitOpts []metric.Float64HistogramOption
+		if m.kind == "ms" {
+			unitOpts = append(unitOpts, metric.WithUnit("ms"))
+		}
+		h, err := statsdInstrument(b.histograms, m.name+"|"+m.kind, func() (metric.Float64Histogram, error) {
+			return b.meter.Float64Histogram(m.name, unitOpts...)
+		})
+		if err != nil {
+			return err
+		}
+		// A sampled timer stands for 1/rate measurements of the same value
+		for range max(1, int(1/m.rate+0.5)) {
+			h.Record(ctx, value, opt)
+		}
+	default:
+		return fmt.Errorf("unsupported metric type %s: %q", m.kind, line)
+	}
+	return nil
+}
+
+// statsdInstrument returns the instrument cached under key, creating it
+// with create on first use
+func statsdInstrument[I any](cache map[string]I, key string, create func() (I, error)) (I, error) {
+	if inst, ok := cache[key]; ok {
+		return inst, nil
+	}
+	inst, err := create()
+	if err != nil {
+		return inst, fmt.Errorf("invalid instrument: %w", err)
+	}
+	cache[key] = inst
+	return inst, nil
+}
+
+// statsdInstrumentName replaces the characters OTel instrument names don't
+// allow; StatsD names are otherwise taken as they are, dots included
+func statsdInstrumentName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '_' || r == '.' || r == '-' || r == '/' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+	if c := name[0]; !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+		name = "statsd_" + name
+	}
+	return name
+}
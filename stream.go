@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
+	"otel-demo/telemetry"
+)
+
+const watchStockMethod = "/clickstack.demo.Inventory/WatchStock"
+
+// runStreams keeps the WatchStock streams of scenario.grpc_stream open one
+// after another until ctx is done, which closes the one in progress
+func (inv *inventory) runStreams(ctx context.Context, cfg telemetry.GRPCStreamConfig, seed uint64) {
+	// A source of its own, apart from the requests' and the long jobs',
+	// keeps seeded runs reproducible
+	rng := rand.New(rand.NewPCG(seed, math.MaxUint64-2))
+	for n := 1; ctx.Err() == nil; n++ {
+		inv.watch(ctx, cfg, rng, n)
+	}
+}
+
+// watch holds one WatchStock stream open under a stock-watch root span.
+// The otelgrpc client span lasts as long as the stream, with a message
+// event for every message either way; the client sends a SKU to watch
+// every interval and counts the updates coming back. When the duration
+// is up, or ctx is done, the client closes its side and the stream ends
+// once the server has answered everything.
+func (inv *inventory) watch(ctx context.Context, cfg telemetry.GRPCStreamConfig, rng *rand.Rand, n int) {
+	sc := *inv.current()
+	// Ended after ctx is done, so the span mustn't be tied to it
+	watchCtx, span := inv.tracer.Start(context.WithoutCancel(ctx), "stock-watch",
+		trace.WithNewRoot(),
+		trace.WithAttributes(
+			attribute.Int("stream.run", n),
+			attribute.Float64("stream.expected_duration_s", cfg.Duration.Seconds()),
+		),
+		trace.WithAttributes(scenarioAttributes(sc)...))
+	defer span.End()
+
+	stream, err := inv.conn.NewStream(watchCtx, &inventoryServiceDesc.Streams[0], watchStockMethod)
+	if err != nil {
+		telemetry.RecordError(span, err)
+		// Don't spin on a server that's gone
+		select {
+		case <-ctx.Done():
+		case <-time.After(cfg.Interval.Max):
+		}
+		return
+	}
+	received := make(chan int, 1)
+	go func() {
+		var updates int
+		for {
+			if err := stream.RecvMsg(new(structpb.Struct)); err != nil {
+				received <- updates
+				return
+			}
+			updates++
+		}
+	}()
+
+	var sent int
+	deadline := time.After(cfg.Duration)
+	next := time.After(cfg.Interval.Sample(rng))
+send:
+	for {
+		select {
+		case <-ctx.Done():
+			break send
+		case <-deadline:
+			break send
+		case <-next:
+		}
+		req, err := structpb.NewStruct(map[string]any{
+			"sku":  fmt.Sprintf("sku-%03d", rng.IntN(1000)),
+			"seed": strconv.FormatUint(rng.Uint64(), 10),
+		})
+		if err != nil {
+			telemetry.RecordError(span, err)
+			break
+		}
+		if err := stream.SendMsg(req); err != nil {
+			// The reason comes out of RecvMsg
+			break
+		}
+		sent++
+		next = time.After(cfg.Interval.Sample(rng))
+	}
+	// The client span ends as the stream does, once the server is done
+	trace.SpanFromContext(stream.Context()).SetAttributes(attribute.Int("stream.messages_sent", sent))
+	if err := stream.CloseSend(); err != nil {
+		telemetry.RecordError(span, err)
+	}
+	updates := <-received
+	span.SetAttributes(
+		attribute.Int("stream.messages_sent", sent),
+		attribute.Int("stream.messages_received", updates),
+	)
+	logRecord(watchCtx, inv.logger, fmt.Sprintf("Stock watch stream %d closed after %d messages sent and %d received", n, sent, updates), otellog.SeverityInfo,
+		otellog.String("component", "inventory-client"),
+		otellog.Int("messages_sent", sent),
+		otellog.Int("messages_received", updates))
+}
+
+// watchStock is the server's side of a WatchStock stream, under its
+// otelgrpc server span: every SKU the client sends to watch is answered
+// with one to three stock updates, until the client closes its side
+func (inv *inventory) watchStock(stream grpc.ServerStream) error {
+	ctx := stream.Context()
+	var received, sent int
+	for {
+		req := new(structpb.Struct)
+		err := stream.RecvMsg(req)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		received++
+		sku := req.Fields["sku"].GetStringValue()
+		seed, _ := strconv.ParseUint(req.Fields["seed"].GetStringValue(), 10, 64)
+		rng := rand.New(rand.NewPCG(seed, 0))
+		quantity := 1 + rng.IntN(500)
+		for range 1 + rng.IntN(3) {
+			quantity = max(0, quantity-rng.IntN(5))
+			update, err := structpb.NewStruct(map[string]any{"sku": sku, "quantity": quantity})
+			if err != nil {
+				return err
+			}
+			if err := stream.SendMsg(update); err != nil {
+				return err
+			}
+			sent++
+		}
+	}
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int("stream.messages_received", received),
+		attribute.Int("stream.messages_sent", sent),
+	)
+	logRecord(ctx, inv.logger, fmt.Sprintf("Stock watch stream closed: %d SKUs watched, %d updates sent", received, sent), otellog.SeverityInfo,
+		otellog.String("component", "inventory"),
+		otellog.Int("messages_received", received),
+		otellog.Int("messages_sent", sent))
+	return nil
+}
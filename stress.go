@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"otel-demo/telemetry"
+)
+
+// largeAttributeOptions returns the client options for
+// scenario.large_attributes: the processor adding the attributes and span
+// limits with room for them, unless limits.attribute_count sets the limit
+func largeAttributeOptions(cfg *telemetry.Config) []telemetry.Option {
+	la := cfg.Scenario.LargeAttributes
+	if la.Count == 0 && la.Size == 0 {
+		return nil
+	}
+	limits := cfg.Limits.SpanLimits()
+	if cfg.Limits.AttributeCount == 0 {
+		// Room for the span's own attributes as well
+		limits.AttributeCountLimit = max(limits.AttributeCountLimit, la.Count+64)
+	}
+	return []telemetry.Option{
+		telemetry.WithSpanProcessor(newLargeAttributesProcessor(la)),
+		telemetry.WithSpanLimits(limits),
+	}
+}
+
+// largeAttributesProcessor adds the oversized attributes to every span as
+// it starts. The SQL statement and the keys are the same for every span,
+// as they'd be in a real service; the blob and the values are drawn
+// afresh, so compression can't fold them across the spans of a batch.
+type largeAttributesProcessor struct {
+	statement string
+	blobSize  int
+	keys      []string
+}
+
+func newLargeAttributesProcessor(cfg telemetry.LargeAttributesConfig) *largeAttributesProcessor {
+	p := &largeAttributesProcessor{blobSize: cfg.Size}
+	if cfg.Size > 0 {
+		p.statement = largeStatement(cfg.Size)
+	}
+	for i := range cfg.Count {
+		p.keys = append(p.keys, fmt.Sprintf("stress.attr.%03d", i))
+	}
+	return p
+}
+
+// largeStatement returns a query of about size bytes, a join whose IN list
+// of placeholders grows to fit, as ORMs generate for batch lookups
+func largeStatement(size int) string {
+	var b strings.Builder
+	b.WriteString("SELECT o.id, o.user_id, o.status, o.total, o.created_at, i.sku, i.quantity, i.price " +
+		"FROM orders o JOIN order_items i ON i.order_id = o.id WHERE o.id IN (?")
+	for b.Len() < size-1 {
+		b.WriteString(", ?")
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+func (p *largeAttributesProcessor) OnStart(_ context.Context, s sdktrace.ReadWriteSpan) {
+	attrs := make([]attribute.KeyValue, 0, len(p.keys)+2)
+	if p.blobSize > 0 {
+		// Three bytes make four base64 characters
+		raw := make([]byte, p.blobSize*3/4)
+		for i := range raw {
+			raw[i] = byte(rand.Uint32())
+		}
+		attrs = append(attrs,
+			attribute.String("stress.sql", p.statement),
+			attribute.String("stress.blob", base64.StdEncoding.EncodeToString(raw)))
+	}
+	for _, k := range p.keys {
+		attrs = append(attrs, attribute.String(k, fmt.Sprintf("%016x", rand.Uint64())))
+	}
+	s.SetAttributes(attrs...)
+}
+
+func (p *largeAttributesProcessor) OnEnd(sdktrace.ReadOnlySpan)      {}
+func (p *largeAttributesProcessor) Shutdown(context.Context) error   { return nil }
+func (p *largeAttributesProcessor) ForceFlush(context.Context) error { return nil }
@@ -0,0 +1,258 @@
+package telemetry
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TimeShift moves the timestamps of everything exported into the past, to
+// backfill history: the over of real time from when it's made is spread,
+// window/over times faster, across the window ending when over has passed,
+// so the history ends as the run does and nothing is dated in the future.
+// All the spans and logs of a trace move by the same amount, keeping their
+// durations and order as they were; it's the time between traces, and
+// between metric data points, that is stretched. Share one between the
+// clients of a process, so that the traces crossing them stay whole.
+type TimeShift struct {
+	start        time.Time
+	window, over time.Duration
+	factor       float64
+
+	mu        sync.Mutex
+	traces    map[trace.TraceID]traceShift
+	lastSweep time.Time
+}
+
+type traceShift struct {
+	offset time.Duration
+	used   time.Time
+}
+
+// traceShiftIdle is how long a trace's offset is kept after its last span
+// or log went out
+const traceShiftIdle = time.Minute
+
+// NewTimeShift returns a TimeShift taking over to backfill window, which
+// must not be shorter, starting now
+func NewTimeShift(window, over time.Duration) *TimeShift {
+	now := time.Now()
+	return &TimeShift{
+		start:     now,
+		window:    window,
+		over:      over,
+		factor:    float64(window) / float64(over),
+		traces:    map[trace.TraceID]traceShift{},
+		lastSweep: now,
+	}
+}
+
+// Factor is how many times faster than real time the window is filled
+func (s *TimeShift) Factor() float64 {
+	return s.factor
+}
+
+// at returns the offset moving t into the window; past the end of the
+// backfill, such as the final flush, times are left as they are
+func (s *TimeShift) at(t time.Time) time.Duration {
+	elapsed := min(t.Sub(s.start), s.over)
+	return time.Duration(float64(elapsed)*(s.factor-1)) - (s.window - s.over)
+}
+
+// trace returns the offset for the trace with the ID, drawn from t the
+// first time the trace is seen
+func (s *TimeShift) trace(id trace.TraceID, t time.Time) time.Duration {
+	if !id.IsValid() {
+		return s.at(t)
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) > traceShiftIdle {
+		for id, ts := range s.traces {
+			if now.Sub(ts.used) > traceShiftIdle {
+				delete(s.traces, id)
+			}
+		}
+		s.lastSweep = now
+	}
+	ts, ok := s.traces[id]
+	if !ok {
+		ts.offset = s.at(t)
+	}
+	ts.used = now
+	s.traces[id] = ts
+	return ts.offset
+}
+
+// WithTimeShift moves the timestamps of every span, log record and metric
+// data point the client exports, Prometheus' excepted, as shift says. nil
+// leaves them as they are.
+func WithTimeShift(shift *TimeShift) Option {
+	return func(o *clientOptions) { o.clock.shift = shift }
+}
+
+// WithClockSkew moves the timestamps of everything the client exports,
+// Prometheus' excepted, by skew, as if its host's clock were off by that
+// much. Spans of other clients' traces then seem to start before their
+// parents or after they end, as they do between hosts whose clocks drift.
+// It adds to a WithTimeShift.
+func WithClockSkew(skew time.Duration) Option {
+	return func(o *clientOptions) { o.clock.skew = skew }
+}
+
+// clockOffset is how far a client's exports are moved in time: by the
+// TimeShift, if any, and the clock skew
+type clockOffset struct {
+	shift *TimeShift
+	skew  time.Duration
+}
+
+func (c clockOffset) enabled() bool {
+	return c.shift != nil || c.skew != 0
+}
+
+// trace returns the offset of the spans and logs of the trace with the ID
+func (c clockOffset) trace(id trace.TraceID, t time.Time) time.Duration {
+	if c.shift == nil {
+		return c.skew
+	}
+	return c.shift.trace(id, t) + c.skew
+}
+
+// at returns the offset of t outside a trace
+func (c clockOffset) at(t time.Time) time.Duration {
+	if c.shift == nil {
+		return c.skew
+	}
+	return c.shift.at(t) + c.skew
+}
+
+type shiftSpanExporter struct {
+	sdktrace.SpanExporter
+	shift clockOffset
+}
+
+func (e shiftSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	shifted := make([]sdktrace.ReadOnlySpan, len(spans))
+	for i, s := range spans {
+		d := e.shift.trace(s.SpanContext().TraceID(), s.StartTime())
+		events := make([]sdktrace.Event, len(s.Events()))
+		for j, ev := range s.Events() {
+			ev.Time = ev.Time.Add(d)
+			events[j] = ev
+		}
+		shifted[i] = shiftedSpan{
+			rewrittenSpan: rewrittenSpan{ReadOnlySpan: s, attrs: s.Attributes(), events: events},
+			start:         s.StartTime().Add(d),
+			end:           s.EndTime().Add(d),
+		}
+	}
+	return e.SpanExporter.ExportSpans(ctx, shifted)
+}
+
+// shiftedSpan is an ended span moved in time
+type shiftedSpan struct {
+	rewrittenSpan
+	start, end time.Time
+}
+
+func (s shiftedSpan) StartTime() time.Time { return s.start }
+func (s shiftedSpan) EndTime() time.Time   { return s.end }
+
+type shiftLogExporter struct {
+	sdklog.Exporter
+	shift clockOffset
+}
+
+func (e shiftLogExporter) Export(ctx context.Context, records []sdklog.Record) error {
+	shifted := make([]sdklog.Record, len(records))
+	for i, r := range records {
+		r = r.Clone()
+		d := e.shift.trace(r.TraceID(), r.Timestamp())
+		r.SetTimestamp(r.Timestamp().Add(d))
+		if t := r.ObservedTimestamp(); !t.IsZero() {
+			r.SetObservedTimestamp(t.Add(d))
+		}
+		shifted[i] = r
+	}
+	return e.Exporter.Export(ctx, shifted)
+}
+
+// shiftMetricExporter moves the data points in place, so it goes in front
+// of anything that might export a batch again
+type shiftMetricExporter struct {
+	sdkmetric.Exporter
+	shift clockOffset
+}
+
+func (e shiftMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	for i := range rm.ScopeMetrics {
+		for j := range rm.ScopeMetrics[i].Metrics {
+			m := &rm.ScopeMetrics[i].Metrics[j]
+			switch data := m.Data.(type) {
+			case metricdata.Gauge[int64]:
+				shiftPoints(e.shift, data.DataPoints)
+			case metricdata.Gauge[float64]:
+				shiftPoints(e.shift, data.DataPoints)
+			case metricdata.Sum[int64]:
+				shiftPoints(e.shift, data.DataPoints)
+			case metricdata.Sum[float64]:
+				shiftPoints(e.shift, data.DataPoints)
+			case metricdata.Histogram[int64]:
+				shiftHistogramPoints(e.shift, data.DataPoints)
+			case metricdata.Histogram[float64]:
+				shiftHistogramPoints(e.shift, data.DataPoints)
+			case metricdata.ExponentialHistogram[int64]:
+				shiftExponentialPoints(e.shift, data.DataPoints)
+			case metricdata.ExponentialHistogram[float64]:
+				shiftExponentialPoints(e.shift, data.DataPoints)
+			}
+		}
+	}
+	return e.Exporter.Export(ctx, rm)
+}
+
+func shiftPoints[N int64 | float64](s clockOffset, points []metricdata.DataPoint[N]) {
+	for i := range points {
+		p := &points[i]
+		p.StartTime, p.Time = shiftTime(s, p.StartTime), shiftTime(s, p.Time)
+		shiftExemplars(s, p.Exemplars)
+	}
+}
+
+func shiftHistogramPoints[N int64 | float64](s clockOffset, points []metricdata.HistogramDataPoint[N]) {
+	for i := range points {
+		p := &points[i]
+		p.StartTime, p.Time = shiftTime(s, p.StartTime), shiftTime(s, p.Time)
+		shiftExemplars(s, p.Exemplars)
+	}
+}
+
+func shiftExponentialPoints[N int64 | float64](s clockOffset, points []metricdata.ExponentialHistogramDataPoint[N]) {
+	for i := range points {
+		p := &points[i]
+		p.StartTime, p.Time = shiftTime(s, p.StartTime), shiftTime(s, p.Time)
+		shiftExemplars(s, p.Exemplars)
+	}
+}
+
+func shiftExemplars[N int64 | float64](s clockOffset, exemplars []metricdata.Exemplar[N]) {
+	for i := range exemplars {
+		exemplars[i].Time = shiftTime(s, exemplars[i].Time)
+	}
+}
+
+// shiftTime moves t into the window, leaving an unset time unset
+func shiftTime(s clockOffset, t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return t.Add(s.at(t))
+}
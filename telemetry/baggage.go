@@ -0,0 +1,137 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Baggage keys for the correlation entries a request commonly carries
+const (
+	BaggageTenant   = "tenant.id"
+	BaggageUserTier = "user.tier"
+	BaggageOrigin   = "request.origin"
+)
+
+// WithBaggage returns ctx with entries added to its baggage, replacing
+// members of the same keys. The baggage travels to other services with the
+// baggage propagator, and the baggage processors copy it onto spans and log
+// records. Values are percent-encoded on the wire, so any value is allowed;
+// a key that isn't a valid token is an error.
+func WithBaggage(ctx context.Context, entries map[string]string) (context.Context, error) {
+	b := baggage.FromContext(ctx)
+	for _, k := range slices.Sorted(maps.Keys(entries)) {
+		m, err := baggage.NewMemberRaw(k, entries[k])
+		if err != nil {
+			return ctx, fmt.Errorf("invalid baggage entry %q: %w", k, err)
+		}
+		if b, err = b.SetMember(m); err != nil {
+			return ctx, fmt.Errorf("invalid baggage entry %q: %w", k, err)
+		}
+	}
+	return baggage.ContextWithBaggage(ctx, b), nil
+}
+
+// WithTenant, WithUserTier and WithRequestOrigin set the BaggageTenant,
+// BaggageUserTier and BaggageOrigin entries
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return withBaggageEntry(ctx, BaggageTenant, tenant)
+}
+
+func WithUserTier(ctx context.Context, tier string) context.Context {
+	return withBaggageEntry(ctx, BaggageUserTier, tier)
+}
+
+func WithRequestOrigin(ctx context.Context, origin string) context.Context {
+	return withBaggageEntry(ctx, BaggageOrigin, origin)
+}
+
+// withBaggageEntry sets one entry of a well-known key, which can't fail
+func withBaggageEntry(ctx context.Context, key, value string) context.Context {
+	ctx, _ = WithBaggage(ctx, map[string]string{key: value})
+	return ctx
+}
+
+// NewBaggageSpanProcessor returns a processor setting the baggage entries
+// of each span's context as attributes of the span, only those with the
+// keys listed if any are, for WithSpanProcessor. The baggage processor type
+// does the same from the config.
+func NewBaggageSpanProcessor(keys ...string) sdktrace.SpanProcessor {
+	return &baggageSpanProcessor{SpanProcessor: nopSpanProcessor{}, keys: keys}
+}
+
+// NewBaggageLogProcessor is NewBaggageSpanProcessor for log records, for
+// WithLogProcessor
+func NewBaggageLogProcessor(keys ...string) sdklog.Processor {
+	return &baggageLogProcessor{Processor: nopLogProcessor{}, keys: keys}
+}
+
+type baggageSpanProcessor struct {
+	sdktrace.SpanProcessor
+	keys []string
+}
+
+func newBaggageSpanProcessor(cfg ProcessorConfig, next sdktrace.SpanProcessor) (sdktrace.SpanProcessor, error) {
+	return &baggageSpanProcessor{SpanProcessor: next, keys: cfg.Keys}, nil
+}
+
+func (p *baggageSpanProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	for _, m := range baggageMembers(ctx, p.keys) {
+		s.SetAttributes(attribute.String(m.Key(), m.Value()))
+	}
+	p.SpanProcessor.OnStart(ctx, s)
+}
+
+type baggageLogProcessor struct {
+	sdklog.Processor
+	keys []string
+}
+
+func newBaggageLogProcessor(cfg ProcessorConfig, next sdklog.Processor) (sdklog.Processor, error) {
+	return &baggageLogProcessor{Processor: next, keys: cfg.Keys}, nil
+}
+
+func (p *baggageLogProcessor) OnEmit(ctx context.Context, r *sdklog.Record) error {
+	for _, m := range baggageMembers(ctx, p.keys) {
+		r.AddAttributes(otellog.String(m.Key(), m.Value()))
+	}
+	return p.Processor.OnEmit(ctx, r)
+}
+
+// baggageMembers returns the members of ctx's baggage with the keys, or
+// all of them without any
+func baggageMembers(ctx context.Context, keys []string) []baggage.Member {
+	b := baggage.FromContext(ctx)
+	if len(keys) == 0 {
+		return b.Members()
+	}
+	var members []baggage.Member
+	for _, k := range keys {
+		if m := b.Member(k); m.Key() != "" {
+			members = append(members, m)
+		}
+	}
+	return members
+}
+
+// nopSpanProcessor and nopLogProcessor end the processors registered on
+// their own rather than in a chain
+type nopSpanProcessor struct{}
+
+func (nopSpanProcessor) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+func (nopSpanProcessor) OnEnd(sdktrace.ReadOnlySpan)                     {}
+func (nopSpanProcessor) Shutdown(context.Context) error                  { return nil }
+func (nopSpanProcessor) ForceFlush(context.Context) error                { return nil }
+
+type nopLogProcessor struct{}
+
+func (nopLogProcessor) OnEmit(context.Context, *sdklog.Record) error { return nil }
+func (nopLogProcessor) Shutdown(context.Context) error               { return nil }
+func (nopLogProcessor) ForceFlush(context.Context) error             { return nil }
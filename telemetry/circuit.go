@@ -0,0 +1,417 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// circuitBreaker stops a signal from hammering a collector that keeps
+// failing. After FailureThreshold consecutive failed exports the circuit
+// opens: batches are dropped, or held in a bounded buffer, without being
+// sent, and every ProbeInterval one batch is let through to see whether the
+// collector is back. The first probe that succeeds closes the circuit
+// again, and from then on every export is followed by one held batch,
+// oldest first, until none are left. Opening and closing are reported to
+// the otel error handler, as are the batches still held at shutdown, which
+// are sent first if the circuit is closed.
+//
+// Dropped batches, and held ones until they're replayed, never reach the
+// counting exporter underneath, so the run summary shows them as neither
+// exported nor failed.
+type circuitBreaker[T any] struct {
+	cfg     CircuitBreakerConfig
+	signal  string
+	export  func(context.Context, T) error
+	clone   func(T) (T, bool) // nil when batches are dropped, as cumulative metrics are
+	counter metric.Int64Counter
+
+	mu        sync.Mutex
+	failures  int
+	open      bool
+	probing   bool
+	openedAt  time.Time
+	nextProbe time.Time
+	held      []T
+	dropped   int
+}
+
+func newCircuitBreaker[T any](cfg CircuitBreakerConfig, signal string, export func(context.Context, T) error, clone func(T) (T, bool)) *circuitBreaker[T] {
+	// The global meter forwards to the real provider once it's installed
+	counter, err := otel.Meter("otel-demo/exporter").Int64Counter(
+		"exporter_circuit_transitions_total",
+		metric.WithDescription("Times an exporter circuit breaker opened or closed"),
+		metric.WithUnit("1"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	if cfg.Mode != "buffer" {
+		clone = nil
+	}
+	return &circuitBreaker[T]{cfg: cfg, signal: signal, export: export, clone: clone, counter: counter}
+}
+
+// do exports batch unless the circuit is open, then replays a held batch
+// if there is one. The lock is never held across an export, and only one
+// probe is in flight at a time.
+func (b *circuitBreaker[T]) do(ctx context.Context, batch T) error {
+	start := time.Now()
+	b.mu.Lock()
+	if b.open && (b.probing || start.Before(b.nextProbe)) {
+		b.hold(batch)
+		b.mu.Unlock()
+		return nil
+	}
+	b.probing = b.open
+	b.mu.Unlock()
+
+	err := b.export(ctx, batch)
+
+	b.mu.Lock()
+	b.probing = false
+	if err != nil {
+		defer b.mu.Unlock()
+		b.failures++
+		switch {
+		case b.open:
+			// The probe failed, wait for the next one
+			b.nextProbe = time.Now().Add(b.cfg.ProbeInterval)
+			b.hold(batch)
+			return nil
+		case b.failures >= b.cfg.FailureThreshold:
+			b.trip(err)
+		}
+		return err
+	}
+	b.failures = 0
+	if b.open {
+		b.close()
+	}
+	var next T
+	replay := len(b.held) > 0
+	if replay {
+		next, b.held = b.held[0], b.held[1:]
+	}
+	b.mu.Unlock()
+
+	if replay {
+		b.replay(ctx, start, next)
+	}
+	return nil
+}
+
+func (b *circuitBreaker[T]) trip(err error) {
+	now := time.Now()
+	b.open = true
+	b.openedAt = now
+	b.nextProbe = now.Add(b.cfg.ProbeInterval)
+	action := "dropping"
+	if b.clone != nil {
+		action = "buffering"
+	}
+	otel.Handle(fmt.Errorf("circuit open for %s after %d consecutive failed exports (%w); %s batches and probing every %s",
+		b.signal, b.failures, err, action, b.cfg.ProbeInterval))
+	b.record("open")
+}
+
+func (b *circuitBreaker[T]) close() {
+	otel.Handle(fmt.Errorf("circuit closed for %s: collector recovered after %s, replaying %d held batches, %d dropped",
+		b.signal, time.Since(b.openedAt).Round(time.Millisecond), len(b.held), b.dropped))
+	b.open, b.dropped = false, 0
+	b.record("closed")
+}
+
+// replay sends a held batch with a deadline of its own, as long as the
+// export it follows had from start. A failure puts the batch back and
+// reopens the circuit.
+func (b *circuitBreaker[T]) replay(ctx context.Context, start time.Time, batch T) {
+	deadline, ok := ctx.Deadline()
+	ctx = context.WithoutCancel(ctx)
+	if ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, deadline.Sub(start))
+		defer cancel()
+	}
+	if err := b.export(ctx, batch); err != nil {
+		b.requeue(batch, err)
+	}
+}
+
+// requeue puts back a held batch whose replay failed, and reopens the
+// circuit
+func (b *circuitBreaker[T]) requeue(batch T, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.held) < b.cfg.BufferSize {
+		b.held = append([]T{batch}, b.held...)
+	} else {
+		// It's the oldest, which hold would evict first
+		b.dropped++
+	}
+	if !b.open {
+		b.failures = b.cfg.FailureThreshold
+		b.trip(err)
+	}
+}
+
+// hold keeps a copy of batch for the replay, evicting the oldest when the
+// buffer is full, or drops it when the circuit doesn't buffer. A batch with
+// nothing in it worth holding is let go without counting it as dropped.
+func (b *circuitBreaker[T]) hold(batch T) {
+	if b.clone == nil {
+		b.dropped++
+		return
+	}
+	held, ok := b.clone(batch)
+	if !ok {
+		return
+	}
+	if len(b.held) >= b.cfg.BufferSize {
+		b.held = b.held[1:]
+		b.dropped++
+	}
+	b.held = append(b.held, held)
+}
+
+// drain replays the held batches while the circuit stays closed, until none
+// are left or ctx is done, and returns how many are still held
+func (b *circuitBreaker[T]) drain(ctx context.Context) int {
+	for ctx.Err() == nil {
+		b.mu.Lock()
+		if b.open || len(b.held) == 0 {
+			b.mu.Unlock()
+			break
+		}
+		next := b.held[0]
+		b.held = b.held[1:]
+		b.mu.Unlock()
+
+		if err := b.export(ctx, next); err != nil {
+			b.requeue(next, err)
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.held)
+}
+
+// shutdown drains what it can and reports the batches that are lost, held
+// or dropped, as nothing will send them after it
+func (b *circuitBreaker[T]) shutdown(ctx context.Context) {
+	held := b.drain(ctx)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if held > 0 || b.dropped > 0 {
+		otel.Handle(fmt.Errorf("circuit for %s at shutdown: %d held batches not sent, %d dropped",
+			b.signal, held, b.dropped))
+	}
+	b.held, b.dropped = nil, 0
+}
+
+func (b *circuitBreaker[T]) record(state string) {
+	if b.counter == nil {
+		return
+	}
+	b.counter.Add(context.Background(), 1, metric.WithAttributes(
+		attribute.String("signal", b.signal),
+		attribute.String("state", state),
+	))
+}
+
+type circuitSpanExporter struct {
+	sdktrace.SpanExporter
+	breaker *circuitBreaker[[]sdktrace.ReadOnlySpan]
+}
+
+func newCircuitSpanExporter(exp sdktrace.SpanExporter, cfg CircuitBreakerConfig) circuitSpanExporter {
+	// Ended spans are immutable, so holding the slice is enough
+	clone := func(spans []sdktrace.ReadOnlySpan) ([]sdktrace.ReadOnlySpan, bool) {
+		return append([]sdktrace.ReadOnlySpan(nil), spans...), len(spans) > 0
+	}
+	return circuitSpanExporter{exp, newCircuitBreaker(cfg, "traces", exp.ExportSpans, clone)}
+}
+
+func (e circuitSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	return e.breaker.do(ctx, spans)
+}
+
+func (e circuitSpanExporter) Shutdown(ctx context.Context) error {
+	e.breaker.shutdown(ctx)
+	return e.SpanExporter.Shutdown(ctx)
+}
+
+type circuitLogExporter struct {
+	sdklog.Exporter
+	breaker *circuitBreaker[[]sdklog.Record]
+}
+
+func newCircuitLogExporter(exp sdklog.Exporter, cfg CircuitBreakerConfig) circuitLogExporter {
+	// The batch processor reuses the records slice after Export returns
+	clone := func(records []sdklog.Record) ([]sdklog.Record, bool) {
+		held := make([]sdklog.Record, len(records))
+		for i, r := range records {
+			held[i] = r.Clone()
+		}
+		return held, len(held) > 0
+	}
+	return circuitLogExporter{exp, newCircuitBreaker(cfg, "logs", exp.Export, clone)}
+}
+
+func (e circuitLogExporter) Export(ctx context.Context, records []sdklog.Record) error {
+	return e.breaker.do(ctx, records)
+}
+
+func (e circuitLogExporter) ForceFlush(ctx context.Context) error {
+	e.breaker.drain(ctx)
+	return e.Exporter.ForceFlush(ctx)
+}
+
+func (e circuitLogExporter) Shutdown(ctx context.Context) error {
+	e.breaker.shutdown(ctx)
+	return e.Exporter.Shutdown(ctx)
+}
+
+type circuitMetricExporter struct {
+	sdkmetric.Exporter
+	breaker *circuitBreaker[*metricdata.ResourceMetrics]
+}
+
+func newCircuitMetricExporter(exp sdkmetric.Exporter, cfg CircuitBreakerConfig, temporality string) circuitMetricExporter {
+	// Cumulative totals are dropped while the circuit is open, as the first
+	// export after recovery catches up anyway. A delta batch is the only
+	// record of its interval, so it's held like spans and logs are, but
+	// only its delta points: the gauges and cumulative sums in it would
+	// reach the backend after newer values when replayed.
+	var clone func(*metricdata.ResourceMetrics) (*metricdata.ResourceMetrics, bool)
+	if temporality != "cumulative" {
+		clone = cloneDeltaMetrics
+	}
+	return circuitMetricExporter{exp, newCircuitBreaker(cfg, "metrics", exp.Export, clone)}
+}
+
+// cloneDeltaMetrics deep-copies the delta sums and histograms in rm, whose
+// slices the periodic reader reuses for the next collection once Export
+// returns, and reports whether there were any
+func cloneDeltaMetrics(rm *metricdata.ResourceMetrics) (*metricdata.ResourceMetrics, bool) {
+	held := &metricdata.ResourceMetrics{Resource: rm.Resource}
+	for _, sm := range rm.ScopeMetrics {
+		var metrics []metricdata.Metrics
+		for _, m := range sm.Metrics {
+			if isDelta(m.Data) {
+				metrics = append(metrics, m)
+			}
+		}
+		if len(metrics) > 0 {
+			held.ScopeMetrics = append(held.ScopeMetrics, metricdata.ScopeMetrics{Scope: sm.Scope, Metrics: metrics})
+		}
+	}
+	for i := range held.ScopeMetrics {
+		sm := &held.ScopeMetrics[i]
+		for j := range sm.Metrics {
+			m := &sm.Metrics[j]
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				data.DataPoints = clonePoints(data.DataPoints)
+				m.Data = data
+			case metricdata.Sum[float64]:
+				data.DataPoints = clonePoints(data.DataPoints)
+				m.Data = data
+			case metricdata.Histogram[int64]:
+				data.DataPoints = cloneHistogramPoints(data.DataPoints)
+				m.Data = data
+			case metricdata.Histogram[float64]:
+				data.DataPoints = cloneHistogramPoints(data.DataPoints)
+				m.Data = data
+			case metricdata.ExponentialHistogram[int64]:
+				data.DataPoints = cloneExponentialPoints(data.DataPoints)
+				m.Data = data
+			case metricdata.ExponentialHistogram[float64]:
+				data.DataPoints = cloneExponentialPoints(data.DataPoints)
+				m.Data = data
+			}
+		}
+	}
+	return held, len(held.ScopeMetrics) > 0
+}
+
+func isDelta(data metricdata.Aggregation) bool {
+	switch data := data.(type) {
+	case metricdata.Sum[int64]:
+		return data.Temporality == metricdata.DeltaTemporality
+	case metricdata.Sum[float64]:
+		return data.Temporality == metricdata.DeltaTemporality
+	case metricdata.Histogram[int64]:
+		return data.Temporality == metricdata.DeltaTemporality
+	case metricdata.Histogram[float64]:
+		return data.Temporality == metricdata.DeltaTemporality
+	case metricdata.ExponentialHistogram[int64]:
+		return data.Temporality == metricdata.DeltaTemporality
+	case metricdata.ExponentialHistogram[float64]:
+		return data.Temporality == metricdata.DeltaTemporality
+	}
+	return false
+}
+
+func clonePoints[N int64 | float64](points []metricdata.DataPoint[N]) []metricdata.DataPoint[N] {
+	points = slices.Clone(points)
+	for i := range points {
+		points[i].Exemplars = cloneExemplars(points[i].Exemplars)
+	}
+	return points
+}
+
+func cloneHistogramPoints[N int64 | float64](points []metricdata.HistogramDataPoint[N]) []metricdata.HistogramDataPoint[N] {
+	points = slices.Clone(points)
+	for i := range points {
+		p := &points[i]
+		p.Bounds, p.BucketCounts = slices.Clone(p.Bounds), slices.Clone(p.BucketCounts)
+		p.Exemplars = cloneExemplars(p.Exemplars)
+	}
+	return points
+}
+
+func cloneExponentialPoints[N int64 | float64](points []metricdata.ExponentialHistogramDataPoint[N]) []metricdata.ExponentialHistogramDataPoint[N] {
+	points = slices.Clone(points)
+	for i := range points {
+		p := &points[i]
+		p.PositiveBucket.Counts = slices.Clone(p.PositiveBucket.Counts)
+		p.NegativeBucket.Counts = slices.Clone(p.NegativeBucket.Counts)
+		p.Exemplars = cloneExemplars(p.Exemplars)
+	}
+	return points
+}
+
+func cloneExemplars[N int64 | float64](exemplars []metricdata.Exemplar[N]) []metricdata.Exemplar[N] {
+	exemplars = slices.Clone(exemplars)
+	for i := range exemplars {
+		e := &exemplars[i]
+		e.FilteredAttributes = slices.Clone(e.FilteredAttributes)
+		e.SpanID, e.TraceID = slices.Clone(e.SpanID), slices.Clone(e.TraceID)
+	}
+	return exemplars
+}
+
+func (e circuitMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	return e.breaker.do(ctx, rm)
+}
+
+func (e circuitMetricExporter) ForceFlush(ctx context.Context) error {
+	e.breaker.drain(ctx)
+	return e.Exporter.ForceFlush(ctx)
+}
+
+func (e circuitMetricExporter) Shutdown(ctx context.Context) error {
+	e.breaker.shutdown(ctx)
+	return e.Exporter.Shutdown(ctx)
+}
@@ -0,0 +1,231 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+type fakeMetricExporter struct {
+	sdkmetric.Exporter
+	fail     bool
+	exported []int64
+}
+
+func (e *fakeMetricExporter) Export(_ context.Context, rm *metricdata.ResourceMetrics) error {
+	if e.fail {
+		return errors.New("collector down")
+	}
+	e.exported = append(e.exported, rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Sum[int64]).DataPoints[0].Value)
+	return nil
+}
+
+func deltaSum(v int64) *metricdata.ResourceMetrics {
+	return &metricdata.ResourceMetrics{ScopeMetrics: []metricdata.ScopeMetrics{{
+		Metrics: []metricdata.Metrics{{
+			Name: "requests_total",
+			Data: metricdata.Sum[int64]{
+				Temporality: metricdata.DeltaTemporality,
+				IsMonotonic: true,
+				DataPoints:  []metricdata.DataPoint[int64]{{Value: v}},
+			},
+		}},
+	}}}
+}
+
+func TestCircuitHoldsDeltaMetrics(t *testing.T) {
+	cfg := CircuitBreakerConfig{Enabled: true, FailureThreshold: 1, ProbeInterval: time.Millisecond, Mode: "buffer", BufferSize: 10}
+	for _, tc := range []struct {
+		temporality string
+		want        []int64
+	}{
+		{"cumulative", []int64{3}},
+		{"delta", []int64{3, 2}},
+		{"lowmemory", []int64{3, 2}},
+	} {
+		t.Run(tc.temporality, func(t *testing.T) {
+			exp := &fakeMetricExporter{fail: true}
+			c := newCircuitMetricExporter(exp, cfg, tc.temporality)
+			ctx := context.Background()
+			if err := c.Export(ctx, deltaSum(1)); err == nil {
+				t.Fatal("failed export returned no error")
+			}
+			// The reader reuses the batch once Export returns
+			rm := deltaSum(2)
+			if err := c.Export(ctx, rm); err != nil {
+				t.Fatalf("export while open: %v", err)
+			}
+			rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Sum[int64]).DataPoints[0].Value = 99
+
+			time.Sleep(2 * cfg.ProbeInterval)
+			exp.fail = false
+			if err := c.Export(ctx, deltaSum(3)); err != nil {
+				t.Fatalf("probe: %v", err)
+			}
+			if !slices.Equal(exp.exported, tc.want) {
+				t.Errorf("exported %v, want %v", exp.exported, tc.want)
+			}
+		})
+	}
+}
+
+func TestCircuitReplaysOneBatchPerExport(t *testing.T) {
+	cfg := CircuitBreakerConfig{Enabled: true, FailureThreshold: 1, ProbeInterval: time.Hour, Mode: "buffer", BufferSize: 10}
+	var (
+		fail     = true
+		exported []int
+	)
+	b := newCircuitBreaker(cfg, "test", func(_ context.Context, n int) error {
+		if fail {
+			return errors.New("collector down")
+		}
+		exported = append(exported, n)
+		return nil
+	}, func(n int) (int, bool) { return n, true })
+	ctx := context.Background()
+	b.do(ctx, 0)
+	for n := 1; n <= 3; n++ {
+		b.do(ctx, n)
+	}
+	fail = false
+	b.nextProbe = time.Now()
+	for n := 4; n <= 7; n++ {
+		b.do(ctx, n)
+	}
+	if want := []int{4, 1, 5, 2, 6, 3, 7}; !slices.Equal(exported, want) {
+		t.Errorf("exported %v, want %v", exported, want)
+	}
+}
+
+func TestCircuitUnlockedDuringExport(t *testing.T) {
+	cfg := CircuitBreakerConfig{Enabled: true, FailureThreshold: 1, ProbeInterval: time.Millisecond, Mode: "buffer", BufferSize: 10}
+	probing, release := make(chan struct{}), make(chan struct{})
+	var b *circuitBreaker[int]
+	b = newCircuitBreaker(cfg, "test", func(_ context.Context, n int) error {
+		switch n {
+		case 0:
+			return errors.New("collector down")
+		case 1:
+			close(probing)
+			<-release
+		}
+		return nil
+	}, func(n int) (int, bool) { return n, true })
+	ctx := context.Background()
+	b.do(ctx, 0)
+	time.Sleep(2 * cfg.ProbeInterval)
+	go b.do(ctx, 1)
+	<-probing
+
+	// A batch behind the probe is held without waiting for it
+	done := make(chan struct{})
+	go func() {
+		b.do(ctx, 2)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("export blocked behind the probe")
+	}
+	close(release)
+}
+
+func TestCircuitHoldsOnlyDeltaPoints(t *testing.T) {
+	cfg := CircuitBreakerConfig{Enabled: true, FailureThreshold: 1, ProbeInterval: time.Hour, Mode: "buffer", BufferSize: 10}
+	var exported []*metricdata.ResourceMetrics
+	fail := true
+	b := newCircuitBreaker(cfg, "metrics", func(_ context.Context, rm *metricdata.ResourceMetrics) error {
+		if fail {
+			return errors.New("collector down")
+		}
+		exported = append(exported, rm)
+		return nil
+	}, cloneDeltaMetrics)
+	ctx := context.Background()
+
+	b.do(ctx, deltaSum(0))
+	rm := deltaSum(1)
+	rm.ScopeMetrics = append(rm.ScopeMetrics, metricdata.ScopeMetrics{Metrics: []metricdata.Metrics{
+		{Name: "queue_depth", Data: metricdata.Gauge[int64]{DataPoints: []metricdata.DataPoint[int64]{{Value: 4}}}},
+		{Name: "connections", Data: metricdata.Sum[int64]{Temporality: metricdata.CumulativeTemporality, DataPoints: []metricdata.DataPoint[int64]{{Value: 7}}}},
+	}})
+	b.do(ctx, rm)
+	// Nothing in this one is worth holding
+	b.do(ctx, &metricdata.ResourceMetrics{ScopeMetrics: rm.ScopeMetrics[1:]})
+	if len(b.held) != 1 || b.dropped != 0 {
+		t.Fatalf("held %d batches and dropped %d, want 1 and 0", len(b.held), b.dropped)
+	}
+
+	fail = false
+	b.nextProbe = time.Now()
+	b.do(ctx, deltaSum(2))
+	if len(exported) != 2 {
+		t.Fatalf("exported %d batches, want the probe and the held one", len(exported))
+	}
+	var names []string
+	for _, sm := range exported[1].ScopeMetrics {
+		for _, m := range sm.Metrics {
+			names = append(names, m.Name)
+		}
+	}
+	if want := []string{"requests_total"}; !slices.Equal(names, want) {
+		t.Errorf("replayed %v, want %v", names, want)
+	}
+}
+
+func TestCircuitShutdown(t *testing.T) {
+	cfg := CircuitBreakerConfig{Enabled: true, FailureThreshold: 1, ProbeInterval: time.Hour, Mode: "buffer", BufferSize: 10}
+	for _, tc := range []struct {
+		name     string
+		recover  bool
+		exported []int
+		reported bool
+	}{
+		{"closed", true, []int{3, 1, 2}, false},
+		{"open", false, nil, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			prev := otel.GetErrorHandler()
+			t.Cleanup(func() { otel.SetErrorHandler(prev) })
+			var handled []error
+			otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) { handled = append(handled, err) }))
+
+			fail := true
+			var exported []int
+			b := newCircuitBreaker(cfg, "test", func(_ context.Context, n int) error {
+				if fail {
+					return errors.New("collector down")
+				}
+				exported = append(exported, n)
+				return nil
+			}, func(n int) (int, bool) { return n, true })
+			ctx := context.Background()
+			for n := range 3 {
+				b.do(ctx, n)
+			}
+			if tc.recover {
+				fail = false
+				b.nextProbe = time.Now()
+				b.do(ctx, 3)
+			}
+			handled = nil
+			b.shutdown(ctx)
+			if !slices.Equal(exported, tc.exported) {
+				t.Errorf("exported %v, want %v", exported, tc.exported)
+			}
+			if reported := len(handled) > 0; reported != tc.reported {
+				t.Errorf("reported %v, want a report %t", handled, tc.reported)
+			}
+			if len(b.held) != 0 {
+				t.Errorf("%d batches still held", len(b.held))
+			}
+		})
+	}
+}
@@ -0,0 +1,516 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// clickhouseURL resolves ep.Endpoint to a ClickHouse HTTP interface URL,
+// with 8123 and 8443 as the default ports. Query parameters such as
+// database=otel are kept and apply to every insert.
+func clickhouseURL(ep EndpointConfig) (*url.URL, error) {
+	return endpointURL(ep, "8123", "8443", "/")
+}
+
+// clickhouseClient inserts rows straight into the tables the collector's
+// ClickHouse exporter creates for ClickStack, as JSONEachRow over the HTTP
+// interface. Credentials in the endpoint URL are sent as the
+// X-ClickHouse-User and X-ClickHouse-Key headers so they never show up in
+// error messages.
+type clickhouseClient struct {
+	*otlpJSONClient
+	base *url.URL
+}
+
+func newClickHouseClient(ep EndpointConfig) (*clickhouseClient, error) {
+	u, err := clickhouseURL(ep)
+	if err != nil {
+		return nil, err
+	}
+	headers := maps.Clone(ep.Headers)
+	if u.User != nil {
+		if headers == nil {
+			headers = map[string]string{}
+		}
+		headers["X-ClickHouse-User"] = u.User.Username()
+		if password, ok := u.User.Password(); ok {
+			headers["X-ClickHouse-Key"] = password
+		}
+		u.User = nil
+	}
+	c, err := newJSONClient(ep, u, headers)
+	if err != nil {
+		return nil, err
+	}
+	return &clickhouseClient{otlpJSONClient: c, base: u}, nil
+}
+
+func (c *clickhouseClient) insert(ctx context.Context, table string, rows []any) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			return err
+		}
+	}
+
+	u := *c.base
+	q := u.Query()
+	q.Set("query", "INSERT INTO "+table+" FORMAT JSONEachRow")
+	// Timestamps are RFC 3339 with a zone, which the default parser rejects
+	q.Set("date_time_input_format", "best_effort")
+	u.RawQuery = q.Encode()
+	if err := c.sendBody(ctx, u.String(), body.Bytes()); err != nil {
+		return fmt.Errorf("insert into %s: %w", table, err)
+	}
+	return nil
+}
+
+// The row types mirror the columns of the ClickHouse exporter's schema.
+// Columns left out take their defaults.
+
+type clickhouseSpan struct {
+	Timestamp          time.Time           `json:"Timestamp"`
+	TraceID            string              `json:"TraceId"`
+	SpanID             string              `json:"SpanId"`
+	ParentSpanID       string              `json:"ParentSpanId"`
+	TraceState         string              `json:"TraceState"`
+	SpanName           string              `json:"SpanName"`
+	SpanKind           string              `json:"SpanKind"`
+	ServiceName        string              `json:"ServiceName"`
+	ResourceAttributes map[string]string   `json:"ResourceAttributes"`
+	ScopeName          string              `json:"ScopeName"`
+	ScopeVersion       string              `json:"ScopeVersion"`
+	SpanAttributes     map[string]string   `json:"SpanAttributes"`
+	Duration           int64               `json:"Duration"`
+	StatusCode         string              `json:"StatusCode"`
+	StatusMessage      string              `json:"StatusMessage"`
+	EventTimestamps    []time.Time         `json:"Events.Timestamp,omitempty"`
+	EventNames         []string            `json:"Events.Name,omitempty"`
+	EventAttributes    []map[string]string `json:"Events.Attributes,omitempty"`
+	LinkTraceIDs       []string            `json:"Links.TraceId,omitempty"`
+	LinkSpanIDs        []string            `json:"Links.SpanId,omitempty"`
+	LinkTraceStates    []string            `json:"Links.TraceState,omitempty"`
+	LinkAttributes     []map[string]string `json:"Links.Attributes,omitempty"`
+}
+
+type clickhouseLog struct {
+	Timestamp          time.Time         `json:"Timestamp"`
+	TraceID            string            `json:"TraceId"`
+	SpanID             string            `json:"SpanId"`
+	TraceFlags         uint8             `json:"TraceFlags"`
+	SeverityText       string            `json:"SeverityText"`
+	SeverityNumber     int               `json:"SeverityNumber"`
+	ServiceName        string            `json:"ServiceName"`
+	Body               string            `json:"Body"`
+	ResourceSchemaURL  string            `json:"ResourceSchemaUrl"`
+	ResourceAttributes map[string]string `json:"ResourceAttributes"`
+	ScopeSchemaURL     string            `json:"ScopeSchemaUrl"`
+	ScopeName          string            `json:"ScopeName"`
+	ScopeVersion       string            `json:"ScopeVersion"`
+	ScopeAttributes    map[string]string `json:"ScopeAttributes"`
+	LogAttributes      map[string]string `json:"LogAttributes"`
+}
+
+// clickhouseMetric holds the columns every otel_metrics_* table shares
+type clickhouseMetric struct {
+	ResourceAttributes map[string]string `json:"ResourceAttributes"`
+	ResourceSchemaURL  string            `json:"ResourceSchemaUrl"`
+	ScopeName          string            `json:"ScopeName"`
+	ScopeVersion       string            `json:"ScopeVersion"`
+	ScopeAttributes    map[string]string `json:"ScopeAttributes"`
+	ScopeSchemaURL     string            `json:"ScopeSchemaUrl"`
+	ServiceName        string            `json:"ServiceName"`
+	MetricName         string            `json:"MetricName"`
+	MetricDescription  string            `json:"MetricDescription"`
+	MetricUnit         string            `json:"MetricUnit"`
+	Attributes         map[string]string `json:"Attributes"`
+	StartTimeUnix      time.Time         `json:"StartTimeUnix"`
+	TimeUnix           time.Time         `json:"TimeUnix"`
+
+	// The Exemplars nested column, one array per field as ClickHouse
+	// flattens it
+	ExemplarsFilteredAttributes []map[string]string `json:"Exemplars.FilteredAttributes"`
+	ExemplarsTimeUnix           []time.Time         `json:"Exemplars.TimeUnix"`
+	ExemplarsValue              []float64           `json:"Exemplars.Value"`
+	ExemplarsSpanID             []string            `json:"Exemplars.SpanId"`
+	ExemplarsTraceID            []string            `json:"Exemplars.TraceId"`
+}
+
+// withExemplars fills in m's exemplar columns
+func withExemplars[N int64 | float64](m clickhouseMetric, exemplars []metricdata.Exemplar[N]) clickhouseMetric {
+	m.ExemplarsFilteredAttributes = make([]map[string]string, len(exemplars))
+	m.ExemplarsTimeUnix = make([]time.Time, len(exemplars))
+	m.ExemplarsValue = make([]float64, len(exemplars))
+	m.ExemplarsSpanID = make([]string, len(exemplars))
+	m.ExemplarsTraceID = make([]string, len(exemplars))
+	for i, e := range exemplars {
+		m.ExemplarsFilteredAttributes[i] = attributeMap(e.FilteredAttributes)
+		m.ExemplarsTimeUnix[i] = e.Time.UTC()
+		m.ExemplarsValue[i] = float64(e.Value)
+		m.ExemplarsSpanID[i] = hex.EncodeToString(e.SpanID)
+		m.ExemplarsTraceID[i] = hex.EncodeToString(e.TraceID)
+	}
+	return m
+}
+
+type clickhouseGauge struct {
+	clickhouseMetric
+	Value float64 `json:"Value"`
+}
+
+type clickhouseSum struct {
+	clickhouseMetric
+	Value                  float64 `json:"Value"`
+	AggregationTemporality int32   `json:"AggregationTemporality"`
+	IsMonotonic            bool    `json:"IsMonotonic"`
+}
+
+type clickhouseHistogram struct {
+	clickhouseMetric
+	Count                  uint64    `json:"Count"`
+	Sum                    float64   `json:"Sum"`
+	BucketCounts           []uint64  `json:"BucketCounts"`
+	ExplicitBounds         []float64 `json:"ExplicitBounds"`
+	Min                    *float64  `json:"Min,omitempty"`
+	Max                    *float64  `json:"Max,omitempty"`
+	AggregationTemporality int32     `json:"AggregationTemporality"`
+}
+
+type clickhouseExponentialHistogram struct {
+	clickhouseMetric
+	Count                  uint64   `json:"Count"`
+	Sum                    float64  `json:"Sum"`
+	Scale                  int32    `json:"Scale"`
+	ZeroCount              uint64   `json:"ZeroCount"`
+	PositiveOffset         int32    `json:"PositiveOffset"`
+	PositiveBucketCounts   []uint64 `json:"PositiveBucketCounts"`
+	NegativeOffset         int32    `json:"NegativeOffset"`
+	NegativeBucketCounts   []uint64 `json:"NegativeBucketCounts"`
+	Min                    *float64 `json:"Min,omitempty"`
+	Max                    *float64 `json:"Max,omitempty"`
+	AggregationTemporality int32    `json:"AggregationTemporality"`
+}
+
+type clickhouseSpanExporter struct{ *clickhouseClient }
+
+func newClickHouseTraceExporter(ep EndpointConfig) (sdktrace.SpanExporter, error) {
+	c, err := newClickHouseClient(ep)
+	if err != nil {
+		return nil, err
+	}
+	return clickhouseSpanExporter{c}, nil
+}
+
+func (e clickhouseSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	return e.insert(ctx, "otel_traces", clickhouseSpanRows(spans))
+}
+
+func (e clickhouseSpanExporter) Shutdown(context.Context) error {
+	e.shutdown()
+	return nil
+}
+
+// clickhouseSpanRows, clickhouseLogRows and clickhouseMetricTables convert
+// a batch into rows of the ClickStack tables, shared by the clickhouse and
+// sql exporters
+func clickhouseSpanRows(spans []sdktrace.ReadOnlySpan) []any {
+	rows := make([]any, 0, len(spans))
+	for _, s := range spans {
+		row := clickhouseSpan{
+			Timestamp:          s.StartTime().UTC(),
+			TraceID:            s.SpanContext().TraceID().String(),
+			SpanID:             s.SpanContext().SpanID().String(),
+			TraceState:         s.SpanContext().TraceState().String(),
+			SpanName:           s.Name(),
+			SpanKind:           clickhouseSpanKind(s.SpanKind()),
+			ServiceName:        resourceServiceName(s.Resource()),
+			ResourceAttributes: attributeMap(s.Resource().Attributes()),
+			ScopeName:          s.InstrumentationScope().Name,
+			ScopeVersion:       s.InstrumentationScope().Version,
+			SpanAttributes:     attributeMap(s.Attributes()),
+			Duration:           s.EndTime().Sub(s.StartTime()).Nanoseconds(),
+			StatusCode:         s.Status().Code.String(),
+			StatusMessage:      s.Status().Description,
+		}
+		if parent := s.Parent(); parent.SpanID().IsValid() {
+			row.ParentSpanID = parent.SpanID().String()
+		}
+		for _, ev := range s.Events() {
+			row.EventTimestamps = append(row.EventTimestamps, ev.Time.UTC())
+			row.EventNames = append(row.EventNames, ev.Name)
+			row.EventAttributes = append(row.EventAttributes, attributeMap(ev.Attributes))
+		}
+		for _, link := range s.Links() {
+			row.LinkTraceIDs = append(row.LinkTraceIDs, link.SpanContext.TraceID().String())
+			row.LinkSpanIDs = append(row.LinkSpanIDs, link.SpanContext.SpanID().String())
+			row.LinkTraceStates = append(row.LinkTraceStates, link.SpanContext.TraceState().String())
+			row.LinkAttributes = append(row.LinkAttributes, attributeMap(link.Attributes))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+type clickhouseLogExporter struct{ *clickhouseClient }
+
+func newClickHouseLogExporter(ep EndpointConfig) (sdklog.Exporter, error) {
+	c, err := newClickHouseClient(ep)
+	if err != nil {
+		return nil, err
+	}
+	return clickhouseLogExporter{c}, nil
+}
+
+func (e clickhouseLogExporter) Export(ctx context.Context, records []sdklog.Record) error {
+	return e.insert(ctx, "otel_logs", clickhouseLogRows(records))
+}
+
+func (e clickhouseLogExporter) ForceFlush(context.Context) error { return nil }
+
+func (e clickhouseLogExporter) Shutdown(context.Context) error {
+	e.shutdown()
+	return nil
+}
+
+func clickhouseLogRows(records []sdklog.Record) []any {
+	rows := make([]any, 0, len(records))
+	for i := range records {
+		r := &records[i]
+		ts := r.Timestamp()
+		if ts.IsZero() {
+			ts = r.ObservedTimestamp()
+		}
+		res, scope := r.Resource(), r.InstrumentationScope()
+		row := clickhouseLog{
+			Timestamp:          ts.UTC(),
+			TraceFlags:         uint8(r.TraceFlags()),
+			SeverityText:       r.SeverityText(),
+			SeverityNumber:     int(r.Severity()),
+			ServiceName:        resourceServiceName(res),
+			Body:               r.Body().String(),
+			ResourceSchemaURL:  res.SchemaURL(),
+			ResourceAttributes: attributeMap(res.Attributes()),
+			ScopeSchemaURL:     scope.SchemaURL,
+			ScopeName:          scope.Name,
+			ScopeVersion:       scope.Version,
+			ScopeAttributes:    attributeMap(scope.Attributes.ToSlice()),
+			LogAttributes:      map[string]string{},
+		}
+		if tid := r.TraceID(); tid.IsValid() {
+			row.TraceID = tid.String()
+		}
+		if sid := r.SpanID(); sid.IsValid() {
+			row.SpanID = sid.String()
+		}
+		r.WalkAttributes(func(kv otellog.KeyValue) bool {
+			row.LogAttributes[kv.Key] = kv.Value.String()
+			return true
+		})
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// clickhouseMetricExporter writes each aggregation to its own table. The
+// generator records no summaries, so they are not inserted.
+type clickhouseMetricExporter struct{ *clickhouseClient }
+
+func newClickHouseMetricExporter(ep EndpointConfig) (sdkmetric.Exporter, error) {
+	c, err := newClickHouseClient(ep)
+	if err != nil {
+		return nil, err
+	}
+	return clickhouseMetricExporter{c}, nil
+}
+
+func (e clickhouseMetricExporter) Temporality(k sdkmetric.InstrumentKind) metricdata.Temporality {
+	return sdkmetric.DefaultTemporalitySelector(k)
+}
+
+func (e clickhouseMetricExporter) Aggregation(k sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return sdkmetric.DefaultAggregationSelector(k)
+}
+
+func (e clickhouseMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	for _, t := range clickhouseMetricTables(rm) {
+		if err := e.insert(ctx, t.table, t.rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e clickhouseMetricExporter) ForceFlush(context.Context) error { return nil }
+
+func (e clickhouseMetricExporter) Shutdown(context.Context) error {
+	e.shutdown()
+	return nil
+}
+
+// clickhouseTable is a batch of rows for one table
+type clickhouseTable struct {
+	table string
+	rows  []any
+}
+
+func clickhouseMetricTables(rm *metricdata.ResourceMetrics) []clickhouseTable {
+	var gauges, sums, histograms, exponentials []any
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			base := func(attrs attribute.Set, start, t time.Time) clickhouseMetric {
+				return clickhouseMetric{
+					ResourceAttributes: attributeMap(rm.Resource.Attributes()),
+					ResourceSchemaURL:  rm.Resource.SchemaURL(),
+					ScopeName:          sm.Scope.Name,
+					ScopeVersion:       sm.Scope.Version,
+					ScopeAttributes:    attributeMap(sm.Scope.Attributes.ToSlice()),
+					ScopeSchemaURL:     sm.Scope.SchemaURL,
+					ServiceName:        resourceServiceName(rm.Resource),
+					MetricName:         m.Name,
+					MetricDescription:  m.Description,
+					MetricUnit:         m.Unit,
+					Attributes:         attributeMap(attrs.ToSlice()),
+					StartTimeUnix:      start.UTC(),
+					TimeUnix:           t.UTC(),
+				}
+			}
+			switch data := m.Data.(type) {
+			case metricdata.Gauge[int64]:
+				gauges = appendGauges(gauges, data.DataPoints, base)
+			case metricdata.Gauge[float64]:
+				gauges = appendGauges(gauges, data.DataPoints, base)
+			case metricdata.Sum[int64]:
+				sums = appendSums(sums, data, base)
+			case metricdata.Sum[float64]:
+				sums = appendSums(sums, data, base)
+			case metricdata.Histogram[int64]:
+				histograms = appendHistograms(histograms, data, base)
+			case metricdata.Histogram[float64]:
+				histograms = appendHistograms(histograms, data, base)
+			case metricdata.ExponentialHistogram[int64]:
+				exponentials = appendExponentialHistograms(exponentials, data, base)
+			case metricdata.ExponentialHistogram[float64]:
+				exponentials = appendExponentialHistograms(exponentials, data, base)
+			}
+		}
+	}
+
+	return []clickhouseTable{
+		{"otel_metrics_gauge", gauges},
+		{"otel_metrics_sum", sums},
+		{"otel_metrics_histogram", histograms},
+		{"otel_metrics_exponential_histogram", exponentials},
+	}
+}
+
+type metricBase func(attrs attribute.Set, start, t time.Time) clickhouseMetric
+
+func appendGauges[N int64 | float64](rows []any, dps []metricdata.DataPoint[N], base metricBase) []any {
+	for _, dp := range dps {
+		rows = append(rows, clickhouseGauge{withExemplars(base(dp.Attributes, dp.StartTime, dp.Time), dp.Exemplars), float64(dp.Value)})
+	}
+	return rows
+}
+
+func appendSums[N int64 | float64](rows []any, sum metricdata.Sum[N], base metricBase) []any {
+	for _, dp := range sum.DataPoints {
+		rows = append(rows, clickhouseSum{
+			clickhouseMetric:       withExemplars(base(dp.Attributes, dp.StartTime, dp.Time), dp.Exemplars),
+			Value:                  float64(dp.Value),
+			AggregationTemporality: int32(temporalityToProto(sum.Temporality)),
+			IsMonotonic:            sum.IsMonotonic,
+		})
+	}
+	return rows
+}
+
+func appendHistograms[N int64 | float64](rows []any, h metricdata.Histogram[N], base metricBase) []any {
+	for _, dp := range h.DataPoints {
+		row := clickhouseHistogram{
+			clickhouseMetric:       withExemplars(base(dp.Attributes, dp.StartTime, dp.Time), dp.Exemplars),
+			Count:                  dp.Count,
+			Sum:                    float64(dp.Sum),
+			BucketCounts:           dp.BucketCounts,
+			ExplicitBounds:         dp.Bounds,
+			AggregationTemporality: int32(temporalityToProto(h.Temporality)),
+		}
+		if v, ok := dp.Min.Value(); ok {
+			f := float64(v)
+			row.Min = &f
+		}
+		if v, ok := dp.Max.Value(); ok {
+			f := float64(v)
+			row.Max = &f
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func appendExponentialHistograms[N int64 | float64](rows []any, h metricdata.ExponentialHistogram[N], base metricBase) []any {
+	for _, dp := range h.DataPoints {
+		row := clickhouseExponentialHistogram{
+			clickhouseMetric:       withExemplars(base(dp.Attributes, dp.StartTime, dp.Time), dp.Exemplars),
+			Count:                  dp.Count,
+			Sum:                    float64(dp.Sum),
+			Scale:                  dp.Scale,
+			ZeroCount:              dp.ZeroCount,
+			PositiveOffset:         dp.PositiveBucket.Offset,
+			PositiveBucketCounts:   dp.PositiveBucket.Counts,
+			NegativeOffset:         dp.NegativeBucket.Offset,
+			NegativeBucketCounts:   dp.NegativeBucket.Counts,
+			AggregationTemporality: int32(temporalityToProto(h.Temporality)),
+		}
+		if v, ok := dp.Min.Value(); ok {
+			f := float64(v)
+			row.Min = &f
+		}
+		if v, ok := dp.Max.Value(); ok {
+			f := float64(v)
+			row.Max = &f
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// clickhouseSpanKind uses the names the collector's exporter writes, e.g.
+// Server rather than server
+func clickhouseSpanKind(k trace.SpanKind) string {
+	s := k.String()
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+func resourceServiceName(res *resource.Resource) string {
+	v, _ := res.Set().Value("service.name")
+	return v.Emit()
+}
+
+// attributeMap flattens attributes into the Map(String, String) columns
+func attributeMap(attrs []attribute.KeyValue) map[string]string {
+	m := make(map[string]string, len(attrs))
+	for _, kv := range attrs {
+		m[string(kv.Key)] = kv.Value.Emit()
+	}
+	return m
+}
@@ -0,0 +1,273 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"time"
+
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/metric"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Client owns the tracer, logger and meter providers of one service,
+// exporting to ClickStack with the settings of a Config adjusted by
+// options. The providers are also installed as the global ones, so
+// instrumentation libraries export through them too.
+type Client struct {
+	p *providers
+	// flushTimeout bounds the flush after a panic
+	flushTimeout time.Duration
+}
+
+// Option configures a Client
+type Option func(*clientOptions)
+
+type clientOptions struct {
+	cfg       *Config
+	configure []func(*Config)
+	signals   Signals
+	onFailure ExportFailureHook
+	sampler   sdktrace.Sampler
+	ids       sdktrace.IDGenerator
+	resource  *resource.Resource
+	clock     clockOffset
+	local     bool
+
+	spanProcessors []sdktrace.SpanProcessor
+	logProcessors  []sdklog.Processor
+	spanLimits     *sdktrace.SpanLimits
+}
+
+// WithConfig sets the configuration the other options adjust. Without it
+// the client uses DefaultConfig with the OTEL_* environment variables
+// applied. The config itself isn't modified.
+func WithConfig(cfg *Config) Option {
+	return func(o *clientOptions) { o.cfg = cfg }
+}
+
+// WithEndpoint sets the collector endpoint shared by all signals, host:port
+// or a URL. Endpoints set per signal in the config still take precedence.
+func WithEndpoint(endpoint string) Option {
+	return configure(func(cfg *Config) { cfg.Exporter.Endpoint = endpoint })
+}
+
+// WithTLS exports over TLS, verifying the collector with the PEM CA bundle
+// in caFile instead of the system roots and presenting the client
+// certificate and key in certFile and keyFile for mutual TLS. Empty paths
+// leave those settings as they are.
+func WithTLS(caFile, certFile, keyFile string) Option {
+	return configure(func(cfg *Config) {
+		insecure := false
+		cfg.Exporter.Insecure = &insecure
+		if caFile != "" {
+			cfg.Exporter.Certificate = caFile
+		}
+		if certFile != "" {
+			cfg.Exporter.ClientCertificate = certFile
+		}
+		if keyFile != "" {
+			cfg.Exporter.ClientKey = keyFile
+		}
+	})
+}
+
+// WithInsecure exports in plaintext, for a collector on localhost or
+// inside the cluster
+func WithInsecure() Option {
+	return configure(func(cfg *Config) {
+		insecure := true
+		cfg.Exporter.Insecure = &insecure
+	})
+}
+
+// WithHeaders adds headers, such as the ClickStack API key in
+// authorization, to every export request
+func WithHeaders(headers map[string]string) Option {
+	return configure(func(cfg *Config) {
+		merged := maps.Clone(cfg.Exporter.Headers)
+		if merged == nil {
+			merged = map[string]string{}
+		}
+		maps.Copy(merged, headers)
+		cfg.Exporter.Headers = merged
+	})
+}
+
+// WithSampler samples traces with sampler instead of the one the config
+// describes
+func WithSampler(sampler sdktrace.Sampler) Option {
+	return func(o *clientOptions) { o.sampler = sampler }
+}
+
+// WithIDGenerator generates trace and span IDs with ids instead of the
+// generator id_generator names, for downstream systems that constrain the
+// format of trace IDs
+func WithIDGenerator(ids sdktrace.IDGenerator) Option {
+	return func(o *clientOptions) { o.ids = ids }
+}
+
+// WithSpanLimits replaces the limits on what a span records, which
+// otherwise come from the config's limits section and the OTEL_SPAN_*_LIMIT
+// variables: by default at most 128 attributes, events and links each, and
+// attribute values of any length. They're used as given, a zero limit
+// allowing none and a negative one any number, so start from
+// sdktrace.NewSpanLimits.
+func WithSpanLimits(limits sdktrace.SpanLimits) Option {
+	return func(o *clientOptions) { o.spanLimits = &limits }
+}
+
+// WithSpanProcessor registers p on the TracerProvider, ahead of the
+// processors the config chains in front of the batch processor. It sees
+// every sampled span start and end, to enrich spans or to hand them on to
+// an exporter of its own, but can't keep one from being exported; the
+// config's filter processor or a RegisterSpanProcessor type does that.
+// It's shut down with the client. Repeatable.
+func WithSpanProcessor(p sdktrace.SpanProcessor) Option {
+	return func(o *clientOptions) { o.spanProcessors = append(o.spanProcessors, p) }
+}
+
+// WithLogProcessor registers p on the LoggerProvider, ahead of the
+// processors the config chains in front of the batch processor. What it
+// changes in a record synchronously, such as added attributes, is exported,
+// but it can't keep a record from being exported; the config's filter and
+// sampling processors or a RegisterLogProcessor type do that. It's shut
+// down with the client. Repeatable.
+func WithLogProcessor(p sdklog.Processor) Option {
+	return func(o *clientOptions) { o.logProcessors = append(o.logProcessors, p) }
+}
+
+// WithResource merges res into the resource built from the config's
+// service section, its attributes winning where both set one
+func WithResource(res *resource.Resource) Option {
+	return func(o *clientOptions) { o.resource = res }
+}
+
+// WithoutGlobal keeps the client's providers, and the propagator, from
+// being installed as the global ones, for a process running several
+// clients where only one should serve the instrumentation libraries
+func WithoutGlobal() Option {
+	return func(o *clientOptions) { o.local = true }
+}
+
+// WithSignals limits the providers that export to the given signals; the
+// others stay no-ops. All three are exported by default.
+func WithSignals(signals Signals) Option {
+	return func(o *clientOptions) { o.signals = signals }
+}
+
+// WithFailureHook calls hook for every failed export instead of letting
+// the SDK log the error. The client wraps the global otel error handler to
+// skip the failures the hook has seen; with WithoutGlobal it leaves the
+// handler alone, so the SDK reports each failure to it as well.
+func WithFailureHook(hook ExportFailureHook) Option {
+	return func(o *clientOptions) { o.onFailure = hook }
+}
+
+func configure(fn func(*Config)) Option {
+	return func(o *clientOptions) { o.configure = append(o.configure, fn) }
+}
+
+// NewClient creates the providers described by opts. Shutdown must be
+// called before the process exits, or the last batches are lost.
+func NewClient(ctx context.Context, opts ...Option) (*Client, error) {
+	o, cfg, err := resolveOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Service.EnsureInstanceID()
+
+	p, err := setupProviders(ctx, cfg, o)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{p: p, flushTimeout: cfg.Batch.ShutdownTimeout}, nil
+}
+
+// resolveOptions applies opts and returns them with the validated config
+// they describe, a copy the caller may modify
+func resolveOptions(opts []Option) (*clientOptions, *Config, error) {
+	o := &clientOptions{signals: Signals{Traces: true, Logs: true, Metrics: true}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	var cfg *Config
+	if o.cfg != nil {
+		cfg = o.cfg.Clone()
+	} else {
+		cfg = DefaultConfig()
+		if err := ApplyEnv(cfg); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, fn := range o.configure {
+		fn(cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return o, cfg, nil
+}
+
+// Setup configures traces, logs and metrics together and installs them as
+// the global providers. The returned shutdown flushes and stops them all.
+func Setup(ctx context.Context, opts ...Option) (shutdown func(context.Context) error, err error) {
+	c, err := NewClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return c.Shutdown, nil
+}
+
+// Tracer returns a tracer from the client's tracer provider
+func (c *Client) Tracer(name string, opts ...trace.TracerOption) trace.Tracer {
+	return c.p.tracerProvider.Tracer(name, opts...)
+}
+
+// Logger returns a logger from the client's logger provider
+func (c *Client) Logger(name string, opts ...otellog.LoggerOption) otellog.Logger {
+	return c.p.loggerProvider.Logger(name, opts...)
+}
+
+// Meter returns a meter from the client's meter provider
+func (c *Client) Meter(name string, opts ...metric.MeterOption) metric.Meter {
+	return c.p.meterProvider.Meter(name, opts...)
+}
+
+// TracerProvider returns the client's tracer provider, for instrumentation
+// that takes one, as a client WithoutGlobal needs
+func (c *Client) TracerProvider() trace.TracerProvider {
+	return c.p.tracerProvider
+}
+
+// MeterProvider returns the client's meter provider, for instrumentation
+// that takes one
+func (c *Client) MeterProvider() metric.MeterProvider {
+	return c.p.meterProvider
+}
+
+// Stats returns the running export counts of each signal
+func (c *Client) Stats() *ExportStats {
+	return &c.p.stats
+}
+
+// SpanLimits returns the limits the client's spans are held to, from
+// WithSpanLimits or the configuration
+func (c *Client) SpanLimits() sdktrace.SpanLimits {
+	return c.p.spanLimits
+}
+
+// ForceFlush exports everything still buffered without stopping the
+// providers
+func (c *Client) ForceFlush(ctx context.Context) error {
+	return c.p.forceFlush(ctx)
+}
+
+// Shutdown stops every enabled provider, flushing anything still buffered
+func (c *Client) Shutdown(ctx context.Context) error {
+	return c.p.shutdown(ctx)
+}
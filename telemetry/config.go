@@ -0,0 +1,1454 @@
+package telemetry
+
+import (
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/google/uuid"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the full set of knobs the demo reads from its config file.
+// Every field has a default, so an empty or missing file reproduces the
+// built-in behaviour.
+type Config struct {
+	Exporter ExporterConfig `yaml:"exporter" toml:"exporter"`
+	Service  ServiceConfig  `yaml:"service" toml:"service"`
+	Sampler  SamplerConfig  `yaml:"sampler" toml:"sampler"`
+	// IDGenerator is random, the SDK's, or xray, trace IDs starting with
+	// the time as AWS X-Ray requires
+	IDGenerator string `yaml:"id_generator" toml:"id_generator"`
+	// Propagators are the formats the trace context and baggage travel in
+	// between services, as OTEL_PROPAGATORS lists them: tracecontext,
+	// baggage, b3 (single header), b3multi, jaeger, xray, composite for
+	// all of the first five, or none
+	Propagators []string         `yaml:"propagators" toml:"propagators"`
+	Processors  ProcessorsConfig `yaml:"processors" toml:"processors"`
+	Views       []ViewConfig     `yaml:"views" toml:"views"`
+	// ExemplarFilter picks the measurements kept as exemplars, linking
+	// metric data points to the spans they were recorded in, as
+	// OTEL_METRICS_EXEMPLAR_FILTER does: trace_based, those recorded in a
+	// sampled span, always_on or always_off
+	ExemplarFilter string         `yaml:"exemplar_filter" toml:"exemplar_filter"`
+	Batch          BatchConfig    `yaml:"batch" toml:"batch"`
+	Limits         LimitsConfig   `yaml:"limits" toml:"limits"`
+	Scenario       ScenarioConfig `yaml:"scenario" toml:"scenario"`
+	DryRun         DryRunConfig   `yaml:"dry_run" toml:"dry_run"`
+}
+
+// ExporterConfig describes where telemetry is sent. The embedded settings
+// apply to every signal; the per-signal sections override them field by
+// field, mirroring the OTEL_EXPORTER_OTLP_<SIGNAL>_* variables.
+//
+// Mirrors are extra named endpoints that receive a copy of every signal
+// their type can export.
+// They are configured on their own and only inherit the protocol,
+// compression, timeout, retry policy, proxy and gRPC tuning, so credentials
+// meant for the primary endpoint are never sent to a mirror.
+type ExporterConfig struct {
+	EndpointConfig `yaml:",inline"`
+
+	Traces  EndpointConfig `yaml:"traces" toml:"traces"`
+	Logs    EndpointConfig `yaml:"logs" toml:"logs"`
+	Metrics EndpointConfig `yaml:"metrics" toml:"metrics"`
+
+	Mirrors map[string]EndpointConfig `yaml:"mirrors" toml:"mirrors"`
+
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker" toml:"circuit_breaker"`
+	Spool          SpoolConfig          `yaml:"spool" toml:"spool"`
+
+	// Record is a directory to keep a copy of every exported batch in, for
+	// the replay command; empty disables it
+	Record string `yaml:"record" toml:"record"`
+
+	// Temporality is the aggregation temporality metrics are exported with:
+	// cumulative, delta for the counters and histograms, or lowmemory for
+	// the synchronous ones only, as
+	// OTEL_EXPORTER_OTLP_METRICS_TEMPORALITY_PREFERENCE has it. Prometheus
+	// only takes cumulative.
+	Temporality string `yaml:"temporality" toml:"temporality"`
+
+	// Preflight checks that the collectors can be reached before the
+	// generate and statsd commands send anything
+	Preflight bool `yaml:"preflight" toml:"preflight"`
+}
+
+// SpoolConfig keeps the batches the primary OTLP endpoint fails to accept
+// on disk under Dir, up to MaxSize bytes, and replays them every
+// ReplayInterval until they're delivered. An empty Dir disables it.
+type SpoolConfig struct {
+	Dir            string        `yaml:"dir" toml:"dir"`
+	MaxSize        int64         `yaml:"max_size" toml:"max_size"`
+	ReplayInterval time.Duration `yaml:"replay_interval" toml:"replay_interval"`
+}
+
+// spools reports whether exports to ep go through the spool. Only OTLP
+// endpoints do, since a spooled batch is replayed as an OTLP request.
+func (e ExporterConfig) spools(ep EndpointConfig) bool {
+	return e.Spool.Dir != "" && ep.Type == "otlp"
+}
+
+// CircuitBreakerConfig stops exporting a signal after FailureThreshold
+// consecutive failed exports and probes the collector every ProbeInterval
+// until it answers again. Mode is drop, which discards batches while the
+// circuit is open, or buffer, which keeps up to BufferSize span and log
+// batches, and metric batches under delta or lowmemory temporality, and
+// replays them on recovery; cumulative metrics catch up with the first
+// export after it. Every failed attempt counts, so with retries on a
+// single failure can take retry.max_elapsed_time.
+type CircuitBreakerConfig struct {
+	Enabled          bool          `yaml:"enabled" toml:"enabled"`
+	FailureThreshold int           `yaml:"failure_threshold" toml:"failure_threshold"`
+	ProbeInterval    time.Duration `yaml:"probe_interval" toml:"probe_interval"`
+	Mode             string        `yaml:"mode" toml:"mode"`
+	BufferSize       int           `yaml:"buffer_size" toml:"buffer_size"`
+}
+
+// EndpointConfig is where one signal goes. Type selects the exporter: otlp
+// sends to the collector described by the remaining fields, stdout writes
+// the SDK's JSON encoding to standard output, file appends OTLP JSON lines
+// to Path, sql appends ClickHouse INSERT statements for the ClickStack
+// tables to Path, prometheus serves metrics for scraping on Listen and
+// clickhouse inserts rows into the ClickStack tables over ClickHouse's HTTP
+// interface at Endpoint, bypassing the collector, and kafka publishes to
+// Topic on the comma-separated brokers in Endpoint. zipkin sends traces to a
+// Zipkin v2 endpoint, syslog sends logs as RFC 5424 messages to a udp://,
+// tcp:// or tls:// Endpoint, loki pushes logs to a Loki push API and fluent
+// forwards them to a fluent-bit or fluentd forward input, tagged with
+// Topic. Otherwise Endpoint is either host:port or a URL whose http/https
+// scheme selects plaintext or TLS.
+type EndpointConfig struct {
+	Type              string            `yaml:"type" toml:"type"`
+	Endpoint          string            `yaml:"endpoint" toml:"endpoint"`
+	Protocol          string            `yaml:"protocol" toml:"protocol"`
+	Insecure          *bool             `yaml:"insecure" toml:"insecure"`
+	Certificate       string            `yaml:"certificate" toml:"certificate"`
+	ClientCertificate string            `yaml:"client_certificate" toml:"client_certificate"`
+	ClientKey         string            `yaml:"client_key" toml:"client_key"`
+	Headers           map[string]string `yaml:"headers" toml:"headers"`
+	Compression       string            `yaml:"compression" toml:"compression"`
+	Timeout           time.Duration     `yaml:"timeout" toml:"timeout"`
+	Retry             RetryConfig       `yaml:"retry" toml:"retry"`
+	Proxy             string            `yaml:"proxy" toml:"proxy"`
+	Path              string            `yaml:"path" toml:"path"`
+	Listen            string            `yaml:"listen" toml:"listen"`
+	Topic             string            `yaml:"topic" toml:"topic"`
+	GRPC              GRPCConfig        `yaml:"grpc" toml:"grpc"`
+
+	// baseEndpoint is the value OTEL_EXPORTER_OTLP_ENDPOINT set, which is
+	// a base URL the signal paths are joined onto rather than used as is
+	baseEndpoint string
+}
+
+// RetryConfig controls how failed exports are retried: exponential backoff
+// from InitialInterval up to MaxInterval between attempts, giving up after
+// MaxElapsedTime. Retries are on unless Enabled is explicitly false.
+type RetryConfig struct {
+	Enabled         *bool         `yaml:"enabled" toml:"enabled"`
+	InitialInterval time.Duration `yaml:"initial_interval" toml:"initial_interval"`
+	MaxInterval     time.Duration `yaml:"max_interval" toml:"max_interval"`
+	MaxElapsedTime  time.Duration `yaml:"max_elapsed_time" toml:"max_elapsed_time"`
+}
+
+func (r RetryConfig) enabled() bool {
+	return r.Enabled == nil || *r.Enabled
+}
+
+// GRPCConfig tunes the gRPC connections. KeepaliveTime sends a ping after
+// that long without activity, also on idle connections, and drops the
+// connection when no answer comes within KeepaliveTimeout; this keeps NAT
+// and load balancer mappings alive on long runs. MaxMessageSize caps each
+// export request and response in bytes, and the backoff delays bound the
+// waits between reconnection attempts. Zero values keep grpc-go's defaults.
+type GRPCConfig struct {
+	KeepaliveTime    time.Duration `yaml:"keepalive_time" toml:"keepalive_time"`
+	KeepaliveTimeout time.Duration `yaml:"keepalive_timeout" toml:"keepalive_timeout"`
+	MaxMessageSize   int           `yaml:"max_message_size" toml:"max_message_size"`
+	BackoffBaseDelay time.Duration `yaml:"backoff_base_delay" toml:"backoff_base_delay"`
+	BackoffMaxDelay  time.Duration `yaml:"backoff_max_delay" toml:"backoff_max_delay"`
+}
+
+// Resolve returns the shared endpoint settings with the non-zero fields of
+// override applied on top.
+func (e ExporterConfig) Resolve(override EndpointConfig) EndpointConfig {
+	ep := e.EndpointConfig
+	if override.Type != "" {
+		ep.Type = override.Type
+	}
+	if override.Endpoint != "" {
+		ep.Endpoint, ep.baseEndpoint = override.Endpoint, override.baseEndpoint
+	}
+	if override.Protocol != "" {
+		ep.Protocol = override.Protocol
+	}
+	if override.Insecure != nil {
+		ep.Insecure = override.Insecure
+	}
+	if override.Certificate != "" {
+		ep.Certificate = override.Certificate
+	}
+	if override.ClientCertificate != "" {
+		ep.ClientCertificate = override.ClientCertificate
+	}
+	if override.ClientKey != "" {
+		ep.ClientKey = override.ClientKey
+	}
+	if override.Headers != nil {
+		ep.Headers = override.Headers
+	}
+	if override.Compression != "" {
+		ep.Compression = override.Compression
+	}
+	if override.Timeout != 0 {
+		ep.Timeout = override.Timeout
+	}
+	if override.Proxy != "" {
+		ep.Proxy = override.Proxy
+	}
+	if override.Path != "" {
+		ep.Path = override.Path
+	}
+	if override.Listen != "" {
+		ep.Listen = override.Listen
+	}
+	if override.Topic != "" {
+		ep.Topic = override.Topic
+	}
+	if override.Retry.Enabled != nil {
+		ep.Retry.Enabled = override.Retry.Enabled
+	}
+	if override.Retry.InitialInterval != 0 {
+		ep.Retry.InitialInterval = override.Retry.InitialInterval
+	}
+	if override.Retry.MaxInterval != 0 {
+		ep.Retry.MaxInterval = override.Retry.MaxInterval
+	}
+	if override.Retry.MaxElapsedTime != 0 {
+		ep.Retry.MaxElapsedTime = override.Retry.MaxElapsedTime
+	}
+	if override.GRPC.KeepaliveTime != 0 {
+		ep.GRPC.KeepaliveTime = override.GRPC.KeepaliveTime
+	}
+	if override.GRPC.KeepaliveTimeout != 0 {
+		ep.GRPC.KeepaliveTimeout = override.GRPC.KeepaliveTimeout
+	}
+	if override.GRPC.MaxMessageSize != 0 {
+		ep.GRPC.MaxMessageSize = override.GRPC.MaxMessageSize
+	}
+	if override.GRPC.BackoffBaseDelay != 0 {
+		ep.GRPC.BackoffBaseDelay = override.GRPC.BackoffBaseDelay
+	}
+	if override.GRPC.BackoffMaxDelay != 0 {
+		ep.GRPC.BackoffMaxDelay = override.GRPC.BackoffMaxDelay
+	}
+	return ep
+}
+
+// resolveMirrors returns the mirror endpoints with their inherited settings
+// filled in
+func (e ExporterConfig) resolveMirrors() map[string]EndpointConfig {
+	mirrors := make(map[string]EndpointConfig, len(e.Mirrors))
+	for name, m := range e.Mirrors {
+		base := ExporterConfig{EndpointConfig: EndpointConfig{
+			Type:        "otlp",
+			Protocol:    e.Protocol,
+			Compression: e.Compression,
+			Timeout:     e.Timeout,
+			Retry:       e.Retry,
+			Proxy:       e.Proxy,
+			GRPC:        e.GRPC,
+		}}
+		mirrors[name] = base.Resolve(m)
+	}
+	return mirrors
+}
+
+// signalOnlyTypes are the exporter types that handle a single signal
+var signalOnlyTypes = map[string]string{
+	"prometheus": "metrics",
+	"zipkin":     "traces",
+	"syslog":     "logs",
+	"loki":       "logs",
+	"fluent":     "logs",
+}
+
+// MirrorsFor returns the mirrors that receive signal. A mirror whose type
+// only exports another signal, such as a syslog mirror for traces, is left
+// out rather than failing.
+func (e ExporterConfig) MirrorsFor(signal string) map[string]EndpointConfig {
+	mirrors := e.resolveMirrors()
+	for name, ep := range mirrors {
+		if only := signalOnlyTypes[ep.Type]; only != "" && only != signal {
+			delete(mirrors, name)
+		}
+	}
+	return mirrors
+}
+
+// UsesStdout reports whether telemetry is written to standard output, in
+// which case status messages go to stderr
+func (c *Config) UsesStdout() bool {
+	if c.DryRun.Enabled {
+		return true
+	}
+	for _, ep := range []EndpointConfig{c.Exporter.Traces, c.Exporter.Logs, c.Exporter.Metrics} {
+		if c.Exporter.Resolve(ep).Type == "stdout" {
+			return true
+		}
+	}
+	return false
+}
+
+// DryRunConfig prints telemetry to stdout instead of exporting it. Format
+// is text (one line per span, log record or data point) or json (one OTLP
+// JSON document per batch).
+type DryRunConfig struct {
+	Enabled bool   `yaml:"enabled" toml:"enabled"`
+	Format  string `yaml:"format" toml:"format"`
+}
+
+// ServiceConfig is the service identity stamped on the resource, plus any
+// extra resource attributes.
+type ServiceConfig struct {
+	Name        string            `yaml:"name" toml:"name"`
+	Version     string            `yaml:"version" toml:"version"`
+	InstanceID  string            `yaml:"instance_id" toml:"instance_id"`
+	Environment string            `yaml:"environment" toml:"environment"`
+	Attributes  map[string]string `yaml:"attributes" toml:"attributes"`
+}
+
+// EnsureInstanceID fills in a random UUID when no instance ID is configured,
+// so concurrent runs show up as separate instances
+func (svc *ServiceConfig) EnsureInstanceID() {
+	if svc.InstanceID == "" {
+		svc.InstanceID = uuid.NewString()
+	}
+}
+
+// SamplerConfig selects the trace sampler. Type is one of always_on,
+// always_off, traceidratio, traceidhash, their parentbased_ variants, which
+// follow the parent span's decision and sample root spans as named,
+// parentbased, sampling root spans with the Root type, ratelimiting or a
+// name given to RegisterSampler. Ratio applies to the traceidratio and
+// traceidhash types, and HashSeed to traceidhash, which decides as the
+// collector's probabilistic_sampler does with that seed; Rate is the spans
+// per second ratelimiting keeps.
+type SamplerConfig struct {
+	Type     string  `yaml:"type" toml:"type"`
+	Ratio    float64 `yaml:"ratio" toml:"ratio"`
+	HashSeed uint32  `yaml:"hash_seed" toml:"hash_seed"`
+	Rate     float64 `yaml:"rate" toml:"rate"`
+	// Root is the sampler type for the root spans of parentbased, always_on
+	// when empty
+	Root   string              `yaml:"root" toml:"root"`
+	Parent ParentSamplerConfig `yaml:"parent" toml:"parent"`
+}
+
+// ParentSamplerConfig overrides how the parentbased types, ratelimiting
+// included, decide for a span with a parent: each is a sampler type other
+// than parentbased, built from the same section. Empty ones follow the
+// parent, sampling when its span was sampled, so RemoteNotSampled:
+// always_on emulates a service that ignores its callers' decision to
+// drop, and RemoteSampled: traceidratio one that samples again.
+type ParentSamplerConfig struct {
+	RemoteSampled    string `yaml:"remote_sampled" toml:"remote_sampled"`
+	RemoteNotSampled string `yaml:"remote_not_sampled" toml:"remote_not_sampled"`
+	LocalSampled     string `yaml:"local_sampled" toml:"local_sampled"`
+	LocalNotSampled  string `yaml:"local_not_sampled" toml:"local_not_sampled"`
+}
+
+func (c SamplerConfig) validate() error {
+	if _, ok := samplerFactory(c.Type); !ok {
+		return fmt.Errorf("unknown sampler.type %q, want one of %s", c.Type, strings.Join(SamplerTypes(), ", "))
+	}
+	types := []string{c.Type}
+	for _, t := range []struct{ key, name string }{
+		{"root", c.Root},
+		{"parent.remote_sampled", c.Parent.RemoteSampled},
+		{"parent.remote_not_sampled", c.Parent.RemoteNotSampled},
+		{"parent.local_sampled", c.Parent.LocalSampled},
+		{"parent.local_not_sampled", c.Parent.LocalNotSampled},
+	} {
+		if t.name == "" {
+			continue
+		}
+		if _, ok := samplerFactory(t.name); !ok || t.name == "parentbased" {
+			return fmt.Errorf("unknown sampler.%s %q, want one of %s other than parentbased", t.key, t.name, strings.Join(SamplerTypes(), ", "))
+		}
+		types = append(types, t.name)
+	}
+	for _, t := range types {
+		switch t {
+		case "traceidratio", "parentbased_traceidratio", "traceidhash", "parentbased_traceidhash":
+			if c.Ratio < 0 || c.Ratio > 1 {
+				return fmt.Errorf("sampler.ratio must be within [0, 1], got %v", c.Ratio)
+			}
+		case "ratelimiting":
+			if c.Rate <= 0 {
+				return fmt.Errorf("sampler.rate must be positive, got %v", c.Rate)
+			}
+		}
+	}
+	return nil
+}
+
+// leaf is the section for the sampler of type name that parentbased
+// composes, without the root and parent settings
+func (c SamplerConfig) leaf(name string) SamplerConfig {
+	return SamplerConfig{Type: name, Ratio: c.Ratio, HashSeed: c.HashSeed, Rate: c.Rate}
+}
+
+// ProcessorsConfig chains processors in front of the batch processors, each
+// seeing the spans or log records in order. For spans, Type is attributes,
+// setting Attributes on every span, baggage, setting the context's baggage
+// entries with the Keys listed (all without any) as attributes, filter,
+// dropping the spans whose names match a Drop pattern (as in path.Match),
+// redact, masking what Rules match in the attribute values, of the Keys
+// listed or all, before export (see RedactRule), or enrich, adding
+// Attributes and fake values for the Generate keys (see EnrichKeys) to
+// every span as it ends, those of one of Pool pods (6 by default) for each
+// trace. For logs it's attributes, baggage, enrich, filter, dropping the
+// records below MinSeverity or whose bodies match a Drop pattern, or
+// sampling, keeping Ratio of the records below MinSeverity and all of those
+// from the sampled traces alike. Any other Type is a name given to
+// RegisterSpanProcessor or RegisterLogProcessor.
+type ProcessorsConfig struct {
+	Spans []ProcessorConfig `yaml:"spans" toml:"spans"`
+	Logs  []ProcessorConfig `yaml:"logs" toml:"logs"`
+}
+
+// ProcessorConfig configures one processor; which fields apply depends on
+// Type
+type ProcessorConfig struct {
+	Type        string            `yaml:"type" toml:"type"`
+	Attributes  map[string]string `yaml:"attributes" toml:"attributes"`
+	Drop        []string          `yaml:"drop" toml:"drop"`
+	Keys        []string          `yaml:"keys" toml:"keys"`
+	MinSeverity string            `yaml:"min_severity" toml:"min_severity"`
+	Ratio       float64           `yaml:"ratio" toml:"ratio"`
+	Rules       []RedactRule      `yaml:"rules" toml:"rules"`
+	Generate    []string          `yaml:"generate" toml:"generate"`
+	Pool        int               `yaml:"pool" toml:"pool"`
+
+	// Filled in by the chain: the run's seed, for what a processor draws
+	// outside a trace, and the limits spans are held to
+	seed   int64
+	limits sdktrace.SpanLimits
+}
+
+// ViewConfig changes the metric streams of the instruments it matches.
+// Instrument is an instrument name, * and ? matching any characters or one,
+// and Meter, if set, the name of the meter that created it. Name renames
+// the stream, which needs Instrument to name a single one. AttributeKeys
+// keeps only the attributes listed and DropAttributes drops those listed,
+// bounding a stream's cardinality. Aggregation is default, drop, sum,
+// last_value, explicit_bucket_histogram, with Buckets as the boundaries,
+// or base2_exponential_histogram, with MaxSize buckets and MaxScale.
+// Buckets on their own imply the explicit bucket histogram.
+type ViewConfig struct {
+	Instrument     string    `yaml:"instrument" toml:"instrument"`
+	Meter          string    `yaml:"meter" toml:"meter"`
+	Name           string    `yaml:"name" toml:"name"`
+	Description    string    `yaml:"description" toml:"description"`
+	AttributeKeys  []string  `yaml:"attribute_keys" toml:"attribute_keys"`
+	DropAttributes []string  `yaml:"drop_attributes" toml:"drop_attributes"`
+	Aggregation    string    `yaml:"aggregation" toml:"aggregation"`
+	Buckets        []float64 `yaml:"buckets" toml:"buckets"`
+	MaxSize        int32     `yaml:"max_size" toml:"max_size"`
+	MaxScale       int32     `yaml:"max_scale" toml:"max_scale"`
+}
+
+// BatchConfig tunes the span and log batch processors and the metric reader.
+// ExportTimeout bounds one export by the batch processor, including its
+// retries, on top of the exporter's per-request timeout. ShutdownTimeout
+// bounds the final flush and shutdown at the end of a run.
+type BatchConfig struct {
+	MaxQueueSize       int           `yaml:"max_queue_size" toml:"max_queue_size"`
+	MaxExportBatchSize int           `yaml:"max_export_batch_size" toml:"max_export_batch_size"`
+	BatchTimeout       time.Duration `yaml:"batch_timeout" toml:"batch_timeout"`
+	ExportTimeout      time.Duration `yaml:"export_timeout" toml:"export_timeout"`
+	MetricInterval     time.Duration `yaml:"metric_interval" toml:"metric_interval"`
+	ShutdownTimeout    time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+// LimitsConfig caps what a span records, as the OTEL_SPAN_*_LIMIT,
+// OTEL_EVENT_ATTRIBUTE_COUNT_LIMIT and OTEL_LINK_ATTRIBUTE_COUNT_LIMIT
+// variables do: attributes, events and links past a count limit are
+// dropped, and string values longer than AttributeValueLength are cut to
+// it. Zero keeps the SDK's default, 128 of each and no length limit, and
+// a negative limit lifts it.
+type LimitsConfig struct {
+	AttributeCount         int `yaml:"attribute_count" toml:"attribute_count"`
+	AttributeValueLength   int `yaml:"attribute_value_length" toml:"attribute_value_length"`
+	EventCount             int `yaml:"event_count" toml:"event_count"`
+	LinkCount              int `yaml:"link_count" toml:"link_count"`
+	AttributePerEventCount int `yaml:"attribute_per_event_count" toml:"attribute_per_event_count"`
+	AttributePerLinkCount  int `yaml:"attribute_per_link_count" toml:"attribute_per_link_count"`
+}
+
+// SpanLimits returns the SDK's span limits with the configured ones applied
+func (l LimitsConfig) SpanLimits() sdktrace.SpanLimits {
+	limits := sdktrace.NewSpanLimits()
+	for _, v := range []struct{ from, to *int }{
+		{&l.AttributeCount, &limits.AttributeCountLimit},
+		{&l.AttributeValueLength, &limits.AttributeValueLengthLimit},
+		{&l.EventCount, &limits.EventCountLimit},
+		{&l.LinkCount, &limits.LinkCountLimit},
+		{&l.AttributePerEventCount, &limits.AttributePerEventCountLimit},
+		{&l.AttributePerLinkCount, &limits.AttributePerLinkCountLimit},
+	} {
+		if *v.from != 0 {
+			*v.to = *v.from
+		}
+	}
+	return limits
+}
+
+// ScenarioConfig shapes the simulated workload.
+type ScenarioConfig struct {
+	Rate       float64       `yaml:"rate" toml:"rate"`
+	Duration   time.Duration `yaml:"duration" toml:"duration"`
+	Forever    bool          `yaml:"forever" toml:"forever"`
+	Seed       int64         `yaml:"seed" toml:"seed"`
+	UserID     string        `yaml:"user_id" toml:"user_id"`
+	APIURL     string        `yaml:"api_url" toml:"api_url"`
+	DBLatency  LatencyRange  `yaml:"db_latency" toml:"db_latency"`
+	APILatency LatencyRange  `yaml:"api_latency" toml:"api_latency"`
+	ErrorRate  float64       `yaml:"error_rate" toml:"error_rate"`
+	// HTTPStatuses weighs the status codes the simulated API calls not
+	// failed by ErrorRate are answered with, 200 to all of them without.
+	// 4xx answers fail the call but not the server spans above it, as
+	// semantic conventions have client errors.
+	HTTPStatuses map[string]float64 `yaml:"http_statuses" toml:"http_statuses"`
+	// SpanEvents adds cache lookup, lock wait, retry and GC pause events
+	// to the simulated work's spans
+	SpanEvents bool `yaml:"span_events" toml:"span_events"`
+	// ExponentialHistograms gives the simulated API answers body sizes,
+	// recorded like the request durations in base2 exponential histograms
+	ExponentialHistograms bool `yaml:"exponential_histograms" toml:"exponential_histograms"`
+	// ExceedLimits starts each request with a limits-probe span going past
+	// every span limit, to see what's dropped and truncated
+	ExceedLimits bool `yaml:"exceed_limits" toml:"exceed_limits"`
+	// PII puts fake personal data, an email address, a card number and a
+	// bearer token, on each request's root span, for a redact processor to
+	// mask
+	PII bool `yaml:"pii" toml:"pii"`
+	// BatchSize, when positive, runs a batch job every BatchSize requests,
+	// a trace of its own linked to the traces of the requests it processed
+	BatchSize int `yaml:"batch_size" toml:"batch_size"`
+	// Tree, with a positive depth, replaces the work of each request with
+	// a synthetic trace tree of that shape
+	Tree TreeConfig `yaml:"tree" toml:"tree"`
+	// StressTrace, with a positive depth or width, replaces the work of
+	// each request with a pathological trace of that shape
+	StressTrace StressTraceConfig `yaml:"stress_trace" toml:"stress_trace"`
+	// ClockSkew moves the timestamps of the services named, the simulated
+	// ones or the generator's own, by their offsets, as if their clocks
+	// were off by that much. Read once at startup, not on reload.
+	ClockSkew map[string]time.Duration `yaml:"clock_skew" toml:"clock_skew"`
+	// Backfill, with a positive window, dates the run's telemetry across
+	// that window of the past instead of now
+	Backfill BackfillConfig `yaml:"backfill" toml:"backfill"`
+	// Orphans breaks some of the requests' traces on purpose, leaving out
+	// a span the others refer to as their parent
+	Orphans OrphansConfig `yaml:"orphans" toml:"orphans"`
+	// Hedge, with Attempts set, makes each request's API call a hedged
+	// request, duplicates of it racing until one wins
+	Hedge HedgeConfig `yaml:"hedge" toml:"hedge"`
+	// ScatterGather, with a positive width, replaces each request's API
+	// call with a scatter-gather across that many shards
+	ScatterGather ScatterGatherConfig `yaml:"scatter_gather" toml:"scatter_gather"`
+	// Transaction, with Statements set, has each request write its order
+	// in a database transaction of that many statements
+	Transaction TransactionConfig `yaml:"transaction" toml:"transaction"`
+	// Queue hands each request's follow-up work to a simulated queue, to be
+	// processed later in a trace of its own
+	Queue QueueConfig `yaml:"queue" toml:"queue"`
+	// LongRunning runs a long job alongside the requests, a span staying
+	// open for minutes with progress events
+	LongRunning LongRunningConfig `yaml:"long_running" toml:"long_running"`
+	// GRPCStream keeps a bidirectional gRPC stream open alongside the
+	// requests, messages flowing both ways
+	GRPCStream GRPCStreamConfig `yaml:"grpc_stream" toml:"grpc_stream"`
+	// LargeAttributes adds oversized attributes to every span, to probe
+	// the exporter's message size limits and how ClickHouse stores them
+	LargeAttributes LargeAttributesConfig `yaml:"large_attributes" toml:"large_attributes"`
+	// Services, from 2 up to MaxServices, has each request go through that
+	// many services of the demo topology (frontend, cart, checkout,
+	// payment, inventory, shipping, email, recommendation), each reporting
+	// with a resource and providers of its own; 0 keeps the single service
+	// demo request. Read once at startup, not on reload.
+	Services int `yaml:"services" toml:"services"`
+	// ServicesNetwork has each of the Services listen on a loopback port
+	// and the calls between them made over HTTP, the trace context in the
+	// request headers, rather than passed along in process. Read once at
+	// startup, not on reload.
+	ServicesNetwork bool `yaml:"services_network" toml:"services_network"`
+	// GRPC adds a call to an in-process gRPC inventory service to every
+	// request; it is read once at startup, not on reload
+	GRPC bool `yaml:"grpc" toml:"grpc"`
+	// Baggage gives every request a tenant, user tier and origin in its
+	// baggage, which is copied onto all its spans and log records; it is
+	// read once at startup, not on reload
+	Baggage bool `yaml:"baggage" toml:"baggage"`
+	// RealHTTPTarget, when set, is sent a real GET in place of the
+	// simulated call to APIURL
+	RealHTTPTarget string            `yaml:"real_http_target" toml:"real_http_target"`
+	Database       DatabaseConfig    `yaml:"database" toml:"database"`
+	Redis          RedisConfig       `yaml:"redis" toml:"redis"`
+	Kafka          KafkaConfig       `yaml:"kafka" toml:"kafka"`
+	Attributes     map[string]string `yaml:"attributes" toml:"attributes"`
+}
+
+// DatabaseConfig runs the simulated requests' database queries against a
+// real database instead of sleeping for db_latency. Driver is empty for the
+// simulation, sqlite for an embedded SQLite, in memory unless DSN names a
+// file, or postgres with DSN as the connection string. It is read once at
+// startup, not on reload.
+type DatabaseConfig struct {
+	Driver string `yaml:"driver" toml:"driver"`
+	DSN    string `yaml:"dsn" toml:"dsn"`
+}
+
+// RedisConfig puts a Redis cache in front of the simulated requests' user
+// lookup when Addr is set. Cached entries expire after TTL; 0 keeps them.
+// It is read once at startup, not on reload.
+type RedisConfig struct {
+	Addr     string        `yaml:"addr" toml:"addr"`
+	Password string        `yaml:"password" toml:"password"`
+	DB       int           `yaml:"db" toml:"db"`
+	TTL      time.Duration `yaml:"ttl" toml:"ttl"`
+}
+
+// KafkaConfig makes the simulated requests publish an order event to Topic
+// on the plaintext Brokers when any are listed, consumed in the same
+// process by the consumer group Group. It is read once at startup, not on
+// reload.
+type KafkaConfig struct {
+	Brokers []string `yaml:"brokers" toml:"brokers"`
+	Topic   string   `yaml:"topic" toml:"topic"`
+	Group   string   `yaml:"group" toml:"group"`
+}
+
+// Continuous reports whether the scenario runs as a timed or endless loop
+// rather than a single request
+func (sc ScenarioConfig) Continuous() bool {
+	return sc.Forever || sc.Duration > 0
+}
+
+// QueueConfig describes the simulated queue of scenario.queue: with Enabled,
+// each request publishes a message to Destination under a producer span,
+// and a consumer processes it after a wait drawn from Delay under a consumer
+// span starting a new trace, linked to the producer span. Read once at
+// startup, not on reload.
+type QueueConfig struct {
+	Enabled     bool         `yaml:"enabled" toml:"enabled"`
+	Destination string       `yaml:"destination" toml:"destination"`
+	Delay       LatencyRange `yaml:"delay" toml:"delay"`
+}
+
+// LongRunningConfig describes the job of scenario.long_running: with a
+// positive Duration, a migration runs for that long under a root span of
+// its own, recording a progress event and a child span for the batch done
+// every Heartbeat, one after another until the run stops, which interrupts
+// the one in progress. Read once at startup, not on reload.
+type LongRunningConfig struct {
+	Duration  time.Duration `yaml:"duration" toml:"duration"`
+	Heartbeat time.Duration `yaml:"heartbeat" toml:"heartbeat"`
+}
+
+// GRPCStreamConfig describes the streams of scenario.grpc_stream: with a
+// positive Duration, a WatchStock stream to the inventory service stays
+// open that long, the client sending a message every Interval and the
+// server answering each with a few, one stream after another until the
+// run stops. Read once at startup, not on reload.
+type GRPCStreamConfig struct {
+	Duration time.Duration `yaml:"duration" toml:"duration"`
+	Interval LatencyRange  `yaml:"interval" toml:"interval"`
+}
+
+// LargeAttributesConfig describes the attributes scenario.large_attributes
+// adds to every span as it starts: with a positive Size, a SQL statement
+// (stress.sql) and a base64 blob of random bytes (stress.blob), each about
+// Size bytes, and Count attributes more, stress.attr.000 and on. The span
+// attribute limit is raised to fit them. Read once at startup, not on
+// reload.
+type LargeAttributesConfig struct {
+	Count int `yaml:"count" toml:"count"`
+	Size  int `yaml:"size" toml:"size"`
+}
+
+// MaxServices is the size of the demo topology scenario.services picks
+// its services from
+const MaxServices = 8
+
+// TreeConfig shapes the synthetic trace trees of scenario.tree: Depth
+// levels of spans under each request's root span, FanOut children per span
+// and Attributes attributes on each. Each span's own work takes a time
+// drawn from Latency, uniform, exponential or lognormal as Distribution
+// says (see scenario.TreeConfig).
+type TreeConfig struct {
+	Depth        int          `yaml:"depth" toml:"depth"`
+	FanOut       int          `yaml:"fan_out" toml:"fan_out"`
+	Distribution string       `yaml:"distribution" toml:"distribution"`
+	Latency      LatencyRange `yaml:"latency" toml:"latency"`
+	Attributes   int          `yaml:"attributes" toml:"attributes"`
+}
+
+// maxTreeSpans bounds the spans of one synthetic trace tree
+const maxTreeSpans = 10000
+
+// spans returns how many spans a tree of the shape has, stopping counting
+// past maxTreeSpans
+func (t TreeConfig) spans() int {
+	n, width := 0, 1
+	for range t.Depth {
+		n += width
+		if n > maxTreeSpans {
+			break
+		}
+		width *= t.FanOut
+	}
+	return n
+}
+
+// StressTraceConfig shapes the pathological traces of
+// scenario.stress_trace: a chain of Depth spans each the parent of the
+// next, as runaway recursion makes, with Width children under the deepest
+// (see scenario.StressTraceConfig).
+type StressTraceConfig struct {
+	Depth int `yaml:"depth" toml:"depth"`
+	Width int `yaml:"width" toml:"width"`
+}
+
+// maxStressSpans bounds the spans of one pathological trace
+const maxStressSpans = 100000
+
+// BackfillConfig describes the history scenario.backfill makes: the run
+// lasts CompressTo, the whole Window without it, and the timestamps of
+// everything it exports are spread across the Window ending when it does
+// (see TimeShift). Read once at startup, not on reload.
+type BackfillConfig struct {
+	Window     time.Duration `yaml:"window" toml:"window"`
+	CompressTo time.Duration `yaml:"compress_to" toml:"compress_to"`
+}
+
+// Over is how long a backfill takes in real time
+func (b BackfillConfig) Over() time.Duration {
+	if b.CompressTo == 0 {
+		return b.Window
+	}
+	return b.CompressTo
+}
+
+// OrphansConfig says what fraction of the requests get broken traces of
+// scenario.orphans: with MissingRoot the root span is never exported, with
+// DroppedParent a span between the root and the rest is never exported,
+// leaving the spans under it without their parent.
+type OrphansConfig struct {
+	MissingRoot   float64 `yaml:"missing_root" toml:"missing_root"`
+	DroppedParent float64 `yaml:"dropped_parent" toml:"dropped_parent"`
+}
+
+// HedgeConfig shapes the hedged API calls of scenario.hedge: up to
+// Attempts copies of the call, a new one started each Delay until one
+// succeeds, the others then cancelled (see scenario.HedgeConfig).
+type HedgeConfig struct {
+	Attempts int           `yaml:"attempts" toml:"attempts"`
+	Delay    time.Duration `yaml:"delay" toml:"delay"`
+}
+
+// maxHedgeAttempts bounds the copies of a hedged call
+const maxHedgeAttempts = 10
+
+// ScatterGatherConfig shapes the scatter-gather requests of
+// scenario.scatter_gather: Width shard calls at once taking Latency, the
+// StragglerRate fraction of them StragglerLatency instead (see
+// scenario.ScatterGatherConfig).
+type ScatterGatherConfig struct {
+	Width            int          `yaml:"width" toml:"width"`
+	Latency          LatencyRange `yaml:"latency" toml:"latency"`
+	StragglerRate    float64      `yaml:"straggler_rate" toml:"straggler_rate"`
+	StragglerLatency LatencyRange `yaml:"straggler_latency" toml:"straggler_latency"`
+}
+
+// maxScatterWidth bounds the shards of a scatter-gather
+const maxScatterWidth = 1000
+
+// TransactionConfig shapes the transactions of scenario.transaction:
+// Statements statements between BEGIN and COMMIT, the DeadlockRate
+// fraction of them rolled back on a deadlock instead (see
+// scenario.TransactionConfig).
+type TransactionConfig struct {
+	Statements   int     `yaml:"statements" toml:"statements"`
+	DeadlockRate float64 `yaml:"deadlock_rate" toml:"deadlock_rate"`
+}
+
+// maxTransactionStatements bounds the statements of a transaction
+const maxTransactionStatements = 100
+
+// LatencyRange is a uniform [Min, Max) latency distribution.
+type LatencyRange struct {
+	Min time.Duration `yaml:"min" toml:"min"`
+	Max time.Duration `yaml:"max" toml:"max"`
+}
+
+// Sample draws a latency uniformly from the range
+func (r LatencyRange) Sample(rng *rand.Rand) time.Duration {
+	if r.Max <= r.Min {
+		return r.Min
+	}
+	return r.Min + time.Duration(rng.Int64N(int64(r.Max-r.Min)))
+}
+
+// Clone returns a deep copy of c, sharing none of its maps, slices or
+// pointers, so either can be modified without the other seeing it
+func (c *Config) Clone() *Config {
+	clone := *c
+	e := &clone.Exporter
+	e.EndpointConfig = e.EndpointConfig.clone()
+	e.Traces, e.Logs, e.Metrics = e.Traces.clone(), e.Logs.clone(), e.Metrics.clone()
+	if e.Mirrors != nil {
+		e.Mirrors = make(map[string]EndpointConfig, len(c.Exporter.Mirrors))
+		for name, m := range c.Exporter.Mirrors {
+			e.Mirrors[name] = m.clone()
+		}
+	}
+	clone.Service.Attributes = maps.Clone(c.Service.Attributes)
+	clone.Propagators = slices.Clone(c.Propagators)
+	clone.Processors.Spans = cloneProcessors(c.Processors.Spans)
+	clone.Processors.Logs = cloneProcessors(c.Processors.Logs)
+	if c.Views != nil {
+		clone.Views = make([]ViewConfig, len(c.Views))
+		for i, v := range c.Views {
+			v.AttributeKeys = slices.Clone(v.AttributeKeys)
+			v.DropAttributes = slices.Clone(v.DropAttributes)
+			v.Buckets = slices.Clone(v.Buckets)
+			clone.Views[i] = v
+		}
+	}
+	sc := &clone.Scenario
+	sc.HTTPStatuses = maps.Clone(c.Scenario.HTTPStatuses)
+	sc.ClockSkew = maps.Clone(c.Scenario.ClockSkew)
+	sc.Attributes = maps.Clone(c.Scenario.Attributes)
+	sc.Kafka.Brokers = slices.Clone(c.Scenario.Kafka.Brokers)
+	return &clone
+}
+
+func (e EndpointConfig) clone() EndpointConfig {
+	e.Insecure = clonePointer(e.Insecure)
+	e.Headers = maps.Clone(e.Headers)
+	e.Retry.Enabled = clonePointer(e.Retry.Enabled)
+	return e
+}
+
+func cloneProcessors(cfgs []ProcessorConfig) []ProcessorConfig {
+	if cfgs == nil {
+		return nil
+	}
+	clones := make([]ProcessorConfig, len(cfgs))
+	for i, p := range cfgs {
+		p.Attributes = maps.Clone(p.Attributes)
+		p.Drop = slices.Clone(p.Drop)
+		p.Keys = slices.Clone(p.Keys)
+		p.Rules = slices.Clone(p.Rules)
+		p.Generate = slices.Clone(p.Generate)
+		clones[i] = p
+	}
+	return clones
+}
+
+func clonePointer[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+// DefaultConfig returns the built-in configuration, which sends every
+// signal over gRPC to a collector on localhost
+func DefaultConfig() *Config {
+	return &Config{
+		Exporter: ExporterConfig{
+			EndpointConfig: EndpointConfig{
+				Type:        "otlp",
+				Endpoint:    otelCollectorEndpoint,
+				Protocol:    "grpc",
+				Compression: "none",
+				Timeout:     10 * time.Second,
+				Listen:      "localhost:9464",
+				// The OTLP exporters' own defaults
+				Retry: RetryConfig{
+					InitialInterval: 5 * time.Second,
+					MaxInterval:     30 * time.Second,
+					MaxElapsedTime:  time.Minute,
+				},
+			},
+			CircuitBreaker: CircuitBreakerConfig{
+				FailureThreshold: 5,
+				ProbeInterval:    10 * time.Second,
+				Mode:             "drop",
+				BufferSize:       100,
+			},
+			Spool: SpoolConfig{
+				MaxSize:        512 << 20,
+				ReplayInterval: 10 * time.Second,
+			},
+			Temporality: "cumulative",
+			Preflight:   true,
+		},
+		Service: ServiceConfig{
+			Name:        serviceName,
+			Version:     serviceVersion,
+			Environment: "development",
+		},
+		Sampler: SamplerConfig{
+			Type:  "always_on",
+			Ratio: 1,
+			Rate:  100,
+		},
+		IDGenerator: "random",
+		Propagators: []string{"tracecontext", "baggage"},
+		// The SDK's default
+		ExemplarFilter: "trace_based",
+		Batch: BatchConfig{
+			MaxQueueSize:       2048,
+			MaxExportBatchSize: 512,
+			BatchTimeout:       5 * time.Second,
+			ExportTimeout:      30 * time.Second,
+			MetricInterval:     10 * time.Second,
+			ShutdownTimeout:    10 * time.Second,
+		},
+		Scenario: ScenarioConfig{
+			Rate:       1,
+			UserID:     "12345",
+			APIURL:     "https://api.example.com/data",
+			DBLatency:  LatencyRange{Min: 80 * time.Millisecond, Max: 120 * time.Millisecond},
+			APILatency: LatencyRange{Min: 150 * time.Millisecond, Max: 250 * time.Millisecond},
+			Redis:      RedisConfig{TTL: 30 * time.Second},
+			Kafka:      KafkaConfig{Topic: "order-events", Group: "otel-demo"},
+			Queue: QueueConfig{
+				Destination: "order-fulfillment",
+				Delay:       LatencyRange{Min: 50 * time.Millisecond, Max: 500 * time.Millisecond},
+			},
+			LongRunning: LongRunningConfig{Heartbeat: 10 * time.Second},
+			GRPCStream:  GRPCStreamConfig{Interval: LatencyRange{Min: 200 * time.Millisecond, Max: time.Second}},
+			Hedge:       HedgeConfig{Delay: 50 * time.Millisecond},
+			ScatterGather: ScatterGatherConfig{
+				Latency:          LatencyRange{Min: 20 * time.Millisecond, Max: 60 * time.Millisecond},
+				StragglerLatency: LatencyRange{Min: 300 * time.Millisecond, Max: 900 * time.Millisecond},
+			},
+			Tree: TreeConfig{
+				FanOut:       2,
+				Distribution: "uniform",
+				Latency:      LatencyRange{Min: 5 * time.Millisecond, Max: 20 * time.Millisecond},
+				Attributes:   5,
+			},
+		},
+		DryRun: DryRunConfig{
+			Format: "text",
+		},
+	}
+}
+
+// LoadConfig returns the defaults overlaid with the file at path and then,
+// if profile is set, with that entry of the file's top-level "profiles"
+// table. A profile holds any subset of the regular keys, so it only needs to
+// spell out what differs from the base settings. The format is chosen by
+// extension: .yaml/.yml or .toml. An empty path returns the defaults
+// unchanged. The result is not validated because the environment and flags
+// are applied on top of it.
+func LoadConfig(path, profile string) (*Config, error) {
+	cfg := DefaultConfig()
+	if path == "" {
+		if profile != "" {
+			return nil, fmt.Errorf("profile %q requested but no config file given", profile)
+		}
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = decodeYAMLConfig(data, profile, cfg)
+	case ".toml":
+		err = decodeTOMLConfig(data, profile, cfg)
+	default:
+		return nil, fmt.Errorf("unsupported config file extension %q (want .yaml, .yml or .toml)", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func decodeYAMLConfig(data []byte, profile string, cfg *Config) error {
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return err
+	}
+	if profile == "" {
+		return nil
+	}
+
+	var doc struct {
+		Profiles map[string]yaml.Node `yaml:"profiles"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	node, ok := doc.Profiles[profile]
+	if !ok {
+		return unknownProfileError(profile, doc.Profiles)
+	}
+	if err := node.Decode(cfg); err != nil {
+		return fmt.Errorf("profile %q: %w", profile, err)
+	}
+	return nil
+}
+
+func decodeTOMLConfig(data []byte, profile string, cfg *Config) error {
+	if _, err := toml.Decode(string(data), cfg); err != nil {
+		return err
+	}
+	if profile == "" {
+		return nil
+	}
+
+	var doc struct {
+		Profiles map[string]toml.Primitive `toml:"profiles"`
+	}
+	md, err := toml.Decode(string(data), &doc)
+	if err != nil {
+		return err
+	}
+	prim, ok := doc.Profiles[profile]
+	if !ok {
+		return unknownProfileError(profile, doc.Profiles)
+	}
+	if err := md.PrimitiveDecode(prim, cfg); err != nil {
+		return fmt.Errorf("profile %q: %w", profile, err)
+	}
+	return nil
+}
+
+func unknownProfileError[V any](profile string, profiles map[string]V) error {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return fmt.Errorf("profile %q not found: the file defines no profiles", profile)
+	}
+	return fmt.Errorf("profile %q not found (available: %s)", profile, strings.Join(names, ", "))
+}
+
+// Validate reports the first setting that is out of range or inconsistent
+func (c *Config) Validate() error {
+	for _, signal := range []struct {
+		name string
+		ep   EndpointConfig
+	}{
+		{"traces", c.Exporter.Resolve(c.Exporter.Traces)},
+		{"logs", c.Exporter.Resolve(c.Exporter.Logs)},
+		{"metrics", c.Exporter.Resolve(c.Exporter.Metrics)},
+	} {
+		name, ep := signal.name, signal.ep
+		if err := ep.validate(); err != nil {
+			return fmt.Errorf("exporter (%s): %w", name, err)
+		}
+		if only := signalOnlyTypes[ep.Type]; only != "" && only != name {
+			return fmt.Errorf("exporter (%s): type %s only exports %s", name, ep.Type, only)
+		}
+	}
+	for name, ep := range c.Exporter.resolveMirrors() {
+		if name == "primary" {
+			return fmt.Errorf("exporter.mirrors: the name primary is reserved for the main endpoint")
+		}
+		if err := ep.validate(); err != nil {
+			return fmt.Errorf("exporter.mirrors.%s: %w", name, err)
+		}
+		if ep.Type == "prometheus" {
+			return fmt.Errorf("exporter.mirrors.%s: type %s can't be used for a mirror", name, ep.Type)
+		}
+	}
+	if cb := c.Exporter.CircuitBreaker; cb.Enabled {
+		if cb.FailureThreshold < 1 {
+			return fmt.Errorf("exporter.circuit_breaker.failure_threshold must be at least 1, got %d", cb.FailureThreshold)
+		}
+		if cb.ProbeInterval <= 0 {
+			return fmt.Errorf("exporter.circuit_breaker.probe_interval must be positive")
+		}
+		switch cb.Mode {
+		case "drop":
+		case "buffer":
+			if cb.BufferSize < 1 {
+				return fmt.Errorf("exporter.circuit_breaker.buffer_size must be at least 1, got %d", cb.BufferSize)
+			}
+		default:
+			return fmt.Errorf("exporter.circuit_breaker.mode must be drop or buffer, got %q", cb.Mode)
+		}
+	}
+	if c.Exporter.Spool.Dir != "" {
+		if c.Exporter.Spool.MaxSize <= 0 {
+			return fmt.Errorf("exporter.spool.max_size must be positive")
+		}
+		if c.Exporter.Spool.ReplayInterval <= 0 {
+			return fmt.Errorf("exporter.spool.replay_interval must be positive")
+		}
+	}
+	switch c.Exporter.Temporality {
+	case "cumulative":
+	case "delta", "lowmemory":
+		if c.Exporter.Resolve(c.Exporter.Metrics).Type == "prometheus" {
+			return fmt.Errorf("exporter.temporality %s can't be used with the prometheus exporter, which only takes cumulative", c.Exporter.Temporality)
+		}
+	default:
+		return fmt.Errorf("unknown exporter.temporality %q, want cumulative, delta or lowmemory", c.Exporter.Temporality)
+	}
+	if c.Service.Name == "" {
+		return fmt.Errorf("service.name must not be empty")
+	}
+	if err := c.Sampler.validate(); err != nil {
+		return err
+	}
+	if c.IDGenerator != "random" && c.IDGenerator != "xray" {
+		return fmt.Errorf("unknown id_generator %q, want random or xray", c.IDGenerator)
+	}
+	switch c.ExemplarFilter {
+	case "trace_based", "always_on", "always_off":
+	default:
+		return fmt.Errorf("unknown exemplar_filter %q, want trace_based, always_on or always_off", c.ExemplarFilter)
+	}
+	for _, name := range c.Propagators {
+		if !slices.Contains(propagatorNames, name) {
+			return fmt.Errorf("unknown propagator %q, want one of %s", name, strings.Join(propagatorNames, ", "))
+		}
+	}
+	for i, p := range c.Processors.Spans {
+		if _, ok := spanProcessorFactory(p.Type); !ok {
+			return fmt.Errorf("processors.spans[%d]: unknown type %q, want one of %s", i, p.Type, strings.Join(SpanProcessorTypes(), ", "))
+		}
+		if err := p.validate(false); err != nil {
+			return fmt.Errorf("processors.spans[%d]: %w", i, err)
+		}
+	}
+	for i, p := range c.Processors.Logs {
+		if _, ok := logProcessorFactory(p.Type); !ok {
+			return fmt.Errorf("processors.logs[%d]: unknown type %q, want one of %s", i, p.Type, strings.Join(LogProcessorTypes(), ", "))
+		}
+		if err := p.validate(true); err != nil {
+			return fmt.Errorf("processors.logs[%d]: %w", i, err)
+		}
+	}
+	for i, v := range c.Views {
+		if err := v.validate(); err != nil {
+			return fmt.Errorf("views[%d]: %w", i, err)
+		}
+	}
+	if c.Batch.MaxQueueSize < 1 || c.Batch.MaxExportBatchSize < 1 {
+		return fmt.Errorf("batch.max_queue_size and batch.max_export_batch_size must be at least 1")
+	}
+	if c.Batch.MaxExportBatchSize > c.Batch.MaxQueueSize {
+		return fmt.Errorf("batch.max_export_batch_size (%d) must not exceed batch.max_queue_size (%d)", c.Batch.MaxExportBatchSize, c.Batch.MaxQueueSize)
+	}
+	if c.Batch.BatchTimeout <= 0 || c.Batch.ExportTimeout <= 0 || c.Batch.MetricInterval <= 0 || c.Batch.ShutdownTimeout <= 0 {
+		return fmt.Errorf("batch.batch_timeout, batch.export_timeout, batch.metric_interval and batch.shutdown_timeout must be positive")
+	}
+	if c.Scenario.Rate <= 0 {
+		return fmt.Errorf("scenario.rate must be positive, got %v", c.Scenario.Rate)
+	}
+	if c.Scenario.Duration < 0 {
+		return fmt.Errorf("scenario.duration must not be negative")
+	}
+	if c.Scenario.ErrorRate < 0 || c.Scenario.ErrorRate > 1 {
+		return fmt.Errorf("scenario.error_rate must be within [0, 1], got %v", c.Scenario.ErrorRate)
+	}
+	if len(c.Scenario.HTTPStatuses) > 0 {
+		var total float64
+		for code, w := range c.Scenario.HTTPStatuses {
+			if n, err := strconv.Atoi(code); err != nil || n < 100 || n > 599 {
+				return fmt.Errorf("scenario.http_statuses: %q isn't an HTTP status code", code)
+			}
+			if w < 0 {
+				return fmt.Errorf("scenario.http_statuses: %s has a negative weight, %v", code, w)
+			}
+			total += w
+		}
+		if total == 0 {
+			return fmt.Errorf("scenario.http_statuses must weigh some status above 0")
+		}
+	}
+	if b := c.Scenario.Backfill; b.Window != 0 || b.CompressTo != 0 {
+		switch {
+		case b.Window <= 0 || b.CompressTo < 0:
+			return fmt.Errorf("scenario.backfill.window must be positive and scenario.backfill.compress_to must not be negative")
+		case b.CompressTo > b.Window:
+			return fmt.Errorf("scenario.backfill.compress_to (%s) must not exceed the window (%s)", b.CompressTo, b.Window)
+		case c.Scenario.Forever:
+			return fmt.Errorf("scenario.backfill can't run forever, it lasts compress_to")
+		}
+	}
+	if o := c.Scenario.Orphans; o.MissingRoot < 0 || o.DroppedParent < 0 || o.MissingRoot+o.DroppedParent > 1 {
+		return fmt.Errorf("scenario.orphans.missing_root and dropped_parent must not be negative nor add up to more than 1")
+	}
+	if h := c.Scenario.Hedge; h.Attempts != 0 {
+		switch {
+		case h.Attempts < 2 || h.Attempts > maxHedgeAttempts:
+			return fmt.Errorf("scenario.hedge.attempts must be 0 or within [2, %d], got %d", maxHedgeAttempts, h.Attempts)
+		case h.Delay <= 0:
+			return fmt.Errorf("scenario.hedge.delay must be positive, got %v", h.Delay)
+		}
+	}
+	if g := c.Scenario.ScatterGather; g.Width != 0 {
+		switch {
+		case g.Width < 0 || g.Width > maxScatterWidth:
+			return fmt.Errorf("scenario.scatter_gather.width must be within [0, %d], got %d", maxScatterWidth, g.Width)
+		case g.StragglerRate < 0 || g.StragglerRate > 1:
+			return fmt.Errorf("scenario.scatter_gather.straggler_rate must be within [0, 1], got %v", g.StragglerRate)
+		}
+	}
+	if t := c.Scenario.Transaction; t.Statements < 0 || t.Statements > maxTransactionStatements {
+		return fmt.Errorf("scenario.transaction.statements must be within [0, %d], got %d", maxTransactionStatements, t.Statements)
+	} else if t.DeadlockRate < 0 || t.DeadlockRate > 1 {
+		return fmt.Errorf("scenario.transaction.deadlock_rate must be within [0, 1], got %v", t.DeadlockRate)
+	}
+	if c.Scenario.Services != 0 && (c.Scenario.Services < 2 || c.Scenario.Services > MaxServices) {
+		return fmt.Errorf("scenario.services must be 0 or within [2, %d], got %d", MaxServices, c.Scenario.Services)
+	}
+	if c.Scenario.BatchSize < 0 || c.Scenario.BatchSize > 128 {
+		// 128 is the SDK's limit on the links of a span
+		return fmt.Errorf("scenario.batch_size must be within [0, 128], got %d", c.Scenario.BatchSize)
+	}
+	if t := c.Scenario.Tree; t.Depth != 0 {
+		switch {
+		case t.Depth < 0 || t.FanOut < 1:
+			return fmt.Errorf("scenario.tree.depth must not be negative and scenario.tree.fan_out must be at least 1")
+		case t.spans() > maxTreeSpans:
+			return fmt.Errorf("scenario.tree makes more than %d spans per request", maxTreeSpans)
+		case t.Distribution != "uniform" && t.Distribution != "exponential" && t.Distribution != "lognormal":
+			return fmt.Errorf("unknown scenario.tree.distribution %q, want uniform, exponential or lognormal", t.Distribution)
+		case t.Attributes < 0 || t.Attributes > 126:
+			// The SDK keeps 128 attributes per span, two taken by the position
+			return fmt.Errorf("scenario.tree.attributes must be within [0, 126], got %d", t.Attributes)
+		case t.Latency.Min < 0 || t.Latency.Max < t.Latency.Min:
+			return fmt.Errorf("scenario.tree.latency must satisfy 0 <= min <= max")
+		}
+	}
+	if t := c.Scenario.StressTrace; t.Depth != 0 || t.Width != 0 {
+		switch {
+		case t.Depth < 0 || t.Width < 0:
+			return fmt.Errorf("scenario.stress_trace.depth and width must not be negative")
+		case t.Depth+t.Width > maxStressSpans:
+			return fmt.Errorf("scenario.stress_trace makes more than %d spans per request", maxStressSpans)
+		case c.Scenario.Tree.Depth != 0:
+			return fmt.Errorf("scenario.stress_trace and scenario.tree can't both be set")
+		}
+	}
+	switch c.Scenario.Database.Driver {
+	case "", "sqlite":
+	case "postgres":
+		if c.Scenario.Database.DSN == "" {
+			return fmt.Errorf("scenario.database.dsn must not be empty for the postgres driver")
+		}
+	default:
+		return fmt.Errorf("scenario.database.driver must be sqlite or postgres, got %q", c.Scenario.Database.Driver)
+	}
+	if t := c.Scenario.RealHTTPTarget; t != "" {
+		u, err := url.Parse(t)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("scenario.real_http_target must be an http or https URL, got %q", t)
+		}
+	}
+	if c.Scenario.Redis.TTL < 0 {
+		return fmt.Errorf("scenario.redis.ttl must not be negative")
+	}
+	if len(c.Scenario.Kafka.Brokers) > 0 && (c.Scenario.Kafka.Topic == "" || c.Scenario.Kafka.Group == "") {
+		return fmt.Errorf("scenario.kafka.topic and scenario.kafka.group must not be empty")
+	}
+	if c.DryRun.Format != "text" && c.DryRun.Format != "json" {
+		return fmt.Errorf("dry_run.format must be text or json, got %q", c.DryRun.Format)
+	}
+	if gs := c.Scenario.GRPCStream; gs.Duration < 0 || gs.Duration > 0 && (gs.Interval.Min <= 0 || gs.Interval.Max < gs.Interval.Min) {
+		return fmt.Errorf("scenario.grpc_stream.interval must satisfy 0 < min <= max, and the duration not negative")
+	}
+	if lr := c.Scenario.LongRunning; lr.Duration < 0 || lr.Duration > 0 && (lr.Heartbeat <= 0 || lr.Heartbeat > lr.Duration) {
+		return fmt.Errorf("scenario.long_running.heartbeat must be positive and at most the duration, and the duration not negative")
+	}
+	if c.Scenario.LargeAttributes.Count < 0 || c.Scenario.LargeAttributes.Size < 0 {
+		return fmt.Errorf("scenario.large_attributes.count and size must not be negative")
+	}
+	if c.Scenario.Queue.Enabled && c.Scenario.Queue.Destination == "" {
+		return fmt.Errorf("scenario.queue.destination must not be empty")
+	}
+	for name, r := range map[string]LatencyRange{"db_latency": c.Scenario.DBLatency, "api_latency": c.Scenario.APILatency, "queue.delay": c.Scenario.Queue.Delay} {
+		if r.Min < 0 || r.Max < r.Min {
+			return fmt.Errorf("scenario.%s must satisfy 0 <= min <= max", name)
+		}
+	}
+	return nil
+}
+
+// validate checks the fields the built-in processor types need, those of
+// the log processors if logs is set
+func (p ProcessorConfig) validate(logs bool) error {
+	switch {
+	case p.Type == "attributes":
+		if len(p.Attributes) == 0 {
+			return fmt.Errorf("attributes must not be empty for the attributes processor")
+		}
+	case p.Type == "filter" && logs:
+		if len(p.Drop) == 0 && p.MinSeverity == "" {
+			return fmt.Errorf("the filter processor needs drop or min_severity")
+		}
+	case p.Type == "filter":
+		if len(p.Drop) == 0 {
+			return fmt.Errorf("drop must not be empty for the filter processor")
+		}
+	case p.Type == "sampling" && logs:
+		if p.Ratio < 0 || p.Ratio > 1 {
+			return fmt.Errorf("ratio must be within [0, 1], got %v", p.Ratio)
+		}
+	case p.Type == "enrich":
+		if len(p.Attributes) == 0 && len(p.Generate) == 0 {
+			return fmt.Errorf("the enrich processor needs attributes or generate")
+		}
+		for _, k := range p.Generate {
+			if _, ok := enrichGenerators[k]; !ok {
+				return fmt.Errorf("enrich can't generate %q, want one of %s", k, strings.Join(EnrichKeys(), ", "))
+			}
+		}
+		if p.Pool < 0 {
+			return fmt.Errorf("pool must not be negative, got %d", p.Pool)
+		}
+	case p.Type == "redact":
+		for i, r := range p.Rules {
+			if _, _, err := r.compile(); err != nil {
+				return fmt.Errorf("rules[%d]: %w", i, err)
+			}
+		}
+	}
+	for _, pattern := range p.Drop {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("bad drop pattern %q: %w", pattern, err)
+		}
+	}
+	if p.MinSeverity != "" {
+		if _, err := parseSeverity(p.MinSeverity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v ViewConfig) validate() error {
+	if v.Instrument == "" {
+		return fmt.Errorf("instrument must be set")
+	}
+	if v.Name != "" && strings.ContainsAny(v.Instrument, "*?") {
+		return fmt.Errorf("name can't rename the instruments %q matches, only a single one", v.Instrument)
+	}
+	if len(v.AttributeKeys) > 0 && len(v.DropAttributes) > 0 {
+		return fmt.Errorf("attribute_keys and drop_attributes can't both be set")
+	}
+	switch v.Aggregation {
+	case "", "default", "drop", "sum", "last_value", "explicit_bucket_histogram":
+	case "base2_exponential_histogram":
+		if v.MaxSize < 0 || v.MaxScale < -10 || v.MaxScale > 20 {
+			return fmt.Errorf("max_size must not be negative and max_scale must be within [-10, 20]")
+		}
+		if len(v.Buckets) > 0 {
+			return fmt.Errorf("buckets only apply to the explicit_bucket_histogram aggregation")
+		}
+	default:
+		return fmt.Errorf("unknown aggregation %q, want default, drop, sum, last_value, explicit_bucket_histogram or base2_exponential_histogram", v.Aggregation)
+	}
+	if len(v.Buckets) > 0 && v.Aggregation != "" && v.Aggregation != "explicit_bucket_histogram" {
+		return fmt.Errorf("buckets only apply to the explicit_bucket_histogram aggregation")
+	}
+	for i := 1; i < len(v.Buckets); i++ {
+		if v.Buckets[i] <= v.Buckets[i-1] {
+			return fmt.Errorf("buckets must be increasing, got %v after %v", v.Buckets[i], v.Buckets[i-1])
+		}
+	}
+	return nil
+}
+
+func (e EndpointConfig) validate() error {
+	switch e.Type {
+	case "otlp", "clickhouse", "kafka", "zipkin", "syslog", "loki", "fluent":
+	case "stdout":
+		return nil
+	case "file", "sql":
+		if e.Path == "" {
+			return fmt.Errorf("path must not be empty for the %s exporter", e.Type)
+		}
+		return nil
+	case "prometheus":
+		if _, _, err := net.SplitHostPort(e.Listen); err != nil {
+			return fmt.Errorf("listen must be host:port, got %q", e.Listen)
+		}
+		return nil
+	default:
+		return fmt.Errorf("type must be otlp, clickhouse, kafka, zipkin, syslog, loki, fluent, stdout, file, sql or prometheus, got %q", e.Type)
+	}
+	if e.Endpoint == "" {
+		return fmt.Errorf("endpoint must not be empty")
+	}
+	switch e.Protocol {
+	case "grpc", "http/protobuf", "http/json":
+	default:
+		if e.Type == "otlp" {
+			return fmt.Errorf("protocol must be grpc, http/protobuf or http/json, got %q", e.Protocol)
+		}
+	}
+	switch e.Compression {
+	case "gzip", "none":
+	default:
+		return fmt.Errorf("compression must be gzip or none, got %q", e.Compression)
+	}
+	if e.Timeout <= 0 {
+		return fmt.Errorf("timeout must be positive")
+	}
+	if e.Retry.enabled() {
+		if e.Retry.InitialInterval <= 0 || e.Retry.MaxInterval <= 0 || e.Retry.MaxElapsedTime <= 0 {
+			return fmt.Errorf("retry intervals and max_elapsed_time must be positive")
+		}
+		if e.Retry.MaxInterval < e.Retry.InitialInterval {
+			return fmt.Errorf("retry.max_interval must not be shorter than retry.initial_interval")
+		}
+	}
+	if e.GRPC.KeepaliveTime < 0 || e.GRPC.KeepaliveTimeout < 0 || e.GRPC.MaxMessageSize < 0 || e.GRPC.BackoffBaseDelay < 0 || e.GRPC.BackoffMaxDelay < 0 {
+		return fmt.Errorf("grpc settings must not be negative")
+	}
+	if e.GRPC.BackoffBaseDelay > 0 && e.GRPC.BackoffMaxDelay > 0 && e.GRPC.BackoffMaxDelay < e.GRPC.BackoffBaseDelay {
+		return fmt.Errorf("grpc.backoff_max_delay must not be shorter than grpc.backoff_base_delay")
+	}
+	if e.Proxy != "" {
+		if _, err := parseProxyURL(e.Proxy); err != nil {
+			return err
+		}
+	}
+	if (e.ClientCertificate == "") != (e.ClientKey == "") {
+		return fmt.Errorf("client_certificate and client_key must be set together")
+	}
+	return nil
+}
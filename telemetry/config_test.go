@@ -0,0 +1,254 @@
+package telemetry
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCloneSharesNothing(t *testing.T) {
+	on := true
+	cfg := DefaultConfig()
+	cfg.Exporter.Insecure = &on
+	cfg.Exporter.Headers = map[string]string{"authorization": "key"}
+	cfg.Exporter.Traces.Headers = map[string]string{"x-signal": "traces"}
+	cfg.Exporter.Mirrors = map[string]EndpointConfig{"backup": {Endpoint: "backup:4317", Headers: map[string]string{"a": "b"}}}
+	cfg.Service.Attributes = map[string]string{"team": "checkout"}
+	cfg.Propagators = []string{"tracecontext"}
+	cfg.Processors.Spans = []ProcessorConfig{{Type: "attributes", Attributes: map[string]string{"k": "v"}, Drop: []string{"d"}}}
+	cfg.Views = []ViewConfig{{Instrument: "x", Buckets: []float64{1, 2}}}
+	cfg.Scenario.HTTPStatuses = map[string]float64{"200": 1}
+	cfg.Scenario.Attributes = map[string]string{"region": "eu"}
+	cfg.Scenario.Kafka.Brokers = []string{"kafka:9092"}
+	clone := cfg.Clone()
+	*clone.Exporter.Insecure = false
+	clone.Exporter.Headers["authorization"] = "other"
+	clone.Exporter.Traces.Headers["x-signal"] = "other"
+	clone.Exporter.Mirrors["backup"].Headers["a"] = "other"
+	delete(clone.Exporter.Mirrors, "backup")
+	clone.Service.Attributes["team"] = "other"
+	clone.Propagators[0] = "b3"
+	clone.Processors.Spans[0].Attributes["k"] = "other"
+	clone.Processors.Spans[0].Drop[0] = "other"
+	clone.Views[0].Buckets[0] = 9
+	clone.Scenario.HTTPStatuses["200"] = 0
+	clone.Scenario.Attributes["region"] = "us"
+	clone.Scenario.Kafka.Brokers[0] = "other:9092"
+
+	for _, c := range []struct {
+		field     string
+		got, want any
+	}{
+		{"exporter.insecure", *cfg.Exporter.Insecure, true},
+		{"exporter.headers", cfg.Exporter.Headers, map[string]string{"authorization": "key"}},
+		{"exporter.traces.headers", cfg.Exporter.Traces.Headers, map[string]string{"x-signal": "traces"}},
+		{"exporter.mirrors", cfg.Exporter.Mirrors, map[string]EndpointConfig{"backup": {Endpoint: "backup:4317", Headers: map[string]string{"a": "b"}}}},
+		{"service.attributes", cfg.Service.Attributes, map[string]string{"team": "checkout"}},
+		{"propagators", cfg.Propagators, []string{"tracecontext"}},
+		{"processors.spans", cfg.Processors.Spans, []ProcessorConfig{{Type: "attributes", Attributes: map[string]string{"k": "v"}, Drop: []string{"d"}}}},
+		{"views", cfg.Views, []ViewConfig{{Instrument: "x", Buckets: []float64{1, 2}}}},
+		{"scenario.http_statuses", cfg.Scenario.HTTPStatuses, map[string]float64{"200": 1}},
+		{"scenario.attributes", cfg.Scenario.Attributes, map[string]string{"region": "eu"}},
+		{"scenario.kafka.brokers", cfg.Scenario.Kafka.Brokers, []string{"kafka:9092"}},
+	} {
+		if !reflect.DeepEqual(c.got, c.want) {
+			t.Errorf("modifying the clone changed the original's %s to %v, want %v", c.field, c.got, c.want)
+		}
+	}
+}
+
+// writeConfig writes data to a file called name in a temporary directory
+// and returns its path
+func writeConfig(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	for _, c := range []struct {
+		name, file, data string
+		check            func(*Config) bool
+		wantErr          string
+	}{
+		{
+			name: "yaml",
+			file: "config.yaml",
+			data: "exporter:\n  endpoint: collector:4318\n  protocol: http/protobuf\nservice:\n  name: checkout\nscenario:\n  rate: 25\n  duration: 90s\n",
+			check: func(c *Config) bool {
+				return c.Exporter.Endpoint == "collector:4318" && c.Exporter.Protocol == "http/protobuf" &&
+					c.Service.Name == "checkout" && c.Scenario.Rate == 25 && c.Scenario.Duration == 90*time.Second
+			},
+		},
+		{
+			name: "yml keeps the defaults of what it leaves out",
+			file: "config.yml",
+			data: "service:\n  name: checkout\n",
+			check: func(c *Config) bool {
+				d := DefaultConfig()
+				return c.Service.Name == "checkout" && c.Exporter.Endpoint == d.Exporter.Endpoint && c.Batch == d.Batch
+			},
+		},
+		{
+			name: "toml",
+			file: "config.toml",
+			data: "[exporter]\nendpoint = \"collector:4317\"\n[exporter.headers]\nauthorization = \"key\"\n[scenario]\nrate = 5.5\n",
+			check: func(c *Config) bool {
+				return c.Exporter.Endpoint == "collector:4317" && c.Exporter.Headers["authorization"] == "key" && c.Scenario.Rate == 5.5
+			},
+		},
+		{name: "unsupported extension", file: "config.json", data: "{}", wantErr: `unsupported config file extension ".json"`},
+		{name: "bad yaml", file: "config.yaml", data: "scenario: [", wantErr: "failed to load config"},
+		{name: "bad toml", file: "config.toml", data: "[scenario\n", wantErr: "failed to load config"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			cfg, err := LoadConfig(writeConfig(t, c.file, c.data), "")
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, c.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !c.check(cfg) {
+				t.Errorf("loaded %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestLoadConfigWithoutFile(t *testing.T) {
+	cfg, err := LoadConfig("", "")
+	if err != nil || !reflect.DeepEqual(cfg, DefaultConfig()) {
+		t.Errorf("got %+v, %v, want the default config", cfg, err)
+	}
+	if _, err := LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"), ""); err == nil {
+		t.Error("loaded a missing file")
+	}
+}
+
+func TestExampleConfigValidates(t *testing.T) {
+	cfg, err := LoadConfig("../config.example.yaml", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		modify  func(*Config)
+		wantErr string
+	}{
+		{"default", func(*Config) {}, ""},
+		{"unknown exporter type", func(c *Config) { c.Exporter.Type = "carrier-pigeon" }, "exporter (traces): type must be"},
+		{"empty endpoint", func(c *Config) { c.Exporter.Endpoint = "" }, "endpoint must not be empty"},
+		{"unknown protocol", func(c *Config) { c.Exporter.Protocol = "udp" }, "protocol must be grpc, http/protobuf or http/json"},
+		{"signal endpoint overrides the shared one", func(c *Config) { c.Exporter.Logs.Compression = "zstd" }, "exporter (logs): compression must be gzip or none"},
+		{"zero timeout", func(c *Config) { c.Exporter.Timeout = 0 }, "timeout must be positive"},
+		{"prometheus for traces", func(c *Config) { c.Exporter.Traces.Type = "prometheus" }, "type prometheus only exports metrics"},
+		{"empty service name", func(c *Config) { c.Service.Name = "" }, "service.name must not be empty"},
+		{"ratio above 1", func(c *Config) { c.Sampler.Type, c.Sampler.Ratio = "traceidratio", 1.5 }, "sampler.ratio must be within [0, 1]"},
+		{"batch larger than the queue", func(c *Config) { c.Batch.MaxExportBatchSize = c.Batch.MaxQueueSize + 1 }, "must not exceed batch.max_queue_size"},
+		{"zero export timeout", func(c *Config) { c.Batch.ExportTimeout = 0 }, "must be positive"},
+		{"zero rate", func(c *Config) { c.Scenario.Rate = 0 }, "scenario.rate must be positive"},
+		{"negative duration", func(c *Config) { c.Scenario.Duration = -time.Second }, "scenario.duration must not be negative"},
+		{"inverted latency", func(c *Config) { c.Scenario.DBLatency = LatencyRange{Min: time.Second, Max: time.Millisecond} }, "scenario.db_latency must satisfy 0 <= min <= max"},
+		{"unknown dry run format", func(c *Config) { c.DryRun.Format = "xml" }, "dry_run.format must be text or json"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			c.modify(cfg)
+			err := cfg.Validate()
+			switch {
+			case c.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error %v", err)
+			case c.wantErr != "" && (err == nil || !strings.Contains(err.Error(), c.wantErr)):
+				t.Fatalf("got error %v, want one containing %q", err, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadConfigProfile(t *testing.T) {
+	const yamlConfig = `
+exporter:
+  endpoint: localhost:4317
+  headers:
+    authorization: local-key
+scenario:
+  rate: 10
+profiles:
+  cloud:
+    exporter:
+      endpoint: otlp.example.com:4317
+  ci:
+    scenario:
+      duration: 2m
+`
+	const tomlConfig = `
+[exporter]
+endpoint = "localhost:4317"
+[exporter.headers]
+authorization = "local-key"
+[scenario]
+rate = 10.0
+[profiles.cloud.exporter]
+endpoint = "otlp.example.com:4317"
+[profiles.ci.scenario]
+duration = "2m"
+`
+	for _, c := range []struct {
+		name, file, data, profile string
+		endpoint                  string
+		duration                  time.Duration
+		wantErr                   string
+	}{
+		{name: "yaml without a profile", file: "c.yaml", data: yamlConfig, endpoint: "localhost:4317"},
+		{name: "yaml profile overrides", file: "c.yaml", data: yamlConfig, profile: "cloud", endpoint: "otlp.example.com:4317"},
+		{name: "yaml profile adds", file: "c.yaml", data: yamlConfig, profile: "ci", endpoint: "localhost:4317", duration: 2 * time.Minute},
+		{name: "yaml unknown profile", file: "c.yaml", data: yamlConfig, profile: "prod", wantErr: `profile "prod" not found (available: ci, cloud)`},
+		{name: "yaml without profiles", file: "c.yaml", data: "scenario:\n  rate: 1\n", profile: "ci", wantErr: "the file defines no profiles"},
+		{name: "toml without a profile", file: "c.toml", data: tomlConfig, endpoint: "localhost:4317"},
+		{name: "toml profile overrides", file: "c.toml", data: tomlConfig, profile: "cloud", endpoint: "otlp.example.com:4317"},
+		{name: "toml profile adds", file: "c.toml", data: tomlConfig, profile: "ci", endpoint: "localhost:4317", duration: 2 * time.Minute},
+		{name: "toml unknown profile", file: "c.toml", data: tomlConfig, profile: "prod", wantErr: `profile "prod" not found (available: ci, cloud)`},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			cfg, err := LoadConfig(writeConfig(t, c.file, c.data), c.profile)
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, c.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Exporter.Endpoint != c.endpoint || cfg.Scenario.Duration != c.duration {
+				t.Errorf("endpoint %s and duration %s, want %s and %s", cfg.Exporter.Endpoint, cfg.Scenario.Duration, c.endpoint, c.duration)
+			}
+			// What the profile doesn't set stays as the top level has it
+			if cfg.Exporter.Headers["authorization"] != "local-key" || cfg.Scenario.Rate != 10 {
+				t.Errorf("profile %q lost the top-level settings: %+v", c.profile, cfg)
+			}
+		})
+	}
+}
+
+func TestLoadConfigProfileWithoutFile(t *testing.T) {
+	if _, err := LoadConfig("", "ci"); err == nil || !strings.Contains(err.Error(), "no config file given") {
+		t.Errorf("got error %v, want one for the missing file", err)
+	}
+}
@@ -0,0 +1,194 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/protobuf/proto"
+)
+
+// dryRunWriter prints batches instead of exporting them, either as one line
+// of text per span, log record and metric data point, or as one line of OTLP
+// JSON per batch. The three signal exporters share it so their output never
+// interleaves mid-batch.
+type dryRunWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format string
+}
+
+func newDryRunWriter(w io.Writer, format string) *dryRunWriter {
+	return &dryRunWriter{w: w, format: format}
+}
+
+func (d *dryRunWriter) write(msg proto.Message, text func(*bytes.Buffer)) error {
+	var buf bytes.Buffer
+	if d.format == "json" {
+		b, err := MarshalOTLPJSON(msg)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	} else {
+		text(&buf)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, err := d.w.Write(buf.Bytes())
+	return err
+}
+
+type dryRunSpanExporter struct{ *dryRunWriter }
+
+func (e dryRunSpanExporter) ExportSpans(_ context.Context, spans []sdktrace.ReadOnlySpan) error {
+	return e.write(spansToProto(spans), func(buf *bytes.Buffer) {
+		for _, s := range spans {
+			sc := s.SpanContext()
+			fmt.Fprintf(buf, "span   %s trace=%s span=%s", s.Name(), sc.TraceID(), sc.SpanID())
+			if s.Parent().IsValid() {
+				fmt.Fprintf(buf, " parent=%s", s.Parent().SpanID())
+			}
+			fmt.Fprintf(buf, " kind=%s status=%s duration=%s %s\n",
+				s.SpanKind(), s.Status().Code, s.EndTime().Sub(s.StartTime()).Round(time.Microsecond), formatAttributes(s.Attributes()))
+			for _, ev := range s.Events() {
+				fmt.Fprintf(buf, "         event %s at=%s %s\n", ev.Name, ev.Time.Format(time.RFC3339Nano), formatAttributes(ev.Attributes))
+			}
+			for _, l := range s.Links() {
+				fmt.Fprintf(buf, "         link trace=%s span=%s %s\n", l.SpanContext.TraceID(), l.SpanContext.SpanID(), formatAttributes(l.Attributes))
+			}
+		}
+	})
+}
+
+func (e dryRunSpanExporter) Shutdown(context.Context) error { return nil }
+
+type dryRunLogExporter struct{ *dryRunWriter }
+
+func (e dryRunLogExporter) Export(_ context.Context, records []sdklog.Record) error {
+	return e.write(logsToProto(records), func(buf *bytes.Buffer) {
+		for i := range records {
+			r := &records[i]
+			fmt.Fprintf(buf, "log    %s %-5s %q", r.Timestamp().Format(time.RFC3339Nano), r.Severity(), r.Body().String())
+			if r.TraceID().IsValid() {
+				fmt.Fprintf(buf, " trace=%s span=%s", r.TraceID(), r.SpanID())
+			}
+			var attrs []string
+			r.WalkAttributes(func(kv otellog.KeyValue) bool {
+				attrs = append(attrs, kv.Key+"="+kv.Value.String())
+				return true
+			})
+			sort.Strings(attrs)
+			fmt.Fprintf(buf, " {%s}\n", strings.Join(attrs, ", "))
+		}
+	})
+}
+
+func (e dryRunLogExporter) Shutdown(context.Context) error   { return nil }
+func (e dryRunLogExporter) ForceFlush(context.Context) error { return nil }
+
+type dryRunMetricExporter struct{ *dryRunWriter }
+
+func (e dryRunMetricExporter) Temporality(k sdkmetric.InstrumentKind) metricdata.Temporality {
+	return sdkmetric.DefaultTemporalitySelector(k)
+}
+
+func (e dryRunMetricExporter) Aggregation(k sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return sdkmetric.DefaultAggregationSelector(k)
+}
+
+func (e dryRunMetricExporter) Export(_ context.Context, rm *metricdata.ResourceMetrics) error {
+	return e.write(metricsToProto(rm), func(buf *bytes.Buffer) {
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				writeMetricText(buf, m)
+			}
+		}
+	})
+}
+
+func (e dryRunMetricExporter) ForceFlush(context.Context) error { return nil }
+func (e dryRunMetricExporter) Shutdown(context.Context) error   { return nil }
+
+// writeExemplars lists a histogram point's exemplars under it, with the
+// trace and span each links to
+func writeExemplars[N int64 | float64](buf *bytes.Buffer, exemplars []metricdata.Exemplar[N]) {
+	for _, e := range exemplars {
+		fmt.Fprintf(buf, "         exemplar value=%v at=%s trace=%x span=%x %s\n", e.Value, e.Time.Format(time.RFC3339Nano), e.TraceID, e.SpanID, formatAttributes(e.FilteredAttributes))
+	}
+}
+
+func writeMetricText(buf *bytes.Buffer, m metricdata.Metrics) {
+	unit := ""
+	if m.Unit != "" && m.Unit != "1" {
+		unit = " " + m.Unit
+	}
+	point := func(kind string, attrs attribute.Set, value string) {
+		fmt.Fprintf(buf, "metric %s %s %s %s\n", m.Name, kind, value, formatAttributes(attrs.ToSlice()))
+	}
+	switch data := m.Data.(type) {
+	case metricdata.Gauge[int64]:
+		for _, dp := range data.DataPoints {
+			point("gauge", dp.Attributes, fmt.Sprintf("value=%d%s", dp.Value, unit))
+		}
+	case metricdata.Gauge[float64]:
+		for _, dp := range data.DataPoints {
+			point("gauge", dp.Attributes, fmt.Sprintf("value=%g%s", dp.Value, unit))
+		}
+	case metricdata.Sum[int64]:
+		for _, dp := range data.DataPoints {
+			point("sum", dp.Attributes, fmt.Sprintf("value=%d%s temporality=%s", dp.Value, unit, data.Temporality))
+		}
+	case metricdata.Sum[float64]:
+		for _, dp := range data.DataPoints {
+			point("sum", dp.Attributes, fmt.Sprintf("value=%g%s temporality=%s", dp.Value, unit, data.Temporality))
+		}
+	case metricdata.Histogram[int64]:
+		for _, dp := range data.DataPoints {
+			point("histogram", dp.Attributes, fmt.Sprintf("count=%d sum=%d%s temporality=%s", dp.Count, dp.Sum, unit, data.Temporality))
+			writeExemplars(buf, dp.Exemplars)
+		}
+	case metricdata.Histogram[float64]:
+		for _, dp := range data.DataPoints {
+			point("histogram", dp.Attributes, fmt.Sprintf("count=%d sum=%g%s temporality=%s", dp.Count, dp.Sum, unit, data.Temporality))
+			writeExemplars(buf, dp.Exemplars)
+		}
+	case metricdata.ExponentialHistogram[int64]:
+		for _, dp := range data.DataPoints {
+			point("exponential_histogram", dp.Attributes, fmt.Sprintf("count=%d sum=%d%s scale=%d temporality=%s", dp.Count, dp.Sum, unit, dp.Scale, data.Temporality))
+			writeExemplars(buf, dp.Exemplars)
+		}
+	case metricdata.ExponentialHistogram[float64]:
+		for _, dp := range data.DataPoints {
+			point("exponential_histogram", dp.Attributes, fmt.Sprintf("count=%d sum=%g%s scale=%d temporality=%s", dp.Count, dp.Sum, unit, dp.Scale, data.Temporality))
+			writeExemplars(buf, dp.Exemplars)
+		}
+	case metricdata.Summary:
+		for _, dp := range data.DataPoints {
+			point("summary", dp.Attributes, fmt.Sprintf("count=%d sum=%g%s", dp.Count, dp.Sum, unit))
+		}
+	}
+}
+
+// formatAttributes renders attributes as a sorted {k=v, ...} list
+func formatAttributes(attrs []attribute.KeyValue) string {
+	parts := make([]string, 0, len(attrs))
+	for _, kv := range attrs {
+		parts = append(parts, string(kv.Key)+"="+kv.Value.Emit())
+	}
+	sort.Strings(parts)
+	return "{" + strings.Join(parts, ", ") + "}"
+}
@@ -0,0 +1,189 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultEnrichPool is the number of pods of the fake fleet an enrich
+// processor draws from without a pool
+const defaultEnrichPool = 6
+
+// enrichRegions are the regions the fake fleet's pods are spread across
+var enrichRegions = []string{"us-east-1", "eu-west-1"}
+
+// enrichGenerators make the values an enrich processor's Generate keys
+// name, for the pod of the fake fleet in the slot given, with the service's
+// name. The values of a slot fit together: the pod runs on its node, in
+// its zone of its region.
+var enrichGenerators = map[string]func(service string, slot int) string{
+	"deployment.environment":  func(string, int) string { return "production" },
+	"cloud.provider":          func(string, int) string { return "aws" },
+	"cloud.region":            func(_ string, slot int) string { return enrichRegion(slot) },
+	"cloud.availability_zone": func(_ string, slot int) string { return enrichRegion(slot) + string(rune('a'+slot/2%3)) },
+	"k8s.cluster.name":        func(_ string, slot int) string { return "shop-" + enrichRegion(slot) },
+	"k8s.namespace.name":      func(string, int) string { return "shop" },
+	"k8s.deployment.name":     func(service string, _ int) string { return service },
+	"k8s.node.name":           enrichNode,
+	"host.name":               enrichNode,
+	"k8s.pod.name": func(service string, slot int) string {
+		// The ReplicaSet's hash, the same for all the pods, and a suffix of
+		// Kubernetes' alphabet
+		rs := sha256.Sum256([]byte(service))
+		h := enrichHash(service, slot)
+		const alphabet = "bcdfghjklmnpqrstvwxz2456789"
+		var suffix [5]byte
+		for i := range suffix {
+			suffix[i] = alphabet[int(h[i])%len(alphabet)]
+		}
+		return fmt.Sprintf("%s-%s-%s", service, hex.EncodeToString(rs[:5])[:9], suffix[:])
+	},
+	"container.id": func(service string, slot int) string {
+		h := enrichHash(service, slot)
+		return hex.EncodeToString(h[:])
+	},
+}
+
+// EnrichKeys returns the attribute keys an enrich processor can generate
+// values for, sorted
+func EnrichKeys() []string {
+	return slices.Sorted(maps.Keys(enrichGenerators))
+}
+
+func enrichRegion(slot int) string {
+	return enrichRegions[slot%len(enrichRegions)]
+}
+
+func enrichNode(_ string, slot int) string {
+	return fmt.Sprintf("ip-10-%d-%d-%d.%s.compute.internal", slot%len(enrichRegions), slot/2%3, 10+slot, enrichRegion(slot))
+}
+
+func enrichHash(service string, slot int) [sha256.Size]byte {
+	return sha256.Sum256(fmt.Appendf(nil, "%s/%d", service, slot))
+}
+
+// enricher holds what an enrich processor adds: fixed attributes and the
+// keys of generated ones
+type enricher struct {
+	fixed    []attribute.KeyValue
+	generate []string
+	pool     int
+
+	mu  sync.Mutex
+	rng *rand.Rand // picks the pod outside a trace
+}
+
+func newEnricher(cfg ProcessorConfig) *enricher {
+	e := &enricher{generate: cfg.Generate, pool: cfg.Pool}
+	if e.pool == 0 {
+		e.pool = defaultEnrichPool
+	}
+	seed := uint64(cfg.seed)
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	e.rng = rand.New(rand.NewPCG(seed, 0))
+	for _, k := range slices.Sorted(maps.Keys(cfg.Attributes)) {
+		e.fixed = append(e.fixed, attribute.String(k, cfg.Attributes[k]))
+	}
+	return e
+}
+
+// attributes returns what to add to a span or record of the service's
+// with the trace ID. The generated values are those of one pod of the
+// fleet, picked by trace ID so that all of a trace's spans and logs appear
+// to come from the same pod, and from the run's seed outside a trace.
+func (e *enricher) attributes(res *resource.Resource, id trace.TraceID) []attribute.KeyValue {
+	if len(e.generate) == 0 {
+		return e.fixed
+	}
+	service := "unknown_service"
+	if res != nil {
+		if v, ok := res.Set().Value(semconv.ServiceNameKey); ok {
+			service = v.AsString()
+		}
+	}
+	var slot int
+	if id.IsValid() {
+		slot = int(binary.BigEndian.Uint64(id[:8]) % uint64(e.pool))
+	} else {
+		e.mu.Lock()
+		slot = e.rng.IntN(e.pool)
+		e.mu.Unlock()
+	}
+	attrs := slices.Clone(e.fixed)
+	for _, k := range e.generate {
+		attrs = append(attrs, attribute.String(k, enrichGenerators[k](strings.ToLower(service), slot)))
+	}
+	return attrs
+}
+
+// enrichSpanProcessor adds its attributes to spans as they end, as a
+// collector's resource detection and k8sattributes processors would on
+// their way in, leaving alone those a span already has. The SDK has
+// applied the attribute count limit by then, so what goes past it is
+// dropped here.
+type enrichSpanProcessor struct {
+	sdktrace.SpanProcessor
+	*enricher
+	limit int
+}
+
+func newEnrichSpanProcessor(cfg ProcessorConfig, next sdktrace.SpanProcessor) (sdktrace.SpanProcessor, error) {
+	return &enrichSpanProcessor{SpanProcessor: next, enricher: newEnricher(cfg), limit: cfg.limits.AttributeCountLimit}, nil
+}
+
+func (p *enrichSpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	attrs := slices.Clip(s.Attributes())
+	for _, kv := range p.attributes(s.Resource(), s.SpanContext().TraceID()) {
+		if !slices.ContainsFunc(attrs, func(a attribute.KeyValue) bool { return a.Key == kv.Key }) {
+			attrs = append(attrs, kv)
+		}
+	}
+	var dropped int
+	if p.limit >= 0 && len(attrs) > p.limit {
+		attrs, dropped = attrs[:p.limit], len(attrs)-p.limit
+	}
+	p.SpanProcessor.OnEnd(rewrittenSpan{ReadOnlySpan: s, attrs: attrs, events: s.Events(), dropped: dropped})
+}
+
+// enrichLogProcessor adds its attributes to log records as they're
+// emitted, leaving alone those a record already has
+type enrichLogProcessor struct {
+	sdklog.Processor
+	*enricher
+}
+
+func newEnrichLogProcessor(cfg ProcessorConfig, next sdklog.Processor) (sdklog.Processor, error) {
+	return &enrichLogProcessor{Processor: next, enricher: newEnricher(cfg)}, nil
+}
+
+func (p *enrichLogProcessor) OnEmit(ctx context.Context, r *sdklog.Record) error {
+	has := map[string]bool{}
+	r.WalkAttributes(func(kv otellog.KeyValue) bool {
+		has[kv.Key] = true
+		return true
+	})
+	for _, kv := range p.attributes(r.Resource(), r.TraceID()) {
+		if !has[string(kv.Key)] {
+			r.AddAttributes(otellog.String(string(kv.Key), kv.Value.AsString()))
+		}
+	}
+	return p.Processor.OnEmit(ctx, r)
+}
@@ -0,0 +1,49 @@
+package telemetry
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestEnrichKeepsAttributeCountLimit(t *testing.T) {
+	limits := sdktrace.NewSpanLimits()
+	limits.AttributeCountLimit = 3
+	recorder := tracetest.NewSpanRecorder()
+	p, err := chainSpanProcessors([]ProcessorConfig{{Type: "enrich", Generate: []string{"cloud.region", "k8s.pod.name"}}}, recorder, 1, limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(p), sdktrace.WithRawSpanLimits(limits))
+	_, span := tp.Tracer("test").Start(context.Background(), "op",
+		trace.WithAttributes(attribute.Int("a", 1), attribute.Int("b", 2), attribute.Int("c", 3), attribute.Int("d", 4)))
+	span.End()
+
+	s := recorder.Ended()[0]
+	if got := len(s.Attributes()); got != 3 {
+		t.Errorf("%d attributes, want 3: %v", got, s.Attributes())
+	}
+	// One dropped by the SDK, both generated ones past the limit
+	if got := s.DroppedAttributes(); got != 3 {
+		t.Errorf("%d dropped attributes, want 3", got)
+	}
+}
+
+func TestEnrichSeedPicksPodsOutsideTraces(t *testing.T) {
+	pods := func(seed int64) []string {
+		e := newEnricher(ProcessorConfig{Generate: []string{"k8s.pod.name"}, Pool: 50, seed: seed})
+		var names []string
+		for range 5 {
+			names = append(names, e.attributes(nil, trace.TraceID{})[0].Value.AsString())
+		}
+		return names
+	}
+	if a, b := pods(22), pods(22); !slices.Equal(a, b) {
+		t.Errorf("seed 22 picked %v, then %v", a, b)
+	}
+}
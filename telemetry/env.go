@@ -0,0 +1,253 @@
+package telemetry
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ApplyEnv overlays the OTEL_* environment variables on cfg following the
+// OTLP exporter specification: OTEL_EXPORTER_OTLP_* applies to every signal
+// and OTEL_EXPORTER_OTLP_{TRACES,LOGS,METRICS}_* overrides it per signal.
+func ApplyEnv(cfg *Config) error {
+	signals := []struct {
+		prefix string
+		ep     *EndpointConfig
+	}{
+		{"OTEL_EXPORTER_OTLP_", &cfg.Exporter.EndpointConfig},
+		{"OTEL_EXPORTER_OTLP_TRACES_", &cfg.Exporter.Traces},
+		{"OTEL_EXPORTER_OTLP_LOGS_", &cfg.Exporter.Logs},
+		{"OTEL_EXPORTER_OTLP_METRICS_", &cfg.Exporter.Metrics},
+	}
+	for _, s := range signals {
+		if err := applyEndpointEnv(s.prefix, s.ep); err != nil {
+			return err
+		}
+	}
+
+	if v, ok := lookupEnv("OTEL_RESOURCE_ATTRIBUTES"); ok {
+		attrs, err := parseKeyValueList(v)
+		if err != nil {
+			return fmt.Errorf("OTEL_RESOURCE_ATTRIBUTES: %w", err)
+		}
+		ApplyResourceAttributes(&cfg.Service, attrs)
+	}
+	// OTEL_SERVICE_NAME wins over service.name in OTEL_RESOURCE_ATTRIBUTES
+	if v, ok := lookupEnv("OTEL_SERVICE_NAME"); ok {
+		cfg.Service.Name = v
+	}
+	if v, ok := lookupEnv("OTEL_EXPORTER_OTLP_METRICS_TEMPORALITY_PREFERENCE"); ok {
+		// Case-insensitive, as the specification has it
+		cfg.Exporter.Temporality = strings.ToLower(v)
+	}
+	if v, ok := lookupEnv("OTEL_METRICS_EXEMPLAR_FILTER"); ok {
+		cfg.ExemplarFilter = v
+	}
+	if v, ok := lookupEnv("OTEL_PROPAGATORS"); ok {
+		cfg.Propagators = splitList(v)
+	}
+	if err := applySamplerEnv(&cfg.Sampler); err != nil {
+		return err
+	}
+	if err := applyBatchEnv(&cfg.Batch); err != nil {
+		return err
+	}
+	return applyLimitsEnv(&cfg.Limits)
+}
+
+// applySamplerEnv reads OTEL_TRACES_SAMPLER and its argument, the ratio
+// for the traceidratio and traceidhash samplers and the spans per second
+// for ratelimiting
+func applySamplerEnv(s *SamplerConfig) error {
+	if v, ok := lookupEnv("OTEL_TRACES_SAMPLER"); ok {
+		s.Type = v
+	}
+	v, ok := lookupEnv("OTEL_TRACES_SAMPLER_ARG")
+	if !ok {
+		return nil
+	}
+	arg, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return fmt.Errorf("OTEL_TRACES_SAMPLER_ARG: %w", err)
+	}
+	if s.Type == "ratelimiting" {
+		s.Rate = arg
+	} else {
+		s.Ratio = arg
+	}
+	return nil
+}
+
+// applyBatchEnv reads the OTEL_BSP_* batch span processor variables. The
+// SDK would read them itself, but the configured options take precedence
+// over them, so they're applied here to keep the usual order.
+func applyBatchEnv(b *BatchConfig) error {
+	for _, v := range []struct {
+		key string
+		n   *int
+	}{
+		{"OTEL_BSP_MAX_QUEUE_SIZE", &b.MaxQueueSize},
+		{"OTEL_BSP_MAX_EXPORT_BATCH_SIZE", &b.MaxExportBatchSize},
+	} {
+		if s, ok := lookupEnv(v.key); ok {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return fmt.Errorf("%s: %w", v.key, err)
+			}
+			*v.n = n
+		}
+	}
+	for _, v := range []struct {
+		key string
+		d   *time.Duration
+	}{
+		{"OTEL_BSP_SCHEDULE_DELAY", &b.BatchTimeout},
+		{"OTEL_BSP_EXPORT_TIMEOUT", &b.ExportTimeout},
+	} {
+		if s, ok := lookupEnv(v.key); ok {
+			// Milliseconds, like OTEL_EXPORTER_OTLP_TIMEOUT
+			ms, err := strconv.Atoi(s)
+			if err != nil {
+				return fmt.Errorf("%s: %w", v.key, err)
+			}
+			*v.d = time.Duration(ms) * time.Millisecond
+		}
+	}
+	return nil
+}
+
+// applyLimitsEnv reads the span limit variables, for the same reason as
+// applyBatchEnv
+func applyLimitsEnv(l *LimitsConfig) error {
+	for _, v := range []struct {
+		key string
+		n   *int
+	}{
+		{"OTEL_SPAN_ATTRIBUTE_COUNT_LIMIT", &l.AttributeCount},
+		{"OTEL_SPAN_ATTRIBUTE_VALUE_LENGTH_LIMIT", &l.AttributeValueLength},
+		{"OTEL_SPAN_EVENT_COUNT_LIMIT", &l.EventCount},
+		{"OTEL_SPAN_LINK_COUNT_LIMIT", &l.LinkCount},
+		{"OTEL_EVENT_ATTRIBUTE_COUNT_LIMIT", &l.AttributePerEventCount},
+		{"OTEL_LINK_ATTRIBUTE_COUNT_LIMIT", &l.AttributePerLinkCount},
+	} {
+		if s, ok := lookupEnv(v.key); ok {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return fmt.Errorf("%s: %w", v.key, err)
+			}
+			*v.n = n
+		}
+	}
+	return nil
+}
+
+func applyEndpointEnv(prefix string, ep *EndpointConfig) error {
+	if v, ok := lookupEnv(prefix + "ENDPOINT"); ok {
+		ep.Endpoint = v
+		if prefix == "OTEL_EXPORTER_OTLP_" {
+			ep.baseEndpoint = v
+		}
+	}
+	if v, ok := lookupEnv(prefix + "PROTOCOL"); ok {
+		ep.Protocol = v
+	}
+	if v, ok := lookupEnv(prefix + "INSECURE"); ok {
+		insecure, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%sINSECURE: %w", prefix, err)
+		}
+		ep.Insecure = &insecure
+	}
+	if v, ok := lookupEnv(prefix + "CERTIFICATE"); ok {
+		ep.Certificate = v
+	}
+	if v, ok := lookupEnv(prefix + "CLIENT_CERTIFICATE"); ok {
+		ep.ClientCertificate = v
+	}
+	if v, ok := lookupEnv(prefix + "CLIENT_KEY"); ok {
+		ep.ClientKey = v
+	}
+	if v, ok := lookupEnv(prefix + "HEADERS"); ok {
+		headers, err := parseKeyValueList(v)
+		if err != nil {
+			return fmt.Errorf("%sHEADERS: %w", prefix, err)
+		}
+		ep.Headers = headers
+	}
+	if v, ok := lookupEnv(prefix + "COMPRESSION"); ok {
+		ep.Compression = v
+	}
+	if v, ok := lookupEnv(prefix + "TIMEOUT"); ok {
+		// The spec expresses the timeout in milliseconds
+		ms, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("%sTIMEOUT: %w", prefix, err)
+		}
+		ep.Timeout = time.Duration(ms) * time.Millisecond
+	}
+	return nil
+}
+
+// lookupEnv treats empty variables as unset, as the OTel spec requires
+func lookupEnv(key string) (string, bool) {
+	v := strings.TrimSpace(os.Getenv(key))
+	return v, v != ""
+}
+
+// parseKeyValueList parses the W3C-baggage-like "k1=v1,k2=v2" format used
+// by OTEL_EXPORTER_OTLP_HEADERS and OTEL_RESOURCE_ATTRIBUTES. Values are
+// percent-decoded.
+func parseKeyValueList(s string) (map[string]string, error) {
+	kv := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid key=value pair %q", pair)
+		}
+		decoded, err := url.PathUnescape(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %q: %w", k, err)
+		}
+		kv[k] = decoded
+	}
+	return kv, nil
+}
+
+// splitList splits a comma-separated list, trimming the items and skipping
+// empty ones.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ApplyResourceAttributes routes the well-known service keys to the identity
+// fields and keeps the rest as extra resource attributes.
+func ApplyResourceAttributes(svc *ServiceConfig, attrs map[string]string) {
+	for k, v := range attrs {
+		switch k {
+		case "service.name":
+			svc.Name = v
+		case "service.version":
+			svc.Version = v
+		case "service.instance.id":
+			svc.InstanceID = v
+		default:
+			if svc.Attributes == nil {
+				svc.Attributes = map[string]string{}
+			}
+			svc.Attributes[k] = v
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package telemetry
+
+import "testing"
+
+func TestEnvEndpointURL(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		env      map[string]string
+		endpoint string // set after the environment, as the -endpoint flag is
+		want     string
+	}{
+		{
+			name: "generic without a path",
+			env:  map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "gw:4318"},
+			want: "https://gw:4318/v1/traces",
+		},
+		{
+			name: "generic with a base path",
+			env:  map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "https://gw:4318/otlp"},
+			want: "https://gw:4318/otlp/v1/traces",
+		},
+		{
+			name: "generic with a trailing slash",
+			env:  map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "https://gw:4318/otlp/"},
+			want: "https://gw:4318/otlp/v1/traces",
+		},
+		{
+			name: "per signal",
+			env:  map[string]string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "https://gw:4318/otlp"},
+			want: "https://gw:4318/otlp",
+		},
+		{
+			name: "per signal over generic",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT":        "https://gw:4318/otlp",
+				"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "https://gw:4318/otlp",
+			},
+			want: "https://gw:4318/otlp",
+		},
+		{
+			name:     "flag over generic",
+			env:      map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "https://gw:4318/otlp"},
+			endpoint: "https://other:4318/otlp",
+			want:     "https://other:4318/otlp",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			cfg := DefaultConfig()
+			if err := ApplyEnv(cfg); err != nil {
+				t.Fatal(err)
+			}
+			if tc.endpoint != "" {
+				cfg.Exporter.Endpoint = tc.endpoint
+			}
+			u, err := httpURL(cfg.Exporter.Resolve(cfg.Exporter.Traces), "traces")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := u.String(); got != tc.want {
+				t.Errorf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
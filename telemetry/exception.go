@@ -0,0 +1,44 @@
+package telemetry
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RecordError records err on span as an exception event and sets the
+// span's error status. Unlike span.RecordError, exception.type names the
+// error wrapped under any fmt.Errorf layers, say *scenario.StatusError
+// rather than *fmt.wrapError, so exceptions group by what went wrong, and
+// exception.stacktrace is always recorded.
+func RecordError(span trace.Span, err error) {
+	span.AddEvent("exception", trace.WithAttributes(exceptionAttributes(errorType(err), err)...))
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// exceptionAttributes are the exception.* semantic convention attributes
+// for err, with the stack of the caller
+func exceptionAttributes(typ string, err error) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("exception.type", typ),
+		attribute.String("exception.message", err.Error()),
+		attribute.String("exception.stacktrace", string(debug.Stack())),
+	}
+}
+
+// errorType is the type of the first error in err's chain that isn't only
+// wrapping another with a message
+func errorType(err error) string {
+	for {
+		typ := fmt.Sprintf("%T", err)
+		next := errors.Unwrap(err)
+		if typ != "*fmt.wrapError" || next == nil {
+			return typ
+		}
+		err = next
+	}
+}
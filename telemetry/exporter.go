@@ -0,0 +1,565 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutlog"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+)
+
+// newTraceExporter, newLogExporter and newMetricExporter pick the exporter
+// backend for a signal: the dry-run writer when one is given, otherwise the
+// exporter for the signal's resolved endpoint, spooled to disk if
+// configured and fanned out to any mirrors.
+func newTraceExporter(ctx context.Context, cfg *Config, dryRun *dryRunWriter, stats *SignalStats) (sdktrace.SpanExporter, error) {
+	if dryRun != nil {
+		return dryRunSpanExporter{dryRun}, nil
+	}
+	primary := cfg.Exporter.Resolve(cfg.Exporter.Traces)
+	newPrimary := func(ctx context.Context, ep EndpointConfig) (sdktrace.SpanExporter, error) {
+		exporter, err := newEndpointTraceExporter(ctx, ep)
+		if err != nil || !cfg.Exporter.spools(ep) {
+			return exporter, err
+		}
+		s, err := newSpool(ctx, cfg.Exporter.Spool, ep, "traces")
+		if err != nil {
+			return nil, errors.Join(err, exporter.Shutdown(ctx))
+		}
+		return spoolSpanExporter{exporter, s}, nil
+	}
+	if len(cfg.Exporter.Mirrors) == 0 {
+		return newPrimary(ctx, primary)
+	}
+	targets, err := newFanoutTargets(ctx, primary, cfg.Exporter.MirrorsFor("traces"), newPrimary, newEndpointTraceExporter, stats)
+	if err != nil {
+		return nil, err
+	}
+	return fanoutSpanExporter{targets}, nil
+}
+
+func newLogExporter(ctx context.Context, cfg *Config, dryRun *dryRunWriter, stats *SignalStats) (sdklog.Exporter, error) {
+	if dryRun != nil {
+		return dryRunLogExporter{dryRun}, nil
+	}
+	primary := cfg.Exporter.Resolve(cfg.Exporter.Logs)
+	newPrimary := func(ctx context.Context, ep EndpointConfig) (sdklog.Exporter, error) {
+		exporter, err := newEndpointLogExporter(ctx, ep)
+		if err != nil || !cfg.Exporter.spools(ep) {
+			return exporter, err
+		}
+		s, err := newSpool(ctx, cfg.Exporter.Spool, ep, "logs")
+		if err != nil {
+			return nil, errors.Join(err, exporter.Shutdown(ctx))
+		}
+		return spoolLogExporter{exporter, s}, nil
+	}
+	if len(cfg.Exporter.Mirrors) == 0 {
+		return newPrimary(ctx, primary)
+	}
+	targets, err := newFanoutTargets(ctx, primary, cfg.Exporter.MirrorsFor("logs"), newPrimary, newEndpointLogExporter, stats)
+	if err != nil {
+		return nil, err
+	}
+	return fanoutLogExporter{targets}, nil
+}
+
+func newMetricExporter(ctx context.Context, cfg *Config, dryRun *dryRunWriter, stats *SignalStats) (sdkmetric.Exporter, error) {
+	if dryRun != nil {
+		return dryRunMetricExporter{dryRun}, nil
+	}
+	primary := cfg.Exporter.Resolve(cfg.Exporter.Metrics)
+	newPrimary := func(ctx context.Context, ep EndpointConfig) (sdkmetric.Exporter, error) {
+		exporter, err := newEndpointMetricExporter(ctx, ep)
+		if err != nil || !cfg.Exporter.spools(ep) {
+			return exporter, err
+		}
+		s, err := newSpool(ctx, cfg.Exporter.Spool, ep, "metrics")
+		if err != nil {
+			return nil, errors.Join(err, exporter.Shutdown(ctx))
+		}
+		return spoolMetricExporter{exporter, s}, nil
+	}
+	if len(cfg.Exporter.Mirrors) == 0 {
+		return newPrimary(ctx, primary)
+	}
+	targets, err := newFanoutTargets(ctx, primary, cfg.Exporter.MirrorsFor("metrics"), newPrimary, newEndpointMetricExporter, stats)
+	if err != nil {
+		return nil, err
+	}
+	return fanoutMetricExporter{targets}, nil
+}
+
+// newEndpointTraceExporter, newEndpointLogExporter and
+// newEndpointMetricExporter create the exporter of ep's type
+func newEndpointTraceExporter(ctx context.Context, ep EndpointConfig) (sdktrace.SpanExporter, error) {
+	switch ep.Type {
+	case "stdout":
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "file":
+		w, err := newFileWriter(ep.Path)
+		if err != nil {
+			return nil, err
+		}
+		return fileSpanExporter{w}, nil
+	case "sql":
+		w, err := newFileWriter(ep.Path)
+		if err != nil {
+			return nil, err
+		}
+		return sqlSpanExporter{w}, nil
+	case "clickhouse":
+		return newClickHouseTraceExporter(ep)
+	case "kafka":
+		return newKafkaTraceExporter(ep)
+	case "zipkin":
+		return newZipkinTraceExporter(ep)
+	default:
+		return newOTLPTraceExporter(ctx, ep)
+	}
+}
+
+func newEndpointLogExporter(ctx context.Context, ep EndpointConfig) (sdklog.Exporter, error) {
+	switch ep.Type {
+	case "stdout":
+		return stdoutlog.New(stdoutlog.WithWriter(os.Stdout))
+	case "file":
+		w, err := newFileWriter(ep.Path)
+		if err != nil {
+			return nil, err
+		}
+		return fileLogExporter{w}, nil
+	case "sql":
+		w, err := newFileWriter(ep.Path)
+		if err != nil {
+			return nil, err
+		}
+		return sqlLogExporter{w}, nil
+	case "clickhouse":
+		return newClickHouseLogExporter(ep)
+	case "kafka":
+		return newKafkaLogExporter(ep)
+	case "syslog":
+		return newSyslogLogExporter(ep)
+	case "loki":
+		return newLokiLogExporter(ep)
+	case "fluent":
+		return newFluentLogExporter(ep)
+	default:
+		return newOTLPLogExporter(ctx, ep)
+	}
+}
+
+func newEndpointMetricExporter(ctx context.Context, ep EndpointConfig) (sdkmetric.Exporter, error) {
+	switch ep.Type {
+	case "stdout":
+		return stdoutmetric.New(stdoutmetric.WithWriter(os.Stdout))
+	case "file":
+		w, err := newFileWriter(ep.Path)
+		if err != nil {
+			return nil, err
+		}
+		return fileMetricExporter{w}, nil
+	case "sql":
+		w, err := newFileWriter(ep.Path)
+		if err != nil {
+			return nil, err
+		}
+		return sqlMetricExporter{w}, nil
+	case "clickhouse":
+		return newClickHouseMetricExporter(ep)
+	case "kafka":
+		return newKafkaMetricExporter(ep)
+	default:
+		return newOTLPMetricExporter(ctx, ep)
+	}
+}
+
+// newOTLPTraceExporter, newOTLPLogExporter and newOTLPMetricExporter
+// create the OTLP exporter for ep's protocol
+func newOTLPTraceExporter(ctx context.Context, ep EndpointConfig) (sdktrace.SpanExporter, error) {
+	switch ep.Protocol {
+	case "http/protobuf":
+		return newHTTPTraceExporter(ctx, ep)
+	case "http/json":
+		return newJSONTraceExporter(ep)
+	default:
+		return newGRPCTraceExporter(ctx, ep)
+	}
+}
+
+func newOTLPLogExporter(ctx context.Context, ep EndpointConfig) (sdklog.Exporter, error) {
+	switch ep.Protocol {
+	case "http/protobuf":
+		return newHTTPLogExporter(ctx, ep)
+	case "http/json":
+		return newJSONLogExporter(ep)
+	default:
+		return newGRPCLogExporter(ctx, ep)
+	}
+}
+
+func newOTLPMetricExporter(ctx context.Context, ep EndpointConfig) (sdkmetric.Exporter, error) {
+	switch ep.Protocol {
+	case "http/protobuf":
+		return newHTTPMetricExporter(ctx, ep)
+	case "http/json":
+		return newJSONMetricExporter(ep)
+	default:
+		return newGRPCMetricExporter(ctx, ep)
+	}
+}
+
+func newGRPCTraceExporter(ctx context.Context, ep EndpointConfig) (sdktrace.SpanExporter, error) {
+	conn, release, err := grpcConns.acquire(ctx, ep)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []otlptracegrpc.Option{
+		otlptracegrpc.WithGRPCConn(conn),
+		otlptracegrpc.WithHeaders(ep.Headers),
+		otlptracegrpc.WithTimeout(ep.Timeout),
+		otlptracegrpc.WithRetry(otlptracegrpc.RetryConfig{
+			Enabled:         ep.Retry.enabled(),
+			InitialInterval: ep.Retry.InitialInterval,
+			MaxInterval:     ep.Retry.MaxInterval,
+			MaxElapsedTime:  ep.Retry.MaxElapsedTime,
+		}),
+	}
+	if ep.Compression == "gzip" {
+		opts = append(opts, otlptracegrpc.WithCompressor("gzip"))
+	}
+
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to create trace exporter: %w", err), release())
+	}
+	return sharedConnSpanExporter{exporter, release}, nil
+}
+
+func newGRPCLogExporter(ctx context.Context, ep EndpointConfig) (sdklog.Exporter, error) {
+	conn, release, err := grpcConns.acquire(ctx, ep)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []otlploggrpc.Option{
+		otlploggrpc.WithGRPCConn(conn),
+		otlploggrpc.WithHeaders(ep.Headers),
+		otlploggrpc.WithTimeout(ep.Timeout),
+		otlploggrpc.WithRetry(otlploggrpc.RetryConfig{
+			Enabled:         ep.Retry.enabled(),
+			InitialInterval: ep.Retry.InitialInterval,
+			MaxInterval:     ep.Retry.MaxInterval,
+			MaxElapsedTime:  ep.Retry.MaxElapsedTime,
+		}),
+	}
+	if ep.Compression == "gzip" {
+		opts = append(opts, otlploggrpc.WithCompressor("gzip"))
+	}
+
+	exporter, err := otlploggrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to create log exporter: %w", err), release())
+	}
+	return sharedConnLogExporter{exporter, release}, nil
+}
+
+func newGRPCMetricExporter(ctx context.Context, ep EndpointConfig) (sdkmetric.Exporter, error) {
+	conn, release, err := grpcConns.acquire(ctx, ep)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []otlpmetricgrpc.Option{
+		otlpmetricgrpc.WithGRPCConn(conn),
+		otlpmetricgrpc.WithHeaders(ep.Headers),
+		otlpmetricgrpc.WithTimeout(ep.Timeout),
+		otlpmetricgrpc.WithRetry(otlpmetricgrpc.RetryConfig{
+			Enabled:         ep.Retry.enabled(),
+			InitialInterval: ep.Retry.InitialInterval,
+			MaxInterval:     ep.Retry.MaxInterval,
+			MaxElapsedTime:  ep.Retry.MaxElapsedTime,
+		}),
+	}
+	if ep.Compression == "gzip" {
+		opts = append(opts, otlpmetricgrpc.WithCompressor("gzip"))
+	}
+
+	exporter, err := otlpmetricgrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to create metric exporter: %w", err), release())
+	}
+	return sharedConnMetricExporter{exporter, release}, nil
+}
+
+// ErrCollectorUnreachable marks errors where the collector couldn't be
+// reached at all, as opposed to a bad configuration
+var ErrCollectorUnreachable = errors.New("collector unreachable")
+
+// dialCollector opens the gRPC connection described by ep. Creating the
+// connection doesn't block; waitReady then gives it the endpoint timeout to
+// come up, so a collector that is down fails at startup with the reason
+// instead of leaving the exporters to retry into the void.
+func dialCollector(ctx context.Context, ep EndpointConfig) (*grpc.ClientConn, error) {
+	target, plaintext, err := grpcTarget(ep)
+	if err != nil {
+		return nil, err
+	}
+
+	creds := insecure.NewCredentials()
+	if !plaintext {
+		tlsCfg, err := tlsConfig(ep)
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(tlsCfg)
+	}
+
+	proxy, err := grpcProxy(ep, target)
+	if err != nil {
+		return nil, err
+	}
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithChainUnaryInterceptor(partialSuccessInterceptor),
+	}
+	opts = append(opts, grpcTuning(ep.GRPC)...)
+	if proxy != nil {
+		opts = append(opts, grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return dialThroughProxy(ctx, proxy, addr)
+		}))
+	}
+
+	// passthrough hands the host name to the dialer unresolved, so a proxy
+	// sees the collector's name rather than an address
+	conn, err := grpc.NewClient("passthrough:///"+target, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC connection: %w", err)
+	}
+	if err := waitReady(ctx, conn, ep.Timeout); err != nil {
+		conn.Close()
+		return nil, collectorProbeError(target, proxy, plaintext, ep, err)
+	}
+	return conn, nil
+}
+
+// waitReady starts connecting and waits up to timeout for the connection
+// to become ready
+func waitReady(ctx context.Context, conn *grpc.ClientConn, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn.Connect()
+	for {
+		state := conn.GetState()
+		if state == connectivity.Ready {
+			return nil
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return fmt.Errorf("not ready after %s (%s)", timeout, strings.ToLower(state.String()))
+		}
+	}
+}
+
+// collectorProbeError explains why the connection to target didn't come
+// up. gRPC only reports its connectivity state, so the TCP connection and
+// the TLS handshake are retried on their own to find the step that fails.
+func collectorProbeError(target string, proxy *url.URL, plaintext bool, ep EndpointConfig, readyErr error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var raw net.Conn
+	var err error
+	if proxy != nil {
+		raw, err = dialThroughProxy(ctx, proxy, target)
+	} else {
+		raw, err = (&net.Dialer{}).DialContext(ctx, "tcp", target)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrCollectorUnreachable, target, err)
+	}
+	defer raw.Close()
+
+	if !plaintext {
+		tlsCfg, err := tlsConfig(ep)
+		if err != nil {
+			return err
+		}
+		if tlsCfg.ServerName == "" {
+			tlsCfg.ServerName, _, _ = net.SplitHostPort(target)
+		}
+		if err := tls.Client(raw, tlsCfg).HandshakeContext(ctx); err != nil {
+			return fmt.Errorf("TLS handshake with %s failed: %w (use -insecure if the collector expects plaintext, or -ca-cert if its certificate isn't publicly trusted)", target, err)
+		}
+	}
+	return fmt.Errorf("%w: %s accepts connections but gRPC is %v", ErrCollectorUnreachable, target, readyErr)
+}
+
+// grpcTuning returns the dial options for the configured keepalive,
+// message size and reconnection backoff
+func grpcTuning(cfg GRPCConfig) []grpc.DialOption {
+	var opts []grpc.DialOption
+	if cfg.KeepaliveTime > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                cfg.KeepaliveTime,
+			Timeout:             cfg.KeepaliveTimeout,
+			PermitWithoutStream: true,
+		}))
+	}
+	if cfg.MaxMessageSize > 0 {
+		opts = append(opts, grpc.WithDefaultCallOptions(
+			grpc.MaxCallSendMsgSize(cfg.MaxMessageSize),
+			grpc.MaxCallRecvMsgSize(cfg.MaxMessageSize),
+		))
+	}
+	if cfg.BackoffBaseDelay > 0 || cfg.BackoffMaxDelay > 0 {
+		params := grpc.ConnectParams{Backoff: backoff.DefaultConfig, MinConnectTimeout: 20 * time.Second}
+		if cfg.BackoffBaseDelay > 0 {
+			params.Backoff.BaseDelay = cfg.BackoffBaseDelay
+		}
+		if cfg.BackoffMaxDelay > 0 {
+			params.Backoff.MaxDelay = cfg.BackoffMaxDelay
+		}
+		opts = append(opts, grpc.WithConnectParams(params))
+	}
+	return opts
+}
+
+// grpcTarget returns the host:port to dial and whether the connection is
+// plaintext. Connections use TLS unless the endpoint is an http:// URL or
+// insecure is set explicitly, which wins over the scheme. The port defaults
+// to 4317.
+func grpcTarget(ep EndpointConfig) (target string, plaintext bool, err error) {
+	target = ep.Endpoint
+
+	if strings.Contains(ep.Endpoint, "://") {
+		u, err := url.Parse(ep.Endpoint)
+		if err != nil {
+			return "", false, fmt.Errorf("invalid endpoint %q: %w", ep.Endpoint, err)
+		}
+		switch u.Scheme {
+		case "http":
+			plaintext = true
+		case "https":
+			plaintext = false
+		default:
+			return "", false, fmt.Errorf("invalid endpoint %q: scheme must be http or https", ep.Endpoint)
+		}
+		target = u.Host
+	}
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		target = net.JoinHostPort(strings.Trim(target, "[]"), "4317")
+	}
+
+	if ep.Insecure != nil {
+		plaintext = *ep.Insecure
+	}
+	return target, plaintext, nil
+}
+
+// endpointTarget describes where ep sends signal for display: the gRPC
+// host:port or the HTTP URL, the host name behind it and whether the
+// transport is plaintext
+func endpointTarget(ep EndpointConfig, signal string) (target, host string, plaintext bool, err error) {
+	if ep.Type == "clickhouse" {
+		u, err := clickhouseURL(ep)
+		if err != nil {
+			return "", "", false, err
+		}
+		return u.Redacted(), u.Hostname(), u.Scheme == "http", nil
+	}
+	if ep.Type == "zipkin" {
+		u, err := zipkinURL(ep)
+		if err != nil {
+			return "", "", false, err
+		}
+		return u.String(), u.Hostname(), u.Scheme == "http", nil
+	}
+	if ep.Type == "loki" {
+		u, err := lokiURL(ep)
+		if err != nil {
+			return "", "", false, err
+		}
+		return u.Redacted(), u.Hostname(), u.Scheme == "http", nil
+	}
+	if ep.Type == "syslog" || ep.Type == "fluent" {
+		network, addr, err := socketEndpoint(ep)
+		if err != nil {
+			return "", "", false, err
+		}
+		host, _, err := net.SplitHostPort(addr)
+		return addr, host, network != "tls", err
+	}
+	if ep.Type == "kafka" {
+		brokers, plaintext, err := kafkaBrokers(ep)
+		if err != nil {
+			return "", "", false, err
+		}
+		host, _, err := net.SplitHostPort(brokers[0])
+		return strings.Join(brokers, ","), host, plaintext, err
+	}
+	if strings.HasPrefix(ep.Protocol, "http/") {
+		u, err := httpURL(ep, signal)
+		if err != nil {
+			return "", "", false, err
+		}
+		return u.String(), u.Hostname(), u.Scheme == "http", nil
+	}
+
+	target, plaintext, err = grpcTarget(ep)
+	if err != nil {
+		return "", "", false, err
+	}
+	host, _, err = net.SplitHostPort(target)
+	return target, host, plaintext, err
+}
+
+// tlsConfig builds the client TLS settings: the system roots unless a CA
+// certificate is configured, plus a client certificate for mTLS.
+func tlsConfig(ep EndpointConfig) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if ep.Certificate != "" {
+		pem, err := os.ReadFile(ep.Certificate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in %s", ep.Certificate)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if ep.ClientCertificate != "" {
+		cert, err := tls.LoadX509KeyPair(ep.ClientCertificate, ep.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
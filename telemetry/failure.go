@@ -0,0 +1,77 @@
+package telemetry
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"go.opentelemetry.io/otel"
+)
+
+// ExportFailureHook is called after every failed export with the signal
+// (traces, logs or metrics), the number of spans, log records or data
+// points in the batch and the error. It runs on the exporting goroutine, so
+// it should return quickly.
+type ExportFailureHook func(signal string, items int, err error)
+
+// LogExportFailure is the default hook, handing the otel error handler,
+// which logs by default, one error per lost batch
+func LogExportFailure(signal string, items int, err error) {
+	otel.Handle(fmt.Errorf("export failed, %d %s not delivered: %w", items, itemNoun(signal), err))
+}
+
+// itemNoun names what signal's batches are made of
+func itemNoun(signal string) string {
+	switch signal {
+	case "traces":
+		return "spans"
+	case "logs":
+		return "log records"
+	default:
+		return "metric data points"
+	}
+}
+
+// reportedError is an export error a hook has already seen. The batch
+// processors still hand it to the otel error handler, which skips it
+// rather than logging the failure a second time.
+type reportedError struct{ error }
+
+func (e reportedError) Unwrap() error { return e.error }
+
+// defaultErrorHandler is the SDK's own, which logs until another is set
+var defaultErrorHandler = otel.GetErrorHandler()
+
+// skipReportedErrors is the otel error handler while a global client has a
+// failure hook. It passes every error but those the hook has reported on to
+// the handler it replaced, or logs it as the SDK's default would.
+type skipReportedErrors struct{ next otel.ErrorHandler }
+
+func (h skipReportedErrors) Handle(err error) {
+	var reported reportedError
+	if errors.As(err, &reported) {
+		return
+	}
+	if h.next == defaultErrorHandler {
+		// The default hands errors to the handler set after it, this one
+		log.Print(err)
+		return
+	}
+	h.next.Handle(err)
+}
+
+// SkipReportedErrors returns h without the export errors a failure hook
+// has already reported, for an otel error handler that replaces the one a
+// client installed
+func SkipReportedErrors(h otel.ErrorHandler) otel.ErrorHandler {
+	return skipReportedErrors{h}
+}
+
+// installSkipReportedErrors wraps the current otel error handler in
+// skipReportedErrors, once
+func installSkipReportedErrors() {
+	current := otel.GetErrorHandler()
+	if _, ok := current.(skipReportedErrors); !ok {
+		otel.SetErrorHandler(skipReportedErrors{current})
+	}
+}
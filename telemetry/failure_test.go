@@ -0,0 +1,37 @@
+package telemetry
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+)
+
+func TestSkipReportedErrorsForwardsTheRest(t *testing.T) {
+	prev := otel.GetErrorHandler()
+	t.Cleanup(func() { otel.SetErrorHandler(prev) })
+
+	var got []error
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) { got = append(got, err) }))
+	installSkipReportedErrors()
+	installSkipReportedErrors()
+
+	other := errors.New("unrelated")
+	otel.Handle(reportedError{errors.New("seen by the hook")})
+	otel.Handle(other)
+	if len(got) != 1 || got[0] != other {
+		t.Fatalf("handled %v, want only %v once", got, other)
+	}
+}
+
+func TestSkipReportedErrorsWraps(t *testing.T) {
+	var got []error
+	h := SkipReportedErrors(otel.ErrorHandlerFunc(func(err error) { got = append(got, err) }))
+	other := errors.New("unrelated")
+	h.Handle(fmt.Errorf("traces export: %w", reportedError{errors.New("seen by the hook")}))
+	h.Handle(other)
+	if len(got) != 1 || got[0] != other {
+		t.Fatalf("handled %v, want only %v", got, other)
+	}
+}
@@ -0,0 +1,151 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// exporterBase is the part every signal's exporter interface has in common
+type exporterBase interface {
+	Shutdown(context.Context) error
+}
+
+// fanoutTarget is one destination of a fan-out exporter. Each target is a
+// separate OTLP exporter with its own connection and retry state, so a slow
+// or failing mirror doesn't change how the others are retried.
+type fanoutTarget[E exporterBase] struct {
+	name     string
+	exporter E
+	stats    *targetStats
+}
+
+// newFanoutTargets creates the exporter for the primary endpoint with
+// newPrimary and one for each mirror, in name order, with newExporter, and
+// registers their tallies with stats. If any of them fails the ones already
+// created are shut down again.
+func newFanoutTargets[E exporterBase](ctx context.Context, primary EndpointConfig, mirrors map[string]EndpointConfig, newPrimary, newExporter func(context.Context, EndpointConfig) (E, error), stats *SignalStats) ([]fanoutTarget[E], error) {
+	names := make([]string, 0, len(mirrors))
+	for name := range mirrors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	targets := make([]fanoutTarget[E], 0, len(names)+1)
+	add := func(name string, ep EndpointConfig, newExporter func(context.Context, EndpointConfig) (E, error)) error {
+		exporter, err := newExporter(ctx, ep)
+		if err != nil {
+			return fmt.Errorf("%s (%s): %w", name, ep.Endpoint, err)
+		}
+		targets = append(targets, fanoutTarget[E]{name, exporter, &targetStats{name: name}})
+		return nil
+	}
+
+	if err := add("primary", primary, newPrimary); err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if err := add(name, mirrors[name], newExporter); err != nil {
+			return nil, errors.Join(err, fanout(targets, func(e E) error { return e.Shutdown(ctx) }))
+		}
+	}
+	for _, t := range targets {
+		stats.targets = append(stats.targets, t.stats)
+	}
+	return targets, nil
+}
+
+// fanout calls fn for every target in parallel and joins the errors, each
+// labelled with the target it came from
+func fanout[E exporterBase](targets []fanoutTarget[E], fn func(E) error) error {
+	return fanoutEach(targets, func(t fanoutTarget[E]) error { return fn(t.exporter) })
+}
+
+// fanoutExport is fanout for an export of n items, recording the outcome
+// in each target's tally
+func fanoutExport[E exporterBase](targets []fanoutTarget[E], n int, fn func(E) error) error {
+	return fanoutEach(targets, func(t fanoutTarget[E]) error {
+		start := time.Now()
+		err := fn(t.exporter)
+		t.stats.recordExport(n, start, err)
+		return err
+	})
+}
+
+func fanoutEach[E exporterBase](targets []fanoutTarget[E], fn func(fanoutTarget[E]) error) error {
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(t); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", t.name, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+type fanoutSpanExporter struct {
+	targets []fanoutTarget[sdktrace.SpanExporter]
+}
+
+func (e fanoutSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	return fanoutExport(e.targets, len(spans), func(x sdktrace.SpanExporter) error { return x.ExportSpans(ctx, spans) })
+}
+
+func (e fanoutSpanExporter) Shutdown(ctx context.Context) error {
+	return fanout(e.targets, func(x sdktrace.SpanExporter) error { return x.Shutdown(ctx) })
+}
+
+type fanoutLogExporter struct {
+	targets []fanoutTarget[sdklog.Exporter]
+}
+
+func (e fanoutLogExporter) Export(ctx context.Context, records []sdklog.Record) error {
+	return fanoutExport(e.targets, len(records), func(x sdklog.Exporter) error { return x.Export(ctx, records) })
+}
+
+func (e fanoutLogExporter) ForceFlush(ctx context.Context) error {
+	return fanout(e.targets, func(x sdklog.Exporter) error { return x.ForceFlush(ctx) })
+}
+
+func (e fanoutLogExporter) Shutdown(ctx context.Context) error {
+	return fanout(e.targets, func(x sdklog.Exporter) error { return x.Shutdown(ctx) })
+}
+
+// fanoutMetricExporter takes its temporality and aggregation from the
+// primary target; every target is an OTLP exporter with the same defaults.
+type fanoutMetricExporter struct {
+	targets []fanoutTarget[sdkmetric.Exporter]
+}
+
+func (e fanoutMetricExporter) Temporality(k sdkmetric.InstrumentKind) metricdata.Temporality {
+	return e.targets[0].exporter.Temporality(k)
+}
+
+func (e fanoutMetricExporter) Aggregation(k sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return e.targets[0].exporter.Aggregation(k)
+}
+
+func (e fanoutMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	return fanoutExport(e.targets, dataPointCount(rm), func(x sdkmetric.Exporter) error { return x.Export(ctx, rm) })
+}
+
+func (e fanoutMetricExporter) ForceFlush(ctx context.Context) error {
+	return fanout(e.targets, func(x sdkmetric.Exporter) error { return x.ForceFlush(ctx) })
+}
+
+func (e fanoutMetricExporter) Shutdown(ctx context.Context) error {
+	return fanout(e.targets, func(x sdkmetric.Exporter) error { return x.Shutdown(ctx) })
+}
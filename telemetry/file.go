@@ -0,0 +1,85 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/protobuf/proto"
+)
+
+// fileWriter appends OTLP JSON lines to a file, one ResourceSpans,
+// ResourceLogs or ResourceMetrics object per line, so an archived run can be
+// split back into export requests by an importer. Each batch is written with
+// a single append, which keeps lines whole when several signals share a file.
+type fileWriter struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func newFileWriter(path string) (*fileWriter, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open output file: %w", err)
+	}
+	return &fileWriter{f: f}, nil
+}
+
+func writeJSONLines[M proto.Message](w *fileWriter, msgs []M) error {
+	var buf bytes.Buffer
+	for _, msg := range msgs {
+		b, err := MarshalOTLPJSON(msg)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err := w.f.Write(buf.Bytes())
+	return err
+}
+
+func (w *fileWriter) Shutdown(context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Close()
+}
+
+type fileSpanExporter struct{ *fileWriter }
+
+func (e fileSpanExporter) ExportSpans(_ context.Context, spans []sdktrace.ReadOnlySpan) error {
+	return writeJSONLines(e.fileWriter, spansToProto(spans).ResourceSpans)
+}
+
+type fileLogExporter struct{ *fileWriter }
+
+func (e fileLogExporter) Export(_ context.Context, records []sdklog.Record) error {
+	return writeJSONLines(e.fileWriter, logsToProto(records).ResourceLogs)
+}
+
+func (e fileLogExporter) ForceFlush(context.Context) error { return nil }
+
+type fileMetricExporter struct{ *fileWriter }
+
+func (e fileMetricExporter) Temporality(k sdkmetric.InstrumentKind) metricdata.Temporality {
+	return sdkmetric.DefaultTemporalitySelector(k)
+}
+
+func (e fileMetricExporter) Aggregation(k sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return sdkmetric.DefaultAggregationSelector(k)
+}
+
+func (e fileMetricExporter) Export(_ context.Context, rm *metricdata.ResourceMetrics) error {
+	return writeJSONLines(e.fileWriter, metricsToProto(rm).ResourceMetrics)
+}
+
+func (e fileMetricExporter) ForceFlush(context.Context) error { return nil }
@@ -0,0 +1,229 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+)
+
+// fluentPorts are the Fluent Forward transports with their default ports
+var fluentPorts = map[string]string{"tcp": "24224", "tls": "24224"}
+
+// fluentTarget splits ep.Endpoint into the network and address of a
+// fluent-bit or fluentd forward input: host[:port], optionally prefixed with
+// tcp:// or tls://
+func fluentTarget(ep EndpointConfig) (network, addr string, err error) {
+	return socketTarget(ep, fluentPorts, "tcp")
+}
+
+// fluentLogExporter sends log records with the Fluent Forward protocol, one
+// Forward mode message per batch, so they can be routed through an existing
+// fluent-bit or fluentd tier. The tag is Topic, or the service name when
+// it's empty. Each record holds the message, severity, trace context and
+// log attributes at the top level and the resource attributes under
+// resource. Acknowledgements aren't requested, so a batch counts as
+// delivered once it's written to the connection.
+type fluentLogExporter struct {
+	conn *socketConn
+	tag  string
+}
+
+func newFluentLogExporter(ep EndpointConfig) (sdklog.Exporter, error) {
+	network, addr, err := fluentTarget(ep)
+	if err != nil {
+		return nil, err
+	}
+	return &fluentLogExporter{conn: &socketConn{ep: ep, network: network, addr: addr}, tag: ep.Topic}, nil
+}
+
+func (e *fluentLogExporter) Export(ctx context.Context, records []sdklog.Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	tag := e.tag
+	if tag == "" {
+		tag = resourceServiceName(records[0].Resource())
+	}
+
+	// [tag, [[time, record], ...], {"size": n}]
+	b := appendMsgpackArray(nil, 3)
+	b = appendMsgpackString(b, tag)
+	b = appendMsgpackArray(b, len(records))
+	for i := range records {
+		b = appendFluentEntry(b, &records[i])
+	}
+	b = appendMsgpackMap(b, 1)
+	b = appendMsgpackString(b, "size")
+	b = appendMsgpackInt(b, int64(len(records)))
+	return e.conn.write(ctx, b)
+}
+
+func appendFluentEntry(b []byte, r *sdklog.Record) []byte {
+	ts := r.Timestamp()
+	if ts.IsZero() {
+		ts = r.ObservedTimestamp()
+	}
+	b = appendMsgpackArray(b, 2)
+	// EventTime, the ext type keeping nanoseconds
+	b = append(b, 0xd7, 0x00)
+	b = binary.BigEndian.AppendUint32(b, uint32(ts.Unix()))
+	b = binary.BigEndian.AppendUint32(b, uint32(ts.Nanosecond()))
+
+	fields := 2 + r.AttributesLen()
+	severityText := r.SeverityText()
+	if severityText == "" && r.Severity() != otellog.SeverityUndefined {
+		severityText = r.Severity().String()
+	}
+	if severityText != "" {
+		fields += 2
+	}
+	tid, sid := r.TraceID(), r.SpanID()
+	if tid.IsValid() {
+		fields++
+	}
+	if sid.IsValid() {
+		fields++
+	}
+	b = appendMsgpackMap(b, fields)
+	b = appendMsgpackString(b, "message")
+	b = appendMsgpackValue(b, r.Body())
+	if severityText != "" {
+		b = appendMsgpackString(b, "severity_text")
+		b = appendMsgpackString(b, severityText)
+		b = appendMsgpackString(b, "severity_number")
+		b = appendMsgpackInt(b, int64(r.Severity()))
+	}
+	if tid.IsValid() {
+		b = appendMsgpackString(b, "trace_id")
+		b = appendMsgpackString(b, tid.String())
+	}
+	if sid.IsValid() {
+		b = appendMsgpackString(b, "span_id")
+		b = appendMsgpackString(b, sid.String())
+	}
+	r.WalkAttributes(func(kv otellog.KeyValue) bool {
+		b = appendMsgpackString(b, kv.Key)
+		b = appendMsgpackValue(b, kv.Value)
+		return true
+	})
+
+	attrs := r.Resource().Attributes()
+	b = appendMsgpackString(b, "resource")
+	b = appendMsgpackMap(b, len(attrs))
+	for _, kv := range attrs {
+		b = appendMsgpackString(b, string(kv.Key))
+		b = appendMsgpackString(b, kv.Value.Emit())
+	}
+	return b
+}
+
+func (e *fluentLogExporter) ForceFlush(context.Context) error { return nil }
+
+func (e *fluentLogExporter) Shutdown(context.Context) error {
+	e.conn.close()
+	return nil
+}
+
+// The appendMsgpack* functions encode the MessagePack subset the forward
+// protocol needs, always picking the shortest form
+
+func appendMsgpackArray(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xdc), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdd), uint32(n))
+	}
+}
+
+func appendMsgpackMap(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xde), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdf), uint32(n))
+	}
+}
+
+func appendMsgpackString(b []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+func appendMsgpackBytes(b []byte, p []byte) []byte {
+	switch n := len(p); {
+	case n <= math.MaxUint8:
+		b = append(b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xc5), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xc6), uint32(n))
+	}
+	return append(b, p...)
+}
+
+func appendMsgpackInt(b []byte, v int64) []byte {
+	switch {
+	case v >= 0 && v < 128:
+		return append(b, byte(v))
+	case v < 0 && v >= -32:
+		return append(b, byte(v))
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(v))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(v))
+	}
+}
+
+// appendMsgpackValue encodes a log value with its own type, so numbers and
+// nested maps arrive as such rather than as strings
+func appendMsgpackValue(b []byte, v otellog.Value) []byte {
+	switch v.Kind() {
+	case otellog.KindBool:
+		if v.AsBool() {
+			return append(b, 0xc3)
+		}
+		return append(b, 0xc2)
+	case otellog.KindInt64:
+		return appendMsgpackInt(b, v.AsInt64())
+	case otellog.KindFloat64:
+		return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(v.AsFloat64()))
+	case otellog.KindString:
+		return appendMsgpackString(b, v.AsString())
+	case otellog.KindBytes:
+		return appendMsgpackBytes(b, v.AsBytes())
+	case otellog.KindSlice:
+		values := v.AsSlice()
+		b = appendMsgpackArray(b, len(values))
+		for _, v := range values {
+			b = appendMsgpackValue(b, v)
+		}
+		return b
+	case otellog.KindMap:
+		kvs := v.AsMap()
+		b = appendMsgpackMap(b, len(kvs))
+		for _, kv := range kvs {
+			b = appendMsgpackString(b, kv.Key)
+			b = appendMsgpackValue(b, kv.Value)
+		}
+		return b
+	default:
+		return append(b, 0xc0) // nil
+	}
+}
@@ -0,0 +1,112 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc"
+)
+
+// grpcConns shares one gRPC connection between all exporters whose
+// endpoints dial the same way. With the usual shared endpoint that is a
+// single connection for traces, logs and metrics, so keepalive and TLS
+// apply to all of them alike.
+var grpcConns = &connPool{conns: map[connKey]*sharedConn{}}
+
+// connKey holds every setting that shapes a gRPC connection. Per-request
+// settings such as headers, compression and retries stay with the
+// exporters, so endpoints that only differ in those still share.
+type connKey struct {
+	target            string
+	plaintext         bool
+	certificate       string
+	clientCertificate string
+	clientKey         string
+	proxy             string
+	grpc              GRPCConfig
+}
+
+type connPool struct {
+	mu    sync.Mutex
+	conns map[connKey]*sharedConn
+}
+
+type sharedConn struct {
+	conn *grpc.ClientConn
+	refs int
+}
+
+// acquire returns the connection for ep, dialling it on first use, and a
+// release func that closes it once its last user is done
+func (p *connPool) acquire(ctx context.Context, ep EndpointConfig) (*grpc.ClientConn, func() error, error) {
+	target, plaintext, err := grpcTarget(ep)
+	if err != nil {
+		return nil, nil, err
+	}
+	key := connKey{target, plaintext, ep.Certificate, ep.ClientCertificate, ep.ClientKey, ep.Proxy, ep.GRPC}
+
+	// Dialling under the lock makes the other signals wait for the first
+	// connection instead of opening their own
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sc, ok := p.conns[key]
+	if !ok {
+		conn, err := dialCollector(ctx, ep)
+		if err != nil {
+			return nil, nil, err
+		}
+		sc = &sharedConn{conn: conn}
+		p.conns[key] = sc
+	}
+	sc.refs++
+
+	var once sync.Once
+	release := func() error {
+		var err error
+		once.Do(func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if sc.refs--; sc.refs == 0 {
+				delete(p.conns, key)
+				err = sc.conn.Close()
+			}
+		})
+		return err
+	}
+	return sc.conn, release, nil
+}
+
+// The shared*Exporter types release their connection after the exporter
+// itself has shut down, since the OTLP exporters never close a connection
+// they were handed.
+
+type sharedConnSpanExporter struct {
+	sdktrace.SpanExporter
+	release func() error
+}
+
+func (e sharedConnSpanExporter) Shutdown(ctx context.Context) error {
+	return errors.Join(e.SpanExporter.Shutdown(ctx), e.release())
+}
+
+type sharedConnLogExporter struct {
+	sdklog.Exporter
+	release func() error
+}
+
+func (e sharedConnLogExporter) Shutdown(ctx context.Context) error {
+	return errors.Join(e.Exporter.Shutdown(ctx), e.release())
+}
+
+type sharedConnMetricExporter struct {
+	sdkmetric.Exporter
+	release func() error
+}
+
+func (e sharedConnMetricExporter) Shutdown(ctx context.Context) error {
+	return errors.Join(e.Exporter.Shutdown(ctx), e.release())
+}
@@ -0,0 +1,28 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/httptrace/otelhttptrace"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// NewHTTPClient returns an http.Client whose requests are traced with
+// otelhttp through the global providers NewClient installs: each request is
+// a client span with the http.* attributes and the http.client.* metrics,
+// it carries the trace context in a traceparent header, and the connection
+// setup shows as http.dns, http.connect and http.tls spans under it, so a
+// slow call can be told apart from a slow server. Requests give up after
+// timeout; 0 waits for as long as the request's context allows.
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: otelhttp.NewTransport(http.DefaultTransport.(*http.Transport).Clone(),
+			otelhttp.WithClientTrace(func(ctx context.Context) *httptrace.ClientTrace {
+				return otelhttptrace.NewClientTrace(ctx)
+			})),
+	}
+}
@@ -0,0 +1,17 @@
+package telemetry
+
+import (
+	"go.opentelemetry.io/contrib/propagators/aws/xray"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// newIDGenerator returns the generator an id_generator value names, nil for
+// the SDK's random IDs
+func newIDGenerator(name string) sdktrace.IDGenerator {
+	if name == "xray" {
+		// The first 4 bytes of each trace ID are the Unix time in seconds,
+		// which X-Ray rejects traces without
+		return xray.NewIDGenerator()
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/protobuf/proto"
+)
+
+// kafkaDefaultTopics are the topics the collector's kafka receiver reads
+// unless it's configured otherwise
+var kafkaDefaultTopics = map[string]string{
+	"traces":  "otlp_spans",
+	"logs":    "otlp_logs",
+	"metrics": "otlp_metrics",
+}
+
+// kafkaBrokers splits ep.Endpoint into broker addresses, defaulting the port
+// to 9092. Kafka has no URL scheme to pick TLS with, so connections are only
+// plaintext when insecure is set.
+func kafkaBrokers(ep EndpointConfig) (brokers []string, plaintext bool, err error) {
+	for _, b := range strings.Split(ep.Endpoint, ",") {
+		b = strings.TrimSpace(b)
+		if b == "" {
+			continue
+		}
+		if strings.Contains(b, "://") {
+			return nil, false, fmt.Errorf("invalid broker %q: want host[:port]", b)
+		}
+		if _, _, err := net.SplitHostPort(b); err != nil {
+			b = net.JoinHostPort(b, "9092")
+		}
+		brokers = append(brokers, b)
+	}
+	if len(brokers) == 0 {
+		return nil, false, fmt.Errorf("no Kafka brokers in %q", ep.Endpoint)
+	}
+	return brokers, ep.Insecure != nil && *ep.Insecure, nil
+}
+
+// kafkaProducer publishes each exported batch as one message holding the
+// OTLP protobuf export request, the otlp_proto encoding of the kafka
+// receiver. Failed writes are retried with ep's backoff until
+// MaxElapsedTime runs out.
+type kafkaProducer struct {
+	writer *kafka.Writer
+	retry  RetryConfig
+}
+
+func newKafkaProducer(ep EndpointConfig, signal string) (*kafkaProducer, error) {
+	brokers, plaintext, err := kafkaBrokers(ep)
+	if err != nil {
+		return nil, err
+	}
+	transport := &kafka.Transport{
+		DialTimeout: ep.Timeout,
+		// Brokers are reached through the proxy like a gRPC collector
+		Dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			proxy, err := grpcProxy(ep, addr)
+			if err != nil {
+				return nil, err
+			}
+			if proxy != nil {
+				return dialThroughProxy(ctx, proxy, addr)
+			}
+			return (&net.Dialer{Timeout: ep.Timeout}).DialContext(ctx, network, addr)
+		},
+	}
+	if !plaintext {
+		if transport.TLS, err = tlsConfig(ep); err != nil {
+			return nil, err
+		}
+	}
+
+	topic := ep.Topic
+	if topic == "" {
+		topic = kafkaDefaultTopics[signal]
+	}
+	w := &kafka.Writer{
+		Addr:                   kafka.TCP(brokers...),
+		Topic:                  topic,
+		Balancer:               &kafka.LeastBytes{},
+		RequiredAcks:           kafka.RequireOne,
+		AllowAutoTopicCreation: true,
+		WriteTimeout:           ep.Timeout,
+		Transport:              transport,
+		MaxAttempts:            1,
+	}
+	if ep.Retry.enabled() {
+		// The context deadline set per export ends the retries
+		w.MaxAttempts = math.MaxInt32
+		w.WriteBackoffMin = ep.Retry.InitialInterval
+		w.WriteBackoffMax = ep.Retry.MaxInterval
+	}
+	if ep.Compression == "gzip" {
+		w.Compression = kafka.Gzip
+	}
+	return &kafkaProducer{writer: w, retry: ep.Retry}, nil
+}
+
+func (p *kafkaProducer) publish(ctx context.Context, msg proto.Message) error {
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if p.retry.enabled() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.retry.MaxElapsedTime)
+		defer cancel()
+	}
+	if err := p.writer.WriteMessages(ctx, kafka.Message{Value: b}); err != nil {
+		return fmt.Errorf("kafka topic %s: %w", p.writer.Topic, err)
+	}
+	return nil
+}
+
+func (p *kafkaProducer) Shutdown(context.Context) error {
+	return p.writer.Close()
+}
+
+type kafkaSpanExporter struct{ *kafkaProducer }
+
+func newKafkaTraceExporter(ep EndpointConfig) (sdktrace.SpanExporter, error) {
+	p, err := newKafkaProducer(ep, "traces")
+	if err != nil {
+		return nil, err
+	}
+	return kafkaSpanExporter{p}, nil
+}
+
+func (e kafkaSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	// TracesData has the same wire format as ExportTraceServiceRequest
+	return e.publish(ctx, spansToProto(spans))
+}
+
+type kafkaLogExporter struct{ *kafkaProducer }
+
+func newKafkaLogExporter(ep EndpointConfig) (sdklog.Exporter, error) {
+	p, err := newKafkaProducer(ep, "logs")
+	if err != nil {
+		return nil, err
+	}
+	return kafkaLogExporter{p}, nil
+}
+
+func (e kafkaLogExporter) Export(ctx context.Context, records []sdklog.Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	return e.publish(ctx, logsToProto(records))
+}
+
+func (e kafkaLogExporter) ForceFlush(context.Context) error { return nil }
+
+type kafkaMetricExporter struct{ *kafkaProducer }
+
+func newKafkaMetricExporter(ep EndpointConfig) (sdkmetric.Exporter, error) {
+	p, err := newKafkaProducer(ep, "metrics")
+	if err != nil {
+		return nil, err
+	}
+	return kafkaMetricExporter{p}, nil
+}
+
+func (e kafkaMetricExporter) Temporality(k sdkmetric.InstrumentKind) metricdata.Temporality {
+	return sdkmetric.DefaultTemporalitySelector(k)
+}
+
+func (e kafkaMetricExporter) Aggregation(k sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return sdkmetric.DefaultAggregationSelector(k)
+}
+
+func (e kafkaMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	return e.publish(ctx, metricsToProto(rm))
+}
+
+func (e kafkaMetricExporter) ForceFlush(context.Context) error { return nil }
@@ -0,0 +1,23 @@
+// Package logrusbridge sends github.com/sirupsen/logrus entries to
+// ClickStack through the LoggerProvider the telemetry package installs.
+// The hook sits next to the logger's own output, which is unchanged:
+//
+//	logrus.AddHook(logrusbridge.NewHook("checkout"))
+//	logrus.WithContext(ctx).WithField("items", 3).Info("order placed")
+//
+// The message becomes the record's body, the level its severity and the
+// fields log attributes, keeping their types. Entries logged WithContext
+// carry the trace and span IDs of the span in the context.
+package logrusbridge
+
+import (
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/bridges/otellogrus"
+	"go.opentelemetry.io/otel/log/global"
+)
+
+// NewHook returns a hook emitting entries of every level through the
+// global LoggerProvider under the instrumentation scope name
+func NewHook(name string) logrus.Hook {
+	return otellogrus.NewHook(name, otellogrus.WithLoggerProvider(global.GetLoggerProvider()))
+}
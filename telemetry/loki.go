@@ -0,0 +1,146 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+)
+
+// lokiURL resolves ep.Endpoint to a Loki push API URL: port 3100 and the
+// /loki/api/v1/push path unless the endpoint has its own
+func lokiURL(ep EndpointConfig) (*url.URL, error) {
+	return endpointURL(ep, "3100", "443", "/loki/api/v1/push")
+}
+
+// lokiLogExporter pushes log records to Loki's JSON push API, for
+// comparing ClickStack with a Loki deployment on identical data. Records
+// are grouped into one stream per resource, labelled with the resource
+// attributes (service.name becomes service_name). Severity, trace context
+// and log attributes go into structured metadata, the way Loki's own OTLP
+// endpoint stores them, so they don't add to the label cardinality.
+// Credentials in the endpoint URL are sent as basic auth; a tenant is set
+// with an X-Scope-OrgID header.
+type lokiLogExporter struct{ *otlpJSONClient }
+
+func newLokiLogExporter(ep EndpointConfig) (sdklog.Exporter, error) {
+	u, err := lokiURL(ep)
+	if err != nil {
+		return nil, err
+	}
+	headers := maps.Clone(ep.Headers)
+	if u.User != nil {
+		if headers == nil {
+			headers = map[string]string{}
+		}
+		password, _ := u.User.Password()
+		headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(u.User.Username()+":"+password))
+		u.User = nil
+	}
+	c, err := newJSONClient(ep, u, headers)
+	if err != nil {
+		return nil, err
+	}
+	return lokiLogExporter{c}, nil
+}
+
+type lokiPush struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	// Each value is [timestamp in ns, line, structured metadata]
+	Values [][]any `json:"values"`
+}
+
+func (e lokiLogExporter) Export(ctx context.Context, records []sdklog.Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	var push lokiPush
+	streams := map[attribute.Distinct]int{}
+	for i := range records {
+		r := &records[i]
+		res := r.Resource()
+		idx, ok := streams[res.Equivalent()]
+		if !ok {
+			idx = len(push.Streams)
+			streams[res.Equivalent()] = idx
+			push.Streams = append(push.Streams, lokiStream{Stream: lokiLabels(res.Attributes())})
+		}
+
+		ts := r.Timestamp()
+		if ts.IsZero() {
+			ts = r.ObservedTimestamp()
+		}
+		metadata := map[string]string{}
+		if r.Severity() != otellog.SeverityUndefined {
+			metadata["severity_text"] = r.Severity().String()
+			metadata["severity_number"] = strconv.Itoa(int(r.Severity()))
+		}
+		if text := r.SeverityText(); text != "" {
+			metadata["severity_text"] = text
+		}
+		if tid := r.TraceID(); tid.IsValid() {
+			metadata["trace_id"] = tid.String()
+		}
+		if sid := r.SpanID(); sid.IsValid() {
+			metadata["span_id"] = sid.String()
+		}
+		r.WalkAttributes(func(kv otellog.KeyValue) bool {
+			metadata[lokiName(kv.Key)] = kv.Value.String()
+			return true
+		})
+		push.Streams[idx].Values = append(push.Streams[idx].Values,
+			[]any{strconv.FormatInt(ts.UnixNano(), 10), r.Body().String(), metadata})
+	}
+
+	body, err := json.Marshal(push)
+	if err != nil {
+		return err
+	}
+	if err := e.sendBody(ctx, e.url, body); err != nil {
+		return fmt.Errorf("loki push: %w", err)
+	}
+	return nil
+}
+
+func (e lokiLogExporter) ForceFlush(context.Context) error { return nil }
+
+func (e lokiLogExporter) Shutdown(context.Context) error {
+	e.shutdown()
+	return nil
+}
+
+// lokiLabels turns resource attributes into stream labels
+func lokiLabels(attrs []attribute.KeyValue) map[string]string {
+	labels := make(map[string]string, len(attrs))
+	for _, kv := range attrs {
+		labels[lokiName(string(kv.Key))] = kv.Value.Emit()
+	}
+	return labels
+}
+
+// lokiName makes key a valid Loki label name, replacing everything but
+// letters, digits and underscores, e.g. service.name becomes service_name
+func lokiName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, key)
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
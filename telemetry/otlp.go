@@ -0,0 +1,503 @@
+package telemetry
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"regexp"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// This file converts SDK batches into their OTLP protobuf form, grouped by
+// resource and instrumentation scope exactly as the OTLP exporters send them.
+
+// spansToProto converts a span batch into OTLP TracesData
+func spansToProto(spans []sdktrace.ReadOnlySpan) *tracepb.TracesData {
+	data := &tracepb.TracesData{}
+	resources := map[attribute.Distinct]*tracepb.ResourceSpans{}
+	scopes := map[attribute.Distinct]map[instrumentation.Scope]*tracepb.ScopeSpans{}
+
+	for _, s := range spans {
+		res := s.Resource()
+		key := res.Equivalent()
+		rs, ok := resources[key]
+		if !ok {
+			rs = &tracepb.ResourceSpans{Resource: resourceToProto(res), SchemaUrl: res.SchemaURL()}
+			resources[key] = rs
+			scopes[key] = map[instrumentation.Scope]*tracepb.ScopeSpans{}
+			data.ResourceSpans = append(data.ResourceSpans, rs)
+		}
+
+		scope := s.InstrumentationScope()
+		ss, ok := scopes[key][scope]
+		if !ok {
+			ss = &tracepb.ScopeSpans{Scope: scopeToProto(scope), SchemaUrl: scope.SchemaURL}
+			scopes[key][scope] = ss
+			rs.ScopeSpans = append(rs.ScopeSpans, ss)
+		}
+		ss.Spans = append(ss.Spans, spanToProto(s))
+	}
+	return data
+}
+
+func spanToProto(s sdktrace.ReadOnlySpan) *tracepb.Span {
+	sc := s.SpanContext()
+	tid, sid := sc.TraceID(), sc.SpanID()
+	span := &tracepb.Span{
+		TraceId:                tid[:],
+		SpanId:                 sid[:],
+		TraceState:             sc.TraceState().String(),
+		Flags:                  uint32(sc.TraceFlags()),
+		Name:                   s.Name(),
+		Kind:                   tracepb.Span_SpanKind(s.SpanKind()),
+		StartTimeUnixNano:      uint64(s.StartTime().UnixNano()),
+		EndTimeUnixNano:        uint64(s.EndTime().UnixNano()),
+		Attributes:             attributesToProto(s.Attributes()),
+		DroppedAttributesCount: uint32(s.DroppedAttributes()),
+		DroppedEventsCount:     uint32(s.DroppedEvents()),
+		DroppedLinksCount:      uint32(s.DroppedLinks()),
+		Status:                 statusToProto(s.Status()),
+	}
+	if parent := s.Parent(); parent.IsValid() {
+		pid := parent.SpanID()
+		span.ParentSpanId = pid[:]
+	}
+	for _, e := range s.Events() {
+		span.Events = append(span.Events, &tracepb.Span_Event{
+			TimeUnixNano:           uint64(e.Time.UnixNano()),
+			Name:                   e.Name,
+			Attributes:             attributesToProto(e.Attributes),
+			DroppedAttributesCount: uint32(e.DroppedAttributeCount),
+		})
+	}
+	for _, l := range s.Links() {
+		ltid, lsid := l.SpanContext.TraceID(), l.SpanContext.SpanID()
+		span.Links = append(span.Links, &tracepb.Span_Link{
+			TraceId:                ltid[:],
+			SpanId:                 lsid[:],
+			TraceState:             l.SpanContext.TraceState().String(),
+			Flags:                  uint32(l.SpanContext.TraceFlags()),
+			Attributes:             attributesToProto(l.Attributes),
+			DroppedAttributesCount: uint32(l.DroppedAttributeCount),
+		})
+	}
+	return span
+}
+
+func statusToProto(st sdktrace.Status) *tracepb.Status {
+	// The OTLP enum orders Ok and Error the other way round from codes
+	code := tracepb.Status_STATUS_CODE_UNSET
+	switch st.Code {
+	case codes.Ok:
+		code = tracepb.Status_STATUS_CODE_OK
+	case codes.Error:
+		code = tracepb.Status_STATUS_CODE_ERROR
+	}
+	return &tracepb.Status{Code: code, Message: st.Description}
+}
+
+// logsToProto converts a log record batch into OTLP LogsData
+func logsToProto(records []sdklog.Record) *logspb.LogsData {
+	data := &logspb.LogsData{}
+	resources := map[attribute.Distinct]*logspb.ResourceLogs{}
+	scopes := map[attribute.Distinct]map[instrumentation.Scope]*logspb.ScopeLogs{}
+
+	for i := range records {
+		r := &records[i]
+		res := r.Resource()
+		key := res.Equivalent()
+		rl, ok := resources[key]
+		if !ok {
+			rl = &logspb.ResourceLogs{Resource: resourceToProto(res), SchemaUrl: res.SchemaURL()}
+			resources[key] = rl
+			scopes[key] = map[instrumentation.Scope]*logspb.ScopeLogs{}
+			data.ResourceLogs = append(data.ResourceLogs, rl)
+		}
+
+		scope := r.InstrumentationScope()
+		sl, ok := scopes[key][scope]
+		if !ok {
+			sl = &logspb.ScopeLogs{Scope: scopeToProto(scope), SchemaUrl: scope.SchemaURL}
+			scopes[key][scope] = sl
+			rl.ScopeLogs = append(rl.ScopeLogs, sl)
+		}
+		sl.LogRecords = append(sl.LogRecords, logToProto(r))
+	}
+	return data
+}
+
+func logToProto(r *sdklog.Record) *logspb.LogRecord {
+	rec := &logspb.LogRecord{
+		TimeUnixNano:           unixNano(r.Timestamp().UnixNano()),
+		ObservedTimeUnixNano:   unixNano(r.ObservedTimestamp().UnixNano()),
+		SeverityNumber:         logspb.SeverityNumber(r.Severity()),
+		SeverityText:           r.SeverityText(),
+		Body:                   logValueToProto(r.Body()),
+		DroppedAttributesCount: uint32(r.DroppedAttributes()),
+		Flags:                  uint32(r.TraceFlags()),
+		EventName:              r.EventName(),
+	}
+	r.WalkAttributes(func(kv otellog.KeyValue) bool {
+		rec.Attributes = append(rec.Attributes, &commonpb.KeyValue{Key: kv.Key, Value: logValueToProto(kv.Value)})
+		return true
+	})
+	if tid := r.TraceID(); tid.IsValid() {
+		rec.TraceId = tid[:]
+	}
+	if sid := r.SpanID(); sid.IsValid() {
+		rec.SpanId = sid[:]
+	}
+	return rec
+}
+
+// unixNano maps the zero time to 0 rather than a negative timestamp
+func unixNano(ns int64) uint64 {
+	if ns < 0 {
+		return 0
+	}
+	return uint64(ns)
+}
+
+func logValueToProto(v otellog.Value) *commonpb.AnyValue {
+	switch v.Kind() {
+	case otellog.KindBool:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v.AsBool()}}
+	case otellog.KindInt64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: v.AsInt64()}}
+	case otellog.KindFloat64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: v.AsFloat64()}}
+	case otellog.KindString:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.AsString()}}
+	case otellog.KindBytes:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BytesValue{BytesValue: v.AsBytes()}}
+	case otellog.KindSlice:
+		arr := &commonpb.ArrayValue{}
+		for _, e := range v.AsSlice() {
+			arr.Values = append(arr.Values, logValueToProto(e))
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: arr}}
+	case otellog.KindMap:
+		kvs := &commonpb.KeyValueList{}
+		for _, kv := range v.AsMap() {
+			kvs.Values = append(kvs.Values, &commonpb.KeyValue{Key: kv.Key, Value: logValueToProto(kv.Value)})
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: kvs}}
+	default:
+		return nil
+	}
+}
+
+// metricsToProto converts a collected metric batch into OTLP MetricsData
+func metricsToProto(rm *metricdata.ResourceMetrics) *metricspb.MetricsData {
+	out := &metricspb.ResourceMetrics{Resource: resourceToProto(rm.Resource), SchemaUrl: rm.Resource.SchemaURL()}
+	for _, sm := range rm.ScopeMetrics {
+		scope := &metricspb.ScopeMetrics{Scope: scopeToProto(sm.Scope), SchemaUrl: sm.Scope.SchemaURL}
+		for _, m := range sm.Metrics {
+			if pm := metricToProto(m); pm != nil {
+				scope.Metrics = append(scope.Metrics, pm)
+			}
+		}
+		out.ScopeMetrics = append(out.ScopeMetrics, scope)
+	}
+	return &metricspb.MetricsData{ResourceMetrics: []*metricspb.ResourceMetrics{out}}
+}
+
+func metricToProto(m metricdata.Metrics) *metricspb.Metric {
+	pm := &metricspb.Metric{Name: m.Name, Description: m.Description, Unit: m.Unit}
+	switch data := m.Data.(type) {
+	case metricdata.Gauge[int64]:
+		pm.Data = &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: numberPoints(data.DataPoints)}}
+	case metricdata.Gauge[float64]:
+		pm.Data = &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: numberPoints(data.DataPoints)}}
+	case metricdata.Sum[int64]:
+		pm.Data = &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			DataPoints:             numberPoints(data.DataPoints),
+			AggregationTemporality: temporalityToProto(data.Temporality),
+			IsMonotonic:            data.IsMonotonic,
+		}}
+	case metricdata.Sum[float64]:
+		pm.Data = &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			DataPoints:             numberPoints(data.DataPoints),
+			AggregationTemporality: temporalityToProto(data.Temporality),
+			IsMonotonic:            data.IsMonotonic,
+		}}
+	case metricdata.Histogram[int64]:
+		pm.Data = &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+			DataPoints:             histogramPoints(data.DataPoints),
+			AggregationTemporality: temporalityToProto(data.Temporality),
+		}}
+	case metricdata.Histogram[float64]:
+		pm.Data = &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+			DataPoints:             histogramPoints(data.DataPoints),
+			AggregationTemporality: temporalityToProto(data.Temporality),
+		}}
+	case metricdata.ExponentialHistogram[int64]:
+		pm.Data = &metricspb.Metric_ExponentialHistogram{ExponentialHistogram: &metricspb.ExponentialHistogram{
+			DataPoints:             expHistogramPoints(data.DataPoints),
+			AggregationTemporality: temporalityToProto(data.Temporality),
+		}}
+	case metricdata.ExponentialHistogram[float64]:
+		pm.Data = &metricspb.Metric_ExponentialHistogram{ExponentialHistogram: &metricspb.ExponentialHistogram{
+			DataPoints:             expHistogramPoints(data.DataPoints),
+			AggregationTemporality: temporalityToProto(data.Temporality),
+		}}
+	case metricdata.Summary:
+		pm.Data = &metricspb.Metric_Summary{Summary: &metricspb.Summary{DataPoints: summaryPoints(data.DataPoints)}}
+	default:
+		return nil
+	}
+	return pm
+}
+
+func temporalityToProto(t metricdata.Temporality) metricspb.AggregationTemporality {
+	switch t {
+	case metricdata.DeltaTemporality:
+		return metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+	case metricdata.CumulativeTemporality:
+		return metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	default:
+		return metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_UNSPECIFIED
+	}
+}
+
+func numberPoints[N int64 | float64](dps []metricdata.DataPoint[N]) []*metricspb.NumberDataPoint {
+	out := make([]*metricspb.NumberDataPoint, 0, len(dps))
+	for _, dp := range dps {
+		p := &metricspb.NumberDataPoint{
+			Attributes:        attributesToProto(dp.Attributes.ToSlice()),
+			StartTimeUnixNano: unixNano(dp.StartTime.UnixNano()),
+			TimeUnixNano:      unixNano(dp.Time.UnixNano()),
+			Exemplars:         exemplarsToProto(dp.Exemplars),
+		}
+		switch v := any(dp.Value).(type) {
+		case int64:
+			p.Value = &metricspb.NumberDataPoint_AsInt{AsInt: v}
+		case float64:
+			p.Value = &metricspb.NumberDataPoint_AsDouble{AsDouble: v}
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+func histogramPoints[N int64 | float64](dps []metricdata.HistogramDataPoint[N]) []*metricspb.HistogramDataPoint {
+	out := make([]*metricspb.HistogramDataPoint, 0, len(dps))
+	for _, dp := range dps {
+		sum := float64(dp.Sum)
+		p := &metricspb.HistogramDataPoint{
+			Attributes:        attributesToProto(dp.Attributes.ToSlice()),
+			StartTimeUnixNano: unixNano(dp.StartTime.UnixNano()),
+			TimeUnixNano:      unixNano(dp.Time.UnixNano()),
+			Count:             dp.Count,
+			Sum:               &sum,
+			BucketCounts:      dp.BucketCounts,
+			ExplicitBounds:    dp.Bounds,
+			Exemplars:         exemplarsToProto(dp.Exemplars),
+		}
+		if v, ok := dp.Min.Value(); ok {
+			m := float64(v)
+			p.Min = &m
+		}
+		if v, ok := dp.Max.Value(); ok {
+			m := float64(v)
+			p.Max = &m
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+func expHistogramPoints[N int64 | float64](dps []metricdata.ExponentialHistogramDataPoint[N]) []*metricspb.ExponentialHistogramDataPoint {
+	out := make([]*metricspb.ExponentialHistogramDataPoint, 0, len(dps))
+	for _, dp := range dps {
+		sum := float64(dp.Sum)
+		p := &metricspb.ExponentialHistogramDataPoint{
+			Attributes:        attributesToProto(dp.Attributes.ToSlice()),
+			StartTimeUnixNano: unixNano(dp.StartTime.UnixNano()),
+			TimeUnixNano:      unixNano(dp.Time.UnixNano()),
+			Count:             dp.Count,
+			Sum:               &sum,
+			Scale:             dp.Scale,
+			ZeroCount:         dp.ZeroCount,
+			ZeroThreshold:     dp.ZeroThreshold,
+			Positive: &metricspb.ExponentialHistogramDataPoint_Buckets{
+				Offset:       dp.PositiveBucket.Offset,
+				BucketCounts: dp.PositiveBucket.Counts,
+			},
+			Negative: &metricspb.ExponentialHistogramDataPoint_Buckets{
+				Offset:       dp.NegativeBucket.Offset,
+				BucketCounts: dp.NegativeBucket.Counts,
+			},
+			Exemplars: exemplarsToProto(dp.Exemplars),
+		}
+		if v, ok := dp.Min.Value(); ok {
+			m := float64(v)
+			p.Min = &m
+		}
+		if v, ok := dp.Max.Value(); ok {
+			m := float64(v)
+			p.Max = &m
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+func summaryPoints(dps []metricdata.SummaryDataPoint) []*metricspb.SummaryDataPoint {
+	out := make([]*metricspb.SummaryDataPoint, 0, len(dps))
+	for _, dp := range dps {
+		p := &metricspb.SummaryDataPoint{
+			Attributes:        attributesToProto(dp.Attributes.ToSlice()),
+			StartTimeUnixNano: unixNano(dp.StartTime.UnixNano()),
+			TimeUnixNano:      unixNano(dp.Time.UnixNano()),
+			Count:             dp.Count,
+			Sum:               dp.Sum,
+		}
+		for _, q := range dp.QuantileValues {
+			p.QuantileValues = append(p.QuantileValues, &metricspb.SummaryDataPoint_ValueAtQuantile{
+				Quantile: q.Quantile,
+				Value:    q.Value,
+			})
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+func exemplarsToProto[N int64 | float64](exemplars []metricdata.Exemplar[N]) []*metricspb.Exemplar {
+	if len(exemplars) == 0 {
+		return nil
+	}
+	out := make([]*metricspb.Exemplar, 0, len(exemplars))
+	for _, e := range exemplars {
+		p := &metricspb.Exemplar{
+			FilteredAttributes: attributesToProto(e.FilteredAttributes),
+			TimeUnixNano:       unixNano(e.Time.UnixNano()),
+			SpanId:             e.SpanID,
+			TraceId:            e.TraceID,
+		}
+		switch v := any(e.Value).(type) {
+		case int64:
+			p.Value = &metricspb.Exemplar_AsInt{AsInt: v}
+		case float64:
+			p.Value = &metricspb.Exemplar_AsDouble{AsDouble: v}
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+func resourceToProto(res *resource.Resource) *resourcepb.Resource {
+	if res == nil {
+		return &resourcepb.Resource{}
+	}
+	return &resourcepb.Resource{Attributes: attributesToProto(res.Attributes())}
+}
+
+func scopeToProto(scope instrumentation.Scope) *commonpb.InstrumentationScope {
+	return &commonpb.InstrumentationScope{
+		Name:       scope.Name,
+		Version:    scope.Version,
+		Attributes: attributesToProto(scope.Attributes.ToSlice()),
+	}
+}
+
+func attributesToProto(attrs []attribute.KeyValue) []*commonpb.KeyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+	out := make([]*commonpb.KeyValue, 0, len(attrs))
+	for _, kv := range attrs {
+		out = append(out, &commonpb.KeyValue{Key: string(kv.Key), Value: attributeValueToProto(kv.Value)})
+	}
+	return out
+}
+
+func attributeValueToProto(v attribute.Value) *commonpb.AnyValue {
+	switch v.Type() {
+	case attribute.BOOL:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v.AsBool()}}
+	case attribute.INT64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: v.AsInt64()}}
+	case attribute.FLOAT64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: v.AsFloat64()}}
+	case attribute.STRING:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.AsString()}}
+	case attribute.BOOLSLICE:
+		return arrayValue(v.AsBoolSlice(), func(b bool) *commonpb.AnyValue {
+			return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: b}}
+		})
+	case attribute.INT64SLICE:
+		return arrayValue(v.AsInt64Slice(), func(i int64) *commonpb.AnyValue {
+			return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: i}}
+		})
+	case attribute.FLOAT64SLICE:
+		return arrayValue(v.AsFloat64Slice(), func(f float64) *commonpb.AnyValue {
+			return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: f}}
+		})
+	case attribute.STRINGSLICE:
+		return arrayValue(v.AsStringSlice(), func(s string) *commonpb.AnyValue {
+			return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: s}}
+		})
+	default:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.Emit()}}
+	}
+}
+
+func arrayValue[T any](values []T, conv func(T) *commonpb.AnyValue) *commonpb.AnyValue {
+	arr := &commonpb.ArrayValue{Values: make([]*commonpb.AnyValue, 0, len(values))}
+	for _, v := range values {
+		arr.Values = append(arr.Values, conv(v))
+	}
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: arr}}
+}
+
+// otlpJSONIDs matches the ID fields that OTLP/JSON encodes as hex where
+// protojson would use base64
+var otlpJSONIDs = regexp.MustCompile(`"(traceId|spanId|parentSpanId)"(\s*:\s*)"([^"]*)"`)
+
+// MarshalOTLPJSON encodes msg as OTLP/JSON, which is protojson with hex
+// trace and span IDs
+func MarshalOTLPJSON(msg proto.Message) ([]byte, error) {
+	b, err := protojson.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return otlpJSONIDs.ReplaceAllFunc(b, func(m []byte) []byte {
+		parts := otlpJSONIDs.FindSubmatch(m)
+		raw, err := base64.StdEncoding.DecodeString(string(parts[3]))
+		if err != nil {
+			return m
+		}
+		return []byte(`"` + string(parts[1]) + `"` + string(parts[2]) + `"` + hex.EncodeToString(raw) + `"`)
+	}), nil
+}
+
+// UnmarshalOTLPJSON decodes OTLP/JSON into msg, turning the hex IDs back
+// into the base64 protojson expects. Unknown fields are ignored so newer
+// producers can be read.
+func UnmarshalOTLPJSON(b []byte, msg proto.Message) error {
+	b = otlpJSONIDs.ReplaceAllFunc(b, func(m []byte) []byte {
+		parts := otlpJSONIDs.FindSubmatch(m)
+		raw, err := hex.DecodeString(string(parts[3]))
+		if err != nil {
+			return m
+		}
+		return []byte(`"` + string(parts[1]) + `"` + string(parts[2]) + `"` + base64.StdEncoding.EncodeToString(raw) + `"`)
+	})
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(b, msg)
+}
@@ -0,0 +1,434 @@
+package telemetry
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// httpURL returns the URL that signal ("traces", "logs" or "metrics") is
+// posted to. The port defaults to 4318, and an endpoint without a path gets
+// the standard /v1/<signal> path; an endpoint with a path is used as is,
+// unless it came from OTEL_EXPORTER_OTLP_ENDPOINT, whose path is a base
+// that /v1/<signal> is joined onto as the specification has it.
+func httpURL(ep EndpointConfig, signal string) (*url.URL, error) {
+	path := "/v1/" + signal
+	u, err := endpointURL(ep, "4318", "4318", path)
+	if err != nil {
+		return nil, err
+	}
+	if ep.baseEndpoint != "" && ep.Endpoint == ep.baseEndpoint && u.Path != path {
+		u = u.JoinPath(path)
+	}
+	return u, nil
+}
+
+// endpointURL resolves ep.Endpoint for an HTTP-based exporter. A bare
+// host[:port] endpoint becomes an https URL, or http when insecure is set,
+// which also wins over an explicit scheme. A missing port and an empty path
+// are filled in with the given defaults.
+func endpointURL(ep EndpointConfig, httpPort, httpsPort, path string) (*url.URL, error) {
+	raw := ep.Endpoint
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint %q: %w", ep.Endpoint, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid endpoint %q: scheme must be http or https", ep.Endpoint)
+	}
+	if ep.Insecure != nil {
+		u.Scheme = "https"
+		if *ep.Insecure {
+			u.Scheme = "http"
+		}
+	}
+	if u.Port() == "" {
+		port := httpsPort
+		if u.Scheme == "http" {
+			port = httpPort
+		}
+		u.Host = net.JoinHostPort(u.Hostname(), port)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = path
+	}
+	return u, nil
+}
+
+// otlpHTTPClient returns the client for the OTLP/HTTP protobuf exporters,
+// with ep's TLS and proxy settings and the partial success counting
+func otlpHTTPClient(ep EndpointConfig, u *url.URL, signal string) (*http.Client, error) {
+	var err error
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if transport.Proxy, err = proxyFunc(ep); err != nil {
+		return nil, err
+	}
+	if u.Scheme == "https" {
+		if transport.TLSClientConfig, err = tlsConfig(ep); err != nil {
+			return nil, err
+		}
+	}
+	return &http.Client{
+		Transport: partialSuccessTransport{base: transport, signal: signal},
+		Timeout:   ep.Timeout,
+	}, nil
+}
+
+func newHTTPTraceExporter(ctx context.Context, ep EndpointConfig) (sdktrace.SpanExporter, error) {
+	u, err := httpURL(ep, "traces")
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpointURL(u.String()),
+		otlptracehttp.WithHeaders(ep.Headers),
+		otlptracehttp.WithTimeout(ep.Timeout),
+		otlptracehttp.WithRetry(otlptracehttp.RetryConfig{
+			Enabled:         ep.Retry.enabled(),
+			InitialInterval: ep.Retry.InitialInterval,
+			MaxInterval:     ep.Retry.MaxInterval,
+			MaxElapsedTime:  ep.Retry.MaxElapsedTime,
+		}),
+	}
+	if ep.Compression == "gzip" {
+		opts = append(opts, otlptracehttp.WithCompression(otlptracehttp.GzipCompression))
+	}
+	client, err := otlpHTTPClient(ep, u, "traces")
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, otlptracehttp.WithHTTPClient(client))
+
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+	return exporter, nil
+}
+
+func newHTTPLogExporter(ctx context.Context, ep EndpointConfig) (sdklog.Exporter, error) {
+	u, err := httpURL(ep, "logs")
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []otlploghttp.Option{
+		otlploghttp.WithEndpointURL(u.String()),
+		otlploghttp.WithHeaders(ep.Headers),
+		otlploghttp.WithTimeout(ep.Timeout),
+		otlploghttp.WithRetry(otlploghttp.RetryConfig{
+			Enabled:         ep.Retry.enabled(),
+			InitialInterval: ep.Retry.InitialInterval,
+			MaxInterval:     ep.Retry.MaxInterval,
+			MaxElapsedTime:  ep.Retry.MaxElapsedTime,
+		}),
+	}
+	if ep.Compression == "gzip" {
+		opts = append(opts, otlploghttp.WithCompression(otlploghttp.GzipCompression))
+	}
+	client, err := otlpHTTPClient(ep, u, "logs")
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, otlploghttp.WithHTTPClient(client))
+
+	exporter, err := otlploghttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create log exporter: %w", err)
+	}
+	return exporter, nil
+}
+
+func newHTTPMetricExporter(ctx context.Context, ep EndpointConfig) (sdkmetric.Exporter, error) {
+	u, err := httpURL(ep, "metrics")
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []otlpmetrichttp.Option{
+		otlpmetrichttp.WithEndpointURL(u.String()),
+		otlpmetrichttp.WithHeaders(ep.Headers),
+		otlpmetrichttp.WithTimeout(ep.Timeout),
+		otlpmetrichttp.WithRetry(otlpmetrichttp.RetryConfig{
+			Enabled:         ep.Retry.enabled(),
+			InitialInterval: ep.Retry.InitialInterval,
+			MaxInterval:     ep.Retry.MaxInterval,
+			MaxElapsedTime:  ep.Retry.MaxElapsedTime,
+		}),
+	}
+	if ep.Compression == "gzip" {
+		opts = append(opts, otlpmetrichttp.WithCompression(otlpmetrichttp.GzipCompression))
+	}
+	client, err := otlpHTTPClient(ep, u, "metrics")
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, otlpmetrichttp.WithHTTPClient(client))
+
+	exporter, err := otlpmetrichttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metric exporter: %w", err)
+	}
+	return exporter, nil
+}
+
+// otlpJSONClient posts OTLP/JSON requests for one signal. The SDK only ships
+// protobuf HTTP exporters, so the JSON encoding reuses the conversion the
+// dry-run output is built on and follows the same retry rules: 429, 502,
+// 503 and 504 responses are retried with exponential backoff, honouring
+// Retry-After.
+type otlpJSONClient struct {
+	url         string
+	client      *http.Client
+	headers     map[string]string
+	contentType string
+	gzip        bool
+	timeout     time.Duration
+	retry       RetryConfig
+
+	// signal is set for OTLP endpoints, whose responses are checked for a
+	// partial success
+	signal string
+}
+
+func newOTLPJSONClient(ep EndpointConfig, signal string) (*otlpJSONClient, error) {
+	u, err := httpURL(ep, signal)
+	if err != nil {
+		return nil, err
+	}
+	c, err := newJSONClient(ep, u, ep.Headers)
+	if err != nil {
+		return nil, err
+	}
+	c.signal = signal
+	return c, nil
+}
+
+// newJSONClient returns a client posting to u with ep's TLS, proxy,
+// compression, timeout and retry settings
+func newJSONClient(ep EndpointConfig, u *url.URL, headers map[string]string) (*otlpJSONClient, error) {
+	var err error
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if transport.Proxy, err = proxyFunc(ep); err != nil {
+		return nil, err
+	}
+	if u.Scheme == "https" {
+		if transport.TLSClientConfig, err = tlsConfig(ep); err != nil {
+			return nil, err
+		}
+	}
+
+	return &otlpJSONClient{
+		url:         u.String(),
+		client:      &http.Client{Transport: transport},
+		headers:     headers,
+		contentType: "application/json",
+		gzip:        ep.Compression == "gzip",
+		timeout:     ep.Timeout,
+		retry:       ep.Retry,
+	}, nil
+}
+
+func (c *otlpJSONClient) send(ctx context.Context, msg proto.Message) error {
+	body, err := MarshalOTLPJSON(msg)
+	if err != nil {
+		return err
+	}
+	return c.sendBody(ctx, c.url, body)
+}
+
+// sendBody posts body to target, compressing it first if configured, and
+// retries it until it's accepted, fails permanently or MaxElapsedTime runs
+// out
+func (c *otlpJSONClient) sendBody(ctx context.Context, target string, body []byte) error {
+	if c.gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+
+	start := time.Now()
+	backoff := c.retry.InitialInterval
+	for {
+		retryAfter, err := c.post(ctx, target, body)
+		if err == nil {
+			return nil
+		}
+		if retryAfter < 0 || !c.retry.enabled() {
+			return err
+		}
+
+		wait := max(backoff, retryAfter)
+		if time.Since(start)+wait > c.retry.MaxElapsedTime {
+			return fmt.Errorf("giving up after %s: %w", time.Since(start).Round(time.Millisecond), err)
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(wait):
+		}
+		backoff = min(backoff*2, c.retry.MaxInterval)
+	}
+}
+
+// post makes one attempt. A non-negative retryAfter means the error is
+// retryable, after at least that long.
+func (c *otlpJSONClient) post(ctx context.Context, target string, body []byte) (retryAfter time.Duration, err error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", c.contentType)
+	if c.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		// Connection errors and timeouts are worth another attempt
+		return 0, err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if c.signal != "" {
+			// The SDK has no JSON exporter to report this for us
+			partial := NewExportResponse(c.signal)
+			if (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(msg, partial) == nil && recordRejected(ctx, partial) {
+				otel.Handle(partialSuccessError(partial))
+			}
+		}
+		return 0, nil
+	}
+	err = fmt.Errorf("%s: %s: %s", req.URL.Redacted(), resp.Status, bytes.TrimSpace(msg))
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		retryAfter = 0
+		if secs, perr := strconv.Atoi(resp.Header.Get("Retry-After")); perr == nil {
+			retryAfter = time.Duration(secs) * time.Second
+		}
+		return retryAfter, err
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity:
+		// The request itself is at fault, not the collector or the config
+		return -1, undeliverableError{err}
+	default:
+		return -1, err
+	}
+}
+
+func (c *otlpJSONClient) shutdown() {
+	c.client.CloseIdleConnections()
+}
+
+type otlpJSONSpanExporter struct{ *otlpJSONClient }
+
+func newJSONTraceExporter(ep EndpointConfig) (sdktrace.SpanExporter, error) {
+	c, err := newOTLPJSONClient(ep, "traces")
+	if err != nil {
+		return nil, err
+	}
+	return otlpJSONSpanExporter{c}, nil
+}
+
+func (e otlpJSONSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	// TracesData has the same JSON shape as ExportTraceServiceRequest
+	return e.send(ctx, spansToProto(spans))
+}
+
+func (e otlpJSONSpanExporter) Shutdown(context.Context) error {
+	e.shutdown()
+	return nil
+}
+
+type otlpJSONLogExporter struct{ *otlpJSONClient }
+
+func newJSONLogExporter(ep EndpointConfig) (sdklog.Exporter, error) {
+	c, err := newOTLPJSONClient(ep, "logs")
+	if err != nil {
+		return nil, err
+	}
+	return otlpJSONLogExporter{c}, nil
+}
+
+func (e otlpJSONLogExporter) Export(ctx context.Context, records []sdklog.Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	return e.send(ctx, logsToProto(records))
+}
+
+func (e otlpJSONLogExporter) ForceFlush(context.Context) error { return nil }
+
+func (e otlpJSONLogExporter) Shutdown(context.Context) error {
+	e.shutdown()
+	return nil
+}
+
+type otlpJSONMetricExporter struct{ *otlpJSONClient }
+
+func newJSONMetricExporter(ep EndpointConfig) (sdkmetric.Exporter, error) {
+	c, err := newOTLPJSONClient(ep, "metrics")
+	if err != nil {
+		return nil, err
+	}
+	return otlpJSONMetricExporter{c}, nil
+}
+
+func (e otlpJSONMetricExporter) Temporality(k sdkmetric.InstrumentKind) metricdata.Temporality {
+	return sdkmetric.DefaultTemporalitySelector(k)
+}
+
+func (e otlpJSONMetricExporter) Aggregation(k sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return sdkmetric.DefaultAggregationSelector(k)
+}
+
+func (e otlpJSONMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	return e.send(ctx, metricsToProto(rm))
+}
+
+func (e otlpJSONMetricExporter) ForceFlush(context.Context) error { return nil }
+
+func (e otlpJSONMetricExporter) Shutdown(context.Context) error {
+	e.shutdown()
+	return nil
+}
@@ -0,0 +1,113 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// A collector that accepts only part of an export answers with a partial
+// success: how many items it rejected and why. The counts are recorded in
+// the SignalStats of the export that got the response, which the counting
+// exporters put in its context; the OTLP exporters report the message
+// through the otel error handler themselves.
+
+type rejectionsKey struct{}
+
+func withRejections(ctx context.Context, stats *SignalStats) context.Context {
+	return context.WithValue(ctx, rejectionsKey{}, stats)
+}
+
+// partialSuccess returns what resp, an OTLP export response, rejected
+func partialSuccess(resp any) (rejected int64, msg, kind string) {
+	switch r := resp.(type) {
+	case *coltracepb.ExportTraceServiceResponse:
+		return r.GetPartialSuccess().GetRejectedSpans(), r.GetPartialSuccess().GetErrorMessage(), "spans"
+	case *collogspb.ExportLogsServiceResponse:
+		return r.GetPartialSuccess().GetRejectedLogRecords(), r.GetPartialSuccess().GetErrorMessage(), "log records"
+	case *colmetricpb.ExportMetricsServiceResponse:
+		return r.GetPartialSuccess().GetRejectedDataPoints(), r.GetPartialSuccess().GetErrorMessage(), "metric data points"
+	}
+	return 0, "", ""
+}
+
+// recordRejected counts the items resp rejected and reports whether it was
+// a partial success at all
+func recordRejected(ctx context.Context, resp any) bool {
+	rejected, msg, _ := partialSuccess(resp)
+	if rejected == 0 && msg == "" {
+		return false
+	}
+	if stats, ok := ctx.Value(rejectionsKey{}).(*SignalStats); ok {
+		stats.Rejected.Add(rejected)
+	}
+	return true
+}
+
+// partialSuccessError matches the wording of the OTLP exporters' own
+// partial success errors
+func partialSuccessError(resp any) error {
+	rejected, msg, kind := partialSuccess(resp)
+	if msg == "" {
+		msg = "empty message"
+	}
+	return fmt.Errorf("OTLP partial success: %s (%d %s rejected)", msg, rejected, kind)
+}
+
+// NewExportResponse returns an empty export response for signal
+func NewExportResponse(signal string) proto.Message {
+	switch signal {
+	case "traces":
+		return &coltracepb.ExportTraceServiceResponse{}
+	case "logs":
+		return &collogspb.ExportLogsServiceResponse{}
+	default:
+		return &colmetricpb.ExportMetricsServiceResponse{}
+	}
+}
+
+// partialSuccessInterceptor counts the rejections in the replies of the
+// gRPC export calls
+func partialSuccessInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	if err == nil {
+		recordRejected(ctx, reply)
+	}
+	return err
+}
+
+// partialSuccessTransport does the same for the OTLP/HTTP protobuf
+// exporters. It reads the response ahead of the exporter and hands it an
+// identical copy of the body.
+type partialSuccessTransport struct {
+	base   http.RoundTripper
+	signal string
+}
+
+func (t partialSuccessTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/x-protobuf") {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	msg := NewExportResponse(t.signal)
+	if proto.Unmarshal(body, msg) == nil {
+		recordRejected(req.Context(), msg)
+	}
+	return resp, nil
+}
@@ -0,0 +1,301 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// PreflightReport is the outcome of Preflight, one entry per signal
+// endpoint in the order they were checked
+type PreflightReport struct {
+	Endpoints []EndpointReport
+}
+
+// EndpointReport holds the checks of one signal endpoint. Signal is
+// traces, logs or metrics, or signal@mirror for a mirror.
+type EndpointReport struct {
+	Signal string
+	Type   string
+	// Target is the host:port or URL the signal is sent to
+	Target    string
+	Plaintext bool
+	// Skipped says why nothing was checked, for exporters that don't talk
+	// to a collector over the network
+	Skipped string
+	Steps   []PreflightStep
+}
+
+// PreflightStep is one check: endpoint, resolve, connect, tls or health
+type PreflightStep struct {
+	Name     string
+	Detail   string
+	Duration time.Duration
+	// Skipped marks a check that didn't apply, such as a collector that
+	// doesn't offer the gRPC health service
+	Skipped bool
+	Err     error
+
+	unreachable bool
+}
+
+// Err returns the first failed step's error, or nil when every step passed
+func (e *EndpointReport) Err() error {
+	for _, s := range e.Steps {
+		if s.Err != nil {
+			if s.unreachable && !errors.Is(s.Err, ErrCollectorUnreachable) {
+				return fmt.Errorf("%w: %s: %s: %v", ErrCollectorUnreachable, e.Signal, s.Name, s.Err)
+			}
+			return fmt.Errorf("%s: %s: %w", e.Signal, s.Name, s.Err)
+		}
+	}
+	return nil
+}
+
+// Err joins the errors of every endpoint that failed. Network failures
+// wrap ErrCollectorUnreachable.
+func (r *PreflightReport) Err() error {
+	var errs []error
+	for i := range r.Endpoints {
+		errs = append(errs, r.Endpoints[i].Err())
+	}
+	return errors.Join(errs...)
+}
+
+// OK reports whether every endpoint passed
+func (r *PreflightReport) OK() bool {
+	return r.Err() == nil
+}
+
+// Write prints the report, a line per endpoint followed by a line per step
+func (r *PreflightReport) Write(w io.Writer) {
+	for _, e := range r.Endpoints {
+		if e.Skipped != "" {
+			fmt.Fprintf(w, "%-9s %s, %s\n", e.Signal+":", e.Type, e.Skipped)
+			continue
+		}
+		transport := "TLS"
+		if e.Plaintext {
+			transport = "plaintext"
+		}
+		fmt.Fprintf(w, "%-9s %s via %s (%s)\n", e.Signal+":", e.Target, e.Type, transport)
+		for _, s := range e.Steps {
+			switch {
+			case s.Err != nil:
+				fmt.Fprintf(w, "          FAIL %s: %v\n", s.Name, s.Err)
+			case s.Skipped:
+				fmt.Fprintf(w, "          skip %s\n", s.Detail)
+			default:
+				fmt.Fprintf(w, "          ok   %s in %s\n", s.Detail, s.Duration.Round(time.Millisecond))
+			}
+		}
+	}
+}
+
+// Preflight checks that the collectors the options describe can be
+// reached, without sending any telemetry: for every enabled signal and its
+// mirrors it resolves the host, connects over TCP, completes the TLS
+// handshake and, for OTLP over gRPC, asks the gRPC health service when the
+// collector offers one. Each endpoint gets its export timeout. The error is
+// only for options that don't make a valid configuration; failed checks
+// are in the report.
+func Preflight(ctx context.Context, opts ...Option) (*PreflightReport, error) {
+	o, cfg, err := resolveOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &PreflightReport{}
+	for _, s := range []struct {
+		name    string
+		ep      EndpointConfig
+		enabled bool
+	}{
+		{"traces", cfg.Exporter.Traces, o.signals.Traces},
+		{"logs", cfg.Exporter.Logs, o.signals.Logs},
+		{"metrics", cfg.Exporter.Metrics, o.signals.Metrics},
+	} {
+		if !s.enabled {
+			continue
+		}
+		ep := cfg.Exporter.Resolve(s.ep)
+		if cfg.DryRun.Enabled {
+			report.Endpoints = append(report.Endpoints, EndpointReport{Signal: s.name, Type: "stdout", Skipped: "dry run, no collector to check"})
+			continue
+		}
+		report.Endpoints = append(report.Endpoints, preflightEndpoint(ctx, s.name, s.name, ep))
+		mirrors := cfg.Exporter.MirrorsFor(s.name)
+		for _, name := range slices.Sorted(maps.Keys(mirrors)) {
+			report.Endpoints = append(report.Endpoints, preflightEndpoint(ctx, s.name+"@"+name, s.name, mirrors[name]))
+		}
+	}
+	return report, nil
+}
+
+// errStepSkipped is returned by a check that doesn't apply to the endpoint,
+// along with the reason as its detail
+var errStepSkipped = errors.New("skipped")
+
+// preflightEndpoint runs the checks for the endpoint ep sends signal to,
+// stopping at the first that fails
+func preflightEndpoint(ctx context.Context, label, signal string, ep EndpointConfig) EndpointReport {
+	report := EndpointReport{Signal: label, Type: ep.Type}
+	if ep.Type == "otlp" {
+		report.Type = "otlp " + ep.Protocol
+	}
+	switch ep.Type {
+	case "stdout", "file", "sql", "prometheus":
+		report.Skipped = "no collector to check"
+		return report
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ep.Timeout)
+	defer cancel()
+	step := func(name string, check func() (string, error)) bool {
+		start := time.Now()
+		detail, err := check()
+		s := PreflightStep{Name: name, Detail: detail, Duration: time.Since(start), Err: err}
+		if errors.Is(err, errStepSkipped) {
+			s.Err, s.Skipped = nil, true
+		}
+		s.unreachable = name != "tls" && name != "endpoint"
+		report.Steps = append(report.Steps, s)
+		return s.Err == nil
+	}
+
+	target, host, plaintext, err := endpointTarget(ep, signal)
+	if err != nil {
+		step("endpoint", func() (string, error) { return "", err })
+		return report
+	}
+	report.Target, report.Plaintext = target, plaintext
+	network, addrs, err := preflightAddrs(ep, target)
+	if err != nil {
+		step("endpoint", func() (string, error) { return "", err })
+		return report
+	}
+	var tlsCfg *tls.Config
+	if !plaintext {
+		if tlsCfg, err = tlsConfig(ep); err != nil {
+			step("tls", func() (string, error) { return "", err })
+			return report
+		}
+	}
+
+	// Behind a proxy the collector's name only has to resolve for the proxy
+	proxy, err := endpointProxy(ep, target)
+	if err != nil {
+		step("endpoint", func() (string, error) { return "", err })
+		return report
+	}
+	if !step("resolve", func() (string, error) {
+		if proxy != nil {
+			return "name resolved by proxy " + proxy.Redacted(), errStepSkipped
+		}
+		addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+		return fmt.Sprintf("resolved %s to %s", host, strings.Join(addrs, ", ")), err
+	}) {
+		return report
+	}
+
+	if network == "udp" {
+		step("connect", func() (string, error) { return "UDP is connectionless, nothing to connect to", errStepSkipped })
+		return report
+	}
+	for _, addr := range addrs {
+		var conn net.Conn
+		if !step("connect", func() (string, error) {
+			var err error
+			if proxy != nil {
+				conn, err = dialThroughProxy(ctx, proxy, addr)
+				return fmt.Sprintf("connected to %s through proxy %s", addr, proxy.Redacted()), err
+			}
+			conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+			return "connected to " + addr, err
+		}) {
+			return report
+		}
+		ok := tlsCfg == nil || step("tls", func() (string, error) {
+			c := tlsCfg.Clone()
+			if c.ServerName == "" {
+				c.ServerName, _, _ = net.SplitHostPort(addr)
+			}
+			tc := tls.Client(conn, c)
+			if err := tc.HandshakeContext(ctx); err != nil {
+				return "", fmt.Errorf("handshake with %s failed: %w (use -insecure if the collector expects plaintext, or -ca-cert if its certificate isn't publicly trusted)", addr, err)
+			}
+			return fmt.Sprintf("TLS handshake with %s (%s)", addr, tls.VersionName(tc.ConnectionState().Version)), nil
+		})
+		conn.Close()
+		if !ok {
+			return report
+		}
+	}
+
+	if ep.Type == "otlp" && ep.Protocol == "grpc" {
+		step("health", func() (string, error) { return grpcHealth(ctx, ep) })
+	}
+	return report
+}
+
+// preflightAddrs returns the network and the addresses to connect to for
+// target as endpointTarget describes it
+func preflightAddrs(ep EndpointConfig, target string) (network string, addrs []string, err error) {
+	switch ep.Type {
+	case "kafka":
+		return "tcp", strings.Split(target, ","), nil
+	case "syslog", "fluent":
+		network, addr, err := socketEndpoint(ep)
+		if network == "tls" {
+			network = "tcp"
+		}
+		return network, []string{addr}, err
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		// A gRPC host:port
+		return "tcp", []string{target}, nil
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	return "tcp", []string{net.JoinHostPort(u.Hostname(), port)}, nil
+}
+
+// grpcHealth asks the collector's gRPC health service whether it is
+// serving. The collector's OTLP receiver doesn't usually register one, in
+// which case the step is marked skipped rather than failed.
+func grpcHealth(ctx context.Context, ep EndpointConfig) (string, error) {
+	conn, err := dialCollector(ctx, ep)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if status.Code(err) == codes.Unimplemented {
+		return "gRPC health service not offered by the collector", errStepSkipped
+	}
+	if err != nil {
+		return "", fmt.Errorf("health check failed: %w", err)
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return "", fmt.Errorf("collector reports %s", strings.ToLower(resp.GetStatus().String()))
+	}
+	return "gRPC health service reports serving", nil
+}
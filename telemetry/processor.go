@@ -0,0 +1,297 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// SpanProcessorFactory builds the span processor a processors.spans entry
+// names. It hands the spans on to next, the rest of the chain ending in the
+// batch processor, so it can change a span as it starts and hold back an
+// ended span from export by not passing it on.
+type SpanProcessorFactory func(cfg ProcessorConfig, next sdktrace.SpanProcessor) (sdktrace.SpanProcessor, error)
+
+var (
+	spanProcessorsMu sync.RWMutex
+	spanProcessors   = map[string]SpanProcessorFactory{
+		"attributes": newAttributesSpanProcessor,
+		"baggage":    newBaggageSpanProcessor,
+		"enrich":     newEnrichSpanProcessor,
+		"filter":     newFilterSpanProcessor,
+		"redact":     newRedactSpanProcessor,
+	}
+)
+
+// RegisterSpanProcessor makes factory the span processor for the
+// processors.spans type name. Register before the config is validated,
+// which rejects unknown types; a built-in name is replaced.
+func RegisterSpanProcessor(name string, factory SpanProcessorFactory) {
+	spanProcessorsMu.Lock()
+	defer spanProcessorsMu.Unlock()
+	spanProcessors[name] = factory
+}
+
+func spanProcessorFactory(name string) (SpanProcessorFactory, bool) {
+	spanProcessorsMu.RLock()
+	defer spanProcessorsMu.RUnlock()
+	f, ok := spanProcessors[name]
+	return f, ok
+}
+
+// SpanProcessorTypes returns the processors.spans type names available,
+// built-in and registered, sorted
+func SpanProcessorTypes() []string {
+	spanProcessorsMu.RLock()
+	defer spanProcessorsMu.RUnlock()
+	return slices.Sorted(maps.Keys(spanProcessors))
+}
+
+// chainSpanProcessors puts the configured processors in front of last, the
+// first entry seeing every span first
+func chainSpanProcessors(cfgs []ProcessorConfig, last sdktrace.SpanProcessor, seed int64, limits sdktrace.SpanLimits) (sdktrace.SpanProcessor, error) {
+	next := last
+	for i, cfg := range slices.Backward(cfgs) {
+		factory, ok := spanProcessorFactory(cfg.Type)
+		if !ok {
+			return nil, fmt.Errorf("processors.spans[%d]: unknown type %q", i, cfg.Type)
+		}
+		cfg.seed, cfg.limits = seed, limits
+		p, err := factory(cfg, next)
+		if err != nil {
+			return nil, fmt.Errorf("processors.spans[%d] (%s): %w", i, cfg.Type, err)
+		}
+		next = p
+	}
+	return next, nil
+}
+
+// attributesSpanProcessor sets fixed attributes on every span as it starts
+type attributesSpanProcessor struct {
+	sdktrace.SpanProcessor
+	attrs []attribute.KeyValue
+}
+
+func newAttributesSpanProcessor(cfg ProcessorConfig, next sdktrace.SpanProcessor) (sdktrace.SpanProcessor, error) {
+	p := &attributesSpanProcessor{SpanProcessor: next}
+	for _, k := range slices.Sorted(maps.Keys(cfg.Attributes)) {
+		p.attrs = append(p.attrs, attribute.String(k, cfg.Attributes[k]))
+	}
+	return p, nil
+}
+
+func (p *attributesSpanProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	s.SetAttributes(p.attrs...)
+	p.SpanProcessor.OnStart(ctx, s)
+}
+
+// filterSpanProcessor keeps spans whose names match one of the drop
+// patterns from being exported
+type filterSpanProcessor struct {
+	sdktrace.SpanProcessor
+	drop []string
+}
+
+func newFilterSpanProcessor(cfg ProcessorConfig, next sdktrace.SpanProcessor) (sdktrace.SpanProcessor, error) {
+	return &filterSpanProcessor{SpanProcessor: next, drop: cfg.Drop}, nil
+}
+
+func (p *filterSpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if matchAny(p.drop, s.Name()) {
+		return
+	}
+	p.SpanProcessor.OnEnd(s)
+}
+
+// rewrittenSpan is an ended span with other attributes and events, for a
+// processor to pass on in its place, since ReadOnlySpan can't be changed.
+// dropped counts the attributes the processor dropped on top of the SDK.
+type rewrittenSpan struct {
+	sdktrace.ReadOnlySpan
+	attrs   []attribute.KeyValue
+	events  []sdktrace.Event
+	dropped int
+}
+
+func (s rewrittenSpan) Attributes() []attribute.KeyValue { return s.attrs }
+func (s rewrittenSpan) Events() []sdktrace.Event         { return s.events }
+func (s rewrittenSpan) DroppedAttributes() int           { return s.ReadOnlySpan.DroppedAttributes() + s.dropped }
+
+// matchAny reports whether name matches one of the path.Match patterns
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// LogProcessorFactory builds the log processor a processors.logs entry
+// names. Like a SpanProcessorFactory it hands the records on to next, so it
+// can change a record and hold one back from export by not passing it on.
+type LogProcessorFactory func(cfg ProcessorConfig, next sdklog.Processor) (sdklog.Processor, error)
+
+var (
+	logProcessorsMu sync.RWMutex
+	logProcessors   = map[string]LogProcessorFactory{
+		"attributes": newAttributesLogProcessor,
+		"baggage":    newBaggageLogProcessor,
+		"enrich":     newEnrichLogProcessor,
+		"filter":     newFilterLogProcessor,
+		"sampling":   newSamplingLogProcessor,
+	}
+)
+
+// RegisterLogProcessor makes factory the log processor for the
+// processors.logs type name. Register before the config is validated,
+// which rejects unknown types; a built-in name is replaced.
+func RegisterLogProcessor(name string, factory LogProcessorFactory) {
+	logProcessorsMu.Lock()
+	defer logProcessorsMu.Unlock()
+	logProcessors[name] = factory
+}
+
+func logProcessorFactory(name string) (LogProcessorFactory, bool) {
+	logProcessorsMu.RLock()
+	defer logProcessorsMu.RUnlock()
+	f, ok := logProcessors[name]
+	return f, ok
+}
+
+// LogProcessorTypes returns the processors.logs type names available,
+// built-in and registered, sorted
+func LogProcessorTypes() []string {
+	logProcessorsMu.RLock()
+	defer logProcessorsMu.RUnlock()
+	return slices.Sorted(maps.Keys(logProcessors))
+}
+
+// chainLogProcessors puts the configured processors in front of last, the
+// first entry seeing every record first
+func chainLogProcessors(cfgs []ProcessorConfig, last sdklog.Processor, seed int64) (sdklog.Processor, error) {
+	next := last
+	for i, cfg := range slices.Backward(cfgs) {
+		factory, ok := logProcessorFactory(cfg.Type)
+		if !ok {
+			return nil, fmt.Errorf("processors.logs[%d]: unknown type %q", i, cfg.Type)
+		}
+		cfg.seed = seed
+		p, err := factory(cfg, next)
+		if err != nil {
+			return nil, fmt.Errorf("processors.logs[%d] (%s): %w", i, cfg.Type, err)
+		}
+		next = p
+	}
+	return next, nil
+}
+
+// attributesLogProcessor adds fixed attributes to every record
+type attributesLogProcessor struct {
+	sdklog.Processor
+	attrs []otellog.KeyValue
+}
+
+func newAttributesLogProcessor(cfg ProcessorConfig, next sdklog.Processor) (sdklog.Processor, error) {
+	p := &attributesLogProcessor{Processor: next}
+	for _, k := range slices.Sorted(maps.Keys(cfg.Attributes)) {
+		p.attrs = append(p.attrs, otellog.String(k, cfg.Attributes[k]))
+	}
+	return p, nil
+}
+
+func (p *attributesLogProcessor) OnEmit(ctx context.Context, r *sdklog.Record) error {
+	r.AddAttributes(p.attrs...)
+	return p.Processor.OnEmit(ctx, r)
+}
+
+// filterLogProcessor keeps records below the minimum severity, or whose
+// bodies match one of the drop patterns, from being exported
+type filterLogProcessor struct {
+	sdklog.Processor
+	min  otellog.Severity
+	drop []string
+}
+
+func newFilterLogProcessor(cfg ProcessorConfig, next sdklog.Processor) (sdklog.Processor, error) {
+	p := &filterLogProcessor{Processor: next, drop: cfg.Drop}
+	if cfg.MinSeverity != "" {
+		var err error
+		if p.min, err = parseSeverity(cfg.MinSeverity); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func (p *filterLogProcessor) OnEmit(ctx context.Context, r *sdklog.Record) error {
+	if r.Severity() < p.min || matchAny(p.drop, r.Body().String()) {
+		return nil
+	}
+	return p.Processor.OnEmit(ctx, r)
+}
+
+// samplingLogProcessor keeps a ratio of the records below the minimum
+// severity. Records in a trace are kept or dropped by their trace ID, as
+// the traceidratio sampler does spans, so a trace keeps all its logs or
+// none.
+type samplingLogProcessor struct {
+	sdklog.Processor
+	min       otellog.Severity
+	ratio     float64
+	threshold uint64
+}
+
+func newSamplingLogProcessor(cfg ProcessorConfig, next sdklog.Processor) (sdklog.Processor, error) {
+	p := &samplingLogProcessor{Processor: next, ratio: cfg.Ratio, threshold: uint64(cfg.Ratio * (1 << 63))}
+	if cfg.MinSeverity != "" {
+		var err error
+		if p.min, err = parseSeverity(cfg.MinSeverity); err != nil {
+			return nil, err
+		}
+	} else {
+		p.min = math.MaxUint8
+	}
+	return p, nil
+}
+
+func (p *samplingLogProcessor) OnEmit(ctx context.Context, r *sdklog.Record) error {
+	if r.Severity() < p.min {
+		if id := r.TraceID(); id.IsValid() {
+			if binary.BigEndian.Uint64(id[8:16])>>1 >= p.threshold {
+				return nil
+			}
+		} else if rand.Float64() >= p.ratio {
+			return nil
+		}
+	}
+	return p.Processor.OnEmit(ctx, r)
+}
+
+// parseSeverity reads a severity name, trace, debug, info, warn, error or
+// fatal, in any case, optionally numbered as in WARN2
+func parseSeverity(s string) (otellog.Severity, error) {
+	names := []string{"trace", "debug", "info", "warn", "error", "fatal"}
+	name := strings.ToLower(strings.TrimRight(s, "1234"))
+	i := slices.Index(names, name)
+	if i < 0 || len(s)-len(name) > 1 {
+		return 0, fmt.Errorf("unknown severity %q, want one of %s", s, strings.Join(names, ", "))
+	}
+	n := 1
+	if len(s) > len(name) {
+		n = int(s[len(s)-1] - '0')
+	}
+	return otellog.Severity(4*i + n), nil
+}
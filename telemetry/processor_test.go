@@ -0,0 +1,39 @@
+package telemetry
+
+import (
+	"testing"
+
+	otellog "go.opentelemetry.io/otel/log"
+)
+
+func TestParseSeverity(t *testing.T) {
+	for _, c := range []struct {
+		in      string
+		want    otellog.Severity
+		wantErr bool
+	}{
+		{in: "trace", want: otellog.SeverityTrace1},
+		{in: "DEBUG", want: otellog.SeverityDebug1},
+		{in: "Info", want: otellog.SeverityInfo1},
+		{in: "warn", want: otellog.SeverityWarn1},
+		{in: "WARN2", want: otellog.SeverityWarn2},
+		{in: "error3", want: otellog.SeverityError3},
+		{in: "fatal4", want: otellog.SeverityFatal4},
+		{in: "trace4", want: otellog.SeverityTrace4},
+		{in: "", wantErr: true},
+		{in: "2", wantErr: true},
+		{in: "warning", wantErr: true},
+		{in: "info0", wantErr: true},
+		{in: "info5", wantErr: true},
+		{in: "info12", wantErr: true},
+		{in: " info", wantErr: true},
+	} {
+		got, err := parseSeverity(c.in)
+		switch {
+		case c.wantErr && err == nil:
+			t.Errorf("parseSeverity(%q) = %v, want an error", c.in, got)
+		case !c.wantErr && (err != nil || got != c.want):
+			t.Errorf("parseSeverity(%q) = %v, %v, want %v", c.in, got, err, c.want)
+		}
+	}
+}
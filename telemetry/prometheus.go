@@ -0,0 +1,61 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// prometheusReader serves the meter provider's metrics on /metrics for a
+// Prometheus scraper instead of pushing them. Each scrape is counted as one
+// export of every data point it returned.
+type prometheusReader struct {
+	sdkmetric.Reader
+	server *http.Server
+}
+
+func newPrometheusReader(ep EndpointConfig, stats *SignalStats) (*prometheusReader, error) {
+	// A registry of our own keeps reloads from registering collectors twice
+	// and leaves out the Go runtime metrics of the default registry
+	registry := prometheus.NewRegistry()
+	exporter, err := otelprom.New(otelprom.WithRegisterer(registry))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create prometheus exporter: %w", err)
+	}
+
+	gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		start := time.Now()
+		families, err := registry.Gather()
+		n := 0
+		for _, family := range families {
+			n += len(family.GetMetric())
+		}
+		stats.Generated.Add(int64(n))
+		stats.recordExport(n, start, err)
+		return families, err
+	})
+
+	ln, err := net.Listen("tcp", ep.Listen)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to listen for prometheus scrapes: %w", err), exporter.Shutdown(context.Background()))
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go server.Serve(ln)
+
+	return &prometheusReader{Reader: exporter, server: server}, nil
+}
+
+func (r *prometheusReader) Shutdown(ctx context.Context) error {
+	return errors.Join(r.server.Shutdown(ctx), r.Reader.Shutdown(ctx))
+}
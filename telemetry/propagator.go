@@ -0,0 +1,46 @@
+package telemetry
+
+import (
+	"go.opentelemetry.io/contrib/propagators/aws/xray"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/contrib/propagators/jaeger"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// propagatorNames are the propagators values, as OTEL_PROPAGATORS names
+// them, plus composite
+var propagatorNames = []string{"tracecontext", "baggage", "b3", "b3multi", "jaeger", "xray", "composite", "none"}
+
+// newPropagator composes the propagators the names list, in order: each
+// one injects its headers, and the context is extracted from whichever
+// the request carries, a later propagator winning. composite stands for
+// all of tracecontext, baggage, b3 in both encodings and jaeger, for
+// services between callers that propagate differently. none on its own
+// propagates nothing.
+func newPropagator(names []string) propagation.TextMapPropagator {
+	var props []propagation.TextMapPropagator
+	for _, name := range names {
+		switch name {
+		case "tracecontext":
+			props = append(props, propagation.TraceContext{})
+		case "baggage":
+			props = append(props, propagation.Baggage{})
+		case "b3":
+			props = append(props, b3.New())
+		case "b3multi":
+			props = append(props, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+		case "jaeger":
+			props = append(props, jaeger.Jaeger{})
+		case "xray":
+			props = append(props, xray.Propagator{})
+		case "composite":
+			props = append(props,
+				b3.New(b3.WithInjectEncoding(b3.B3SingleHeader|b3.B3MultipleHeader)),
+				jaeger.Jaeger{},
+				propagation.TraceContext{},
+				propagation.Baggage{},
+			)
+		}
+	}
+	return propagation.NewCompositeTextMapPropagator(props...)
+}
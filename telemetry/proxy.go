@@ -0,0 +1,140 @@
+package telemetry
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// proxyFunc returns the proxy selection for ep's HTTP requests: the
+// explicitly configured proxy, or else HTTPS_PROXY, HTTP_PROXY and NO_PROXY
+// from the environment.
+func proxyFunc(ep EndpointConfig) (func(*http.Request) (*url.URL, error), error) {
+	if ep.Proxy == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	u, err := parseProxyURL(ep.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	return http.ProxyURL(u), nil
+}
+
+func parseProxyURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", s, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q: want an http:// or https:// URL", s)
+	}
+	return u, nil
+}
+
+// grpcProxy returns the proxy, if any, that a gRPC connection to target has
+// to go through. The environment variables are matched as for an HTTPS
+// request, so NO_PROXY applies in the same way.
+func grpcProxy(ep EndpointConfig, target string) (*url.URL, error) {
+	proxy, err := proxyFunc(ep)
+	if err != nil {
+		return nil, err
+	}
+	return proxy(&http.Request{URL: &url.URL{Scheme: "https", Host: target}})
+}
+
+// endpointProxy returns the proxy used for target, which is either a gRPC
+// host:port or an HTTP URL as returned by endpointTarget
+func endpointProxy(ep EndpointConfig, target string) (*url.URL, error) {
+	if ep.Type == "syslog" || ep.Type == "fluent" {
+		network, addr, err := socketEndpoint(ep)
+		if err != nil {
+			return nil, err
+		}
+		return socketProxy(ep, network, addr)
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return grpcProxy(ep, target)
+	}
+	proxy, err := proxyFunc(ep)
+	if err != nil {
+		return nil, err
+	}
+	return proxy(&http.Request{URL: u})
+}
+
+// dialThroughProxy opens a tunnel to addr with an HTTP CONNECT request, which
+// is how gRPC traffic crosses a forward proxy
+func dialThroughProxy(ctx context.Context, proxy *url.URL, addr string) (net.Conn, error) {
+	proxyAddr := proxy.Host
+	if proxy.Port() == "" {
+		port := "80"
+		if proxy.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddr = net.JoinHostPort(proxy.Hostname(), port)
+	}
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach proxy %s: %w", proxyAddr, err)
+	}
+	if proxy.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: proxy.Hostname(), MinVersion: tls.VersionTLS12})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("TLS handshake with proxy %s failed: %w", proxyAddr, err)
+		}
+		conn = tlsConn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %w", proxyAddr, err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %w", proxyAddr, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s refused CONNECT to %s: %s", proxyAddr, addr, resp.Status)
+	}
+	if br.Buffered() > 0 {
+		// The server spoke first and the reader already holds its bytes
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) { return c.r.Read(p) }
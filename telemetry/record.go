@@ -0,0 +1,85 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/protobuf/proto"
+)
+
+// recorder keeps a copy of every batch of one signal under Dir/<signal>, as
+// an OTLP protobuf export request per file named like a spooled batch, so
+// `replay -input Dir` sends a run again exactly, in the order it went out.
+// Batches are recorded before they're exported, whether or not the export
+// succeeds.
+type recorder struct {
+	dir string
+
+	mu     sync.Mutex
+	seq    int
+	failed bool // whether a write failed, so it's logged once
+}
+
+func newRecorder(dir, signal string) (*recorder, error) {
+	dir = filepath.Join(dir, signal)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create record directory: %w", err)
+	}
+	return &recorder{dir: dir}, nil
+}
+
+// save writes msg to the next file. A batch that can't be recorded is still
+// exported, so the first failure only goes to the otel error handler.
+func (r *recorder) save(msg proto.Message) {
+	b, err := proto.Marshal(msg)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		r.seq++
+		name := filepath.Join(r.dir, fmt.Sprintf("%020d-%06d.pb", time.Now().UnixNano(), r.seq))
+		err = os.WriteFile(name, b, 0o644)
+	}
+	if err != nil && !r.failed {
+		r.failed = true
+		otel.Handle(fmt.Errorf("record: failed to record a batch in %s: %w", r.dir, err))
+	}
+}
+
+type recordSpanExporter struct {
+	sdktrace.SpanExporter
+	recorder *recorder
+}
+
+func (e recordSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.recorder.save(spansToProto(spans))
+	return e.SpanExporter.ExportSpans(ctx, spans)
+}
+
+type recordLogExporter struct {
+	sdklog.Exporter
+	recorder *recorder
+}
+
+func (e recordLogExporter) Export(ctx context.Context, records []sdklog.Record) error {
+	e.recorder.save(logsToProto(records))
+	return e.Exporter.Export(ctx, records)
+}
+
+type recordMetricExporter struct {
+	sdkmetric.Exporter
+	recorder *recorder
+}
+
+func (e recordMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	e.recorder.save(metricsToProto(rm))
+	return e.Exporter.Export(ctx, rm)
+}
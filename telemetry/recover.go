@@ -0,0 +1,82 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Recover reports a panic and panics again, so the crash still happens but
+// its telemetry reaches the collector first. Defer it where the span the
+// panic should be recorded on is in ctx:
+//
+//	ctx, span := tracer.Start(ctx, "checkout")
+//	defer span.End()
+//	defer client.Recover(ctx)
+func (c *Client) Recover(ctx context.Context) {
+	if r := recover(); r != nil {
+		c.RecordPanic(ctx, r)
+		panic(r)
+	}
+}
+
+// RecordPanic reports the value a panic was recovered with: the span in ctx
+// gets an exception event with the stack trace and ends with an error
+// status, a fatal log record correlated with it carries the exception.*
+// attributes, and the providers are flushed, for up to the batch
+// shutdown_timeout, before it returns.
+func (c *Client) RecordPanic(ctx context.Context, r any) {
+	err, ok := r.(error)
+	if !ok {
+		err = fmt.Errorf("%v", r)
+	}
+	attrs := exceptionAttributes(fmt.Sprintf("%T", r), err)
+
+	span := trace.SpanFromContext(ctx)
+	// As RecordError would, but with the type of the panic value
+	span.AddEvent("exception", trace.WithAttributes(attrs...))
+	span.SetStatus(codes.Error, "panic: "+err.Error())
+	// The deferred End of the panicking function would come too late for
+	// the flush
+	span.End()
+
+	var record otellog.Record
+	record.SetSeverity(otellog.SeverityFatal)
+	record.SetSeverityText("FATAL")
+	record.SetBody(otellog.StringValue("panic: " + err.Error()))
+	record.SetTimestamp(time.Now())
+	for _, kv := range attrs {
+		record.AddAttributes(otellog.KeyValueFromAttribute(kv))
+	}
+	c.Logger("otel-demo/recover").Emit(ctx, record)
+
+	flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.flushTimeout)
+	defer cancel()
+	if err := c.ForceFlush(flushCtx); err != nil {
+		otel.Handle(fmt.Errorf("failed to flush the telemetry of a panic: %w", err))
+	}
+}
+
+// RecoverHandler returns h reporting the panics of its requests with
+// Recover, on the server span when it's wrapped in otelhttp.NewHandler.
+// net/http recovers the panic again, so the server keeps serving;
+// http.ErrAbortHandler, which aborts a response on purpose, isn't reported.
+func (c *Client) RecoverHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if v := recover(); v != nil {
+				if v != http.ErrAbortHandler {
+					c.RecordPanic(r.Context(), v)
+				}
+				panic(v)
+			}
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,171 @@
+package telemetry
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// RedactRule masks the parts of attribute values matching Pattern, a
+// regular expression, with Replacement, [REDACTED] by default. Name, with
+// Pattern unset, picks a built-in pattern: email, credit_card (13 to 16
+// digits, grouped by spaces or dashes or not) or token (bearer tokens and
+// API keys).
+type RedactRule struct {
+	Name        string `yaml:"name" toml:"name"`
+	Pattern     string `yaml:"pattern" toml:"pattern"`
+	Replacement string `yaml:"replacement" toml:"replacement"`
+}
+
+// redactPatterns are the built-in patterns, applied in this order when a
+// redact processor has no rules
+var redactPatterns = []struct{ name, pattern string }{
+	{"email", `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`},
+	{"credit_card", `\b\d{4}[ -]?\d{4}[ -]?\d{4}[ -]?\d{1,4}\b`},
+	{"token", `(?i)\bbearer\s+[A-Za-z0-9._~+/=-]+|\b(?:sk|pk|rk)_(?:live|test)_[A-Za-z0-9]{8,}\b|\bgh[pousr]_[A-Za-z0-9]{20,}\b`},
+}
+
+// compile returns the rule's expression and replacement
+func (r RedactRule) compile() (*regexp.Regexp, string, error) {
+	pattern := r.Pattern
+	if pattern == "" {
+		i := slices.IndexFunc(redactPatterns, func(p struct{ name, pattern string }) bool { return p.name == r.Name })
+		if i < 0 {
+			return nil, "", fmt.Errorf("redact rule %q has no pattern and isn't a built-in: email, credit_card or token", r.Name)
+		}
+		pattern = redactPatterns[i].pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, "", fmt.Errorf("bad redact pattern %q: %w", pattern, err)
+	}
+	replacement := r.Replacement
+	if replacement == "" {
+		replacement = "[REDACTED]"
+	}
+	return re, replacement, nil
+}
+
+// redactRules returns the rules of a redact processor entry, the built-in
+// ones when it lists none
+func redactRules(cfg ProcessorConfig) []RedactRule {
+	if len(cfg.Rules) > 0 {
+		return cfg.Rules
+	}
+	rules := make([]RedactRule, len(redactPatterns))
+	for i, p := range redactPatterns {
+		rules[i] = RedactRule{Name: p.name}
+	}
+	return rules
+}
+
+// redactSpanProcessor masks what its rules match in the string attributes
+// of ended spans, and of their events, before passing them on. Values are
+// only read once a span has ended, so attributes set at any point are
+// covered. With Keys, only those attributes are looked at.
+type redactSpanProcessor struct {
+	sdktrace.SpanProcessor
+	rules []compiledRedactRule
+	keys  map[attribute.Key]bool
+}
+
+type compiledRedactRule struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+func newRedactSpanProcessor(cfg ProcessorConfig, next sdktrace.SpanProcessor) (sdktrace.SpanProcessor, error) {
+	p := &redactSpanProcessor{SpanProcessor: next}
+	for _, r := range redactRules(cfg) {
+		re, replacement, err := r.compile()
+		if err != nil {
+			return nil, err
+		}
+		p.rules = append(p.rules, compiledRedactRule{re, replacement})
+	}
+	if len(cfg.Keys) > 0 {
+		p.keys = map[attribute.Key]bool{}
+		for _, k := range cfg.Keys {
+			p.keys[attribute.Key(k)] = true
+		}
+	}
+	return p, nil
+}
+
+func (p *redactSpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	attrs, changed := p.redact(s.Attributes())
+	events, cloned := s.Events(), false
+	for i, e := range events {
+		redacted, ok := p.redact(e.Attributes)
+		if !ok {
+			continue
+		}
+		if !cloned {
+			// The span's events aren't ours to change
+			events, cloned = slices.Clone(events), true
+		}
+		events[i].Attributes = redacted
+		changed = true
+	}
+	if !changed {
+		p.SpanProcessor.OnEnd(s)
+		return
+	}
+	p.SpanProcessor.OnEnd(rewrittenSpan{ReadOnlySpan: s, attrs: attrs, events: events})
+}
+
+// redact returns attrs with the rules applied, and whether any matched;
+// attrs itself is left as it is
+func (p *redactSpanProcessor) redact(attrs []attribute.KeyValue) ([]attribute.KeyValue, bool) {
+	var out []attribute.KeyValue
+	for i, kv := range attrs {
+		if p.keys != nil && !p.keys[kv.Key] {
+			continue
+		}
+		var v attribute.Value
+		switch kv.Value.Type() {
+		case attribute.STRING:
+			s, ok := p.mask(kv.Value.AsString())
+			if !ok {
+				continue
+			}
+			v = attribute.StringValue(s)
+		case attribute.STRINGSLICE:
+			ss := kv.Value.AsStringSlice()
+			masked := false
+			for j, s := range ss {
+				if m, ok := p.mask(s); ok {
+					ss[j], masked = m, true
+				}
+			}
+			if !masked {
+				continue
+			}
+			v = attribute.StringSliceValue(ss)
+		default:
+			continue
+		}
+		if out == nil {
+			out = slices.Clone(attrs)
+		}
+		out[i] = attribute.KeyValue{Key: kv.Key, Value: v}
+	}
+	if out == nil {
+		return attrs, false
+	}
+	return out, true
+}
+
+// mask applies every rule to s and reports whether any matched
+func (p *redactSpanProcessor) mask(s string) (string, bool) {
+	masked := false
+	for _, r := range p.rules {
+		if r.re.MatchString(s) {
+			s, masked = r.re.ReplaceAllString(s, r.replacement), true
+		}
+	}
+	return s, masked
+}
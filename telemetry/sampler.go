@@ -0,0 +1,251 @@
+package telemetry
+
+import (
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"math/bits"
+	"slices"
+	"sync"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SamplerFactory builds the sampler a sampler.type names from the rest of
+// the sampler section. sdktrace.Sampler is the interface a sampler of the
+// service's own implements; RegisterSampler makes it selectable by name.
+type SamplerFactory func(cfg SamplerConfig) (sdktrace.Sampler, error)
+
+var (
+	samplersMu sync.RWMutex
+	samplers   = map[string]SamplerFactory{
+		"always_on": func(SamplerConfig) (sdktrace.Sampler, error) {
+			return sdktrace.AlwaysSample(), nil
+		},
+		"always_off": func(SamplerConfig) (sdktrace.Sampler, error) {
+			return sdktrace.NeverSample(), nil
+		},
+		"traceidratio": func(cfg SamplerConfig) (sdktrace.Sampler, error) {
+			return sdktrace.TraceIDRatioBased(cfg.Ratio), nil
+		},
+		"traceidhash": func(cfg SamplerConfig) (sdktrace.Sampler, error) {
+			return NewTraceIDHashSampler(cfg.Ratio, cfg.HashSeed), nil
+		},
+	}
+)
+
+// The parentbased samplers build their parent overrides by name from the
+// registry, so they're added once it exists
+func init() {
+	for name, root := range map[string]SamplerFactory{
+		"parentbased_always_on": func(SamplerConfig) (sdktrace.Sampler, error) {
+			return sdktrace.AlwaysSample(), nil
+		},
+		"parentbased_always_off": func(SamplerConfig) (sdktrace.Sampler, error) {
+			return sdktrace.NeverSample(), nil
+		},
+		"parentbased_traceidratio": func(cfg SamplerConfig) (sdktrace.Sampler, error) {
+			return sdktrace.TraceIDRatioBased(cfg.Ratio), nil
+		},
+		"parentbased_traceidhash": func(cfg SamplerConfig) (sdktrace.Sampler, error) {
+			return NewTraceIDHashSampler(cfg.Ratio, cfg.HashSeed), nil
+		},
+		"ratelimiting": func(cfg SamplerConfig) (sdktrace.Sampler, error) {
+			return NewRateLimitingSampler(cfg.Rate), nil
+		},
+		"parentbased": func(cfg SamplerConfig) (sdktrace.Sampler, error) {
+			return newSampler(cfg.leaf(cmp.Or(cfg.Root, "always_on")))
+		},
+	} {
+		samplers[name] = func(cfg SamplerConfig) (sdktrace.Sampler, error) {
+			r, err := root(cfg)
+			if err != nil {
+				return nil, err
+			}
+			return parentBased(r, cfg)
+		}
+	}
+}
+
+// parentBased follows the parent span's decision, sampling root spans with
+// root and applying the sampler.parent overrides
+func parentBased(root sdktrace.Sampler, cfg SamplerConfig) (sdktrace.Sampler, error) {
+	var opts []sdktrace.ParentBasedSamplerOption
+	for _, o := range []struct {
+		name   string
+		option func(sdktrace.Sampler) sdktrace.ParentBasedSamplerOption
+	}{
+		{cfg.Parent.RemoteSampled, sdktrace.WithRemoteParentSampled},
+		{cfg.Parent.RemoteNotSampled, sdktrace.WithRemoteParentNotSampled},
+		{cfg.Parent.LocalSampled, sdktrace.WithLocalParentSampled},
+		{cfg.Parent.LocalNotSampled, sdktrace.WithLocalParentNotSampled},
+	} {
+		if o.name == "" {
+			continue
+		}
+		s, err := newSampler(cfg.leaf(o.name))
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, o.option(s))
+	}
+	return sdktrace.ParentBased(root, opts...), nil
+}
+
+// RegisterSampler makes factory the sampler for sampler.type name, so a
+// service embedding the package can select its own sampler from the config
+// file as well as with WithSampler. Register before the config is
+// validated, which rejects unknown types; a built-in name is replaced.
+func RegisterSampler(name string, factory SamplerFactory) {
+	samplersMu.Lock()
+	defer samplersMu.Unlock()
+	samplers[name] = factory
+}
+
+func samplerFactory(name string) (SamplerFactory, bool) {
+	samplersMu.RLock()
+	defer samplersMu.RUnlock()
+	f, ok := samplers[name]
+	return f, ok
+}
+
+// SamplerTypes returns the sampler.type names available, built-in and
+// registered, sorted
+func SamplerTypes() []string {
+	samplersMu.RLock()
+	defer samplersMu.RUnlock()
+	return slices.Sorted(maps.Keys(samplers))
+}
+
+// newSampler builds the sampler described by the config
+func newSampler(cfg SamplerConfig) (sdktrace.Sampler, error) {
+	factory, ok := samplerFactory(cfg.Type)
+	if !ok {
+		return nil, fmt.Errorf("unknown sampler.type %q", cfg.Type)
+	}
+	sampler, err := factory(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("sampler %s: %w", cfg.Type, err)
+	}
+	return sampler, nil
+}
+
+// rateLimitingSampler keeps at most rate spans a second, averaged by a
+// token bucket holding up to a second's worth, so a traffic spike can't
+// multiply the export volume
+type rateLimitingSampler struct {
+	rate float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimitingSampler returns a sampler keeping up to perSecond of the
+// spans it's asked about each second, best used as the root sampler of
+// sdktrace.ParentBased so whole traces are kept or dropped, as the
+// ratelimiting sampler.type does
+func NewRateLimitingSampler(perSecond float64) sdktrace.Sampler {
+	return &rateLimitingSampler{rate: perSecond, tokens: max(perSecond, 1), last: time.Now()}
+}
+
+func (s *rateLimitingSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	s.mu.Lock()
+	now := time.Now()
+	s.tokens = min(s.tokens+now.Sub(s.last).Seconds()*s.rate, max(s.rate, 1))
+	s.last = now
+	decision := sdktrace.Drop
+	if s.tokens >= 1 {
+		s.tokens--
+		decision = sdktrace.RecordAndSample
+	}
+	s.mu.Unlock()
+	return sdktrace.SamplingResult{
+		Decision:   decision,
+		Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+	}
+}
+
+func (s *rateLimitingSampler) Description() string {
+	return fmt.Sprintf("RateLimitingSampler{%g}", s.rate)
+}
+
+// hashBuckets is the number of buckets trace ID hashes fall into, as in the
+// collector's probabilistic_sampler processor
+const hashBuckets = 1 << 14
+
+// traceIDHashSampler keeps the traces whose ID hashes, with the seed, into
+// the first ratio of the buckets
+type traceIDHashSampler struct {
+	ratio     float64
+	seed      uint32
+	threshold uint32
+}
+
+// NewTraceIDHashSampler returns a sampler keeping ratio of the traces,
+// decided by a seeded murmur3 hash of the trace ID the way the collector's
+// probabilistic_sampler processor decides in hash_seed mode. Every process
+// sampling with the same ratio and seed keeps the same traces, so runs on
+// several machines agree, and so does a collector with sampling_percentage
+// ratio*100 and that hash_seed, which lets a collector's sampling config be
+// checked against what was sent. The collector's percentage is a float32,
+// so the bucket threshold is worked out in float32 here too; ratio*100 is
+// rounded to a float32 on the way, which for a ratio with more digits than
+// a float32 holds can put the threshold a bucket, 1/16384 of the traces,
+// off the collector's for the same percentage. As the traceidhash
+// sampler.type does, it decides every span; use it under
+// sdktrace.ParentBased for root spans only.
+func NewTraceIDHashSampler(ratio float64, seed uint32) sdktrace.Sampler {
+	// As the collector scales its percentage, truncating
+	threshold := uint32(float32(ratio*100) * (hashBuckets / 100.0))
+	return &traceIDHashSampler{ratio: ratio, seed: seed, threshold: threshold}
+}
+
+func (s *traceIDHashSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	decision := sdktrace.Drop
+	if murmur3(p.TraceID[:], s.seed)&(hashBuckets-1) < s.threshold {
+		decision = sdktrace.RecordAndSample
+	}
+	return sdktrace.SamplingResult{
+		Decision:   decision,
+		Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+	}
+}
+
+func (s *traceIDHashSampler) Description() string {
+	return fmt.Sprintf("TraceIDHashSampler{%g,%d}", s.ratio, s.seed)
+}
+
+// murmur3 is the 32-bit MurmurHash3 of b with the seed
+func murmur3(b []byte, seed uint32) uint32 {
+	const c1, c2 = 0xcc9e2d51, 0x1b873593
+	h := seed
+	n := len(b)
+	for ; len(b) >= 4; b = b[4:] {
+		k := binary.LittleEndian.Uint32(b)
+		k = bits.RotateLeft32(k*c1, 15) * c2
+		h = bits.RotateLeft32(h^k, 13)*5 + 0xe6546b64
+	}
+	var k uint32
+	switch len(b) {
+	case 3:
+		k ^= uint32(b[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(b[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(b[0])
+		h ^= bits.RotateLeft32(k*c1, 15) * c2
+	}
+	h ^= uint32(n)
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
@@ -0,0 +1,68 @@
+package telemetry
+
+import (
+	"encoding/hex"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMurmur3(t *testing.T) {
+	// The published MurmurHash3 x86_32 test vectors
+	for _, c := range []struct {
+		data string
+		seed uint32
+		want uint32
+	}{
+		{"", 0, 0},
+		{"", 1, 0x514e28b7},
+		{"", 0xffffffff, 0x81f16f39},
+		{"\xff\xff\xff\xff", 0, 0x76293b50},
+		{"\x21\x43\x65\x87", 0, 0xf55b516b},
+		{"\x21\x43\x65\x87", 0x5082edee, 0x2362f9de},
+		{"\x21\x43\x65", 0, 0x7e4a8634},
+		{"\x21\x43", 0, 0xa0f7b07a},
+		{"\x21", 0, 0x72661cf4},
+		{"\x00\x00\x00\x00", 0, 0x2362f9de},
+		{"\x00\x00\x00", 0, 0x85f0b427},
+		{"\x00\x00", 0, 0x30f4c306},
+		{"\x00", 0, 0x514e28b7},
+		{"Hello, world!", 1234, 0xfaf6cdb3},
+		{"The quick brown fox jumps over the lazy dog", 0, 0x2e4ff723},
+	} {
+		if got := murmur3([]byte(c.data), c.seed); got != c.want {
+			t.Errorf("murmur3(%q, %#x) = %#x, want %#x", c.data, c.seed, got, c.want)
+		}
+	}
+}
+
+func TestTraceIDHashSamplerDecisions(t *testing.T) {
+	// At 10% the threshold is bucket 1638; the buckets are those of the
+	// trace IDs hashed with seed 22
+	sampler := NewTraceIDHashSampler(0.1, 22)
+	for _, c := range []struct {
+		traceID string
+		bucket  int
+		want    sdktrace.SamplingDecision
+	}{
+		{"57ee05cde00902c77ebff20686734721", 8, sdktrace.RecordAndSample},
+		{"fe8ad4a156d2a68c02f4b342742a8063", 1593, sdktrace.RecordAndSample},
+		{"233b91a99a988e0c4d438786a88ddaf7", 1637, sdktrace.RecordAndSample},
+		{"76c44c83591361d890cc6f79ed42e099", 1638, sdktrace.Drop},
+		{"88913910624ddf476a6642da7b27e105", 1639, sdktrace.Drop},
+		{"5b8efff798038103d269b633813fc60c", 4069, sdktrace.Drop},
+		{"4bf92f3577b34da6a3ce929d0e0e4736", 14535, sdktrace.Drop},
+	} {
+		var id trace.TraceID
+		if _, err := hex.Decode(id[:], []byte(c.traceID)); err != nil {
+			t.Fatal(err)
+		}
+		if got := murmur3(id[:], 22) & (hashBuckets - 1); got != uint32(c.bucket) {
+			t.Errorf("trace %s hashes into bucket %d, want %d", c.traceID, got, c.bucket)
+		}
+		if got := sampler.ShouldSample(sdktrace.SamplingParameters{TraceID: id}).Decision; got != c.want {
+			t.Errorf("trace %s: decision %v, want %v", c.traceID, got, c.want)
+		}
+	}
+}
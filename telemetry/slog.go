@@ -0,0 +1,29 @@
+package telemetry
+
+import (
+	"log/slog"
+
+	"go.opentelemetry.io/contrib/bridges/otelslog"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/log/global"
+)
+
+// NewSlogLogger returns a log/slog logger that exports its records through
+// the global LoggerProvider, the one NewClient installs, under the
+// instrumentation scope name. Attributes and groups become log attributes,
+// the record's source location is kept as code.* attributes, and records
+// logged with a context (InfoContext and friends) carry the trace and span
+// IDs of the span in it. Passing it to slog.SetDefault sends everything
+// logged with the slog package functions to ClickStack as well.
+func NewSlogLogger(name string) *slog.Logger {
+	return newSlogLogger(name, global.GetLoggerProvider())
+}
+
+// SlogLogger is NewSlogLogger for the client's own LoggerProvider
+func (c *Client) SlogLogger(name string) *slog.Logger {
+	return newSlogLogger(name, c.p.loggerProvider)
+}
+
+func newSlogLogger(name string, provider otellog.LoggerProvider) *slog.Logger {
+	return otelslog.NewLogger(name, otelslog.WithLoggerProvider(provider), otelslog.WithSource(true))
+}
@@ -0,0 +1,150 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// socketTarget splits ep.Endpoint into a network and host:port for the
+// exporters that write to a plain socket. ports lists the accepted schemes
+// (udp, tcp or tls) with their default ports; an endpoint without a scheme
+// uses fallback.
+func socketTarget(ep EndpointConfig, ports map[string]string, fallback string) (network, addr string, err error) {
+	network, addr, found := strings.Cut(ep.Endpoint, "://")
+	if !found {
+		network, addr = fallback, ep.Endpoint
+	}
+	port, ok := ports[network]
+	if !ok {
+		schemes := make([]string, 0, len(ports))
+		for _, s := range []string{"udp", "tcp", "tls"} {
+			if _, ok := ports[s]; ok {
+				schemes = append(schemes, s)
+			}
+		}
+		return "", "", fmt.Errorf("invalid endpoint %q: scheme must be %s", ep.Endpoint, strings.Join(schemes, ", "))
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(strings.Trim(addr, "[]"), port)
+	}
+	return network, addr, nil
+}
+
+// socketEndpoint returns the network and address of a socket exporter's
+// endpoint
+func socketEndpoint(ep EndpointConfig) (network, addr string, err error) {
+	if ep.Type == "fluent" {
+		return fluentTarget(ep)
+	}
+	return syslogTarget(ep)
+}
+
+// socketProxy returns the proxy TCP and TLS connections are tunnelled
+// through. UDP can't cross an HTTP proxy, so it always goes direct.
+func socketProxy(ep EndpointConfig, network, addr string) (*url.URL, error) {
+	if network == "udp" {
+		return nil, nil
+	}
+	return grpcProxy(ep, addr)
+}
+
+// socketConn is a lazily dialled connection to a socket exporter's
+// endpoint. A write that fails closes the connection and is retried once on
+// a fresh one; there are no other retries.
+type socketConn struct {
+	ep      EndpointConfig
+	network string
+	addr    string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// write sends each payload with its own Write, which over UDP means one
+// datagram each, within ep's timeout
+func (c *socketConn) write(ctx context.Context, payloads ...[]byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ctx, cancel := context.WithTimeout(ctx, c.ep.Timeout)
+	defer cancel()
+	for attempt := 0; ; attempt++ {
+		err := c.writeOnce(ctx, payloads)
+		if err == nil {
+			return nil
+		}
+		if c.conn != nil {
+			c.conn.Close()
+			c.conn = nil
+		}
+		if attempt > 0 || ctx.Err() != nil {
+			return fmt.Errorf("%s://%s: %w", c.network, c.addr, err)
+		}
+	}
+}
+
+func (c *socketConn) writeOnce(ctx context.Context, payloads [][]byte) error {
+	if c.conn == nil {
+		conn, err := c.dial(ctx)
+		if err != nil {
+			return err
+		}
+		c.conn = conn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		c.conn.SetWriteDeadline(deadline)
+	}
+	for _, p := range payloads {
+		if _, err := c.conn.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *socketConn) dial(ctx context.Context) (net.Conn, error) {
+	if c.network == "udp" {
+		return (&net.Dialer{}).DialContext(ctx, "udp", c.addr)
+	}
+	proxy, err := socketProxy(c.ep, c.network, c.addr)
+	if err != nil {
+		return nil, err
+	}
+	var conn net.Conn
+	if proxy != nil {
+		conn, err = dialThroughProxy(ctx, proxy, c.addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", c.addr)
+	}
+	if err != nil || c.network == "tcp" {
+		return conn, err
+	}
+
+	tlsCfg, err := tlsConfig(c.ep)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if tlsCfg.ServerName == "" {
+		tlsCfg.ServerName, _, _ = net.SplitHostPort(c.addr)
+	}
+	tlsConn := tls.Client(conn, tlsCfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake with %s failed: %w", c.addr, err)
+	}
+	return tlsConn, nil
+}
+
+func (c *socketConn) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
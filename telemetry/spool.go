@@ -0,0 +1,381 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	_ "google.golang.org/grpc/encoding/gzip" // registers the gzip compressor
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// spool is the write-ahead log of one signal's primary endpoint. A batch
+// whose export fails is written to Dir/<signal> as an OTLP protobuf export
+// request, one file per batch, and every ReplayInterval the files are sent
+// again, oldest first, until one fails. A batch the collector won't ever
+// take, or a file that doesn't decode, is deleted instead of holding up the
+// ones behind it. Files left over from an earlier run are replayed the same
+// way, so nothing is lost across restarts either.
+// Outages and replays are reported to the otel error handler, which logs
+// them by default.
+type spool struct {
+	dir     string
+	signal  string
+	maxSize int64
+	send    func(context.Context, []byte) error
+	release func() error
+
+	mu       sync.Mutex
+	size     int64
+	seq      int
+	spooling bool // whether the last batch went to disk, so outages are logged once
+
+	replayMu sync.Mutex // one replay at a time
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newSpool(ctx context.Context, cfg SpoolConfig, ep EndpointConfig, signal string) (*spool, error) {
+	// Retrying is the replay loop's job
+	off := false
+	ep.Retry.Enabled = &off
+	send, release, err := NewRequestSender(ctx, ep, signal)
+	if err != nil {
+		return nil, err
+	}
+	s, err := openSpool(cfg, signal, send)
+	if err != nil {
+		return nil, errors.Join(err, release())
+	}
+	s.release = release
+
+	go s.loop(cfg.ReplayInterval)
+	return s, nil
+}
+
+// openSpool returns the spool of signal under cfg.Dir, sending with send,
+// with the size of the batches an earlier run left in it
+func openSpool(cfg SpoolConfig, signal string, send func(context.Context, []byte) error) (*spool, error) {
+	dir := filepath.Join(cfg.Dir, signal)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	s := &spool{
+		dir:     dir,
+		signal:  signal,
+		maxSize: cfg.MaxSize,
+		send:    send,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	// Written by a run that crashed before renaming them, and not counted
+	// against the size
+	if tmp, err := filepath.Glob(filepath.Join(dir, "*.pb.tmp")); err == nil {
+		for _, name := range tmp {
+			os.Remove(name)
+		}
+	}
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		s.size += f.size
+	}
+	if len(files) > 0 {
+		otel.Handle(fmt.Errorf("spool: %d %s batches from an earlier run in %s, replaying them", len(files), signal, dir))
+	}
+	return s, nil
+}
+
+type spoolFile struct {
+	path string
+	size int64
+}
+
+// files lists the spooled batches oldest first. The names start with the
+// time they were written, so name order is age order.
+func (s *spool) files() ([]spoolFile, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []spoolFile
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".pb") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, spoolFile{filepath.Join(s.dir, e.Name()), info.Size()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	return files, nil
+}
+
+// save writes msg to the spool after its export failed with cause. It only
+// returns an error, cause included, when the batch couldn't be kept.
+func (s *spool) save(msg proto.Message, cause error) error {
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		return errors.Join(cause, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.size+int64(len(b)) > s.maxSize {
+		return fmt.Errorf("%w (spool %s is full)", cause, s.dir)
+	}
+	s.seq++
+	name := filepath.Join(s.dir, fmt.Sprintf("%020d-%06d.pb", time.Now().UnixNano(), s.seq))
+	// Written under another name first so a replay never sees half a file
+	if err := os.WriteFile(name+".tmp", b, 0o644); err != nil {
+		return errors.Join(cause, err)
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		return errors.Join(cause, err)
+	}
+	s.size += int64(len(b))
+	if !s.spooling {
+		s.spooling = true
+		otel.Handle(fmt.Errorf("spool: %s export failed (%v), spooling batches to %s until the collector is back", s.signal, cause, s.dir))
+	}
+	return nil
+}
+
+func (s *spool) loop(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.replay(context.Background())
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// replay sends the spooled batches in order, deleting each once it's
+// delivered or rejected for good, and stops at the first that fails
+// otherwise
+func (s *spool) replay(ctx context.Context) {
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+
+	files, err := s.files()
+	if err != nil || len(files) == 0 {
+		return
+	}
+	sent, dropped := 0, 0
+	for _, f := range files {
+		b, err := os.ReadFile(f.path)
+		if err == nil {
+			err = s.send(ctx, b)
+		}
+		if err != nil && !undeliverable(err) {
+			break
+		}
+		if err != nil {
+			otel.Handle(fmt.Errorf("spool: dropped %s, a %s batch that can't be delivered: %w", f.path, s.signal, err))
+			dropped++
+		} else {
+			sent++
+		}
+		os.Remove(f.path)
+
+		s.mu.Lock()
+		s.size -= f.size
+		s.mu.Unlock()
+	}
+	if sent+dropped == 0 {
+		return
+	}
+	s.mu.Lock()
+	if sent+dropped == len(files) {
+		s.spooling = false
+	}
+	s.mu.Unlock()
+	if sent > 0 {
+		otel.Handle(fmt.Errorf("spool: replayed %d of %d spooled %s batches", sent, len(files), s.signal))
+	}
+}
+
+// undeliverableError is an export refused for what it carries, so sending it
+// again can't succeed
+type undeliverableError struct{ error }
+
+func (e undeliverableError) Unwrap() error { return e.error }
+
+// undeliverable reports whether err means the batch itself can't be
+// delivered: it doesn't decode, or the collector refused it as malformed or
+// too large. A ResourceExhausted without RetryInfo is a size limit, not
+// throttling.
+func undeliverable(err error) bool {
+	if errors.As(err, new(undeliverableError)) {
+		return true
+	}
+	s, ok := status.FromError(err)
+	if !ok {
+		return false
+	}
+	switch s.Code() {
+	case codes.InvalidArgument, codes.OutOfRange:
+		return true
+	case codes.ResourceExhausted:
+		for _, d := range s.Details() {
+			if _, ok := d.(*errdetails.RetryInfo); ok {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// shutdown makes a last replay attempt and reports what's left for the
+// next run
+func (s *spool) shutdown(ctx context.Context) error {
+	close(s.stop)
+	<-s.done
+	s.replay(ctx)
+	if files, err := s.files(); err == nil && len(files) > 0 {
+		otel.Handle(fmt.Errorf("spool: %d %s batches still in %s, replayed on the next run", len(files), s.signal, s.dir))
+	}
+	return s.release()
+}
+
+// NewRequestSender returns a func that sends one serialized OTLP export
+// request for signal to ep as is, for the spool and the replay command. The
+// SDK exporters only take SDK data, so this bypasses them; HTTP requests
+// are retried with ep's policy, gRPC ones not at all.
+func NewRequestSender(ctx context.Context, ep EndpointConfig, signal string) (func(context.Context, []byte) error, func() error, error) {
+	switch ep.Protocol {
+	case "http/protobuf", "http/json":
+		c, err := newOTLPJSONClient(ep, signal)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ep.Protocol == "http/protobuf" {
+			c.contentType = "application/x-protobuf"
+			return func(ctx context.Context, b []byte) error { return c.sendBody(ctx, c.url, b) }, func() error { c.shutdown(); return nil }, nil
+		}
+		return func(ctx context.Context, b []byte) error {
+			msg := NewExportRequest(signal)
+			if err := proto.Unmarshal(b, msg); err != nil {
+				return undeliverableError{err}
+			}
+			return c.send(ctx, msg)
+		}, func() error { c.shutdown(); return nil }, nil
+	}
+
+	conn, release, err := grpcConns.acquire(ctx, ep)
+	if err != nil {
+		return nil, nil, err
+	}
+	var opts []grpc.CallOption
+	if ep.Compression == "gzip" {
+		opts = append(opts, grpc.UseCompressor("gzip"))
+	}
+	return func(ctx context.Context, b []byte) error {
+		req := NewExportRequest(signal)
+		err := proto.Unmarshal(b, req)
+		if err != nil {
+			return undeliverableError{err}
+		}
+		ctx, cancel := context.WithTimeout(metadata.NewOutgoingContext(ctx, metadata.New(ep.Headers)), ep.Timeout)
+		defer cancel()
+		switch req := req.(type) {
+		case *coltracepb.ExportTraceServiceRequest:
+			_, err = coltracepb.NewTraceServiceClient(conn).Export(ctx, req, opts...)
+		case *collogspb.ExportLogsServiceRequest:
+			_, err = collogspb.NewLogsServiceClient(conn).Export(ctx, req, opts...)
+		case *colmetricpb.ExportMetricsServiceRequest:
+			_, err = colmetricpb.NewMetricsServiceClient(conn).Export(ctx, req, opts...)
+		}
+		return err
+	}, release, nil
+}
+
+// NewExportRequest returns an empty export request for signal
+func NewExportRequest(signal string) proto.Message {
+	switch signal {
+	case "traces":
+		return &coltracepb.ExportTraceServiceRequest{}
+	case "logs":
+		return &collogspb.ExportLogsServiceRequest{}
+	default:
+		return &colmetricpb.ExportMetricsServiceRequest{}
+	}
+}
+
+type spoolSpanExporter struct {
+	sdktrace.SpanExporter
+	spool *spool
+}
+
+func (e spoolSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if err := e.SpanExporter.ExportSpans(ctx, spans); err != nil {
+		// TracesData has the same wire format as ExportTraceServiceRequest
+		return e.spool.save(spansToProto(spans), err)
+	}
+	return nil
+}
+
+func (e spoolSpanExporter) Shutdown(ctx context.Context) error {
+	return errors.Join(e.SpanExporter.Shutdown(ctx), e.spool.shutdown(ctx))
+}
+
+type spoolLogExporter struct {
+	sdklog.Exporter
+	spool *spool
+}
+
+func (e spoolLogExporter) Export(ctx context.Context, records []sdklog.Record) error {
+	if err := e.Exporter.Export(ctx, records); err != nil {
+		return e.spool.save(logsToProto(records), err)
+	}
+	return nil
+}
+
+func (e spoolLogExporter) Shutdown(ctx context.Context) error {
+	return errors.Join(e.Exporter.Shutdown(ctx), e.spool.shutdown(ctx))
+}
+
+type spoolMetricExporter struct {
+	sdkmetric.Exporter
+	spool *spool
+}
+
+func (e spoolMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	if err := e.Exporter.Export(ctx, rm); err != nil {
+		return e.spool.save(metricsToProto(rm), err)
+	}
+	return nil
+}
+
+func (e spoolMetricExporter) Shutdown(ctx context.Context) error {
+	return errors.Join(e.Exporter.Shutdown(ctx), e.spool.shutdown(ctx))
+}
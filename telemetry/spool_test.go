@@ -0,0 +1,163 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestSpoolSizeAcrossRestarts(t *testing.T) {
+	batch := &coltracepb.ExportTraceServiceRequest{ResourceSpans: []*tracepb.ResourceSpans{{SchemaUrl: "https://opentelemetry.io/schemas/1.26.0"}}}
+	n := int64(proto.Size(batch))
+	cfg := SpoolConfig{Dir: t.TempDir(), MaxSize: 3 * n}
+	down := errors.New("connection refused")
+
+	// sendable is how many sends succeed before the collector goes down
+	sendable := 0
+	send := func(context.Context, []byte) error {
+		if sendable == 0 {
+			return down
+		}
+		sendable--
+		return nil
+	}
+	open := func() *spool {
+		t.Helper()
+		s, err := openSpool(cfg, "traces", send)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	check := func(s *spool, batches int) {
+		t.Helper()
+		files, err := s.files()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != batches || s.size != int64(batches)*n {
+			t.Fatalf("%d files and size %d, want %d and %d", len(files), s.size, batches, int64(batches)*n)
+		}
+	}
+
+	s := open()
+	for range 3 {
+		if err := s.save(batch, down); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.save(batch, down); err == nil || !strings.Contains(err.Error(), "is full") || !errors.Is(err, down) {
+		t.Fatalf("saving past max_size: %v", err)
+	}
+	check(s, 3)
+	s.replay(context.Background())
+	check(s, 3)
+
+	// A restart counts what was left
+	s = open()
+	check(s, 3)
+	sendable = 1
+	s.replay(context.Background())
+	check(s, 2)
+
+	s = open()
+	check(s, 2)
+	if err := s.save(batch, down); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.save(batch, down); err == nil {
+		t.Fatal("saved past max_size after a restart")
+	}
+	check(s, 3)
+	sendable = 3
+	s.replay(context.Background())
+	check(s, 0)
+
+	check(open(), 0)
+}
+
+func TestSpoolDropsUndeliverableBatches(t *testing.T) {
+	batch := &coltracepb.ExportTraceServiceRequest{ResourceSpans: []*tracepb.ResourceSpans{{SchemaUrl: "https://opentelemetry.io/schemas/1.26.0"}}}
+	cfg := SpoolConfig{Dir: t.TempDir(), MaxSize: 1 << 20}
+	var sent [][]byte
+	poison := status.Error(codes.InvalidArgument, "span has an invalid trace ID")
+	s, err := openSpool(cfg, "traces", func(_ context.Context, b []byte) error {
+		if len(sent) == 0 && len(b) == 0 {
+			return poison
+		}
+		sent = append(sent, b)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.save(&coltracepb.ExportTraceServiceRequest{}, poison); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if err := s.save(batch, poison); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.replay(context.Background())
+	if len(sent) != 2 || s.size != 0 {
+		t.Fatalf("sent %d batches behind the undeliverable one, size %d left, want 2 and 0", len(sent), s.size)
+	}
+	if files, _ := s.files(); len(files) != 0 {
+		t.Errorf("%d files left", len(files))
+	}
+}
+
+func TestSpoolRemovesPartialFiles(t *testing.T) {
+	cfg := SpoolConfig{Dir: t.TempDir(), MaxSize: 1 << 20}
+	dir := filepath.Join(cfg.Dir, "logs")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	partial := filepath.Join(dir, "00000000000000000001-000001.pb.tmp")
+	if err := os.WriteFile(partial, []byte("half a batch"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openSpool(cfg, "logs", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(partial); !os.IsNotExist(err) {
+		t.Errorf("the partial file is still there: %v", err)
+	}
+}
+
+func TestUndeliverable(t *testing.T) {
+	retryInfo, err := status.New(codes.ResourceExhausted, "slow down").WithDetails(&errdetails.RetryInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"connection refused", errors.New("connection refused"), false},
+		{"unavailable", status.Error(codes.Unavailable, "no connection"), false},
+		{"unauthenticated", status.Error(codes.Unauthenticated, "bad api key"), false},
+		{"invalid argument", status.Error(codes.InvalidArgument, "bad span"), true},
+		{"too large", status.Error(codes.ResourceExhausted, "message larger than max"), true},
+		{"throttled", retryInfo.Err(), false},
+		{"wrapped", fmt.Errorf("traces: %w", status.Error(codes.InvalidArgument, "bad span")), true},
+		{"undecodable or refused over HTTP", undeliverableError{errors.New("400 Bad Request")}, true},
+	} {
+		if got := undeliverable(c.err); got != c.want {
+			t.Errorf("%s: undeliverable = %t, want %t", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// The sql exporter appends every batch to Path as ClickHouse INSERT
+// statements for the ClickStack tables, one statement per table and batch,
+// so a run can be bulk-loaded later without a collector:
+//
+//	clickhouse-client --database otel --multiquery < run.sql
+//
+// The rows are the ones the clickhouse exporter sends. Timestamps are
+// written as nanoseconds since the epoch, which DateTime64(9) columns take
+// as UTC.
+
+// writeSQLInserts renders one INSERT per table and writes them with a
+// single append
+func writeSQLInserts(w *fileWriter, tables ...clickhouseTable) error {
+	var buf bytes.Buffer
+	for _, t := range tables {
+		if len(t.rows) == 0 {
+			continue
+		}
+		buf.WriteString("INSERT INTO " + t.table + " (")
+		for i, col := range sqlColumns(reflect.TypeOf(t.rows[0])) {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString("`" + col + "`")
+		}
+		buf.WriteString(") VALUES\n")
+		for i, row := range t.rows {
+			if i > 0 {
+				buf.WriteString(",\n")
+			}
+			buf.WriteByte('(')
+			for j, v := range sqlFields(reflect.ValueOf(row)) {
+				if j > 0 {
+					buf.WriteString(", ")
+				}
+				writeSQLValue(&buf, v)
+			}
+			buf.WriteByte(')')
+		}
+		buf.WriteString(";\n")
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err := w.f.Write(buf.Bytes())
+	return err
+}
+
+// sqlColumns and sqlFields walk a row struct in field order, flattening
+// embedded structs. Column names come from the JSON tags; every column is
+// listed, including the ones JSONEachRow leaves out when empty.
+func sqlColumns(t reflect.Type) []string {
+	var cols []string
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if f.Anonymous {
+			cols = append(cols, sqlColumns(f.Type)...)
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		cols = append(cols, name)
+	}
+	return cols
+}
+
+func sqlFields(v reflect.Value) []reflect.Value {
+	var fields []reflect.Value
+	for i := range v.NumField() {
+		if v.Type().Field(i).Anonymous {
+			fields = append(fields, sqlFields(v.Field(i))...)
+			continue
+		}
+		fields = append(fields, v.Field(i))
+	}
+	return fields
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// writeSQLValue writes v as a ClickHouse literal
+func writeSQLValue(buf *bytes.Buffer, v reflect.Value) {
+	if v.Type() == timeType {
+		buf.WriteString(strconv.FormatInt(v.Interface().(time.Time).UnixNano(), 10))
+		return
+	}
+	switch v.Kind() {
+	case reflect.String:
+		writeSQLString(buf, v.String())
+	case reflect.Bool:
+		buf.WriteString(strconv.FormatBool(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		buf.WriteString(strconv.FormatInt(v.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		buf.WriteString(strconv.FormatUint(v.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		switch f := v.Float(); {
+		case math.IsNaN(f):
+			buf.WriteString("nan")
+		case math.IsInf(f, 1):
+			buf.WriteString("inf")
+		case math.IsInf(f, -1):
+			buf.WriteString("-inf")
+		default:
+			buf.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+		}
+	case reflect.Pointer:
+		if v.IsNil() {
+			buf.WriteString("NULL")
+			return
+		}
+		writeSQLValue(buf, v.Elem())
+	case reflect.Slice:
+		buf.WriteByte('[')
+		for i := range v.Len() {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			writeSQLValue(buf, v.Index(i))
+		}
+		buf.WriteByte(']')
+	case reflect.Map:
+		// Sorted so the same batch always renders the same statement
+		keys := v.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int { return strings.Compare(a.String(), b.String()) })
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			writeSQLString(buf, k.String())
+			buf.WriteByte(':')
+			writeSQLValue(buf, v.MapIndex(k))
+		}
+		buf.WriteByte('}')
+	default:
+		panic(fmt.Sprintf("no SQL literal for %s", v.Type()))
+	}
+}
+
+// writeSQLString quotes s with ClickHouse's backslash escapes
+func writeSQLString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('\'')
+	for _, r := range s {
+		switch r {
+		case '\'', '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case 0:
+			buf.WriteString(`\0`)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('\'')
+}
+
+type sqlSpanExporter struct{ *fileWriter }
+
+func (e sqlSpanExporter) ExportSpans(_ context.Context, spans []sdktrace.ReadOnlySpan) error {
+	return writeSQLInserts(e.fileWriter, clickhouseTable{"otel_traces", clickhouseSpanRows(spans)})
+}
+
+type sqlLogExporter struct{ *fileWriter }
+
+func (e sqlLogExporter) Export(_ context.Context, records []sdklog.Record) error {
+	return writeSQLInserts(e.fileWriter, clickhouseTable{"otel_logs", clickhouseLogRows(records)})
+}
+
+func (e sqlLogExporter) ForceFlush(context.Context) error { return nil }
+
+type sqlMetricExporter struct{ *fileWriter }
+
+func (e sqlMetricExporter) Temporality(k sdkmetric.InstrumentKind) metricdata.Temporality {
+	return sdkmetric.DefaultTemporalitySelector(k)
+}
+
+func (e sqlMetricExporter) Aggregation(k sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return sdkmetric.DefaultAggregationSelector(k)
+}
+
+func (e sqlMetricExporter) Export(_ context.Context, rm *metricdata.ResourceMetrics) error {
+	return writeSQLInserts(e.fileWriter, clickhouseMetricTables(rm)...)
+}
+
+func (e sqlMetricExporter) ForceFlush(context.Context) error { return nil }
@@ -0,0 +1,391 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ExportStats counts the spans, log records and metric data points each
+// provider generated and how many of them its exporter delivered, and the
+// traces the sampler kept.
+type ExportStats struct {
+	Spans, Logs, Points SignalStats
+	Traces              SamplingStats
+	Limits              LimitStats
+}
+
+// Add adds the counts of other to s, to report on several clients
+// exporting to the same place as one. The latencies and mirror tallies
+// aren't added.
+func (s *ExportStats) Add(other *ExportStats) {
+	for _, sig := range []struct{ to, from *SignalStats }{
+		{&s.Spans, &other.Spans},
+		{&s.Logs, &other.Logs},
+		{&s.Points, &other.Points},
+	} {
+		sig.to.Generated.Add(sig.from.Generated.Load())
+		sig.to.Exported.Add(sig.from.Exported.Load())
+		sig.to.Failed.Add(sig.from.Failed.Load())
+		sig.to.Rejected.Add(sig.from.Rejected.Load())
+	}
+	s.Traces.Generated.Add(other.Traces.Generated.Load())
+	s.Traces.Sampled.Add(other.Traces.Sampled.Load())
+	for _, v := range []struct{ to, from *atomic.Int64 }{
+		{&s.Limits.Attributes, &other.Limits.Attributes},
+		{&s.Limits.Events, &other.Limits.Events},
+		{&s.Limits.Links, &other.Limits.Links},
+		{&s.Limits.EventAttributes, &other.Limits.EventAttributes},
+		{&s.Limits.LinkAttributes, &other.Limits.LinkAttributes},
+		{&s.Limits.TruncatedValues, &other.Limits.TruncatedValues},
+		{&s.Limits.Spans, &other.Limits.Spans},
+	} {
+		v.to.Add(v.from.Load())
+	}
+}
+
+// LimitStats counts what the span limits took out of the spans generated:
+// the attributes, events and links dropped past a count limit, and the
+// attributes of events and links dropped past theirs. TruncatedValues
+// counts the string values exactly as long as the value length limit,
+// which were most likely cut to it; the SDK doesn't tell. Spans counts the
+// spans that lost anything.
+type LimitStats struct {
+	Attributes      atomic.Int64
+	Events          atomic.Int64
+	Links           atomic.Int64
+	EventAttributes atomic.Int64
+	LinkAttributes  atomic.Int64
+	TruncatedValues atomic.Int64
+	Spans           atomic.Int64
+
+	// valueLength is the value length limit, negative for none; it's set
+	// before the provider starts
+	valueLength int
+}
+
+// record tallies what the limits took out of s
+func (l *LimitStats) record(s sdktrace.ReadOnlySpan) {
+	var eventAttrs, linkAttrs, truncated int
+	for _, e := range s.Events() {
+		eventAttrs += e.DroppedAttributeCount
+	}
+	for _, k := range s.Links() {
+		linkAttrs += k.DroppedAttributeCount
+	}
+	if l.valueLength >= 0 {
+		for _, kv := range s.Attributes() {
+			switch kv.Value.Type() {
+			case attribute.STRING:
+				if len(kv.Value.AsString()) == l.valueLength {
+					truncated++
+				}
+			case attribute.STRINGSLICE:
+				for _, v := range kv.Value.AsStringSlice() {
+					if len(v) == l.valueLength {
+						truncated++
+					}
+				}
+			}
+		}
+	}
+	counts := []struct {
+		n  int
+		to *atomic.Int64
+	}{
+		{s.DroppedAttributes(), &l.Attributes},
+		{s.DroppedEvents(), &l.Events},
+		{s.DroppedLinks(), &l.Links},
+		{eventAttrs, &l.EventAttributes},
+		{linkAttrs, &l.LinkAttributes},
+		{truncated, &l.TruncatedValues},
+	}
+	var lost bool
+	for _, c := range counts {
+		if c.n > 0 {
+			c.to.Add(int64(c.n))
+			lost = true
+		}
+	}
+	if lost {
+		l.Spans.Add(1)
+	}
+}
+
+// SamplingStats counts the traces started here, by a span without a parent,
+// local or remote, and how many of them the sampler kept. The spans of the
+// dropped traces never reach the span counts.
+type SamplingStats struct {
+	Generated atomic.Int64
+	Sampled   atomic.Int64
+}
+
+// SignalStats is the running tally for one signal. Generated items that are
+// neither exported nor failed are still queued or were dropped by a full
+// batch queue.
+type SignalStats struct {
+	Generated   atomic.Int64
+	Exported    atomic.Int64
+	Failed      atomic.Int64
+	LastLatency atomic.Int64 // nanoseconds taken by the most recent export
+
+	// Rejected counts items the collector turned away in a partial success
+	// response. They're also counted as exported, since the export itself
+	// succeeded.
+	Rejected atomic.Int64
+
+	// signal and onFailure are set before the provider starts exporting
+	signal    string
+	onFailure ExportFailureHook
+
+	// targets has one entry per endpoint when the signal is mirrored. It's
+	// filled in while the exporter is created and only read afterwards.
+	targets []*targetStats
+}
+
+// recordExport tallies one export and passes a failure to the hook. The
+// error it returns is the one to hand back to the SDK.
+func (s *SignalStats) recordExport(n int, start time.Time, err error) error {
+	s.LastLatency.Store(int64(time.Since(start)))
+	if err != nil {
+		s.Failed.Add(int64(n))
+		if s.onFailure != nil {
+			s.onFailure(s.signal, n, err)
+			return reportedError{err}
+		}
+		return err
+	}
+	s.Exported.Add(int64(n))
+	return nil
+}
+
+// targetStats is the tally for one endpoint of a mirrored signal, kept
+// separately so endpoints can be compared at the end of a run
+type targetStats struct {
+	name          string
+	batches       atomic.Int64
+	failedBatches atomic.Int64
+	exported      atomic.Int64
+	failed        atomic.Int64
+	totalLatency  atomic.Int64 // nanoseconds, summed over all batches
+	maxLatency    atomic.Int64
+}
+
+func (s *targetStats) recordExport(n int, start time.Time, err error) {
+	latency := int64(time.Since(start))
+	s.totalLatency.Add(latency)
+	for {
+		current := s.maxLatency.Load()
+		if latency <= current || s.maxLatency.CompareAndSwap(current, latency) {
+			break
+		}
+	}
+	s.batches.Add(1)
+	if err != nil {
+		s.failedBatches.Add(1)
+		s.failed.Add(int64(n))
+		return
+	}
+	s.exported.Add(int64(n))
+}
+
+// WriteMirrorReport prints how each endpoint of the mirrored signals fared:
+// batches and items delivered or failed, export latency, and how far its
+// delivered count diverged from the primary's.
+func WriteMirrorReport(w io.Writer, stats *ExportStats) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "signal\tendpoint\tbatches\tfailed\titems\tfailed\tavg latency\tmax latency\tvs primary")
+	for _, sig := range []struct {
+		name  string
+		stats *SignalStats
+	}{
+		{"traces", &stats.Spans},
+		{"logs", &stats.Logs},
+		{"metrics", &stats.Points},
+	} {
+		if len(sig.stats.targets) == 0 {
+			continue
+		}
+		primary := sig.stats.targets[0].exported.Load()
+		for i, t := range sig.stats.targets {
+			batches := t.batches.Load()
+			var avg time.Duration
+			if batches > 0 {
+				avg = time.Duration(t.totalLatency.Load() / batches)
+			}
+			divergence := "-"
+			if i > 0 {
+				divergence = fmt.Sprintf("%+d", t.exported.Load()-primary)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\t%s\t%s\t%s\n", sig.name, t.name,
+				batches, t.failedBatches.Load(), t.exported.Load(), t.failed.Load(),
+				avg.Round(time.Millisecond), time.Duration(t.maxLatency.Load()).Round(time.Millisecond), divergence)
+		}
+	}
+	tw.Flush()
+}
+
+// WriteRejections warns about the items the collector rejected in partial
+// success responses, which would otherwise pass for delivered
+func WriteRejections(w io.Writer, stats *ExportStats) {
+	spans, logs, points := stats.Spans.Rejected.Load(), stats.Logs.Rejected.Load(), stats.Points.Rejected.Load()
+	if spans+logs+points == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Warning: the collector rejected %d spans, %d log records and %d metric data points (OTLP partial success)\n", spans, logs, points)
+}
+
+// WriteLimits reports what the span limits took out of the spans, if
+// anything, so it can be matched with what the collector received
+func WriteLimits(w io.Writer, stats *ExportStats) {
+	l := &stats.Limits
+	spans := l.Spans.Load()
+	if spans == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Span limits truncated %d spans: dropped %d attributes, %d events, %d links, %d event attributes and %d link attributes; %d values cut to the length limit\n",
+		spans, l.Attributes.Load(), l.Events.Load(), l.Links.Load(), l.EventAttributes.Load(), l.LinkAttributes.Load(), l.TruncatedValues.Load())
+}
+
+// WriteSampling reports how many of the traces started the sampler kept,
+// to compare with what the collector received
+func WriteSampling(w io.Writer, stats *ExportStats) {
+	generated, sampled := stats.Traces.Generated.Load(), stats.Traces.Sampled.Load()
+	var pct float64
+	if generated > 0 {
+		pct = 100 * float64(sampled) / float64(generated)
+	}
+	fmt.Fprintf(w, "Sampled %d of %d traces (%.1f%%), %d spans\n", sampled, generated, pct, stats.Spans.Generated.Load())
+}
+
+// WriteFailures warns about the items whose export failed and reports
+// whether there were any
+func WriteFailures(w io.Writer, stats *ExportStats) bool {
+	spans, logs, points := stats.Spans.Failed.Load(), stats.Logs.Failed.Load(), stats.Points.Failed.Load()
+	if spans+logs+points == 0 {
+		return false
+	}
+	fmt.Fprintf(w, "Warning: %d spans, %d log records and %d metric data points failed to export\n", spans, logs, points)
+	return true
+}
+
+type countingSpanExporter struct {
+	sdktrace.SpanExporter
+	stats *SignalStats
+}
+
+func (e countingSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	start := time.Now()
+	err := e.SpanExporter.ExportSpans(withRejections(ctx, e.stats), spans)
+	return e.stats.recordExport(len(spans), start, err)
+}
+
+type countingLogExporter struct {
+	sdklog.Exporter
+	stats *SignalStats
+}
+
+func (e countingLogExporter) Export(ctx context.Context, records []sdklog.Record) error {
+	start := time.Now()
+	err := e.Exporter.Export(withRejections(ctx, e.stats), records)
+	return e.stats.recordExport(len(records), start, err)
+}
+
+// countingMetricExporter also counts the generated data points, since
+// metrics only exist as data points once the reader collects them
+type countingMetricExporter struct {
+	sdkmetric.Exporter
+	stats *SignalStats
+}
+
+func (e countingMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	n := dataPointCount(rm)
+	e.stats.Generated.Add(int64(n))
+	start := time.Now()
+	err := e.Exporter.Export(withRejections(ctx, e.stats), rm)
+	return e.stats.recordExport(n, start, err)
+}
+
+// samplingCounter counts the traces sampler is asked to start and those it
+// keeps
+type samplingCounter struct {
+	sdktrace.Sampler
+	stats *SamplingStats
+}
+
+func (c samplingCounter) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	result := c.Sampler.ShouldSample(p)
+	if !trace.SpanContextFromContext(p.ParentContext).IsValid() {
+		c.stats.Generated.Add(1)
+		if result.Decision == sdktrace.RecordAndSample {
+			c.stats.Sampled.Add(1)
+		}
+	}
+	return result
+}
+
+// spanCounter and logCounter count items as they are generated, before the
+// batch processors queue them. spanCounter hands the spans on to the batch
+// processor, as logCounter does the log records, so what a configured
+// processor filters out isn't counted. spanCounter also tallies what the
+// span limits took out of each span.
+type spanCounter struct {
+	sdktrace.SpanProcessor
+	stats  *SignalStats
+	limits *LimitStats
+}
+
+func (c spanCounter) OnEnd(s sdktrace.ReadOnlySpan) {
+	c.stats.Generated.Add(1)
+	c.limits.record(s)
+	c.SpanProcessor.OnEnd(s)
+}
+
+type logCounter struct {
+	sdklog.Processor
+	stats *SignalStats
+}
+
+func (c logCounter) OnEmit(ctx context.Context, r *sdklog.Record) error {
+	c.stats.Generated.Add(1)
+	return c.Processor.OnEmit(ctx, r)
+}
+
+func dataPointCount(rm *metricdata.ResourceMetrics) int {
+	n := 0
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Gauge[int64]:
+				n += len(data.DataPoints)
+			case metricdata.Gauge[float64]:
+				n += len(data.DataPoints)
+			case metricdata.Sum[int64]:
+				n += len(data.DataPoints)
+			case metricdata.Sum[float64]:
+				n += len(data.DataPoints)
+			case metricdata.Histogram[int64]:
+				n += len(data.DataPoints)
+			case metricdata.Histogram[float64]:
+				n += len(data.DataPoints)
+			case metricdata.ExponentialHistogram[int64]:
+				n += len(data.DataPoints)
+			case metricdata.ExponentialHistogram[float64]:
+				n += len(data.DataPoints)
+			case metricdata.Summary:
+				n += len(data.DataPoints)
+			}
+		}
+	}
+	return n
+}
@@ -0,0 +1,111 @@
+package telemetry
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/log/global"
+)
+
+// LogWriter forwards the lines of the standard library's log package as
+// log records, so unstructured legacy logging is searchable in HyperDX:
+//
+//	log.SetOutput(io.MultiWriter(os.Stderr, telemetry.NewLogWriter("legacy", otellog.SeverityInfo)))
+//
+// Each write is one record with the line as its body. A date and time at
+// the start of the line, as the log package's default flags put there,
+// becomes the record's timestamp instead, and a level word leading the
+// message (ERROR, [warn], Debug: and the like) sets the severity; other
+// lines get the default severity. log.Fatal exits before batches are
+// exported, so its line is usually lost unless the client is shut down
+// first.
+type LogWriter struct {
+	logger   otellog.Logger
+	severity otellog.Severity
+}
+
+// NewLogWriter returns a LogWriter emitting through the global
+// LoggerProvider under the instrumentation scope name, with severity for
+// lines that don't name a level
+func NewLogWriter(name string, severity otellog.Severity) *LogWriter {
+	return &LogWriter{logger: global.GetLoggerProvider().Logger(name), severity: severity}
+}
+
+// NewStdLogger returns a *log.Logger writing only to a LogWriter, for code
+// that takes a logger rather than using the package functions
+func NewStdLogger(name string, severity otellog.Severity) *log.Logger {
+	return log.New(NewLogWriter(name, severity), "", 0)
+}
+
+// Write emits p as one log record
+func (w *LogWriter) Write(p []byte) (int, error) {
+	line := strings.TrimRight(string(p), "\r\n")
+	now := time.Now()
+	ts, line := stdlogTimestamp(line, now)
+	severity, text := stdlogSeverity(line)
+	if severity == otellog.SeverityUndefined {
+		severity = w.severity
+	}
+
+	var record otellog.Record
+	record.SetTimestamp(ts)
+	record.SetObservedTimestamp(now)
+	record.SetSeverity(severity)
+	if text != "" {
+		record.SetSeverityText(text)
+	}
+	record.SetBody(otellog.StringValue(line))
+	w.logger.Emit(context.Background(), record)
+	return len(p), nil
+}
+
+// stdlogTimestamp strips the date and time the log package's Ldate and
+// Ltime flags print, with microseconds for Lmicroseconds, returning them as
+// a time in the local zone. Lines without them keep now.
+func stdlogTimestamp(line string, now time.Time) (time.Time, string) {
+	date, rest, ok := strings.Cut(line, " ")
+	if !ok {
+		return now, line
+	}
+	day, err := time.ParseInLocation("2006/01/02", date, time.Local)
+	if err != nil {
+		return now, line
+	}
+	clock, msg, _ := strings.Cut(rest, " ")
+	t, err := time.ParseInLocation("2006/01/02 15:04:05.999999", date+" "+clock, time.Local)
+	if err != nil {
+		// Ldate on its own
+		return day, rest
+	}
+	return t, msg
+}
+
+// stdlogSeverities maps the level words legacy log lines start with
+var stdlogSeverities = map[string]otellog.Severity{
+	"TRACE":    otellog.SeverityTrace,
+	"DEBUG":    otellog.SeverityDebug,
+	"INFO":     otellog.SeverityInfo,
+	"NOTICE":   otellog.SeverityInfo2,
+	"WARN":     otellog.SeverityWarn,
+	"WARNING":  otellog.SeverityWarn,
+	"ERROR":    otellog.SeverityError,
+	"ERR":      otellog.SeverityError,
+	"CRITICAL": otellog.SeverityFatal,
+	"FATAL":    otellog.SeverityFatal,
+	"PANIC":    otellog.SeverityFatal4,
+}
+
+// stdlogSeverity returns the severity of the level word the message starts
+// with, bare or as [LEVEL] or LEVEL:, and the word itself
+func stdlogSeverity(msg string) (otellog.Severity, string) {
+	word, _, _ := strings.Cut(msg, " ")
+	word = strings.TrimSuffix(word, ":")
+	word = strings.TrimSuffix(strings.TrimPrefix(word, "["), "]")
+	if s, ok := stdlogSeverities[strings.ToUpper(word)]; ok {
+		return s, word
+	}
+	return otellog.SeverityUndefined, ""
+}
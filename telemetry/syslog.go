@@ -0,0 +1,176 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+)
+
+// syslogPorts are the syslog transports with their default ports
+var syslogPorts = map[string]string{"udp": "514", "tcp": "514", "tls": "6514"}
+
+// syslogTarget splits ep.Endpoint into the network and address to send
+// syslog to: udp://, tcp:// or tls:// followed by host[:port], with udp
+// when there's no scheme
+func syslogTarget(ep EndpointConfig) (network, addr string, err error) {
+	return socketTarget(ep, syslogPorts, "udp")
+}
+
+// syslogLogExporter sends every log record as an RFC 5424 message, for the
+// collector's syslog receiver or a relay in front of it. Over UDP each
+// message is one datagram; over TCP and TLS messages are separated by
+// newlines, the non-transparent framing the syslog receiver expects unless
+// octet counting is enabled.
+type syslogLogExporter struct {
+	conn     *socketConn
+	hostname string
+}
+
+func newSyslogLogExporter(ep EndpointConfig) (sdklog.Exporter, error) {
+	network, addr, err := syslogTarget(ep)
+	if err != nil {
+		return nil, err
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "-"
+	}
+	return &syslogLogExporter{conn: &socketConn{ep: ep, network: network, addr: addr}, hostname: hostname}, nil
+}
+
+func (e *syslogLogExporter) Export(ctx context.Context, records []sdklog.Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if e.conn.network == "udp" {
+		msgs := make([][]byte, 0, len(records))
+		for i := range records {
+			msgs = append(msgs, e.format(&records[i]))
+		}
+		return e.conn.write(ctx, msgs...)
+	}
+	var buf bytes.Buffer
+	for i := range records {
+		buf.Write(e.format(&records[i]))
+		buf.WriteByte('\n')
+	}
+	return e.conn.write(ctx, buf.Bytes())
+}
+
+// The structured data element carrying the trace context and attributes,
+// under the example enterprise number RFC 5424 reserves for documentation
+const syslogSDID = "otel@32473"
+
+// format renders r as
+//
+//	<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [otel@32473 ...] MSG
+//
+// with the user facility, the service name as the app name and the trace
+// and span IDs and log attributes as structured data parameters
+func (e *syslogLogExporter) format(r *sdklog.Record) []byte {
+	ts := r.Timestamp()
+	if ts.IsZero() {
+		ts = r.ObservedTimestamp()
+	}
+	res := r.Resource()
+	hostname := e.hostname
+	if v, ok := res.Set().Value("host.name"); ok {
+		hostname = v.Emit()
+	}
+
+	var buf bytes.Buffer
+	const facilityUser = 1
+	fmt.Fprintf(&buf, "<%d>1 %s %s %s - - ",
+		facilityUser*8+syslogSeverity(r.Severity()),
+		ts.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeaderField(hostname, 255),
+		syslogHeaderField(resourceServiceName(res), 48),
+	)
+
+	var params []string
+	if tid := r.TraceID(); tid.IsValid() {
+		params = append(params, syslogParam("trace_id", tid.String()))
+	}
+	if sid := r.SpanID(); sid.IsValid() {
+		params = append(params, syslogParam("span_id", sid.String()))
+		params = append(params, syslogParam("trace_flags", fmt.Sprintf("%02x", byte(r.TraceFlags()))))
+	}
+	r.WalkAttributes(func(kv otellog.KeyValue) bool {
+		params = append(params, syslogParam(kv.Key, kv.Value.String()))
+		return true
+	})
+	if len(params) == 0 {
+		buf.WriteByte('-')
+	} else {
+		buf.WriteString("[" + syslogSDID + " " + strings.Join(params, " ") + "]")
+	}
+
+	if body := r.Body().String(); body != "" {
+		buf.WriteByte(' ')
+		// Newlines would split the message under non-transparent framing
+		buf.WriteString(strings.ReplaceAll(body, "\n", " "))
+	}
+	return buf.Bytes()
+}
+
+// syslogSeverity maps an OpenTelemetry severity to the syslog one
+func syslogSeverity(s otellog.Severity) int {
+	switch {
+	case s >= otellog.SeverityFatal1:
+		return 2 // critical
+	case s >= otellog.SeverityError1:
+		return 3 // error
+	case s >= otellog.SeverityWarn1:
+		return 4 // warning
+	case s >= otellog.SeverityInfo1, s == otellog.SeverityUndefined:
+		return 6 // informational
+	default:
+		return 7 // debug
+	}
+}
+
+// syslogHeaderField makes s a valid header field: printable ASCII without
+// spaces, at most limit characters, or - when empty
+func syslogHeaderField(s string, limit int) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, s)
+	if s == "" {
+		return "-"
+	}
+	if len(s) > limit {
+		s = s[:limit]
+	}
+	return s
+}
+
+// syslogParam renders one structured data parameter. Names can't contain
+// =, space, ] or ", and are at most 32 characters; values escape ", \ and ].
+func syslogParam(name, value string) string {
+	name = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, name)
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+	return name + `="` + value + `"`
+}
+
+func (e *syslogLogExporter) ForceFlush(context.Context) error { return nil }
+
+func (e *syslogLogExporter) Shutdown(context.Context) error {
+	e.conn.close()
+	return nil
+}
@@ -0,0 +1,343 @@
+// Package telemetry wires OpenTelemetry traces, logs and metrics to
+// ClickStack the way the demo client does: the same exporters, batching,
+// mirrors, spool and circuit breaker, configured by the same Config. Go
+// services adopt it with a single call:
+//
+//	shutdown, err := telemetry.Setup(ctx, telemetry.WithConfig(cfg))
+//	if err != nil {
+//		return err
+//	}
+//	defer shutdown(context.Background())
+//
+// after which the global tracer, logger and meter providers export to the
+// configured endpoints.
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/log/global"
+	lognoop "go.opentelemetry.io/otel/log/noop"
+	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	serviceName    = "otel-demo-service"
+	serviceVersion = "1.0.0"
+	// Default OpenTelemetry collector endpoint. The port follows the
+	// protocol: 4317 for gRPC, 4318 for HTTP.
+	otelCollectorEndpoint = "localhost"
+)
+
+// Signals selects which of the three signals are exported
+type Signals struct {
+	Traces, Logs, Metrics bool
+}
+
+// providers holds the tracer, logger and meter for the enabled signals.
+// Disabled signals are backed by no-op implementations so the workload
+// doesn't need to know which signals are being exported.
+type providers struct {
+	tracerProvider trace.TracerProvider
+	loggerProvider otellog.LoggerProvider
+	meterProvider  metric.MeterProvider
+
+	stats ExportStats
+
+	// spanLimits are the limits the tracer provider applies
+	spanLimits sdktrace.SpanLimits
+
+	flushes, shutdowns []func(context.Context) error
+}
+
+// setupProviders creates the providers for o.signals from cfg. o.onFailure,
+// if not nil, is called for every failed export instead of the SDK logging
+// the error.
+func setupProviders(ctx context.Context, cfg *Config, o *clientOptions) (*providers, error) {
+	signals, onFailure := o.signals, o.onFailure
+	p := &providers{
+		tracerProvider: tracenoop.NewTracerProvider(),
+		loggerProvider: lognoop.NewLoggerProvider(),
+		meterProvider:  metricnoop.NewMeterProvider(),
+	}
+	for signal, stats := range map[string]*SignalStats{"traces": &p.stats.Spans, "logs": &p.stats.Logs, "metrics": &p.stats.Points} {
+		stats.signal, stats.onFailure = signal, onFailure
+	}
+	if onFailure != nil && !o.local {
+		installSkipReportedErrors()
+	}
+
+	// Setup resource
+	res := NewResource(cfg.Service)
+	if o.resource != nil {
+		merged, err := resource.Merge(res, o.resource)
+		if err != nil {
+			return nil, fmt.Errorf("failed to merge resources: %w", err)
+		}
+		res = merged
+	}
+
+	// Dry runs print every signal through one shared writer
+	var out *dryRunWriter
+	if cfg.DryRun.Enabled {
+		out = newDryRunWriter(os.Stdout, cfg.DryRun.Format)
+	}
+
+	// Setup trace provider
+	if signals.Traces {
+		sampler := o.sampler
+		if sampler == nil {
+			var err error
+			if sampler, err = newSampler(cfg.Sampler); err != nil {
+				return nil, errors.Join(err, p.shutdown(ctx))
+			}
+		}
+		ids := o.ids
+		if ids == nil {
+			ids = newIDGenerator(cfg.IDGenerator)
+		}
+		sampler = samplingCounter{sampler, &p.stats.Traces}
+		// The caller's limits win over the configured ones
+		p.spanLimits = cfg.Limits.SpanLimits()
+		if o.spanLimits != nil {
+			p.spanLimits = *o.spanLimits
+		}
+		p.stats.Limits.valueLength = p.spanLimits.AttributeValueLengthLimit
+		traceProvider, err := setupTraceProvider(ctx, cfg, res, sampler, ids, p.spanLimits, o.spanProcessors, o.clock, out, &p.stats.Spans, &p.stats.Limits)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to setup trace provider: %w", err), p.shutdown(ctx))
+		}
+		p.tracerProvider = traceProvider
+		p.flushes = append(p.flushes, traceProvider.ForceFlush)
+		p.shutdowns = append(p.shutdowns, traceProvider.Shutdown)
+	}
+
+	// Setup log provider
+	if signals.Logs {
+		logProvider, err := setupLogProvider(ctx, cfg, res, o.logProcessors, o.clock, out, &p.stats.Logs)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to setup log provider: %w", err), p.shutdown(ctx))
+		}
+		p.loggerProvider = logProvider
+		p.flushes = append(p.flushes, logProvider.ForceFlush)
+		p.shutdowns = append(p.shutdowns, logProvider.Shutdown)
+	}
+
+	// Setup metric provider
+	if signals.Metrics {
+		metricProvider, err := setupMetricProvider(ctx, cfg, res, o.clock, out, &p.stats.Points)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to setup metric provider: %w", err), p.shutdown(ctx))
+		}
+		p.meterProvider = metricProvider
+		p.flushes = append(p.flushes, metricProvider.ForceFlush)
+		p.shutdowns = append(p.shutdowns, metricProvider.Shutdown)
+	}
+
+	if o.local {
+		return p, nil
+	}
+	// Set global providers
+	otel.SetTracerProvider(p.tracerProvider)
+	global.SetLoggerProvider(p.loggerProvider)
+	otel.SetMeterProvider(p.meterProvider)
+	// W3C trace context and baggage unless configured otherwise, so
+	// instrumented servers continue the traces of their callers and clients
+	// pass theirs on
+	otel.SetTextMapPropagator(newPropagator(cfg.Propagators))
+
+	return p, nil
+}
+
+// forceFlush exports everything the enabled providers still buffer
+func (p *providers) forceFlush(ctx context.Context) error {
+	return callAll(ctx, p.flushes)
+}
+
+// shutdown stops every enabled provider, flushing anything still buffered
+func (p *providers) shutdown(ctx context.Context) error {
+	return callAll(ctx, p.shutdowns)
+}
+
+func callAll(ctx context.Context, fns []func(context.Context) error) error {
+	var errs []error
+	for _, fn := range fns {
+		if err := fn(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NewResource describes the service the telemetry comes from
+func NewResource(svc ServiceConfig) *resource.Resource {
+	attrs := []attribute.KeyValue{
+		semconv.ServiceName(svc.Name),
+		semconv.ServiceVersion(svc.Version),
+		semconv.ServiceInstanceID(svc.InstanceID),
+		attribute.String("environment", svc.Environment),
+	}
+	for k, v := range svc.Attributes {
+		attrs = append(attrs, attribute.String(k, v))
+	}
+	res := resource.NewWithAttributes(semconv.SchemaURL, attrs...)
+	return res
+}
+
+func setupTraceProvider(ctx context.Context, cfg *Config, res *resource.Resource, sampler sdktrace.Sampler, ids sdktrace.IDGenerator, limits sdktrace.SpanLimits, processors []sdktrace.SpanProcessor, clock clockOffset, out *dryRunWriter, stats *SignalStats, limitStats *LimitStats) (*sdktrace.TracerProvider, error) {
+	// Create trace exporter
+	traceExporter, err := newTraceExporter(ctx, cfg, out, stats)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Exporter.Record != "" && out == nil {
+		r, err := newRecorder(cfg.Exporter.Record, "traces")
+		if err != nil {
+			return nil, errors.Join(err, traceExporter.Shutdown(ctx))
+		}
+		traceExporter = recordSpanExporter{traceExporter, r}
+	}
+
+	var exporter sdktrace.SpanExporter = countingSpanExporter{traceExporter, stats}
+	if cfg.Exporter.CircuitBreaker.Enabled && out == nil {
+		exporter = newCircuitSpanExporter(exporter, cfg.Exporter.CircuitBreaker)
+	}
+	if clock.enabled() {
+		exporter = shiftSpanExporter{exporter, clock}
+	}
+
+	batcher := sdktrace.NewBatchSpanProcessor(exporter,
+		sdktrace.WithMaxQueueSize(cfg.Batch.MaxQueueSize),
+		sdktrace.WithMaxExportBatchSize(cfg.Batch.MaxExportBatchSize),
+		sdktrace.WithBatchTimeout(cfg.Batch.BatchTimeout),
+		sdktrace.WithExportTimeout(cfg.Batch.ExportTimeout),
+	)
+	pipeline, err := chainSpanProcessors(cfg.Processors.Spans, spanCounter{batcher, stats, limitStats}, cfg.Scenario.Seed, limits)
+	if err != nil {
+		return nil, errors.Join(err, batcher.Shutdown(ctx))
+	}
+
+	// Create trace provider; the caller's processors see each span before
+	// the configured ones
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithRawSpanLimits(limits),
+	}
+	if ids != nil {
+		opts = append(opts, sdktrace.WithIDGenerator(ids))
+	}
+	for _, p := range processors {
+		opts = append(opts, sdktrace.WithSpanProcessor(p))
+	}
+	traceProvider := sdktrace.NewTracerProvider(append(opts, sdktrace.WithSpanProcessor(pipeline))...)
+
+	return traceProvider, nil
+}
+
+func setupLogProvider(ctx context.Context, cfg *Config, res *resource.Resource, processors []sdklog.Processor, clock clockOffset, out *dryRunWriter, stats *SignalStats) (*sdklog.LoggerProvider, error) {
+	// Create log exporter
+	logExporter, err := newLogExporter(ctx, cfg, out, stats)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Exporter.Record != "" && out == nil {
+		r, err := newRecorder(cfg.Exporter.Record, "logs")
+		if err != nil {
+			return nil, errors.Join(err, logExporter.Shutdown(ctx))
+		}
+		logExporter = recordLogExporter{logExporter, r}
+	}
+
+	var exporter sdklog.Exporter = countingLogExporter{logExporter, stats}
+	if cfg.Exporter.CircuitBreaker.Enabled && out == nil {
+		exporter = newCircuitLogExporter(exporter, cfg.Exporter.CircuitBreaker)
+	}
+	if clock.enabled() {
+		exporter = shiftLogExporter{exporter, clock}
+	}
+
+	batcher := sdklog.NewBatchProcessor(exporter,
+		sdklog.WithMaxQueueSize(cfg.Batch.MaxQueueSize),
+		sdklog.WithExportMaxBatchSize(cfg.Batch.MaxExportBatchSize),
+		sdklog.WithExportInterval(cfg.Batch.BatchTimeout),
+		sdklog.WithExportTimeout(cfg.Batch.ExportTimeout),
+	)
+	pipeline, err := chainLogProcessors(cfg.Processors.Logs, logCounter{batcher, stats}, cfg.Scenario.Seed)
+	if err != nil {
+		return nil, errors.Join(err, batcher.Shutdown(ctx))
+	}
+
+	// Create log provider; the caller's processors see each record before
+	// the configured ones
+	opts := []sdklog.LoggerProviderOption{sdklog.WithResource(res)}
+	for _, p := range processors {
+		opts = append(opts, sdklog.WithProcessor(p))
+	}
+	logProvider := sdklog.NewLoggerProvider(append(opts, sdklog.WithProcessor(pipeline))...)
+
+	return logProvider, nil
+}
+
+func setupMetricProvider(ctx context.Context, cfg *Config, res *resource.Resource, clock clockOffset, out *dryRunWriter, stats *SignalStats) (*sdkmetric.MeterProvider, error) {
+	// Prometheus pulls instead, so there is no exporter to push with
+	if ep := cfg.Exporter.Resolve(cfg.Exporter.Metrics); out == nil && ep.Type == "prometheus" {
+		reader, err := newPrometheusReader(ep, stats)
+		if err != nil {
+			return nil, err
+		}
+		return sdkmetric.NewMeterProvider(
+			sdkmetric.WithReader(reader),
+			sdkmetric.WithResource(res),
+			sdkmetric.WithView(newViews(cfg.Views)...),
+			sdkmetric.WithExemplarFilter(exemplarFilter(cfg.ExemplarFilter)),
+		), nil
+	}
+
+	// Create metric exporter
+	metricExporter, err := newMetricExporter(ctx, cfg, out, stats)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Exporter.Record != "" && out == nil {
+		r, err := newRecorder(cfg.Exporter.Record, "metrics")
+		if err != nil {
+			return nil, errors.Join(err, metricExporter.Shutdown(ctx))
+		}
+		metricExporter = recordMetricExporter{metricExporter, r}
+	}
+
+	var exporter sdkmetric.Exporter = countingMetricExporter{metricExporter, stats}
+	exporter = temporalityMetricExporter{exporter, temporalitySelector(cfg.Exporter.Temporality)}
+	if cfg.Exporter.CircuitBreaker.Enabled && out == nil {
+		exporter = newCircuitMetricExporter(exporter, cfg.Exporter.CircuitBreaker, cfg.Exporter.Temporality)
+	}
+	if clock.enabled() {
+		exporter = shiftMetricExporter{exporter, clock}
+	}
+
+	// Create metric provider
+	metricProvider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter,
+			sdkmetric.WithInterval(cfg.Batch.MetricInterval))),
+		sdkmetric.WithResource(res),
+		sdkmetric.WithView(newViews(cfg.Views)...),
+		sdkmetric.WithExemplarFilter(exemplarFilter(cfg.ExemplarFilter)),
+	)
+
+	return metricProvider, nil
+}
@@ -0,0 +1,31 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestNegativeSpanLimitLiftsIt(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	cfg := DefaultConfig()
+	cfg.Exporter.Type, cfg.Exporter.Path = "file", t.TempDir()+"/telemetry.jsonl"
+	cfg.Limits.AttributeCount = -1
+	client, err := NewClient(context.Background(), WithConfig(cfg), WithSignals(Signals{Traces: true}), WithSpanProcessor(recorder), WithoutGlobal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Shutdown(context.Background())
+
+	_, span := client.Tracer("test").Start(context.Background(), "op")
+	for i := range 200 {
+		span.SetAttributes(attribute.Int(fmt.Sprintf("attr.%03d", i), i))
+	}
+	span.End()
+	if got := len(recorder.Ended()[0].Attributes()); got != 200 {
+		t.Errorf("%d attributes kept, want all 200", got)
+	}
+}
@@ -0,0 +1,45 @@
+package telemetry
+
+import (
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// temporalitySelector returns the selector for exporter.temporality, as
+// OTEL_EXPORTER_OTLP_METRICS_TEMPORALITY_PREFERENCE defines its values:
+// cumulative for every instrument; delta for the counters and histograms,
+// synchronous or not, leaving the up-down counters cumulative; lowmemory
+// for the synchronous counters and histograms only
+func temporalitySelector(preference string) sdkmetric.TemporalitySelector {
+	switch preference {
+	case "delta":
+		return func(k sdkmetric.InstrumentKind) metricdata.Temporality {
+			switch k {
+			case sdkmetric.InstrumentKindCounter, sdkmetric.InstrumentKindHistogram, sdkmetric.InstrumentKindObservableCounter:
+				return metricdata.DeltaTemporality
+			}
+			return metricdata.CumulativeTemporality
+		}
+	case "lowmemory":
+		return func(k sdkmetric.InstrumentKind) metricdata.Temporality {
+			switch k {
+			case sdkmetric.InstrumentKindCounter, sdkmetric.InstrumentKindHistogram:
+				return metricdata.DeltaTemporality
+			}
+			return metricdata.CumulativeTemporality
+		}
+	}
+	return sdkmetric.DefaultTemporalitySelector
+}
+
+// temporalityMetricExporter hands the periodic reader the temporality
+// selector of exporter.temporality in place of the exporter's own, which
+// is what the reader aggregates with
+type temporalityMetricExporter struct {
+	sdkmetric.Exporter
+	selector sdkmetric.TemporalitySelector
+}
+
+func (e temporalityMetricExporter) Temporality(k sdkmetric.InstrumentKind) metricdata.Temporality {
+	return e.selector(k)
+}
@@ -0,0 +1,270 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// CheckEndpoints checks that every signal path of cfg, mirrors included,
+// can actually deliver data by sending one test span, log record and metric
+// data point to its resolved endpoint. It writes a line per step to w and
+// returns the signal paths that failed.
+func CheckEndpoints(ctx context.Context, w io.Writer, cfg *Config, timeout time.Duration) []string {
+	res := NewResource(cfg.Service)
+	type check struct {
+		signal string
+		ep     EndpointConfig
+		export func(context.Context, EndpointConfig, *resource.Resource) (string, error)
+	}
+	checks := []check{
+		{"traces", cfg.Exporter.Resolve(cfg.Exporter.Traces), exportTestSpan},
+		{"logs", cfg.Exporter.Resolve(cfg.Exporter.Logs), exportTestLog},
+		{"metrics", cfg.Exporter.Resolve(cfg.Exporter.Metrics), exportTestMetric},
+	}
+	// Mirrors get every signal they can export too, and are
+	// reported as signal@mirror
+	names := make([]string, 0, len(cfg.Exporter.Mirrors))
+	for name := range cfg.Exporter.Mirrors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, c := range checks[:3] {
+		mirrors := cfg.Exporter.MirrorsFor(c.signal)
+		for _, name := range names {
+			if ep, ok := mirrors[name]; ok {
+				checks = append(checks, check{c.signal + "@" + name, ep, c.export})
+			}
+		}
+	}
+
+	var unhealthy []string
+	for _, c := range checks {
+		if !validateSignal(ctx, w, c.signal, c.ep, timeout, func(ctx context.Context) (string, error) {
+			return c.export(ctx, c.ep, res)
+		}) {
+			unhealthy = append(unhealthy, c.signal)
+		}
+	}
+	return unhealthy
+}
+
+// validateSignal runs the checks for one signal, printing a line per step,
+// and reports whether they all passed
+func validateSignal(ctx context.Context, w io.Writer, signal string, ep EndpointConfig, timeout time.Duration, export func(context.Context) (string, error)) bool {
+	fail := func(step string, err error) bool {
+		fmt.Fprintf(w, "          FAIL %s: %v\n", step, err)
+		return false
+	}
+
+	if ep.Type == "stdout" {
+		fmt.Fprintf(w, "%-9s stdout, no collector to check\n", signal+":")
+		return true
+	}
+	if ep.Type == "file" || ep.Type == "sql" {
+		fmt.Fprintf(w, "%-9s %s %s\n", signal+":", ep.Type, ep.Path)
+		fw, err := newFileWriter(ep.Path)
+		if err != nil {
+			return fail("open", err)
+		}
+		fw.Shutdown(ctx)
+		fmt.Fprintf(w, "          ok   writable\n")
+		return true
+	}
+	if ep.Type == "prometheus" {
+		fmt.Fprintf(w, "%-9s prometheus scrape endpoint http://%s/metrics\n", signal+":", ep.Listen)
+		ln, err := net.Listen("tcp", ep.Listen)
+		if err != nil {
+			return fail("listen", err)
+		}
+		ln.Close()
+		fmt.Fprintf(w, "          ok   address is free\n")
+		return true
+	}
+
+	name, _, _ := strings.Cut(signal, "@")
+	target, host, plaintext, err := endpointTarget(ep, name)
+	if err != nil {
+		fmt.Fprintf(w, "%-9s %s\n", signal+":", ep.Endpoint)
+		return fail("endpoint", err)
+	}
+	transport := "TLS"
+	if plaintext {
+		transport = "plaintext"
+	}
+	via := ep.Protocol
+	switch ep.Type {
+	case "clickhouse":
+		via = "ClickHouse HTTP"
+	case "kafka":
+		via = "Kafka"
+	case "zipkin":
+		via = "Zipkin"
+	case "loki":
+		via = "Loki push API"
+	case "syslog":
+		network, _, _ := syslogTarget(ep)
+		via = "syslog over " + network
+	case "fluent":
+		network, _, _ := fluentTarget(ep)
+		via = "Fluent Forward over " + network
+	}
+	fmt.Fprintf(w, "%-9s %s via %s (%s)\n", signal+":", target, via, transport)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Behind a proxy the collector's name only has to resolve for the proxy
+	proxy, err := endpointProxy(ep, target)
+	if err != nil {
+		return fail("proxy", err)
+	}
+	if proxy != nil {
+		fmt.Fprintf(w, "          ok   connecting through proxy %s\n", proxy.Redacted())
+	} else {
+		addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			return fail("resolve", err)
+		}
+		fmt.Fprintf(w, "          ok   resolved %s to %s\n", host, strings.Join(addrs, ", "))
+	}
+
+	if !plaintext {
+		tlsCfg, err := tlsConfig(ep)
+		if err != nil {
+			return fail("TLS material", err)
+		}
+		for _, cert := range tlsCfg.Certificates {
+			if cert.Leaf != nil && time.Now().After(cert.Leaf.NotAfter) {
+				return fail("TLS material", fmt.Errorf("client certificate expired on %s", cert.Leaf.NotAfter.Format(time.DateOnly)))
+			}
+		}
+		fmt.Fprintf(w, "          ok   TLS material loaded\n")
+	}
+
+	start := time.Now()
+	what, err := export(ctx)
+	if err != nil {
+		return fail("export", err)
+	}
+	fmt.Fprintf(w, "          ok   exported %s in %s\n", what, time.Since(start).Round(time.Millisecond))
+	return true
+}
+
+func exportTestSpan(ctx context.Context, ep EndpointConfig, res *resource.Resource) (string, error) {
+	capture := &spanCapture{}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithResource(res), sdktrace.WithSpanProcessor(capture))
+	_, span := tp.Tracer(validateScope.Name).Start(ctx, "clickstack-client.validate")
+	span.End()
+
+	exporter, err := newEndpointTraceExporter(ctx, ep)
+	if err != nil {
+		return "", err
+	}
+	defer exporter.Shutdown(context.Background())
+	var stats SignalStats
+	if err := exporter.ExportSpans(withRejections(ctx, &stats), capture.spans); err != nil {
+		return "", err
+	}
+	if err := rejectedError(&stats, "test span"); err != nil {
+		return "", err
+	}
+	return "1 span", nil
+}
+
+func exportTestLog(ctx context.Context, ep EndpointConfig, res *resource.Resource) (string, error) {
+	capture := &logCapture{}
+	lp := sdklog.NewLoggerProvider(sdklog.WithResource(res), sdklog.WithProcessor(capture))
+	var record otellog.Record
+	record.SetTimestamp(time.Now())
+	record.SetBody(otellog.StringValue("clickstack-client validation record"))
+	record.SetSeverity(otellog.SeverityInfo)
+	lp.Logger(validateScope.Name).Emit(ctx, record)
+
+	exporter, err := newEndpointLogExporter(ctx, ep)
+	if err != nil {
+		return "", err
+	}
+	defer exporter.Shutdown(context.Background())
+	var stats SignalStats
+	if err := exporter.Export(withRejections(ctx, &stats), capture.records); err != nil {
+		return "", err
+	}
+	if err := rejectedError(&stats, "test log record"); err != nil {
+		return "", err
+	}
+	return "1 log record", nil
+}
+
+func exportTestMetric(ctx context.Context, ep EndpointConfig, res *resource.Resource) (string, error) {
+	now := time.Now()
+	rm := &metricdata.ResourceMetrics{
+		Resource: res,
+		ScopeMetrics: []metricdata.ScopeMetrics{{
+			Scope: validateScope,
+			Metrics: []metricdata.Metrics{{
+				Name:        "clickstack_client.validate",
+				Description: "Data point sent by clickstack-client validate",
+				Unit:        "1",
+				Data: metricdata.Gauge[int64]{
+					DataPoints: []metricdata.DataPoint[int64]{{StartTime: now, Time: now, Value: 1}},
+				},
+			}},
+		}},
+	}
+
+	exporter, err := newEndpointMetricExporter(ctx, ep)
+	if err != nil {
+		return "", err
+	}
+	defer exporter.Shutdown(context.Background())
+	var stats SignalStats
+	if err := exporter.Export(withRejections(ctx, &stats), rm); err != nil {
+		return "", err
+	}
+	if err := rejectedError(&stats, "test data point"); err != nil {
+		return "", err
+	}
+	return "1 metric data point", nil
+}
+
+var validateScope = instrumentation.Scope{Name: "clickstack-client/validate"}
+
+// rejectedError fails a check whose export the collector accepted but
+// whose item it turned away in a partial success
+func rejectedError(stats *SignalStats, item string) error {
+	if stats.Rejected.Load() > 0 {
+		return fmt.Errorf("collector rejected the %s (OTLP partial success)", item)
+	}
+	return nil
+}
+
+// spanCapture keeps ended spans so they can be exported by hand, which
+// surfaces the export error that a batch processor would swallow
+type spanCapture struct{ spans []sdktrace.ReadOnlySpan }
+
+func (c *spanCapture) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+func (c *spanCapture) OnEnd(s sdktrace.ReadOnlySpan)                   { c.spans = append(c.spans, s) }
+func (c *spanCapture) Shutdown(context.Context) error                  { return nil }
+func (c *spanCapture) ForceFlush(context.Context) error                { return nil }
+
+// logCapture is the log counterpart of spanCapture
+type logCapture struct{ records []sdklog.Record }
+
+func (c *logCapture) OnEmit(_ context.Context, r *sdklog.Record) error {
+	c.records = append(c.records, r.Clone())
+	return nil
+}
+func (c *logCapture) Shutdown(context.Context) error   { return nil }
+func (c *logCapture) ForceFlush(context.Context) error { return nil }
@@ -0,0 +1,85 @@
+package telemetry
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/exemplar"
+)
+
+// newViews builds the MeterProvider views the config declares, in order;
+// the SDK applies every view matching an instrument
+func newViews(cfgs []ViewConfig) []sdkmetric.View {
+	views := make([]sdkmetric.View, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		stream := sdkmetric.Stream{
+			Name:        cfg.Name,
+			Description: cfg.Description,
+			Aggregation: cfg.aggregation(),
+		}
+		switch {
+		case len(cfg.AttributeKeys) > 0:
+			stream.AttributeFilter = attribute.NewAllowKeysFilter(attributeKeys(cfg.AttributeKeys)...)
+		case len(cfg.DropAttributes) > 0:
+			stream.AttributeFilter = attribute.NewDenyKeysFilter(attributeKeys(cfg.DropAttributes)...)
+		}
+		views = append(views, sdkmetric.NewView(
+			sdkmetric.Instrument{Name: cfg.Instrument, Scope: instrumentation.Scope{Name: cfg.Meter}},
+			stream,
+		))
+	}
+	return views
+}
+
+// aggregation returns the aggregation the view overrides the instrument's
+// with, or nil to keep it
+func (v ViewConfig) aggregation() sdkmetric.Aggregation {
+	switch v.Aggregation {
+	case "default":
+		return sdkmetric.AggregationDefault{}
+	case "drop":
+		return sdkmetric.AggregationDrop{}
+	case "sum":
+		return sdkmetric.AggregationSum{}
+	case "last_value":
+		return sdkmetric.AggregationLastValue{}
+	case "base2_exponential_histogram":
+		a := sdkmetric.AggregationBase2ExponentialHistogram{MaxSize: 160, MaxScale: 20}
+		if v.MaxSize > 0 {
+			a.MaxSize = v.MaxSize
+		}
+		if v.MaxScale != 0 {
+			a.MaxScale = v.MaxScale
+		}
+		return a
+	}
+	if v.Aggregation == "explicit_bucket_histogram" || len(v.Buckets) > 0 {
+		if len(v.Buckets) == 0 {
+			// The SDK's default boundaries
+			return sdkmetric.AggregationExplicitBucketHistogram{
+				Boundaries: []float64{0, 5, 10, 25, 50, 75, 100, 250, 500, 750, 1000, 2500, 5000, 7500, 10000},
+			}
+		}
+		return sdkmetric.AggregationExplicitBucketHistogram{Boundaries: v.Buckets}
+	}
+	return nil
+}
+
+func attributeKeys(names []string) []attribute.Key {
+	keys := make([]attribute.Key, len(names))
+	for i, name := range names {
+		keys[i] = attribute.Key(name)
+	}
+	return keys
+}
+
+// exemplarFilter returns the filter exemplar_filter names
+func exemplarFilter(name string) exemplar.Filter {
+	switch name {
+	case "always_on":
+		return exemplar.AlwaysOnFilter
+	case "always_off":
+		return exemplar.AlwaysOffFilter
+	}
+	return exemplar.TraceBasedFilter
+}
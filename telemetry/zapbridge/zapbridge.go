@@ -0,0 +1,48 @@
+// Package zapbridge sends go.uber.org/zap logs to ClickStack through the
+// LoggerProvider the telemetry package installs, so services already on
+// zap keep their console output and get their logs in HyperDX as well:
+//
+//	console := zapcore.NewCore(zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig()), os.Stderr, zap.InfoLevel)
+//	logger := zapbridge.NewLogger("checkout", console)
+//	logger.Info("order placed", zapbridge.Context(ctx), zap.Int("items", 3))
+//
+// Fields become log attributes, keeping their types, and entries logged
+// with a Context field carry the trace and span IDs of the span in it.
+package zapbridge
+
+import (
+	"context"
+
+	"go.opentelemetry.io/contrib/bridges/otelzap"
+	"go.opentelemetry.io/otel/log/global"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// NewCore returns a zapcore.Core exporting every entry through the global
+// LoggerProvider under the instrumentation scope name; named loggers use
+// their name as the scope instead. The entry's level maps to the record's
+// severity, and the caller and stack, when zap adds them, become code.*
+// attributes.
+func NewCore(name string) zapcore.Core {
+	return otelzap.NewCore(name, otelzap.WithLoggerProvider(global.GetLoggerProvider()))
+}
+
+// NewLogger returns a logger writing every entry to console and to
+// ClickStack, with the caller recorded. console is the core the service
+// logged with before, such as a console or JSON encoder on stderr; nil
+// sends entries to ClickStack only.
+func NewLogger(name string, console zapcore.Core, opts ...zap.Option) *zap.Logger {
+	core := NewCore(name)
+	if console != nil {
+		core = zapcore.NewTee(console, core)
+	}
+	return zap.New(core, append([]zap.Option{zap.AddCaller()}, opts...)...)
+}
+
+// Context returns a field attaching ctx to an entry, or with Logger.With to
+// every entry of a logger, so the records carry the trace and span IDs of
+// the span in ctx. Encoders skip it, so the console output is unchanged.
+func Context(ctx context.Context) zap.Field {
+	return zap.Field{Key: "context", Type: zapcore.SkipType, Interface: ctx}
+}
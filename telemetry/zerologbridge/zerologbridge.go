@@ -0,0 +1,204 @@
+// Package zerologbridge sends github.com/rs/zerolog events to ClickStack
+// through the LoggerProvider the telemetry package installs. The Writer
+// parses each JSON event zerolog writes and emits the equivalent log
+// record, so it goes next to the service's console writer:
+//
+//	logger := zerolog.New(zerolog.MultiLevelWriter(os.Stderr, zerologbridge.NewWriter("checkout"))).
+//		Hook(zerologbridge.TraceHook{}).With().Timestamp().Logger()
+//	logger.Info().Ctx(ctx).Int("items", 3).Msg("order placed")
+//
+// The message becomes the record's body, the level its severity, the
+// timestamp its time and the caller code.* attributes; every other field
+// is a log attribute, nested objects and arrays included. TraceHook adds
+// the IDs of the span in an event's context, which correlates the record
+// with its trace.
+package zerologbridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/log/global"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The fields TraceHook adds and Writer reads the span context from
+const (
+	traceIDField = "trace_id"
+	spanIDField  = "span_id"
+)
+
+// Writer is a zerolog.LevelWriter emitting every event through the global
+// LoggerProvider
+type Writer struct {
+	logger otellog.Logger
+}
+
+// NewWriter returns a Writer emitting under the instrumentation scope name
+func NewWriter(name string) *Writer {
+	return &Writer{logger: global.GetLoggerProvider().Logger(name)}
+}
+
+// Write emits the JSON event p as a log record
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel emits the JSON event p as a log record with level's severity,
+// or the severity of the event's level field for zerolog.NoLevel. A
+// malformed event is reported as an error but still counts as written, so
+// the writers next to this one in a MultiLevelWriter carry on.
+func (w *Writer) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+	var fields map[string]any
+	if err := dec.Decode(&fields); err != nil {
+		return len(p), fmt.Errorf("zerologbridge: malformed event: %w", err)
+	}
+
+	var record otellog.Record
+	record.SetTimestamp(eventTime(fields[zerolog.TimestampFieldName]))
+	record.SetObservedTimestamp(time.Now())
+	if s, ok := fields[zerolog.LevelFieldName].(string); ok && level == zerolog.NoLevel {
+		if l, err := zerolog.ParseLevel(s); err == nil {
+			level = l
+		}
+	}
+	if level != zerolog.NoLevel {
+		record.SetSeverity(severity(level))
+		record.SetSeverityText(level.String())
+	}
+	if msg, ok := fields[zerolog.MessageFieldName]; ok {
+		record.SetBody(convertValue(msg))
+	}
+	if caller, ok := fields[zerolog.CallerFieldName].(string); ok {
+		if i := strings.LastIndexByte(caller, ':'); i > 0 {
+			if line, err := strconv.Atoi(caller[i+1:]); err == nil {
+				record.AddAttributes(otellog.String("code.file.path", caller[:i]), otellog.Int("code.line.number", line))
+				delete(fields, zerolog.CallerFieldName)
+			}
+		}
+	}
+
+	ctx := context.Background()
+	traceID, _ := fields[traceIDField].(string)
+	spanID, _ := fields[spanIDField].(string)
+	if tid, err := trace.TraceIDFromHex(traceID); err == nil {
+		if sid, err := trace.SpanIDFromHex(spanID); err == nil {
+			ctx = trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{TraceID: tid, SpanID: sid}))
+			delete(fields, traceIDField)
+			delete(fields, spanIDField)
+		}
+	}
+
+	for _, k := range []string{zerolog.TimestampFieldName, zerolog.LevelFieldName, zerolog.MessageFieldName} {
+		delete(fields, k)
+	}
+	record.AddAttributes(convertMap(fields)...)
+	w.logger.Emit(ctx, record)
+	return len(p), nil
+}
+
+// TraceHook is a zerolog.Hook adding the trace and span IDs of the span in
+// an event's context, set with Event.Ctx or Context.Ctx, for the Writer to
+// correlate the record with
+type TraceHook struct{}
+
+// Run adds the IDs as trace_id and span_id when the context holds a span
+func (TraceHook) Run(e *zerolog.Event, _ zerolog.Level, _ string) {
+	sc := trace.SpanContextFromContext(e.GetCtx())
+	if sc.IsValid() {
+		e.Str(traceIDField, sc.TraceID().String()).Str(spanIDField, sc.SpanID().String())
+	}
+}
+
+// eventTime parses the timestamp field in zerolog.TimeFieldFormat, falling
+// back to now when it is missing or doesn't parse
+func eventTime(v any) time.Time {
+	switch v := v.(type) {
+	case string:
+		if t, err := time.Parse(zerolog.TimeFieldFormat, v); err == nil {
+			return t
+		}
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			break
+		}
+		switch zerolog.TimeFieldFormat {
+		case zerolog.TimeFormatUnix:
+			return time.Unix(n, 0)
+		case zerolog.TimeFormatUnixMs:
+			return time.UnixMilli(n)
+		case zerolog.TimeFormatUnixMicro:
+			return time.UnixMicro(n)
+		case zerolog.TimeFormatUnixNano:
+			return time.Unix(0, n)
+		}
+	}
+	return time.Now()
+}
+
+func severity(level zerolog.Level) otellog.Severity {
+	switch level {
+	case zerolog.TraceLevel:
+		return otellog.SeverityTrace
+	case zerolog.DebugLevel:
+		return otellog.SeverityDebug
+	case zerolog.InfoLevel:
+		return otellog.SeverityInfo
+	case zerolog.WarnLevel:
+		return otellog.SeverityWarn
+	case zerolog.ErrorLevel:
+		return otellog.SeverityError
+	case zerolog.FatalLevel:
+		return otellog.SeverityFatal
+	case zerolog.PanicLevel:
+		return otellog.SeverityFatal4
+	}
+	return otellog.SeverityUndefined
+}
+
+// convertMap turns JSON object fields into attributes, sorted by key
+func convertMap(fields map[string]any) []otellog.KeyValue {
+	kvs := make([]otellog.KeyValue, 0, len(fields))
+	for k, v := range fields {
+		kvs = append(kvs, otellog.KeyValue{Key: k, Value: convertValue(v)})
+	}
+	slices.SortFunc(kvs, func(a, b otellog.KeyValue) int { return strings.Compare(a.Key, b.Key) })
+	return kvs
+}
+
+// convertValue turns a decoded JSON value into a log value; whole numbers
+// stay integers
+func convertValue(v any) otellog.Value {
+	switch v := v.(type) {
+	case string:
+		return otellog.StringValue(v)
+	case bool:
+		return otellog.BoolValue(v)
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return otellog.Int64Value(n)
+		}
+		f, _ := v.Float64()
+		return otellog.Float64Value(f)
+	case []any:
+		values := make([]otellog.Value, len(v))
+		for i, e := range v {
+			values[i] = convertValue(e)
+		}
+		return otellog.SliceValue(values...)
+	case map[string]any:
+		return otellog.MapValue(convertMap(v)...)
+	}
+	return otellog.Value{}
+}
@@ -0,0 +1,45 @@
+package telemetry
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"go.opentelemetry.io/otel/exporters/zipkin"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// zipkinURL resolves ep.Endpoint to a Zipkin v2 spans URL: port 9411 and
+// the /api/v2/spans path unless the endpoint has its own
+func zipkinURL(ep EndpointConfig) (*url.URL, error) {
+	return endpointURL(ep, "9411", "9411", "/api/v2/spans")
+}
+
+// newZipkinTraceExporter sends spans as Zipkin v2 JSON, for the collector's
+// zipkin receiver. The Zipkin exporter has no retries or compression of its
+// own, so only the endpoint, TLS, proxy, headers and timeout apply.
+func newZipkinTraceExporter(ep EndpointConfig) (sdktrace.SpanExporter, error) {
+	u, err := zipkinURL(ep)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if transport.Proxy, err = proxyFunc(ep); err != nil {
+		return nil, err
+	}
+	if u.Scheme == "https" {
+		if transport.TLSClientConfig, err = tlsConfig(ep); err != nil {
+			return nil, err
+		}
+	}
+
+	exporter, err := zipkin.New(u.String(),
+		zipkin.WithClient(&http.Client{Transport: transport, Timeout: ep.Timeout}),
+		zipkin.WithHeaders(ep.Headers),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zipkin exporter: %w", err)
+	}
+	return exporter, nil
+}
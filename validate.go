@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"otel-demo/telemetry"
+)
+
+// validateCommand checks that the configuration parses and that every
+// signal path can actually deliver data by sending one test span, log record
+// and metric data point to its resolved endpoint.
+func validateCommand() *command {
+	timeout := 10 * time.Second
+	return &command{
+		name:    "validate",
+		summary: "check the config and export one test span, log record and metric",
+		flags: func(fs *flag.FlagSet, cfg *telemetry.Config) {
+			bindExporterFlags(fs, cfg)
+			bindServiceFlags(fs, cfg)
+			fs.DurationVar(&timeout, "timeout", timeout, "time allowed per signal to connect and export")
+		},
+		run: func(ctx context.Context, cfg *telemetry.Config, _ func() (*telemetry.Config, error)) error {
+			fmt.Println("config:   ok")
+
+			cfg.Service.EnsureInstanceID()
+			unhealthy := telemetry.CheckEndpoints(ctx, os.Stdout, cfg, timeout)
+			if len(unhealthy) > 0 {
+				return fmt.Errorf("unhealthy signal paths: %s", strings.Join(unhealthy, ", "))
+			}
+			fmt.Println("all signal paths are healthy")
+			return nil
+		},
+	}
+}
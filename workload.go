@@ -0,0 +1,467 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"otel-demo/scenario"
+	"otel-demo/telemetry"
+)
+
+// workload owns the tracer, logger and instruments the simulated requests
+// report through.
+type workload struct {
+	tracer trace.Tracer
+	logger otellog.Logger
+
+	requestCounter metric.Int64Counter
+	metrics        *scenario.Metrics
+
+	scenario atomic.Pointer[telemetry.ScenarioConfig]
+	// inventory is the gRPC service requests call with scenario.grpc; nil
+	// without it
+	inventory *inventory
+	// db runs the user lookup for real with scenario.database; nil
+	// simulates it
+	db *database
+	// httpClient sends the API call with scenario.real_http_target
+	httpClient *http.Client
+	// cache fronts the user lookup with scenario.redis; nil without it
+	cache *cache
+	// messaging publishes an order event per request with scenario.kafka;
+	// nil without it
+	messaging *messaging
+	// queue takes a fulfillment message from every request with
+	// scenario.queue; nil without it
+	queue *queue
+	// baggage gives each request baggage entries with scenario.baggage
+	baggage bool
+	// batch collects the requests for the batch job of scenario.batch_size
+	batch batchJob
+	// services are the services of scenario.services the requests go
+	// through; nil runs the demo request in the workload's own service
+	services *services
+	// client reports the panics of requests before they crash the run;
+	// nil lets them crash unreported
+	client *telemetry.Client
+	// limits are the span limits the limits-probe of
+	// scenario.exceed_limits goes past
+	limits sdktrace.SpanLimits
+
+	// seed fixes every random draw of the run; see requestRand
+	seed     uint64
+	gaugeMu  sync.Mutex
+	gaugeRng *rand.Rand
+}
+
+func newWorkload(sc telemetry.ScenarioConfig, tracer trace.Tracer, logger otellog.Logger, meter metric.Meter) (*workload, error) {
+	w := &workload{
+		tracer:     tracer,
+		logger:     logger,
+		seed:       uint64(sc.Seed),
+		httpClient: telemetry.NewHTTPClient(10 * time.Second),
+	}
+	w.gaugeRng = rand.New(rand.NewPCG(w.seed, math.MaxUint64))
+	w.setScenario(sc)
+
+	// Create metrics
+	var err error
+	w.requestCounter, err = meter.Int64Counter(
+		"requests_total",
+		metric.WithDescription("Total number of requests"),
+		metric.WithUnit("1"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create counter: %w", err)
+	}
+
+	if w.metrics, err = scenario.NewMetrics(meter); err != nil {
+		return nil, err
+	}
+
+	// Create a gauge callback for memory usage
+	_, err = meter.Int64ObservableGauge(
+		"memory_usage_bytes",
+		metric.WithDescription("Current memory usage"),
+		metric.WithUnit("By"),
+		metric.WithInt64Callback(func(ctx context.Context, observer metric.Int64Observer) error {
+			// Simulate memory usage
+			w.gaugeMu.Lock()
+			memUsage := int64(1024 * 1024 * (50 + w.gaugeRng.IntN(50))) // 50-100 MB
+			w.gaugeMu.Unlock()
+			observer.Observe(memUsage, metric.WithAttributes(
+				attribute.String("memory_type", "heap"),
+			))
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gauge: %w", err)
+	}
+
+	return w, nil
+}
+
+// setScenario replaces the scenario settings. Requests already in flight
+// finish with the settings they started with.
+func (w *workload) setScenario(sc telemetry.ScenarioConfig) {
+	w.scenario.Store(&sc)
+}
+
+// run issues simulated requests at the scenario rate until the scenario
+// duration has elapsed, or until ctx is done when the scenario runs forever.
+// Otherwise a zero duration issues exactly one request, which is the
+// original single-pass demo. Requests are scheduled on a fixed grid so the
+// achieved rate doesn't drift over long runs. The scenario is re-read before
+// every request, so setScenario takes effect immediately, including changes
+// to the rate and to the duration of the run. run returns the number of
+// requests issued.
+func (w *workload) run(ctx context.Context) int {
+	if sc := w.scenario.Load(); !sc.Continuous() {
+		w.request(ctx, *sc, w.requestRand(0))
+		return 1
+	}
+
+	start := time.Now()
+	next := start
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	// Requests overlap whenever the rate outpaces the simulated latency
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	issued := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return issued
+		case <-timer.C:
+		}
+
+		sc := *w.scenario.Load()
+		if !sc.Forever && time.Since(start) >= sc.Duration {
+			return issued
+		}
+
+		rng := w.requestRand(issued)
+		issued++
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.request(ctx, sc, rng)
+		}()
+
+		// Don't burst to catch up after a stall, just carry on from now
+		next = next.Add(time.Duration(float64(time.Second) / sc.Rate))
+		if now := time.Now(); next.Before(now) {
+			next = now
+		}
+		wait := time.Until(next)
+		if !sc.Forever {
+			wait = min(wait, sc.Duration-time.Since(start))
+		}
+		timer.Reset(wait)
+	}
+}
+
+// requestRand returns the random source for the n-th request. Deriving it
+// from the seed and the request number, rather than sharing one generator,
+// keeps seeded runs identical however the concurrent requests interleave.
+func (w *workload) requestRand(n int) *rand.Rand {
+	return rand.New(rand.NewPCG(w.seed, uint64(n)))
+}
+
+// request runs one simulated request under its own root span
+func (w *workload) request(ctx context.Context, sc telemetry.ScenarioConfig, rng *rand.Rand) {
+	if w.baggage {
+		ctx = withRequestBaggage(ctx, rng)
+	}
+
+	orphan := drawOrphan(sc, rng)
+
+	// Create a root span
+	ctx, rootSpan := w.tracer.Start(ctx, "main-operation",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", "GET"),
+			attribute.String("http.route", "/api/users"),
+			attribute.String("operation.type", "demo"),
+			attribute.String("user.id", sc.UserID),
+		),
+		trace.WithAttributes(scenarioAttributes(sc)...))
+	if orphan != orphanMissingRoot {
+		defer rootSpan.End()
+	}
+	if sc.PII {
+		rootSpan.SetAttributes(piiAttributes(sc, rng)...)
+	}
+	if w.client != nil {
+		defer w.client.Recover(ctx)
+	}
+
+	// Log at the start of the operation
+	w.emit(ctx, sc, "Starting main operation", otellog.SeverityInfo,
+		otellog.String("component", "main"),
+		otellog.String("operation", "start"))
+
+	// Simulate some work with nested spans and metrics
+	requestStart := time.Now()
+	w.countRequest(ctx, sc, "processing")
+	env := &scenario.Env{
+		Tracer:     w.tracer,
+		Logger:     w.logger,
+		Metrics:    w.metrics,
+		Rand:       rng,
+		Attributes: scenarioAttributes(sc),
+		SpanEvents: sc.SpanEvents,
+	}
+	workCtx := ctx
+	if orphan == orphanDroppedParent {
+		// Never ended, so never exported
+		workCtx, _ = w.tracer.Start(ctx, "request-handler", trace.WithAttributes(scenarioAttributes(sc)...))
+	}
+	work := w.demoRequest(sc)
+	if sc.ExceedLimits {
+		work = scenario.Sequence(exceedLimits(w.limits), work)
+	}
+	err := work(workCtx, env)
+	switch {
+	case err != nil && ctx.Err() != nil:
+		// Stopped part way through; the log still carries the span context
+		w.countRequest(ctx, sc, "cancelled")
+		rootSpan.SetStatus(codes.Error, err.Error())
+		w.emit(ctx, sc, fmt.Sprintf("Operation cancelled: %v", err), otellog.SeverityWarn,
+			otellog.String("component", "main"),
+			otellog.String("operation", "cancelled"))
+	case err != nil && responseStatus(err) < 500:
+		// The client's fault, not the server's: the span's status is left
+		// unset, as semantic conventions have server spans answering 4xx
+		status := responseStatus(err)
+		w.countRequest(ctx, sc, "client_error")
+		rootSpan.SetAttributes(
+			attribute.Int("http.status_code", status),
+			attribute.Int("http.response.status_code", status),
+		)
+		w.emit(ctx, sc, fmt.Sprintf("Operation rejected: %v", err), otellog.SeverityWarn,
+			otellog.String("component", "main"),
+			otellog.String("error", err.Error()))
+	case err != nil:
+		status := responseStatus(err)
+		w.countRequest(ctx, sc, "error")
+		telemetry.RecordError(rootSpan, err)
+		rootSpan.SetAttributes(
+			attribute.Int("http.status_code", status),
+			attribute.Int("http.response.status_code", status),
+			attribute.String("error.type", strconv.Itoa(status)),
+		)
+
+		// Log the error
+		w.emit(ctx, sc, fmt.Sprintf("Operation failed: %v", err), otellog.SeverityError,
+			otellog.String("component", "main"),
+			otellog.String("error", err.Error()))
+	default:
+		w.metrics.Duration.Record(ctx, time.Since(requestStart).Seconds(), metric.WithAttributes(env.Attributes...), metric.WithAttributes(
+			attribute.String("operation", "total_request"),
+			attribute.String("method", "GET"),
+			attribute.String("endpoint", "/api/users"),
+			attribute.String("status", "success"),
+		))
+		w.countRequest(ctx, sc, "success")
+		rootSpan.SetStatus(codes.Ok, "Operation completed successfully")
+		rootSpan.SetAttributes(
+			attribute.Int("http.status_code", http.StatusOK),
+			attribute.Int("http.response.status_code", http.StatusOK),
+		)
+
+		// Log success
+		w.emit(ctx, sc, "Operation completed successfully", otellog.SeverityInfo,
+			otellog.String("component", "main"),
+			otellog.String("operation", "complete"))
+	}
+
+	if sc.BatchSize > 0 {
+		if batch := w.batch.add(rootSpan.SpanContext(), sc.BatchSize); batch != nil {
+			w.processBatch(ctx, sc, rng, batch)
+		}
+	}
+}
+
+// responseStatus is the status a request failing with err is answered
+// with: a client error as the API call or the service called was answered
+// with, the client's fault either way, a gateway error when it's one of
+// those that failed on their side, as a service in front of them would
+// answer, 500 otherwise
+func responseStatus(err error) int {
+	var (
+		se     *scenario.StatusError
+		ue     *serviceError
+		status int
+	)
+	switch {
+	case errors.As(err, &se):
+		status = se.StatusCode
+	case errors.As(err, &ue):
+		status = ue.statusCode
+	default:
+		return http.StatusInternalServerError
+	}
+	if status < 500 || status == http.StatusGatewayTimeout {
+		return status
+	}
+	return http.StatusBadGateway
+}
+
+// httpStatuses returns scenario.http_statuses for the simulated API calls,
+// by code so that seeded runs draw the same ones
+func httpStatuses(sc telemetry.ScenarioConfig) []scenario.WeightedStatus {
+	var statuses []scenario.WeightedStatus
+	for code, w := range sc.HTTPStatuses {
+		// Validated as a status code
+		n, _ := strconv.Atoi(code)
+		statuses = append(statuses, scenario.WeightedStatus{Code: n, Weight: w})
+	}
+	slices.SortFunc(statuses, func(a, b scenario.WeightedStatus) int { return a.Code - b.Code })
+	return statuses
+}
+
+// realHTTPRetries is how many times a failing real API call is retried
+const realHTTPRetries = 2
+
+// demoRequest is the work of every simulated request: a user lookup in
+// the database, through the cache when there is one, followed by a call to
+// the scenario's API, the order written in a transaction with
+// scenario.transaction, a stock check over gRPC when the inventory service
+// runs, an order event published to Kafka when messaging is on and a
+// fulfillment message to the simulated queue when that is. The API call
+// becomes a scatter-gather with scenario.scatter_gather and is hedged with
+// scenario.hedge. With scenario.services the request goes through the
+// simulated services instead, and a scenario.tree or scenario.stress_trace
+// replaces it all with a trace of that shape.
+func (w *workload) demoRequest(sc telemetry.ScenarioConfig) scenario.Step {
+	if t := sc.StressTrace; t.Depth > 0 || t.Width > 0 {
+		return scenario.StressTrace(scenario.StressTraceConfig{Depth: t.Depth, Width: t.Width})
+	}
+	if t := sc.Tree; t.Depth > 0 {
+		return scenario.Tree(scenario.TreeConfig{
+			Depth:        t.Depth,
+			FanOut:       t.FanOut,
+			Distribution: t.Distribution,
+			Latency:      t.Latency,
+			Attributes:   t.Attributes,
+		})
+	}
+	if w.services != nil {
+		return w.services.call(nil, sc, topology[0].name)
+	}
+	lookup := scenario.DBCallConfig{
+		System:    "postgresql",
+		Name:      "userdb",
+		Operation: "SELECT",
+		Statement: "SELECT * FROM users WHERE id = ?",
+		Latency:   sc.DBLatency,
+	}
+	if w.db != nil {
+		lookup = w.db.userLookup()
+	}
+	call := scenario.HTTPCallConfig{
+		Method:        "GET",
+		URL:           sc.APIURL,
+		Latency:       sc.APILatency,
+		ErrorRate:     sc.ErrorRate,
+		Statuses:      httpStatuses(sc),
+		ResponseSizes: sc.ExponentialHistograms,
+	}
+	if sc.RealHTTPTarget != "" {
+		call.URL, call.Client, call.Retries = sc.RealHTTPTarget, w.httpClient, realHTTPRetries
+	}
+	load := scenario.DBCall(lookup)
+	if w.cache != nil {
+		load = w.cache.cached(load)
+	}
+	api := scenario.HTTPCall(call)
+	if g := sc.ScatterGather; g.Width > 0 {
+		api = scenario.ScatterGather(scenario.ScatterGatherConfig{
+			Width:            g.Width,
+			Latency:          g.Latency,
+			StragglerRate:    g.StragglerRate,
+			StragglerLatency: g.StragglerLatency,
+		})
+	}
+	if h := sc.Hedge; h.Attempts > 0 {
+		api = scenario.Hedge(scenario.HedgeConfig{Attempts: h.Attempts, Delay: h.Delay}, api)
+	}
+	steps := []scenario.Step{load, api}
+	if t := sc.Transaction; t.Statements > 0 {
+		steps = append(steps, scenario.Transaction(scenario.TransactionConfig{
+			System:       "postgresql",
+			Name:         "orderdb",
+			Statements:   t.Statements,
+			Latency:      telemetry.LatencyRange{Min: sc.DBLatency.Min / 4, Max: sc.DBLatency.Max / 4},
+			DeadlockRate: t.DeadlockRate,
+		}))
+	}
+	if w.inventory != nil {
+		steps = append(steps, w.inventory.checkStep())
+	}
+	if w.messaging != nil {
+		steps = append(steps, w.messaging.publishStep())
+	}
+	if w.queue != nil {
+		steps = append(steps, w.queue.publishStep())
+	}
+	return scenario.Sequence(steps...)
+}
+
+// emit logs through the workload logger, appending the scenario attributes
+func (w *workload) emit(ctx context.Context, sc telemetry.ScenarioConfig, message string, severity otellog.Severity, attrs ...otellog.KeyValue) {
+	for _, k := range slices.Sorted(maps.Keys(sc.Attributes)) {
+		attrs = append(attrs, otellog.String(k, sc.Attributes[k]))
+	}
+	logRecord(ctx, w.logger, message, severity, attrs...)
+}
+
+// Helper function to create and emit log records
+func logRecord(ctx context.Context, logger otellog.Logger, message string, severity otellog.Severity, attrs ...otellog.KeyValue) {
+	var record otellog.Record
+	record.SetTimestamp(time.Now())
+	record.SetBody(otellog.StringValue(message))
+	record.SetSeverity(severity)
+	record.AddAttributes(attrs...)
+	logger.Emit(ctx, record)
+}
+
+// Helper function to turn configured scenario attributes into span
+// attributes, sorted by key so a limit always drops the same ones
+func scenarioAttributes(sc telemetry.ScenarioConfig) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, len(sc.Attributes))
+	for _, k := range slices.Sorted(maps.Keys(sc.Attributes)) {
+		attrs = append(attrs, attribute.String(k, sc.Attributes[k]))
+	}
+	return attrs
+}
+
+// countRequest counts a request in requests_total under status: once as
+// processing when it starts, then again with its outcome
+func (w *workload) countRequest(ctx context.Context, sc telemetry.ScenarioConfig, status string) {
+	w.requestCounter.Add(ctx, 1, metric.WithAttributes(scenarioAttributes(sc)...), metric.WithAttributes(
+		attribute.String("method", "GET"),
+		attribute.String("endpoint", "/api/users"),
+		attribute.String("status", status),
+	))
+}